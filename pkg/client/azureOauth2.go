@@ -3,6 +3,7 @@ package client
 import (
 	"context"
 	"errors"
+	"time"
 
 	"golang.org/x/oauth2/clientcredentials"
 
@@ -37,6 +38,13 @@ func NewAzureOauth2(tokenEndpoint, scope, clientID, clientSecret string) ALPAuth
 }
 
 func (ao *AzureOauth2) Authenticate(ctx context.Context) (string, error) {
+	token, _, err := ao.AuthenticateWithExpiry(ctx)
+	return token, err
+}
+
+// AuthenticateWithExpiry fetches a new token and returns it together with its expiry,
+// which allows transport.OAuth2ClientCredentials to cache it
+func (ao *AzureOauth2) AuthenticateWithExpiry(ctx context.Context) (string, time.Time, error) {
 	conf := &clientcredentials.Config{
 		ClientID:     ao.clientID,
 		ClientSecret: ao.clientSecret,
@@ -46,7 +54,7 @@ func (ao *AzureOauth2) Authenticate(ctx context.Context) (string, error) {
 	token, err := conf.Token(ctx)
 	if err != nil {
 		logging.LogErrorfCtx(ctx, err, "Azure oauth2 authentication error")
-		return "", err
+		return "", time.Time{}, err
 	}
-	return token.AccessToken, nil
+	return token.AccessToken, token.Expiry, nil
 }
@@ -0,0 +1,146 @@
+// Package compression provides the content codings (gzip, zstd and br) shared by middlewares.Compress,
+// transport.Compress and the body logging of the log package.
+package compression
+
+import (
+	"errors"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/gzip"
+	"github.com/klauspost/compress/zstd"
+)
+
+// Content codings in the order of preference for equally accepted codings
+const (
+	Zstd   = "zstd"
+	Brotli = "br"
+	Gzip   = "gzip"
+)
+
+// ErrUnsupportedEncoding happens for content codings other than gzip, zstd and br
+var ErrUnsupportedEncoding = errors.New("unsupported content encoding")
+
+// Encodings returns the supported content codings in the order of preference
+func Encodings() []string {
+	return []string{Zstd, Brotli, Gzip}
+}
+
+// Supported tells whether the content coding can be encoded and decoded
+func Supported(encoding string) bool {
+	return slices.Contains(Encodings(), strings.ToLower(strings.TrimSpace(encoding)))
+}
+
+// Encoder compresses everything written to it, Close must be called to write the end of the stream
+type Encoder interface {
+	io.WriteCloser
+	Flush() error
+}
+
+type resetEncoder interface {
+	Encoder
+	Reset(io.Writer)
+}
+
+// encoder pools are shared by all callers, creating encoders allocates their whole window
+var encoderPools = map[string]*sync.Pool{ // nolint: gochecknoglobals
+	Gzip: {New: func() any {
+		w, _ := gzip.NewWriterLevel(nil, gzip.DefaultCompression)
+		return w
+	}},
+	Zstd: {New: func() any {
+		w, _ := zstd.NewWriter(nil, zstd.WithEncoderConcurrency(1), zstd.WithLowerEncoderMem(true))
+		return w
+	}},
+	Brotli: {New: func() any {
+		return brotli.NewWriterLevel(nil, 5)
+	}},
+}
+
+type pooledEncoder struct {
+	resetEncoder
+	pool *sync.Pool
+}
+
+// Close finishes the stream and returns the encoder to its pool
+func (e *pooledEncoder) Close() error {
+	if e.resetEncoder == nil {
+		return nil
+	}
+	err := e.resetEncoder.Close()
+	e.resetEncoder.Reset(nil)
+	e.pool.Put(e.resetEncoder)
+	e.resetEncoder = nil
+	return err
+}
+
+// NewEncoder returns an encoder of the content coding writing to w
+func NewEncoder(encoding string, w io.Writer) (Encoder, error) {
+	pool, ok := encoderPools[strings.ToLower(encoding)]
+	if !ok {
+		return nil, ErrUnsupportedEncoding
+	}
+	enc := pool.Get().(resetEncoder)
+	enc.Reset(w)
+	return &pooledEncoder{resetEncoder: enc, pool: pool}, nil
+}
+
+// NewDecoder returns a reader decompressing r with the content coding
+func NewDecoder(encoding string, r io.Reader) (io.ReadCloser, error) {
+	switch strings.ToLower(encoding) {
+	case Gzip:
+		return gzip.NewReader(r)
+	case Zstd:
+		// a single decoder decodes synchronously without background goroutines
+		dec, err := zstd.NewReader(r, zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return nil, err
+		}
+		return dec.IOReadCloser(), nil
+	case Brotli:
+		return io.NopCloser(brotli.NewReader(r)), nil
+	default:
+		return nil, ErrUnsupportedEncoding
+	}
+}
+
+// Negotiate returns the content coding of the offered ones (in order of preference) with the highest quality
+// in the Accept-Encoding header, or "" if none is acceptable
+func Negotiate(acceptEncoding string, offered []string) string {
+	qualities := map[string]float64{}
+	wildcard := -1.0
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		name, params, _ := strings.Cut(part, ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		q := 1.0
+		if value, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if parsed, err := strconv.ParseFloat(value, 64); err == nil {
+				q = parsed
+			}
+		}
+		if name == "*" {
+			wildcard = q
+			continue
+		}
+		qualities[name] = q
+	}
+
+	best, bestQ := "", 0.0
+	for _, encoding := range offered {
+		q, ok := qualities[encoding]
+		if !ok {
+			q = wildcard
+		}
+		if q > bestQ {
+			best, bestQ = encoding, q
+		}
+	}
+	return best
+}
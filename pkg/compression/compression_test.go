@@ -0,0 +1,71 @@
+package compression_test
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/d4l-data4life/go-svc/pkg/compression"
+)
+
+func TestRoundTrip(t *testing.T) {
+	body := strings.Repeat("compressible ", 1000)
+
+	for _, encoding := range compression.Encodings() {
+		t.Run(encoding, func(t *testing.T) {
+			// encoders are pooled, the second run uses a reset one
+			for range 2 {
+				var buf bytes.Buffer
+				encoder, err := compression.NewEncoder(encoding, &buf)
+				require.NoError(t, err)
+				_, err = io.WriteString(encoder, body)
+				require.NoError(t, err)
+				require.NoError(t, encoder.Close())
+				assert.Less(t, buf.Len(), len(body))
+
+				decoder, err := compression.NewDecoder(encoding, &buf)
+				require.NoError(t, err)
+				decoded, err := io.ReadAll(decoder)
+				require.NoError(t, err)
+				require.NoError(t, decoder.Close())
+				assert.Equal(t, body, string(decoded))
+			}
+		})
+	}
+}
+
+func TestUnsupportedEncoding(t *testing.T) {
+	_, err := compression.NewEncoder("deflate", io.Discard)
+	assert.ErrorIs(t, err, compression.ErrUnsupportedEncoding)
+	_, err = compression.NewDecoder("compress", strings.NewReader(""))
+	assert.ErrorIs(t, err, compression.ErrUnsupportedEncoding)
+	assert.False(t, compression.Supported("identity"))
+	assert.True(t, compression.Supported("GZIP"))
+}
+
+func TestNegotiate(t *testing.T) {
+	offered := compression.Encodings()
+
+	tests := []struct {
+		acceptEncoding string
+		want           string
+	}{
+		{acceptEncoding: "", want: ""},
+		{acceptEncoding: "identity", want: ""},
+		{acceptEncoding: "gzip", want: compression.Gzip},
+		{acceptEncoding: "gzip, deflate, br", want: compression.Brotli},
+		{acceptEncoding: "gzip, br, zstd", want: compression.Zstd},
+		{acceptEncoding: "gzip;q=1.0, br;q=0.8", want: compression.Gzip},
+		{acceptEncoding: "zstd;q=0, *", want: compression.Brotli},
+		{acceptEncoding: "*;q=0", want: ""},
+		{acceptEncoding: "GZIP ; q=0.5", want: compression.Gzip},
+	}
+
+	for _, tc := range tests {
+		assert.Equal(t, tc.want, compression.Negotiate(tc.acceptEncoding, offered), tc.acceptEncoding)
+	}
+}
@@ -2,6 +2,7 @@ package db
 
 import (
 	"context"
+	"errors"
 	"math/rand"
 	"strconv"
 	"sync"
@@ -9,15 +10,20 @@ import (
 
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 	"gorm.io/gorm"
 
 	"github.com/d4l-data4life/go-svc/pkg/prom"
+	"github.com/d4l-data4life/go-svc/pkg/tracing"
 )
 
 type contextKey string
 
 const (
 	QueryIDContextKey contextKey = "query-id"
+	spanContextKey    contextKey = "span"
 )
 
 type Instrumenter struct {
@@ -52,21 +58,48 @@ func createDeleteWithLock(m map[string]time.Time, mutex *sync.RWMutex) func(key
 	}
 }
 
-func createBeforeRequestCallback(m map[string]time.Time, mMutex *sync.RWMutex) func(tx *gorm.DB) {
+func createBeforeRequestCallback(m map[string]time.Time, mMutex *sync.RWMutex, operation string) func(tx *gorm.DB) {
 	setWithLock := createSetWithLock(m, mMutex)
 	return func(tx *gorm.DB) {
 		// nolint: gosec
 		queryID := strconv.Itoa(rand.Int())
-		tx.Statement.Context = context.WithValue(tx.Statement.Context, QueryIDContextKey, queryID)
+		ctx := context.WithValue(tx.Statement.Context, QueryIDContextKey, queryID)
+		ctx, span := tracing.Tracer().Start(ctx, "db "+operation,
+			trace.WithSpanKind(trace.SpanKindClient),
+			trace.WithAttributes(
+				attribute.String("db.system", tx.Dialector.Name()),
+				attribute.String("db.operation.name", operation),
+			),
+		)
+		tx.Statement.Context = context.WithValue(ctx, spanContextKey, span)
 		setWithLock(queryID, time.Now())
 	}
 }
 
+// endSpan ends the span started by the before callback. The SQL contains placeholders only, no values.
+func endSpan(tx *gorm.DB) {
+	span, ok := tx.Statement.Context.Value(spanContextKey).(trace.Span)
+	if !ok {
+		return
+	}
+	span.SetAttributes(
+		attribute.String("db.collection.name", tx.Statement.Table),
+		attribute.String("db.query.text", tx.Statement.SQL.String()),
+	)
+	if tx.Error != nil && !errors.Is(tx.Error, gorm.ErrRecordNotFound) {
+		span.RecordError(tx.Error)
+		span.SetStatus(codes.Error, tx.Error.Error())
+	}
+	span.End()
+}
+
 func createAfterRequestCallback(m map[string]time.Time, mMutex *sync.RWMutex, metric *prometheus.HistogramVec) func(tx *gorm.DB) {
 	getWithLock := createGetWithLock(m, mMutex)
 	deleteWithLock := createDeleteWithLock(m, mMutex)
 
 	return func(tx *gorm.DB) {
+		endSpan(tx)
+
 		queryID := tx.Statement.Context.Value(QueryIDContextKey).(string)
 		if ts, ok := getWithLock(queryID); ok {
 			now := time.Now()
@@ -101,7 +134,7 @@ func (i *Instrumenter) Name() string {
 	return "gorm:instrumenter"
 }
 
-// Initialize adds gorm Plugin for collecting database request metrics
+// Initialize adds gorm Plugin for collecting database request metrics and spans
 func (i *Instrumenter) Initialize(_ *gorm.DB) (err error) {
 	m := make(map[string]time.Time)
 	// mutex for goroutine safe map access
@@ -111,7 +144,7 @@ func (i *Instrumenter) Initialize(_ *gorm.DB) (err error) {
 
 	dbRequestDurationMetric := registerDbRequestDurationMetric()
 
-	err = conn.Callback().Create().Before("gorm:create").Register("gorminstrumenter:before_create", createBeforeRequestCallback(m, mutex))
+	err = conn.Callback().Create().Before("gorm:create").Register("gorminstrumenter:before_create", createBeforeRequestCallback(m, mutex, "create"))
 	if err != nil {
 		return err
 	}
@@ -122,7 +155,7 @@ func (i *Instrumenter) Initialize(_ *gorm.DB) (err error) {
 	if err != nil {
 		return err
 	}
-	err = conn.Callback().Query().Before("gorm:query").Register("gorminstrumenter:before_query", createBeforeRequestCallback(m, mutex))
+	err = conn.Callback().Query().Before("gorm:query").Register("gorminstrumenter:before_query", createBeforeRequestCallback(m, mutex, "query"))
 	if err != nil {
 		return err
 	}
@@ -133,7 +166,7 @@ func (i *Instrumenter) Initialize(_ *gorm.DB) (err error) {
 	if err != nil {
 		return err
 	}
-	err = conn.Callback().Delete().Before("gorm:delete").Register("gorminstrumenter:before_delete", createBeforeRequestCallback(m, mutex))
+	err = conn.Callback().Delete().Before("gorm:delete").Register("gorminstrumenter:before_delete", createBeforeRequestCallback(m, mutex, "delete"))
 	if err != nil {
 		return err
 	}
@@ -144,7 +177,7 @@ func (i *Instrumenter) Initialize(_ *gorm.DB) (err error) {
 	if err != nil {
 		return err
 	}
-	err = conn.Callback().Update().Before("gorm:update").Register("gorminstrumenter:before_update", createBeforeRequestCallback(m, mutex))
+	err = conn.Callback().Update().Before("gorm:update").Register("gorminstrumenter:before_update", createBeforeRequestCallback(m, mutex, "update"))
 	if err != nil {
 		return err
 	}
@@ -1,6 +1,8 @@
 package db
 
 import (
+	"context"
+	"errors"
 	"io"
 	"net/http/httptest"
 	"strconv"
@@ -9,9 +11,17 @@ import (
 	"testing"
 	"time"
 
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
+
+	"github.com/d4l-data4life/go-svc/pkg/tracing"
 )
 
 type TestType struct {
@@ -132,3 +142,52 @@ func checkMetricsCollection(metricSrv *httptest.Server, want []string, t *testin
 		}
 	}
 }
+
+func TestGormInstrumenterSpans(t *testing.T) {
+	exporter := tracing.NewInMemoryExporter()
+	shutdown, err := tracing.Init("test", tracing.WithSyncExporter(exporter))
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = shutdown(context.Background()) })
+
+	// dry runs pass the callbacks without connecting to the database
+	conn, err := gorm.Open(postgres.New(postgres.Config{DSN: "host=localhost user=user dbname=test"}),
+		&gorm.Config{DryRun: true, DisableAutomaticPing: true, SkipDefaultTransaction: true})
+	require.NoError(t, err)
+
+	m := map[string]time.Time{}
+	mutex := &sync.RWMutex{}
+	metric := prometheus.NewHistogramVec(prometheus.HistogramOpts{Name: "test_db_request_duration_seconds"}, []string{"sqlstring"})
+	require.NoError(t, conn.Callback().Query().Before("gorm:query").Register("test:before_query", createBeforeRequestCallback(m, mutex, "query")))
+	require.NoError(t, conn.Callback().Query().After("gorm:query").Register("test:after_query", createAfterRequestCallback(m, mutex, metric)))
+	require.NoError(t, conn.Callback().Delete().Before("gorm:delete").Register("test:before_delete", createBeforeRequestCallback(m, mutex, "delete")))
+	require.NoError(t, conn.Callback().Delete().After("gorm:delete").Register("test:after_delete", createAfterRequestCallback(m, mutex, metric)))
+	require.NoError(t, conn.Callback().Delete().Before("gorm:delete").After("test:before_delete").
+		Register("test:fail", func(tx *gorm.DB) { _ = tx.AddError(errors.New("deadlock detected")) }))
+
+	ctx, parent := tracing.Tracer().Start(context.Background(), "parent")
+	conn.WithContext(ctx).Where("code = ?", "L1212").Find(&[]TestType{})
+	conn.WithContext(ctx).Where("code = ?", "L1212").Delete(&TestType{})
+	parent.End()
+
+	spans := exporter.GetSpans()
+	require.Len(t, spans, 3)
+
+	query := spans[0]
+	assert.Equal(t, "db query", query.Name)
+	assert.Equal(t, trace.SpanKindClient, query.SpanKind)
+	assert.Equal(t, parent.SpanContext().SpanID(), query.Parent.SpanID(), "the span is a child of the request span")
+	attrs := map[attribute.Key]string{}
+	for _, attr := range query.Attributes {
+		attrs[attr.Key] = attr.Value.Emit()
+	}
+	assert.Equal(t, "postgres", attrs["db.system"])
+	assert.Equal(t, "query", attrs["db.operation.name"])
+	assert.Equal(t, "test_types", attrs["db.collection.name"])
+	assert.Equal(t, `SELECT * FROM "test_types" WHERE code = $1`, attrs["db.query.text"], "values are not recorded")
+	assert.Equal(t, codes.Unset, query.Status.Code)
+
+	deleted := spans[1]
+	assert.Equal(t, "db delete", deleted.Name)
+	assert.Equal(t, codes.Error, deleted.Status.Code)
+	assert.Equal(t, "deadlock detected", deleted.Status.Description)
+}
@@ -0,0 +1,239 @@
+package fault
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"net/http"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/d4l-data4life/go-svc/pkg/log"
+	"github.com/d4l-data4life/go-svc/pkg/logging"
+	"github.com/d4l-data4life/go-svc/pkg/prom"
+)
+
+// ErrInjectedFault is returned for injected connection errors.
+var ErrInjectedFault = errors.New("injected fault")
+
+// Side tells where a fault is injected.
+type Side string
+
+const (
+	// Client faults are injected into outgoing requests by transport.FaultInjector
+	Client Side = "client"
+	// Server faults are injected into incoming requests by middlewares.FaultInjector
+	Server Side = "server"
+)
+
+// Duration is a time.Duration that is encoded as string (e.g. "150ms") in JSON.
+type Duration time.Duration
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+// Rule describes which requests are affected and which fault is injected.
+// Empty match fields match all requests. A rule can combine latency with either
+// a connection error or a status code.
+type Rule struct {
+	Name string `json:"name"`
+
+	// Host matches the request host with or without port
+	Host string `json:"host,omitempty"`
+	// Path is a regular expression matched against the request path
+	Path     string `json:"path,omitempty"`
+	Method   string `json:"method,omitempty"`
+	TenantID string `json:"tenant-id,omitempty"`
+	// Percentage of matching requests that are affected (more than 0, up to 100), a rule without it is rejected
+	Percentage float64 `json:"percentage"`
+
+	// Latency is added before the request is processed
+	Latency Duration `json:"latency,omitempty"`
+	// Error aborts the request with a connection error
+	Error bool `json:"error,omitempty"`
+	// StatusCode answers the request with the given status code
+	StatusCode int `json:"status-code,omitempty"`
+}
+
+// Fault returns a short name of the injected fault, used for logging and metrics
+func (r Rule) Fault() string {
+	switch {
+	case r.Error:
+		return "error"
+	case r.StatusCode != 0:
+		return "status"
+	case r.Latency > 0:
+		return "latency"
+	}
+	return "none"
+}
+
+type compiledRule struct {
+	Rule
+	path *regexp.Regexp
+}
+
+func (c compiledRule) matches(r *http.Request, host string) bool {
+	if c.Host != "" && c.Host != host && c.Host != stripPort(host) {
+		return false
+	}
+	if c.Method != "" && c.Method != r.Method {
+		return false
+	}
+	if c.path != nil && !c.path.MatchString(r.URL.Path) {
+		return false
+	}
+	if c.TenantID != "" {
+		tenantID, _ := r.Context().Value(log.TenantIDContextKey).(string)
+		if c.TenantID != tenantID {
+			return false
+		}
+	}
+	// nolint: gosec
+	return rand.Float64()*100 < c.Percentage
+}
+
+func stripPort(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		return h
+	}
+	return host
+}
+
+// Injector holds the fault rules, which can be changed at runtime.
+// The same Injector can be shared by transports, middlewares and the admin handler.
+type Injector struct {
+	mu    sync.RWMutex
+	rules []compiledRule
+
+	logger  *log.Logger
+	metrics *prom.FaultInstrumenter
+}
+
+// Option is to be implemented by functional options
+type Option func(*Injector)
+
+// WithLogger sets the logger used for injected faults (defaults to the logging singleton)
+func WithLogger(logger *log.Logger) Option {
+	return func(i *Injector) {
+		i.logger = logger
+	}
+}
+
+// WithInitOptions changes the subsystem of the exported metrics
+func WithInitOptions(options ...prom.InitOption) Option {
+	return func(i *Injector) {
+		i.metrics = prom.NewFaultInstrumenter(options...)
+	}
+}
+
+// NewInjector creates an Injector without any rules
+func NewInjector(options ...Option) *Injector {
+	i := &Injector{}
+	for _, apply := range options {
+		apply(i)
+	}
+	if i.logger == nil {
+		i.logger = logging.Logger()
+	}
+	if i.metrics == nil {
+		i.metrics = prom.NewFaultInstrumenter()
+	}
+	return i
+}
+
+// SetRules replaces all rules. The rules are not changed if any of them is invalid.
+func (i *Injector) SetRules(rules ...Rule) error {
+	compiled := make([]compiledRule, 0, len(rules))
+	for _, rule := range rules {
+		c := compiledRule{Rule: rule}
+		if rule.Path != "" {
+			re, err := regexp.Compile(rule.Path)
+			if err != nil {
+				return fmt.Errorf("rule %s: invalid path: %w", rule.Name, err)
+			}
+			c.path = re
+		}
+		if rule.Percentage <= 0 || rule.Percentage > 100 {
+			return fmt.Errorf("rule %s: percentage %v out of range", rule.Name, rule.Percentage)
+		}
+		if rule.StatusCode != 0 && (rule.StatusCode < 100 || rule.StatusCode > 599) {
+			return fmt.Errorf("rule %s: invalid status code %d", rule.Name, rule.StatusCode)
+		}
+		compiled = append(compiled, c)
+	}
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.rules = compiled
+
+	return nil
+}
+
+// Rules returns a copy of the current rules
+func (i *Injector) Rules() []Rule {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
+	rules := make([]Rule, 0, len(i.rules))
+	for _, c := range i.rules {
+		rules = append(rules, c.Rule)
+	}
+	return rules
+}
+
+// Match returns the first rule affecting the request. host is the target host
+// for outgoing requests and the requested host for incoming ones.
+// Every match is logged and counted as injected fault.
+func (i *Injector) Match(side Side, r *http.Request, host string) (Rule, bool) {
+	i.mu.RLock()
+	rules := i.rules
+	i.mu.RUnlock()
+
+	for _, c := range rules {
+		if c.matches(r, host) {
+			i.metrics.Inject(string(side), c.Name, c.Fault())
+			_ = i.logger.WarnGeneric(r.Context(),
+				fmt.Sprintf("fault rule %s injects %s into %s %s%s", c.Name, c.Fault(), r.Method, host, r.URL.Path),
+				ErrInjectedFault,
+			)
+			return c.Rule, true
+		}
+	}
+	return Rule{}, false
+}
+
+// Delay waits for the latency of the rule or until the context is done
+func Delay(ctx context.Context, rule Rule) error {
+	if rule.Latency <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(time.Duration(rule.Latency))
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,96 @@
+package fault_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/d4l-data4life/go-svc/pkg/fault"
+	"github.com/d4l-data4life/go-svc/pkg/log"
+)
+
+func newInjector(t *testing.T, rules ...fault.Rule) *fault.Injector {
+	t.Helper()
+
+	injector := fault.NewInjector(fault.WithLogger(log.NewLogger("test", "v0", "localhost", log.WithWriter(io.Discard))))
+	require.NoError(t, injector.SetRules(rules...))
+	return injector
+}
+
+func TestInjector_Match(t *testing.T) {
+	tenantCtx := context.WithValue(context.Background(), log.TenantIDContextKey, "tenant-1")
+
+	tests := []struct {
+		name  string
+		rule  fault.Rule
+		ctx   context.Context
+		host  string
+		match bool
+	}{
+		{"match all", fault.Rule{Name: "all", Percentage: 100}, context.Background(), "example.org", true},
+		{"host without port", fault.Rule{Name: "host", Host: "example.org", Percentage: 100}, context.Background(), "example.org:8080", true},
+		{"other host", fault.Rule{Name: "host", Host: "example.com", Percentage: 100}, context.Background(), "example.org", false},
+		{"path regex", fault.Rule{Name: "path", Path: "^/api/v1/", Percentage: 100}, context.Background(), "example.org", true},
+		{"other path", fault.Rule{Name: "path", Path: "^/admin", Percentage: 100}, context.Background(), "example.org", false},
+		{"method", fault.Rule{Name: "method", Method: http.MethodPost, Percentage: 100}, context.Background(), "example.org", false},
+		{"tenant", fault.Rule{Name: "tenant", TenantID: "tenant-1", Percentage: 100}, tenantCtx, "example.org", true},
+		{"other tenant", fault.Rule{Name: "tenant", TenantID: "tenant-2", Percentage: 100}, tenantCtx, "example.org", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			injector := newInjector(t, tt.rule)
+
+			req := httptest.NewRequest(http.MethodGet, "/api/v1/records", nil).WithContext(tt.ctx)
+			_, ok := injector.Match(fault.Client, req, tt.host)
+			assert.Equal(t, tt.match, ok)
+		})
+	}
+}
+
+func TestInjector_SetRules(t *testing.T) {
+	injector := newInjector(t, fault.Rule{Name: "valid", Percentage: 100})
+
+	assert.Error(t, injector.SetRules(fault.Rule{Name: "regex", Path: "(", Percentage: 100}))
+	assert.Error(t, injector.SetRules(fault.Rule{Name: "percentage", Percentage: 101}))
+	assert.Error(t, injector.SetRules(fault.Rule{Name: "without percentage", Latency: fault.Duration(time.Second)}))
+	assert.Error(t, injector.SetRules(fault.Rule{Name: "status", StatusCode: 1000, Percentage: 100}))
+
+	// invalid rules leave the current ones untouched
+	assert.Equal(t, []fault.Rule{{Name: "valid", Percentage: 100}}, injector.Rules())
+}
+
+func TestInjector_Handler(t *testing.T) {
+	injector := newInjector(t)
+	handler := injector.Handler()
+
+	res := httptest.NewRecorder()
+	body := `[{"name":"slow","path":"^/api","percentage":50,"latency":"150ms"}]`
+	handler.ServeHTTP(res, httptest.NewRequest(http.MethodPut, "/faults", strings.NewReader(body)))
+	require.Equal(t, http.StatusOK, res.Code)
+	assert.Equal(t, []fault.Rule{{Name: "slow", Path: "^/api", Percentage: 50, Latency: fault.Duration(150 * time.Millisecond)}}, injector.Rules())
+
+	res = httptest.NewRecorder()
+	handler.ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/faults", nil))
+	require.Equal(t, http.StatusOK, res.Code)
+	assert.JSONEq(t, body, res.Body.String())
+
+	res = httptest.NewRecorder()
+	handler.ServeHTTP(res, httptest.NewRequest(http.MethodPut, "/faults", strings.NewReader(`[{"name":"broken","path":"("}]`)))
+	assert.Equal(t, http.StatusBadRequest, res.Code)
+
+	res = httptest.NewRecorder()
+	handler.ServeHTTP(res, httptest.NewRequest(http.MethodDelete, "/faults", nil))
+	require.Equal(t, http.StatusOK, res.Code)
+	assert.Empty(t, injector.Rules())
+
+	res = httptest.NewRecorder()
+	handler.ServeHTTP(res, httptest.NewRequest(http.MethodPost, "/faults", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, res.Code)
+}
@@ -0,0 +1,41 @@
+package fault
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// Handler returns the admin handler to inspect and change the rules at runtime:
+//   - GET returns the current rules
+//   - PUT replaces all rules with the JSON array in the request body
+//   - DELETE removes all rules
+//
+// The handler must be protected, e.g. with middlewares.Auth.ServiceSecret.
+func (i *Injector) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+		case http.MethodPut:
+			var rules []Rule
+			if err := json.NewDecoder(r.Body).Decode(&rules); err != nil {
+				http.Error(w, "invalid rules: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+			if err := i.SetRules(rules...); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			_ = i.logger.InfoGeneric(r.Context(), "fault injection rules replaced")
+		case http.MethodDelete:
+			_ = i.SetRules()
+			_ = i.logger.InfoGeneric(r.Context(), "fault injection rules removed")
+		default:
+			w.Header().Set("Allow", "GET, PUT, DELETE")
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(i.Rules())
+	})
+}
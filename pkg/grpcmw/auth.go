@@ -0,0 +1,73 @@
+package grpcmw
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/d4l-data4life/go-svc/pkg/log"
+	"github.com/d4l-data4life/go-svc/pkg/middlewares"
+)
+
+const authorizationMetadataKey = "authorization"
+
+func authenticate(ctx context.Context, sa *middlewares.ServiceSecretAuthenticator) error {
+	if err := sa.Validate(ctx, incomingValue(ctx, authorizationMetadataKey)); err != nil {
+		return status.Error(codes.Unauthenticated, "unauthorized")
+	}
+	return nil
+}
+
+// UnaryServiceSecret rejects calls without the service secret in the authorization metadata ("Bearer <secret>")
+// with codes.Unauthenticated, like ServiceSecretAuthenticator.Authenticate
+func UnaryServiceSecret(sa *middlewares.ServiceSecretAuthenticator) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		if err := authenticate(ctx, sa); err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// StreamServiceSecret is the stream variant of UnaryServiceSecret
+func StreamServiceSecret(sa *middlewares.ServiceSecretAuthenticator) grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if err := authenticate(ss.Context(), sa); err != nil {
+			return err
+		}
+		return handler(srv, ss)
+	}
+}
+
+func authenticateJWT(ctx context.Context, a *middlewares.JWTAuthenticator) (context.Context, error) {
+	ctx, err := a.Validate(ctx, incomingValue(ctx, authorizationMetadataKey))
+	if err != nil {
+		return ctx, status.Error(codes.Unauthenticated, "unauthorized")
+	}
+	return ctx, nil
+}
+
+// UnaryJWT rejects calls without a valid bearer token in the authorization metadata with codes.Unauthenticated
+// and stores the identity, scopes and roles of the caller in the context, like JWTAuthenticator.Authenticate
+func UnaryJWT(a *middlewares.JWTAuthenticator) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		ctx, err := authenticateJWT(context.WithValue(ctx, log.RequestURLContextKey, info.FullMethod), a)
+		if err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// StreamJWT is the stream variant of UnaryJWT
+func StreamJWT(a *middlewares.JWTAuthenticator) grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, err := authenticateJWT(context.WithValue(ss.Context(), log.RequestURLContextKey, info.FullMethod), a)
+		if err != nil {
+			return err
+		}
+		return handler(srv, withContext(ss, ctx))
+	}
+}
@@ -0,0 +1,47 @@
+package grpcmw
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/d4l-data4life/go-svc/pkg/log"
+	"github.com/d4l-data4life/go-svc/pkg/middlewares"
+)
+
+// MethodPolicies maps full method names ("/package.Service/Method") to the policy protecting them
+type MethodPolicies map[string]middlewares.Policy
+
+func authorize(ctx context.Context, a *middlewares.Authorizer, policies MethodPolicies, fullMethod string) error {
+	policy, ok := policies[fullMethod]
+	if !ok {
+		return nil
+	}
+	if err := a.Check(context.WithValue(ctx, log.RequestURLContextKey, fullMethod), policy); err != nil {
+		return status.Error(codes.PermissionDenied, "forbidden")
+	}
+	return nil
+}
+
+// UnaryAuthorize rejects calls of methods whose policy the caller does not fulfill with codes.PermissionDenied,
+// like Authorizer.Require. Methods without a policy are not restricted.
+func UnaryAuthorize(a *middlewares.Authorizer, policies MethodPolicies) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		if err := authorize(ctx, a, policies, info.FullMethod); err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// StreamAuthorize is the stream variant of UnaryAuthorize
+func StreamAuthorize(a *middlewares.Authorizer, policies MethodPolicies) grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if err := authorize(ss.Context(), a, policies, info.FullMethod); err != nil {
+			return err
+		}
+		return handler(srv, ss)
+	}
+}
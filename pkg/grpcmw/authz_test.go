@@ -0,0 +1,53 @@
+package grpcmw_test
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/d4l-data4life/go-svc/pkg/grpcmw"
+	"github.com/d4l-data4life/go-svc/pkg/log"
+	"github.com/d4l-data4life/go-svc/pkg/middlewares"
+)
+
+func TestUnaryAuthorize(t *testing.T) {
+	buf := new(bytes.Buffer)
+	logger := log.NewLogger("test", "v0", "localhost", log.WithWriter(buf))
+	interceptor := grpcmw.UnaryAuthorize(
+		middlewares.NewAuthorizer(middlewares.AuthorizerWithLogger(logger)),
+		grpcmw.MethodPolicies{"/records.Service/Delete": middlewares.RequireAnyRole("admin")},
+	)
+	handler := func(context.Context, any) (any, error) { return "ok", nil }
+
+	tests := []struct {
+		name     string
+		method   string
+		ctx      context.Context
+		wantCode codes.Code
+	}{
+		{"method without policy", "/records.Service/Get", context.Background(), codes.OK},
+		{"policy fulfilled", "/records.Service/Delete", middlewares.WithRoles(context.Background(), "admin"), codes.OK},
+		{"policy not fulfilled", "/records.Service/Delete", middlewares.WithRoles(context.Background(), "user"), codes.PermissionDenied},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			buf.Reset()
+
+			_, err := interceptor(tc.ctx, nil, &grpc.UnaryServerInfo{FullMethod: tc.method}, handler)
+			assert.Equal(t, tc.wantCode, status.Code(err))
+			if tc.wantCode == codes.OK {
+				assert.Empty(t, buf.String())
+				return
+			}
+			assert.Contains(t, buf.String(), `"security-event":"authorization"`)
+			assert.Contains(t, buf.String(), `"req-url":"/records.Service/Delete"`)
+			assert.Contains(t, buf.String(), `"missing-any-role":["admin"]`)
+		})
+	}
+}
@@ -0,0 +1,258 @@
+package grpcmw
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/d4l-data4life/go-svc/pkg/log"
+	"github.com/d4l-data4life/go-svc/pkg/logging"
+	"github.com/d4l-data4life/go-svc/pkg/prom"
+	"github.com/d4l-data4life/go-svc/pkg/tracing"
+	"github.com/d4l-data4life/go-svc/pkg/transport"
+)
+
+type clientChainConfig struct {
+	logger      *log.Logger
+	logOptions  []func(*log.GRPCLogger)
+	secret      string
+	tokens      *transport.OAuth2TokenSource
+	initOptions []prom.InitOption
+}
+
+// ClientChainOption is to be implemented by functional options
+type ClientChainOption func(*clientChainConfig)
+
+// ClientChainWithLogger sets the logger used for call logs (defaults to the logging singleton)
+func ClientChainWithLogger(logger *log.Logger, options ...func(*log.GRPCLogger)) ClientChainOption {
+	return func(c *clientChainConfig) {
+		c.logger = logger
+		c.logOptions = options
+	}
+}
+
+// ClientChainWithServiceSecret authenticates all calls with the service secret
+func ClientChainWithServiceSecret(secret string) ClientChainOption {
+	return func(c *clientChainConfig) {
+		c.secret = secret
+	}
+}
+
+// ClientChainWithOAuth2 authenticates all calls with a token of the token source
+func ClientChainWithOAuth2(tokens *transport.OAuth2TokenSource) ClientChainOption {
+	return func(c *clientChainConfig) {
+		c.tokens = tokens
+	}
+}
+
+// ClientChainWithInitOptions changes the subsystem and buckets of the exported metrics
+func ClientChainWithInitOptions(options ...prom.InitOption) ClientChainOption {
+	return func(c *clientChainConfig) {
+		c.initOptions = options
+	}
+}
+
+// ClientChain returns the dial options installing all client interceptors in the order
+// trace, tenant, logging, metrics and - if configured - service secret or OAuth2 authentication.
+//
+//	conn, err := grpc.NewClient(target, append(grpcmw.ClientChain(), grpc.WithTransportCredentials(creds))...)
+func ClientChain(options ...ClientChainOption) []grpc.DialOption {
+	c := &clientChainConfig{}
+	for _, apply := range options {
+		apply(c)
+	}
+	if c.logger == nil {
+		c.logger = logging.Logger()
+	}
+
+	grpcLogger := c.logger.GRPC(c.logOptions...)
+	instrumenter := prom.NewGRPCClientInstrumenter(c.initOptions...)
+
+	unary := []grpc.UnaryClientInterceptor{
+		UnaryClientTrace(),
+		UnaryClientTenant(),
+		UnaryClientLogger(grpcLogger),
+		UnaryClientMetrics(instrumenter),
+	}
+	stream := []grpc.StreamClientInterceptor{
+		StreamClientTrace(),
+		StreamClientTenant(),
+		StreamClientLogger(grpcLogger),
+		StreamClientMetrics(instrumenter),
+	}
+	switch {
+	case c.tokens != nil:
+		unary = append(unary, UnaryClientOAuth2(c.tokens))
+		stream = append(stream, StreamClientOAuth2(c.tokens))
+	case c.secret != "":
+		unary = append(unary, UnaryClientServiceSecret(c.secret))
+		stream = append(stream, StreamClientServiceSecret(c.secret))
+	}
+
+	return []grpc.DialOption{
+		grpc.WithChainUnaryInterceptor(unary...),
+		grpc.WithChainStreamInterceptor(stream...),
+	}
+}
+
+// UnaryClientTrace creates client spans and propagates the W3C trace context and the legacy trace-id
+func UnaryClientTrace() grpc.UnaryClientInterceptor {
+	return tracing.UnaryClientInterceptor()
+}
+
+// StreamClientTrace is the stream variant of UnaryClientTrace
+func StreamClientTrace() grpc.StreamClientInterceptor {
+	return tracing.StreamClientInterceptor()
+}
+
+// outgoingTenant copies the tenant id of the context to the outgoing metadata
+func outgoingTenant(ctx context.Context) context.Context {
+	tenantID, _ := ctx.Value(log.TenantIDContextKey).(string)
+	if tenantID == "" {
+		return ctx
+	}
+	md, _ := metadata.FromOutgoingContext(ctx)
+	md = md.Copy()
+	md.Set(TenantIDMetadataKey, tenantID)
+	return metadata.NewOutgoingContext(ctx, md)
+}
+
+// UnaryClientTenant copies the tenant id of the context to the outgoing metadata
+func UnaryClientTenant() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		return invoker(outgoingTenant(ctx), method, req, reply, cc, opts...)
+	}
+}
+
+// StreamClientTenant is the stream variant of UnaryClientTenant
+func StreamClientTenant() grpc.StreamClientInterceptor {
+	return func(
+		ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption,
+	) (grpc.ClientStream, error) {
+		return streamer(outgoingTenant(ctx), desc, cc, method, opts...)
+	}
+}
+
+func logOutRequest(ctx context.Context, l *log.GRPCLogger, cc *grpc.ClientConn, method string, body string) {
+	md, _ := metadata.FromOutgoingContext(ctx)
+	_ = l.OutRequest(ctx, method, cc.Target(), md, body)
+}
+
+// UnaryClientLogger logs requests and responses of outgoing unary calls
+func UnaryClientLogger(l *log.GRPCLogger) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		reqTime := time.Now()
+		logOutRequest(ctx, l, cc, method, messageString(req))
+
+		err := invoker(ctx, method, req, reply, cc, opts...)
+
+		body := ""
+		if err == nil {
+			body = messageString(reply)
+		}
+		_ = l.OutResponse(ctx, method, status.Code(err).String(), body, err, reqTime)
+		return err
+	}
+}
+
+// StreamClientLogger logs the creation of outgoing streams, the streamed messages are not logged
+func StreamClientLogger(l *log.GRPCLogger) grpc.StreamClientInterceptor {
+	return func(
+		ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption,
+	) (grpc.ClientStream, error) {
+		reqTime := time.Now()
+		logOutRequest(ctx, l, cc, method, "")
+
+		cs, err := streamer(ctx, desc, cc, method, opts...)
+
+		_ = l.OutResponse(ctx, method, status.Code(err).String(), "", err, reqTime)
+		return cs, err
+	}
+}
+
+// UnaryClientMetrics records the in-flight gauge, count and duration of outgoing unary calls per full method
+func UnaryClientMetrics(i *prom.GRPCClientInstrumenter) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		done := i.Start(method)
+		err := invoker(ctx, method, req, reply, cc, opts...)
+		done(status.Code(err).String())
+		return err
+	}
+}
+
+// StreamClientMetrics records the creation of outgoing streams like UnaryClientMetrics
+func StreamClientMetrics(i *prom.GRPCClientInstrumenter) grpc.StreamClientInterceptor {
+	return func(
+		ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption,
+	) (grpc.ClientStream, error) {
+		done := i.Start(method)
+		cs, err := streamer(ctx, desc, cc, method, opts...)
+		done(status.Code(err).String())
+		return cs, err
+	}
+}
+
+func withBearer(ctx context.Context, token string) context.Context {
+	md, _ := metadata.FromOutgoingContext(ctx)
+	md = md.Copy()
+	md.Set(authorizationMetadataKey, fmt.Sprintf("Bearer %s", token))
+	return metadata.NewOutgoingContext(ctx, md)
+}
+
+// UnaryClientServiceSecret adds the service secret to the authorization metadata of outgoing calls
+func UnaryClientServiceSecret(secret string) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		return invoker(withBearer(ctx, secret), method, req, reply, cc, opts...)
+	}
+}
+
+// StreamClientServiceSecret is the stream variant of UnaryClientServiceSecret
+func StreamClientServiceSecret(secret string) grpc.StreamClientInterceptor {
+	return func(
+		ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption,
+	) (grpc.ClientStream, error) {
+		return streamer(withBearer(ctx, secret), desc, cc, method, opts...)
+	}
+}
+
+// UnaryClientOAuth2 adds a bearer token of the token source to outgoing calls.
+// Like the OAuth2ClientCredentials transport, a call rejected with codes.Unauthenticated is retried once with a fresh token.
+func UnaryClientOAuth2(tokens *transport.OAuth2TokenSource) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		token, err := tokens.Token(ctx)
+		if err != nil {
+			return status.Error(codes.Unauthenticated, err.Error())
+		}
+
+		err = invoker(withBearer(ctx, token), method, req, reply, cc, opts...)
+		if status.Code(err) != codes.Unauthenticated {
+			return err
+		}
+
+		// the token might have been revoked before its expiry, retry once with a fresh one
+		tokens.Invalidate(token)
+		freshToken, tokenErr := tokens.Token(ctx)
+		if tokenErr != nil || freshToken == token {
+			return err
+		}
+		return invoker(withBearer(ctx, freshToken), method, req, reply, cc, opts...)
+	}
+}
+
+// StreamClientOAuth2 adds a bearer token of the token source to outgoing streams
+func StreamClientOAuth2(tokens *transport.OAuth2TokenSource) grpc.StreamClientInterceptor {
+	return func(
+		ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption,
+	) (grpc.ClientStream, error) {
+		token, err := tokens.Token(ctx)
+		if err != nil {
+			return nil, status.Error(codes.Unauthenticated, err.Error())
+		}
+		return streamer(withBearer(ctx, token), desc, cc, method, opts...)
+	}
+}
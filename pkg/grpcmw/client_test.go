@@ -0,0 +1,74 @@
+package grpcmw_test
+
+import (
+	"bytes"
+	"context"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+
+	"github.com/d4l-data4life/go-svc/pkg/grpcmw"
+	"github.com/d4l-data4life/go-svc/pkg/log"
+	"github.com/d4l-data4life/go-svc/pkg/prom"
+	"github.com/d4l-data4life/go-svc/pkg/transport"
+)
+
+// rotatingProvider returns an outdated token first and the service secret afterwards
+type rotatingProvider struct {
+	calls atomic.Int32
+}
+
+func (p *rotatingProvider) Authenticate(_ context.Context) (string, error) {
+	if p.calls.Add(1) == 1 {
+		return "outdated", nil
+	}
+	return secret, nil
+}
+
+func TestClientChain(t *testing.T) {
+	t.Run("propagates trace and tenant with the service secret", func(t *testing.T) {
+		buf := new(bytes.Buffer)
+		logger := log.NewLogger("test", "v0", "localhost", log.WithWriter(buf))
+		client := startServer(t, logger, grpcmw.ClientChain(
+			grpcmw.ClientChainWithLogger(logger),
+			grpcmw.ClientChainWithServiceSecret(secret),
+			grpcmw.ClientChainWithInitOptions(prom.WithSubsystem("grpcmw")),
+		)...)
+
+		ctx := context.WithValue(context.Background(), log.TraceIDContextKey, "0af7651916cd43dd8448eb211c80319c")
+		ctx = context.WithValue(ctx, log.TenantIDContextKey, "tenant-1")
+		_, err := client.Check(ctx, &healthpb.HealthCheckRequest{})
+		require.NoError(t, err)
+
+		logs := decodeLogs(t, buf)
+		require.Len(t, logs, 4)
+		for _, entry := range logs {
+			assert.Equal(t, "0af7651916cd43dd8448eb211c80319c", entry["trace-id"], entry["event-type"])
+			assert.Equal(t, "tenant-1", entry["tenant-id"], entry["event-type"])
+		}
+		assert.Equal(t, "grpc-out-request", logs[0]["event-type"])
+		assert.Equal(t, "grpc-in-request", logs[1]["event-type"])
+		assert.Equal(t, "grpc-in-response", logs[2]["event-type"])
+		assert.Equal(t, "grpc-out-response", logs[3]["event-type"])
+		assert.Equal(t, "OK", logs[3]["response-code"])
+	})
+
+	t.Run("retries once with a fresh oauth2 token", func(t *testing.T) {
+		logger := log.NewLogger("test", "v0", "localhost", log.WithWriter(new(bytes.Buffer)))
+		provider := &rotatingProvider{}
+		tokens, err := transport.NewOAuth2TokenSource(transport.OAuth2Config{Name: "grpcmw", Provider: provider})
+		require.NoError(t, err)
+
+		client := startServer(t, logger, grpcmw.ClientChain(
+			grpcmw.ClientChainWithLogger(logger),
+			grpcmw.ClientChainWithOAuth2(tokens),
+		)...)
+
+		_, err = client.Check(context.Background(), &healthpb.HealthCheckRequest{})
+		require.NoError(t, err)
+		assert.Equal(t, int32(2), provider.calls.Load())
+	})
+}
@@ -0,0 +1,169 @@
+// Package grpcmw provides gRPC server interceptors mirroring the HTTP middlewares:
+// trace and tenant extraction, service secret and JWT authentication, authorization, logging,
+// Prometheus metrics, load shedding and panic recovery.
+package grpcmw
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+
+	"github.com/d4l-data4life/go-svc/pkg/log"
+	"github.com/d4l-data4life/go-svc/pkg/logging"
+	"github.com/d4l-data4life/go-svc/pkg/middlewares"
+	"github.com/d4l-data4life/go-svc/pkg/prom"
+)
+
+type chainConfig struct {
+	logger        *log.Logger
+	logOptions    []func(*log.GRPCLogger)
+	recoverer     *middlewares.Recoverer
+	authenticator *middlewares.ServiceSecretAuthenticator
+	jwt           *middlewares.JWTAuthenticator
+	authorizer    *middlewares.Authorizer
+	policies      MethodPolicies
+	shedder       *middlewares.LoadShedder
+	priorities    MethodPriorities
+	initOptions   []prom.InitOption
+}
+
+// ChainOption is to be implemented by functional options
+type ChainOption func(*chainConfig)
+
+// ChainWithLogger sets the logger used for call logs and recovered panics (defaults to the logging singleton)
+func ChainWithLogger(logger *log.Logger, options ...func(*log.GRPCLogger)) ChainOption {
+	return func(c *chainConfig) {
+		c.logger = logger
+		c.logOptions = options
+	}
+}
+
+// ChainWithRecoverer sets the recoverer handling panics, e.g. to share its hooks with the HTTP middleware
+// (defaults to a recoverer using the chain logger)
+func ChainWithRecoverer(recoverer *middlewares.Recoverer) ChainOption {
+	return func(c *chainConfig) {
+		c.recoverer = recoverer
+	}
+}
+
+// ChainWithServiceSecret requires all calls to be authenticated with the service secret
+func ChainWithServiceSecret(authenticator *middlewares.ServiceSecretAuthenticator) ChainOption {
+	return func(c *chainConfig) {
+		c.authenticator = authenticator
+	}
+}
+
+// ChainWithJWT requires all calls to be authenticated with a bearer token of a user
+func ChainWithJWT(authenticator *middlewares.JWTAuthenticator) ChainOption {
+	return func(c *chainConfig) {
+		c.jwt = authenticator
+	}
+}
+
+// ChainWithAuthorization enforces the policies of the called methods after authentication
+func ChainWithAuthorization(authorizer *middlewares.Authorizer, policies MethodPolicies) ChainOption {
+	return func(c *chainConfig) {
+		c.authorizer = authorizer
+		c.policies = policies
+	}
+}
+
+// ChainWithLoadShedder rejects calls exceeding the adaptive concurrency limit of the shedder
+func ChainWithLoadShedder(shedder *middlewares.LoadShedder, priorities MethodPriorities) ChainOption {
+	return func(c *chainConfig) {
+		c.shedder = shedder
+		c.priorities = priorities
+	}
+}
+
+// ChainWithInitOptions changes the subsystem and buckets of the exported metrics
+func ChainWithInitOptions(options ...prom.InitOption) ChainOption {
+	return func(c *chainConfig) {
+		c.initOptions = options
+	}
+}
+
+// ServerChain returns the server options installing all interceptors in the order of the HTTP stack:
+// trace, tenant, logging, metrics, recover and - if configured - load shedding, service secret or JWT authentication
+// and authorization. Recover runs after the context has been populated, so logged panics carry the trace and tenant ID,
+// and inside logging and metrics, so panicked calls are logged and counted as codes.Internal.
+//
+//	grpcServer := grpc.NewServer(grpcmw.ServerChain(grpcmw.ChainWithServiceSecret(authenticator))...)
+func ServerChain(options ...ChainOption) []grpc.ServerOption {
+	c := &chainConfig{}
+	for _, apply := range options {
+		apply(c)
+	}
+	if c.logger == nil {
+		c.logger = logging.Logger()
+	}
+	if c.recoverer == nil {
+		c.recoverer = middlewares.NewRecoverer(
+			middlewares.RecoverWithLogger(c.logger),
+			middlewares.RecoverWithInitOptions(c.initOptions...),
+		)
+	}
+
+	grpcLogger := c.logger.GRPC(c.logOptions...)
+	instrumenter := prom.NewGRPCServerInstrumenter(c.initOptions...)
+
+	unary := []grpc.UnaryServerInterceptor{
+		UnaryTrace(),
+		UnaryTenant(),
+		UnaryLogger(grpcLogger),
+		UnaryMetrics(instrumenter),
+		UnaryRecoverer(c.recoverer),
+	}
+	stream := []grpc.StreamServerInterceptor{
+		StreamTrace(),
+		StreamTenant(),
+		StreamLogger(grpcLogger),
+		StreamMetrics(instrumenter),
+		StreamRecoverer(c.recoverer),
+	}
+	if c.shedder != nil {
+		unary = append(unary, UnaryLoadShed(c.shedder, c.priorities))
+		stream = append(stream, StreamLoadShed(c.shedder, c.priorities))
+	}
+	if c.authenticator != nil {
+		unary = append(unary, UnaryServiceSecret(c.authenticator))
+		stream = append(stream, StreamServiceSecret(c.authenticator))
+	}
+	if c.jwt != nil {
+		unary = append(unary, UnaryJWT(c.jwt))
+		stream = append(stream, StreamJWT(c.jwt))
+	}
+	if c.authorizer != nil {
+		unary = append(unary, UnaryAuthorize(c.authorizer, c.policies))
+		stream = append(stream, StreamAuthorize(c.authorizer, c.policies))
+	}
+
+	return []grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(unary...),
+		grpc.ChainStreamInterceptor(stream...),
+	}
+}
+
+// serverStream replaces the context of a server stream
+type serverStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *serverStream) Context() context.Context {
+	return s.ctx
+}
+
+func withContext(ss grpc.ServerStream, ctx context.Context) grpc.ServerStream {
+	return &serverStream{ServerStream: ss, ctx: ctx}
+}
+
+// incomingValue returns the first value of the metadata key
+func incomingValue(ctx context.Context, key string) string {
+	values := metadata.ValueFromIncomingContext(ctx, key)
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
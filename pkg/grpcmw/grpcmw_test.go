@@ -0,0 +1,185 @@
+package grpcmw_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	"github.com/d4l-data4life/go-svc/pkg/grpcmw"
+	"github.com/d4l-data4life/go-svc/pkg/log"
+	"github.com/d4l-data4life/go-svc/pkg/middlewares"
+	"github.com/d4l-data4life/go-svc/pkg/prom"
+)
+
+const secret = "service-secret"
+
+func startServer(t *testing.T, logger *log.Logger, dialOptions ...grpc.DialOption) healthpb.HealthClient {
+	t.Helper()
+
+	lis := bufconn.Listen(1 << 20)
+	server := grpc.NewServer(grpcmw.ServerChain(
+		grpcmw.ChainWithLogger(logger),
+		grpcmw.ChainWithServiceSecret(middlewares.NewServiceSecretAuthenticator(secret, logger)),
+		grpcmw.ChainWithInitOptions(prom.WithSubsystem("grpcmw")),
+	)...)
+	healthpb.RegisterHealthServer(server, health.NewServer())
+	go func() { _ = server.Serve(lis) }()
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet", append([]grpc.DialOption{
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	}, dialOptions...)...)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = conn.Close() })
+
+	return healthpb.NewHealthClient(conn)
+}
+
+func decodeLogs(t *testing.T, buf *bytes.Buffer) []map[string]any {
+	t.Helper()
+	var logs []map[string]any
+	dec := json.NewDecoder(buf)
+	for dec.More() {
+		entry := map[string]any{}
+		require.NoError(t, dec.Decode(&entry))
+		logs = append(logs, entry)
+	}
+	return logs
+}
+
+func TestServerChain(t *testing.T) {
+	buf := new(bytes.Buffer)
+	logger := log.NewLogger("test", "v0", "localhost", log.WithWriter(buf))
+	client := startServer(t, logger)
+
+	t.Run("authenticated call is logged with trace and tenant", func(t *testing.T) {
+		buf.Reset()
+		ctx := metadata.AppendToOutgoingContext(context.Background(),
+			"authorization", "Bearer "+secret,
+			"trace-id", "0af7651916cd43dd8448eb211c80319c",
+			"x-tenant-id", "tenant-1",
+		)
+
+		resp, err := client.Check(ctx, &healthpb.HealthCheckRequest{})
+		require.NoError(t, err)
+		assert.Equal(t, healthpb.HealthCheckResponse_SERVING, resp.Status)
+
+		logs := decodeLogs(t, buf)
+		require.Len(t, logs, 2)
+		assert.Equal(t, "grpc-in-request", logs[0]["event-type"])
+		assert.Equal(t, "/grpc.health.v1.Health/Check", logs[0]["req-url"])
+		assert.Equal(t, "0af7651916cd43dd8448eb211c80319c", logs[0]["trace-id"])
+		assert.Equal(t, "tenant-1", logs[0]["tenant-id"])
+		assert.Equal(t, []any{"Obfuscated{21}"}, logs[0]["header"].(map[string]any)["Authorization"])
+		assert.Equal(t, "grpc-in-response", logs[1]["event-type"])
+		assert.Equal(t, "OK", logs[1]["response-code"])
+		assert.JSONEq(t, `{"status":"SERVING"}`, logs[1]["response-body"].(string))
+	})
+
+	t.Run("call without service secret is rejected", func(t *testing.T) {
+		buf.Reset()
+
+		_, err := client.Check(context.Background(), &healthpb.HealthCheckRequest{})
+		assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+		logs := decodeLogs(t, buf)
+		require.NotEmpty(t, logs)
+		assert.Equal(t, "Unauthenticated", logs[len(logs)-1]["response-code"])
+	})
+}
+
+type panickingHealthServer struct {
+	healthpb.UnimplementedHealthServer
+}
+
+func (panickingHealthServer) Check(context.Context, *healthpb.HealthCheckRequest) (*healthpb.HealthCheckResponse, error) {
+	panic("boom")
+}
+
+func TestServerChainRecoversInsideLogging(t *testing.T) {
+	buf := new(bytes.Buffer)
+	logger := log.NewLogger("test", "v0", "localhost", log.WithWriter(buf))
+
+	lis := bufconn.Listen(1 << 20)
+	server := grpc.NewServer(grpcmw.ServerChain(
+		grpcmw.ChainWithLogger(logger),
+		grpcmw.ChainWithInitOptions(prom.WithSubsystem("grpcmw_recover")),
+	)...)
+	healthpb.RegisterHealthServer(server, panickingHealthServer{})
+	go func() { _ = server.Serve(lis) }()
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = conn.Close() })
+
+	_, err = healthpb.NewHealthClient(conn).Check(context.Background(), &healthpb.HealthCheckRequest{})
+	assert.Equal(t, codes.Internal, status.Code(err))
+
+	logs := decodeLogs(t, buf)
+	require.NotEmpty(t, logs)
+	assert.Equal(t, "grpc-in-response", logs[len(logs)-1]["event-type"])
+	assert.Equal(t, "Internal", logs[len(logs)-1]["response-code"])
+}
+
+func TestUnaryRecover(t *testing.T) {
+	buf := new(bytes.Buffer)
+	logger := log.NewLogger("test", "v0", "localhost", log.WithWriter(buf))
+
+	info := &grpc.UnaryServerInfo{FullMethod: "/test.Service/Panic"}
+	_, err := grpcmw.UnaryRecover(logger)(context.Background(), nil, info, func(context.Context, any) (any, error) {
+		panic("boom")
+	})
+
+	assert.Equal(t, codes.Internal, status.Code(err))
+	assert.Contains(t, buf.String(), "panic in /test.Service/Panic: boom")
+}
+
+func TestStreamRecoverer(t *testing.T) {
+	buf := new(bytes.Buffer)
+	logger := log.NewLogger("test", "v0", "localhost", log.WithWriter(buf))
+
+	var hooked string
+	recoverer := middlewares.NewRecoverer(
+		middlewares.RecoverWithLogger(logger),
+		middlewares.RecoverWithHook(func(_ context.Context, where string, _ any, _ []byte) {
+			hooked = where
+		}),
+	)
+
+	info := &grpc.StreamServerInfo{FullMethod: "/test.Service/Watch"}
+	ss := &testServerStream{ctx: context.Background()}
+	err := grpcmw.StreamRecoverer(recoverer)(nil, ss, info, func(any, grpc.ServerStream) error {
+		panic("boom")
+	})
+
+	assert.Equal(t, codes.Internal, status.Code(err))
+	assert.Equal(t, "/test.Service/Watch", hooked)
+	assert.Contains(t, buf.String(), "panic in /test.Service/Watch: boom")
+}
+
+type testServerStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *testServerStream) Context() context.Context {
+	return s.ctx
+}
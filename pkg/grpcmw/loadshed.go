@@ -0,0 +1,66 @@
+package grpcmw
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/d4l-data4life/go-svc/pkg/middlewares"
+)
+
+// MethodPriorities maps full method names ("/package.Service/Method") to their load shedding priority,
+// methods without entry have middlewares.PriorityNormal
+type MethodPriorities map[string]middlewares.Priority
+
+// overloaded tells whether the status code of a call signals that the server is overloaded
+func overloaded(err error) bool {
+	switch status.Code(err) {
+	case codes.Unavailable, codes.ResourceExhausted, codes.DeadlineExceeded:
+		return true
+	}
+	return false
+}
+
+func acquire(s *middlewares.LoadShedder, priorities MethodPriorities, fullMethod string, stream bool) (func(bool), error) {
+	priority, ok := priorities[fullMethod]
+	if !ok {
+		priority = middlewares.PriorityNormal
+	}
+	acquireFn := s.Acquire
+	if stream {
+		acquireFn = s.AcquireStream
+	}
+	release, ok := acquireFn(priority)
+	if !ok {
+		return nil, status.Error(codes.Unavailable, "service overloaded")
+	}
+	return release, nil
+}
+
+// UnaryLoadShed rejects calls exceeding the adaptive concurrency limit of the shedder with codes.Unavailable,
+// like LoadShedder.Shed. Calls failing with Unavailable, ResourceExhausted or DeadlineExceeded decrease the limit.
+func UnaryLoadShed(s *middlewares.LoadShedder, priorities MethodPriorities) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp any, err error) {
+		release, err := acquire(s, priorities, info.FullMethod, false)
+		if err != nil {
+			return nil, err
+		}
+		defer func() { release(overloaded(err)) }()
+		return handler(ctx, req)
+	}
+}
+
+// StreamLoadShed is the stream variant of UnaryLoadShed. The limit covers the whole lifetime of a stream,
+// only errors decrease it.
+func StreamLoadShed(s *middlewares.LoadShedder, priorities MethodPriorities) grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
+		release, err := acquire(s, priorities, info.FullMethod, true)
+		if err != nil {
+			return err
+		}
+		defer func() { release(overloaded(err)) }()
+		return handler(srv, ss)
+	}
+}
@@ -0,0 +1,51 @@
+package grpcmw_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/d4l-data4life/go-svc/pkg/grpcmw"
+	"github.com/d4l-data4life/go-svc/pkg/middlewares"
+)
+
+func TestUnaryLoadShed(t *testing.T) {
+	shedder := middlewares.NewLoadShedder(middlewares.LoadShedWithLimits(10, 2, 12))
+	interceptor := grpcmw.UnaryLoadShed(shedder, grpcmw.MethodPriorities{
+		"/records.Service/Health": middlewares.PriorityCritical,
+	})
+	ok := func(context.Context, any) (any, error) { return "ok", nil }
+	unavailable := func(context.Context, any) (any, error) { return nil, status.Error(codes.Unavailable, "down") }
+
+	// calls failing with Unavailable decrease the limit
+	_, err := interceptor(context.Background(), nil, &grpc.UnaryServerInfo{FullMethod: "/records.Service/Get"}, unavailable)
+	assert.Equal(t, codes.Unavailable, status.Code(err))
+	assert.Equal(t, 9, shedder.Limit())
+
+	// HTTP requests and gRPC calls count against the same limit
+	var releases []func(bool)
+	for i := 0; i < 9; i++ {
+		release, admitted := shedder.Acquire(middlewares.PriorityNormal)
+		require.True(t, admitted)
+		releases = append(releases, release)
+	}
+
+	_, err = interceptor(context.Background(), nil, &grpc.UnaryServerInfo{FullMethod: "/records.Service/Get"}, ok)
+	assert.Equal(t, codes.Unavailable, status.Code(err))
+	assert.Equal(t, "service overloaded", status.Convert(err).Message())
+
+	resp, err := interceptor(context.Background(), nil, &grpc.UnaryServerInfo{FullMethod: "/records.Service/Health"}, ok)
+	assert.NoError(t, err)
+	assert.Equal(t, "ok", resp)
+
+	for _, release := range releases {
+		release(false)
+	}
+	_, err = interceptor(context.Background(), nil, &grpc.UnaryServerInfo{FullMethod: "/records.Service/Get"}, ok)
+	assert.NoError(t, err)
+}
@@ -0,0 +1,72 @@
+package grpcmw
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/d4l-data4life/go-svc/pkg/log"
+)
+
+// messageString serializes a message for the log, proto messages as JSON
+func messageString(msg any) string {
+	if msg == nil {
+		return ""
+	}
+	if m, ok := msg.(proto.Message); ok {
+		b, err := protojson.Marshal(m)
+		if err != nil {
+			return fmt.Sprintf("error marshaling message: %v", err)
+		}
+		return string(b)
+	}
+	return fmt.Sprintf("%v", msg)
+}
+
+func logRequest(ctx context.Context, l *log.GRPCLogger, fullMethod string, body string) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	addr := ""
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		addr = p.Addr.String()
+	}
+	_ = l.InRequest(ctx, fullMethod, addr, md, body)
+}
+
+// UnaryLogger logs requests and responses of unary calls like log.HTTPLogger,
+// obfuscators are added with log.WithGRPCObfuscators
+func UnaryLogger(l *log.GRPCLogger) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		reqTime := time.Now()
+		logRequest(ctx, l, info.FullMethod, messageString(req))
+
+		resp, err := handler(ctx, req)
+
+		body := ""
+		if err == nil {
+			body = messageString(resp)
+		}
+		_ = l.InResponse(ctx, info.FullMethod, status.Code(err).String(), body, err, reqTime)
+
+		return resp, err
+	}
+}
+
+// StreamLogger logs begin and end of streaming calls, the streamed messages are not logged
+func StreamLogger(l *log.GRPCLogger) grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		reqTime := time.Now()
+		logRequest(ss.Context(), l, info.FullMethod, "")
+
+		err := handler(srv, ss)
+
+		_ = l.InResponse(ss.Context(), info.FullMethod, status.Code(err).String(), "", err, reqTime)
+		return err
+	}
+}
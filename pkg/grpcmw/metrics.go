@@ -0,0 +1,30 @@
+package grpcmw
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+
+	"github.com/d4l-data4life/go-svc/pkg/prom"
+)
+
+// UnaryMetrics records the in-flight gauge, count and duration of unary calls per full method
+func UnaryMetrics(i *prom.GRPCServerInstrumenter) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		done := i.Start(info.FullMethod)
+		resp, err := handler(ctx, req)
+		done(status.Code(err).String())
+		return resp, err
+	}
+}
+
+// StreamMetrics is the stream variant of UnaryMetrics
+func StreamMetrics(i *prom.GRPCServerInstrumenter) grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		done := i.Start(info.FullMethod)
+		err := handler(srv, ss)
+		done(status.Code(err).String())
+		return err
+	}
+}
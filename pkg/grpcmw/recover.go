@@ -0,0 +1,45 @@
+package grpcmw
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/d4l-data4life/go-svc/pkg/log"
+	"github.com/d4l-data4life/go-svc/pkg/middlewares"
+)
+
+func recoverPanic(ctx context.Context, r *middlewares.Recoverer, fullMethod string, err *error) {
+	if p := recover(); p != nil {
+		r.HandlePanic(ctx, "grpc", fullMethod, p)
+		*err = status.Error(codes.Internal, "internal error")
+	}
+}
+
+// UnaryRecover turns panics of the handler into codes.Internal errors and logs them with the stack trace
+func UnaryRecover(l *log.Logger) grpc.UnaryServerInterceptor {
+	return UnaryRecoverer(middlewares.NewRecoverer(middlewares.RecoverWithLogger(l)))
+}
+
+// StreamRecover is the stream variant of UnaryRecover
+func StreamRecover(l *log.Logger) grpc.StreamServerInterceptor {
+	return StreamRecoverer(middlewares.NewRecoverer(middlewares.RecoverWithLogger(l)))
+}
+
+// UnaryRecoverer is UnaryRecover with the metrics and hooks of the recoverer, like middlewares.Recover
+func UnaryRecoverer(r *middlewares.Recoverer) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp any, err error) {
+		defer recoverPanic(ctx, r, info.FullMethod, &err)
+		return handler(ctx, req)
+	}
+}
+
+// StreamRecoverer is the stream variant of UnaryRecoverer
+func StreamRecoverer(r *middlewares.Recoverer) grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
+		defer recoverPanic(ss.Context(), r, info.FullMethod, &err)
+		return handler(srv, ss)
+	}
+}
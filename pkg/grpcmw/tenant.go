@@ -0,0 +1,32 @@
+package grpcmw
+
+import (
+	"context"
+	"strings"
+
+	"google.golang.org/grpc"
+
+	"github.com/d4l-data4life/go-svc/pkg/log"
+	"github.com/d4l-data4life/go-svc/pkg/middlewares"
+)
+
+// TenantIDMetadataKey is the gRPC metadata key of the tenant id, the lower case middlewares.TenantIDHeaderName
+var TenantIDMetadataKey = strings.ToLower(middlewares.TenantIDHeaderName) // nolint: gochecknoglobals
+
+func tenantContext(ctx context.Context) context.Context {
+	return context.WithValue(ctx, log.TenantIDContextKey, incomingValue(ctx, TenantIDMetadataKey))
+}
+
+// UnaryTenant copies the tenant id from the incoming metadata to the context like middlewares.Tenant
+func UnaryTenant() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		return handler(tenantContext(ctx), req)
+	}
+}
+
+// StreamTenant is the stream variant of UnaryTenant
+func StreamTenant() grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		return handler(srv, withContext(ss, tenantContext(ss.Context())))
+	}
+}
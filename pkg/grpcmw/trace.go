@@ -0,0 +1,18 @@
+package grpcmw
+
+import (
+	"google.golang.org/grpc"
+
+	"github.com/d4l-data4life/go-svc/pkg/tracing"
+)
+
+// UnaryTrace continues the W3C trace context or the legacy trace-id of the incoming metadata in a server span
+// and stores the trace ID in the context like middlewares.Tracing
+func UnaryTrace() grpc.UnaryServerInterceptor {
+	return tracing.UnaryServerInterceptor()
+}
+
+// StreamTrace is the stream variant of UnaryTrace
+func StreamTrace() grpc.StreamServerInterceptor {
+	return tracing.StreamServerInterceptor()
+}
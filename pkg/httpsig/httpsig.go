@@ -0,0 +1,177 @@
+// Package httpsig implements the HMAC request signatures created by transport.HMACSign and
+// validated by middlewares.HMACVerify.
+//
+// The signature covers the key ID, the method, the host, the path with query, the selected headers, a timestamp,
+// a nonce and the SHA-256 digest of the body. Signing the host keeps requests from being replayed against other
+// services sharing the key, so proxies between signer and verifier have to preserve it.
+// It is sent in the X-Signature header:
+//
+//	X-Signature: keyId="svc-a",ts="1700000000",nonce="9c0f...",headers="content-type x-tenant-id",sig="base64"
+//	Content-Digest: sha-256=:base64:
+package httpsig
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Header names of the signature and the body digest (RFC 9530)
+const (
+	SignatureHeader = "X-Signature"
+	DigestHeader    = "Content-Digest"
+)
+
+// ErrMalformedSignature happens when the signature header cannot be parsed
+var ErrMalformedSignature = errors.New("malformed signature header")
+
+// DefaultHeaders are signed if no other headers are selected
+var DefaultHeaders = []string{"Content-Type", "X-Tenant-ID"} // nolint: gochecknoglobals
+
+// Params are the fields of the signature header
+type Params struct {
+	KeyID     string
+	Timestamp time.Time
+	Nonce     string
+	Headers   []string
+	Signature []byte
+}
+
+// String formats the params as value of the signature header
+func (p Params) String() string {
+	return fmt.Sprintf(`keyId=%q,ts="%d",nonce=%q,headers=%q,sig=%q`,
+		p.KeyID, p.Timestamp.Unix(), p.Nonce,
+		strings.ToLower(strings.Join(p.Headers, " ")),
+		base64.StdEncoding.EncodeToString(p.Signature),
+	)
+}
+
+// ParseParams parses the value of the signature header
+func ParseParams(value string) (Params, error) {
+	fields, err := parseFields(value)
+	if err != nil {
+		return Params{}, err
+	}
+
+	ts, err := strconv.ParseInt(fields["ts"], 10, 64)
+	if err != nil {
+		return Params{}, fmt.Errorf("%w: invalid timestamp", ErrMalformedSignature)
+	}
+	signature, err := base64.StdEncoding.DecodeString(fields["sig"])
+	if err != nil || len(signature) == 0 {
+		return Params{}, fmt.Errorf("%w: invalid signature", ErrMalformedSignature)
+	}
+	if fields["keyId"] == "" || fields["nonce"] == "" {
+		return Params{}, fmt.Errorf("%w: missing key ID or nonce", ErrMalformedSignature)
+	}
+
+	return Params{
+		KeyID:     fields["keyId"],
+		Timestamp: time.Unix(ts, 0),
+		Nonce:     fields["nonce"],
+		Headers:   strings.Fields(fields["headers"]),
+		Signature: signature,
+	}, nil
+}
+
+// parseFields splits the comma separated name="value" pairs, commas within the quoted values are kept
+func parseFields(value string) (map[string]string, error) {
+	fields := map[string]string{}
+	for rest := strings.TrimSpace(value); rest != ""; {
+		name, quoted, ok := strings.Cut(rest, "=")
+		if !ok || !strings.HasPrefix(quoted, `"`) {
+			return nil, ErrMalformedSignature
+		}
+
+		end := 1
+		for end < len(quoted) && quoted[end] != '"' {
+			if quoted[end] == '\\' {
+				end++
+			}
+			end++
+		}
+		if end >= len(quoted) {
+			return nil, ErrMalformedSignature
+		}
+		unquoted, err := strconv.Unquote(quoted[:end+1])
+		if err != nil {
+			return nil, ErrMalformedSignature
+		}
+		fields[strings.TrimSpace(name)] = unquoted
+
+		rest = strings.TrimSpace(quoted[end+1:])
+		if rest != "" {
+			if rest[0] != ',' {
+				return nil, ErrMalformedSignature
+			}
+			rest = strings.TrimSpace(rest[1:])
+		}
+	}
+	return fields, nil
+}
+
+// Digest returns the value of the Content-Digest header for the body
+func Digest(body []byte) string {
+	sum := sha256.Sum256(body)
+	return "sha-256=:" + base64.StdEncoding.EncodeToString(sum[:]) + ":"
+}
+
+// Sign computes the HMAC-SHA256 signature of the request with the given params and body digest.
+// The Signature field of the params is ignored.
+func Sign(key []byte, req *http.Request, p Params, digest string) []byte {
+	mac := hmac.New(sha256.New, key)
+	_, _ = mac.Write(stringToSign(req, p, digest))
+	return mac.Sum(nil)
+}
+
+// Verify tells whether the signature of the params is valid for the request and body digest
+func Verify(key []byte, req *http.Request, p Params, digest string) bool {
+	return hmac.Equal(p.Signature, Sign(key, req, p, digest))
+}
+
+// stringToSign joins the signed parts of the request by newlines
+func stringToSign(req *http.Request, p Params, digest string) []byte {
+	var b strings.Builder
+	b.WriteString(p.KeyID)
+	b.WriteByte('\n')
+	method := req.Method
+	if method == "" {
+		method = http.MethodGet
+	}
+	b.WriteString(method)
+	b.WriteByte('\n')
+	b.WriteString(host(req))
+	b.WriteByte('\n')
+	b.WriteString(req.URL.EscapedPath())
+	if req.URL.RawQuery != "" {
+		b.WriteByte('?')
+		b.WriteString(req.URL.RawQuery)
+	}
+	b.WriteByte('\n')
+	for _, name := range p.Headers {
+		b.WriteString(strings.ToLower(name))
+		b.WriteByte(':')
+		b.WriteString(strings.Join(req.Header.Values(name), ","))
+		b.WriteByte('\n')
+	}
+	b.WriteString(strconv.FormatInt(p.Timestamp.Unix(), 10))
+	b.WriteByte('\n')
+	b.WriteString(p.Nonce)
+	b.WriteByte('\n')
+	b.WriteString(digest)
+	return []byte(b.String())
+}
+
+// host returns the authority the request is sent to, outgoing requests may only carry it in the URL
+func host(req *http.Request) string {
+	if req.Host != "" {
+		return strings.ToLower(req.Host)
+	}
+	return strings.ToLower(req.URL.Host)
+}
@@ -0,0 +1,89 @@
+package httpsig
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParams(t *testing.T) {
+	params := Params{
+		KeyID:     "svc-a",
+		Timestamp: time.Unix(1700000000, 0),
+		Nonce:     "abc",
+		Headers:   []string{"Content-Type", "X-Tenant-ID"},
+		Signature: []byte{1, 2, 3},
+	}
+	assert.Equal(t, `keyId="svc-a",ts="1700000000",nonce="abc",headers="content-type x-tenant-id",sig="AQID"`, params.String())
+
+	parsed, err := ParseParams(params.String())
+	require.NoError(t, err)
+	assert.Equal(t, "svc-a", parsed.KeyID)
+	assert.True(t, params.Timestamp.Equal(parsed.Timestamp))
+	assert.Equal(t, "abc", parsed.Nonce)
+	assert.Equal(t, []string{"content-type", "x-tenant-id"}, parsed.Headers)
+	assert.Equal(t, []byte{1, 2, 3}, parsed.Signature)
+
+	withComma := Params{KeyID: `svc-a,ts="1"`, Timestamp: time.Unix(1, 0), Nonce: "n", Signature: []byte{1}}
+	parsed, err = ParseParams(withComma.String())
+	require.NoError(t, err)
+	assert.Equal(t, `svc-a,ts="1"`, parsed.KeyID)
+	assert.True(t, withComma.Timestamp.Equal(parsed.Timestamp))
+
+	for _, malformed := range []string{
+		"",
+		`keyId="svc-a"`,
+		`keyId=svc-a,ts="1",nonce="n",sig="AQID"`,
+		`keyId="svc-a",ts="now",nonce="n",sig="AQID"`,
+		`keyId="svc-a",ts="1",sig="AQID"`,
+		`keyId="svc-a",ts="1",nonce="n",sig="%%%"`,
+		`keyId="svc-a" ts="1",nonce="n",sig="AQID"`,
+		`keyId="svc-a,ts="1",nonce="n",sig="AQID"`,
+	} {
+		_, err := ParseParams(malformed)
+		assert.ErrorIs(t, err, ErrMalformedSignature, malformed)
+	}
+}
+
+func TestSign(t *testing.T) {
+	key := []byte("key")
+	params := Params{KeyID: "svc-a", Timestamp: time.Now(), Nonce: "n", Headers: []string{"X-Tenant-ID"}}
+	digest := Digest([]byte("body"))
+
+	req := httptest.NewRequest(http.MethodPost, "/records?owner=1", nil)
+	req.Header.Set("X-Tenant-ID", "tenant-1")
+	params.Signature = Sign(key, req, params, digest)
+	assert.True(t, Verify(key, req, params, digest))
+
+	// outgoing requests carry the host in the URL, incoming ones in the Host field
+	outgoing := httptest.NewRequest(http.MethodPost, "/records?owner=1", nil)
+	outgoing.Host = ""
+	outgoing.URL.Host = "EXAMPLE.com"
+	outgoing.Header.Set("X-Tenant-ID", "tenant-1")
+	assert.True(t, Verify(key, outgoing, params, digest))
+
+	tests := []struct {
+		name   string
+		modify func(*http.Request, *Params) string
+	}{
+		{"body", func(*http.Request, *Params) string { return Digest([]byte("other")) }},
+		{"method", func(r *http.Request, _ *Params) string { r.Method = http.MethodPut; return digest }},
+		{"host", func(r *http.Request, _ *Params) string { r.Host = "other.example.com"; return digest }},
+		{"query", func(r *http.Request, _ *Params) string { r.URL.RawQuery = "owner=2"; return digest }},
+		{"signed header", func(r *http.Request, _ *Params) string { r.Header.Set("X-Tenant-ID", "tenant-2"); return digest }},
+		{"timestamp", func(_ *http.Request, p *Params) string { p.Timestamp = p.Timestamp.Add(time.Second); return digest }},
+		{"key ID", func(_ *http.Request, p *Params) string { p.KeyID = "svc-b"; return digest }},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			r := req.Clone(req.Context())
+			p := params
+			d := tc.modify(r, &p)
+			assert.False(t, Verify(key, r, p, d))
+		})
+	}
+}
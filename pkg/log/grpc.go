@@ -0,0 +1,237 @@
+package log
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+const (
+	GRPCInRequest  EventType = "grpc-in-request"
+	GRPCInResponse EventType = "grpc-in-response"
+
+	GRPCOutRequest  EventType = "grpc-out-request"
+	GRPCOutResponse EventType = "grpc-out-response"
+)
+
+// GRPCReqMethod is the request method of all gRPC log entries, to be used as Obfuscator.ReqMethod.
+// The full gRPC method (e.g. /package.Service/Method) is logged as request URL and matched by Obfuscator.ReqURL.
+const GRPCReqMethod = "GRPC"
+
+// grpcRequestLog is used for incoming and outgoing gRPC requests
+type grpcRequestLog struct {
+	Timestamp      time.Time           `json:"timestamp,omitempty"`
+	LogLevel       logLevel            `json:"log-level,omitempty"`
+	TraceID        string              `json:"trace-id,omitempty"`
+	ServiceName    string              `json:"service-name,omitempty"`
+	ServiceVersion string              `json:"service-version,omitempty"`
+	Hostname       string              `json:"hostname,omitempty"`
+	ReqIP          string              `json:"req-ip,omitempty"`
+	ReqMethod      string              `json:"req-method"`
+	ReqBody        string              `json:"req-body"`
+	ReqURL         string              `json:"req-url"`
+	EventType      string              `json:"event-type,omitempty"`
+	UserID         string              `json:"user-id,omitempty"`
+	Header         map[string][]string `json:"header,omitempty"`
+	// OAuth client ID
+	ClientID string `json:"client-id,omitempty"`
+	// TenantID is the ID of the tenant to which the log belongs to
+	TenantID string `json:"tenant-id,omitempty"`
+}
+
+// grpcResponseLog is used for incoming and outgoing gRPC responses
+type grpcResponseLog struct {
+	Timestamp      time.Time `json:"timestamp,omitempty"`
+	LogLevel       logLevel  `json:"log-level,omitempty"`
+	TraceID        string    `json:"trace-id,omitempty"`
+	ServiceName    string    `json:"service-name,omitempty"`
+	ServiceVersion string    `json:"service-version,omitempty"`
+	Hostname       string    `json:"hostname,omitempty"`
+	EventType      string    `json:"event-type,omitempty"`
+	UserID         string    `json:"user-id,omitempty"`
+	ReqMethod      string    `json:"req-method"`
+	ReqURL         string    `json:"req-url"`
+	// ResponseCode is the gRPC status code name, e.g. OK or NotFound
+	ResponseCode  string `json:"response-code"`
+	ResponseBody  string `json:"response-body"`
+	ResponseError string `json:"response-error,omitempty"`
+	Duration      int64  `json:"roundtrip-duration,omitempty"`
+	// OAuth client ID
+	ClientID string `json:"client-id,omitempty"`
+	// TenantID is the ID of the tenant to which the log belongs to
+	TenantID string `json:"tenant-id,omitempty"`
+}
+
+// GRPCLogger logs gRPC calls with the same header obfuscation and Obfuscator model as HTTPLogger.
+// Obfuscators are registered for the gRPC event types with ReqMethod GRPCReqMethod.
+type GRPCLogger struct {
+	log *Logger
+	obf map[string][]HTTPObfuscator
+}
+
+// WithGRPCObfuscators is an option for Logger.GRPC, that adds obfuscators for the logged messages
+func WithGRPCObfuscators(o ...HTTPObfuscator) func(*GRPCLogger) {
+	return func(l *GRPCLogger) {
+		for _, obf := range o {
+			key := ObfuscatorKey(obf.GetEventType(), obf.GetReqMethod())
+			l.obf[key] = append(l.obf[key], obf)
+		}
+	}
+}
+
+// GRPC returns a logger for gRPC calls, used by the interceptors of the grpcmw package
+func (l *Logger) GRPC(options ...func(*GRPCLogger)) *GRPCLogger {
+	grpcLogger := &GRPCLogger{
+		log: l,
+		obf: make(map[string][]HTTPObfuscator),
+	}
+
+	for _, apply := range options {
+		apply(grpcLogger)
+	}
+
+	return grpcLogger
+}
+
+// InRequest logs an incoming gRPC call. metadata is the incoming gRPC metadata and
+// body the request message already serialized to a string (empty for streams).
+func (g *GRPCLogger) InRequest(ctx context.Context, fullMethod string, peer string, metadata map[string][]string, body string) error {
+	return g.logRequest(ctx, GRPCInRequest, hlcInRequest, fullMethod, peer, metadata, body)
+}
+
+// OutRequest logs an outgoing gRPC call. metadata is the outgoing gRPC metadata and
+// body the request message already serialized to a string (empty for streams).
+func (g *GRPCLogger) OutRequest(ctx context.Context, fullMethod string, target string, metadata map[string][]string, body string) error {
+	return g.logRequest(ctx, GRPCOutRequest, hlcOutRequest, fullMethod, target, metadata, body)
+}
+
+func (g *GRPCLogger) logRequest(
+	ctx context.Context,
+	eventType EventType,
+	hlc *headerObfuscator,
+	fullMethod string,
+	addr string,
+	metadata map[string][]string,
+	body string,
+) error {
+	traceID, userID, clientID := parseContext(ctx)
+
+	log := grpcRequestLog{
+		Timestamp:      time.Now(),
+		LogLevel:       LevelInfo,
+		TraceID:        traceID,
+		ServiceName:    g.log.serviceName,
+		ServiceVersion: g.log.serviceVersion,
+		Hostname:       g.log.hostname,
+		ReqIP:          addr,
+		ReqMethod:      GRPCReqMethod,
+		ReqBody:        body,
+		ReqURL:         fullMethod,
+		EventType:      eventType.String(),
+		UserID:         userID,
+		Header:         hlc.processHeaders(metadataToHeader(metadata)),
+		ClientID:       clientID,
+		TenantID:       getFromContextWithDefault(ctx, TenantIDContextKey, g.log.tenantID),
+	}
+
+	for _, o := range g.obf[ObfuscatorKey(eventType, GRPCReqMethod)] {
+		log = o.Obfuscate(log).(grpcRequestLog)
+	}
+
+	return g.log.Log(log)
+}
+
+// InResponse logs the result of an incoming gRPC call. code is the name of the gRPC status code
+// and body the response message already serialized to a string (empty for streams).
+func (g *GRPCLogger) InResponse(ctx context.Context, fullMethod string, code string, body string, err error, requestTimestamp time.Time) error {
+	return g.logResponse(ctx, GRPCInResponse, fullMethod, code, body, err, requestTimestamp)
+}
+
+// OutResponse logs the result of an outgoing gRPC call. code is the name of the gRPC status code
+// and body the response message already serialized to a string (empty for streams).
+func (g *GRPCLogger) OutResponse(ctx context.Context, fullMethod string, code string, body string, err error, requestTimestamp time.Time) error {
+	return g.logResponse(ctx, GRPCOutResponse, fullMethod, code, body, err, requestTimestamp)
+}
+
+func (g *GRPCLogger) logResponse(
+	ctx context.Context,
+	eventType EventType,
+	fullMethod string,
+	code string,
+	body string,
+	err error,
+	requestTimestamp time.Time,
+) error {
+	traceID, userID, clientID := parseContext(ctx)
+
+	level := LevelInfo
+	errStr := ""
+	if err != nil {
+		level = LevelError
+		errStr = err.Error()
+	}
+
+	now := time.Now()
+
+	log := grpcResponseLog{
+		Timestamp:      now,
+		LogLevel:       level,
+		TraceID:        traceID,
+		ServiceName:    g.log.serviceName,
+		ServiceVersion: g.log.serviceVersion,
+		Hostname:       g.log.hostname,
+		EventType:      eventType.String(),
+		UserID:         userID,
+		ReqMethod:      GRPCReqMethod,
+		ReqURL:         fullMethod,
+		ResponseCode:   code,
+		ResponseBody:   body,
+		ResponseError:  errStr,
+		Duration:       now.Sub(requestTimestamp).Milliseconds(),
+		ClientID:       clientID,
+		TenantID:       getFromContextWithDefault(ctx, TenantIDContextKey, g.log.tenantID),
+	}
+
+	for _, o := range g.obf[ObfuscatorKey(eventType, GRPCReqMethod)] {
+		log = o.Obfuscate(log).(grpcResponseLog)
+	}
+
+	return g.log.Log(log)
+}
+
+// metadataToHeader canonicalizes the lower case gRPC metadata keys, so the header obfuscation rules apply.
+// Pseudo headers like :authority are dropped.
+func metadataToHeader(metadata map[string][]string) http.Header {
+	header := make(http.Header, len(metadata))
+	for key, values := range metadata {
+		if key == "" || key[0] == ':' {
+			continue
+		}
+		for _, value := range values {
+			header.Add(key, value)
+		}
+	}
+	return header
+}
+
+func (o *Obfuscator) obfuscateGRPCRequest(rlog grpcRequestLog) grpcRequestLog {
+	if o.ReqURL != nil && o.ReqURL.String() != matchAll && !o.ReqURL.MatchString(rlog.ReqURL) {
+		return rlog
+	}
+
+	if o.Field == Body {
+		rlog.ReqBody = o.Replace.ReplaceAllString(rlog.ReqBody, o.With)
+	}
+	return rlog
+}
+
+func (o *Obfuscator) obfuscateGRPCResponse(rlog grpcResponseLog) grpcResponseLog {
+	if o.ReqURL != nil && o.ReqURL.String() != matchAll && !o.ReqURL.MatchString(rlog.ReqURL) {
+		return rlog
+	}
+
+	if o.Field == Body {
+		rlog.ResponseBody = o.Replace.ReplaceAllString(rlog.ResponseBody, o.With)
+	}
+	return rlog
+}
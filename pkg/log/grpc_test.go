@@ -0,0 +1,45 @@
+package log_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/d4l-data4life/go-svc/pkg/log"
+)
+
+func TestGRPCObfuscators(t *testing.T) {
+	buf := new(bytes.Buffer)
+	l := log.NewLogger("name", "version", "hostname", log.WithWriter(buf))
+	grpcLogger := l.GRPC(log.WithGRPCObfuscators(
+		log.MailObfuscator{EventType: log.GRPCInRequest, ReqMethod: log.GRPCReqMethod},
+		log.MailObfuscator{EventType: log.GRPCInResponse, ReqMethod: log.GRPCReqMethod},
+		log.IPObfuscator{EventType: log.GRPCInRequest, ReqMethod: log.GRPCReqMethod},
+	))
+
+	ctx := context.Background()
+	method := "/users.v1.Users/Create"
+	if err := grpcLogger.InRequest(ctx, method, "203.0.113.7:4711", nil, `{"email":"jane.doe@example.com"}`); err != nil {
+		t.Fatalf("logging request: %v", err)
+	}
+	err := errors.New("user jane.doe@example.com exists")
+	if err := grpcLogger.InResponse(ctx, method, "AlreadyExists", `{"email":"jane.doe@example.com"}`, err, time.Now()); err != nil {
+		t.Fatalf("logging response: %v", err)
+	}
+
+	requestLog, responseLog := decodeHTTPLogs(t, buf)
+	if got, want := requestLog["req-ip"], "203.0.xxx.xxx:4711"; got != want {
+		t.Errorf("req-ip = %q, want %q", got, want)
+	}
+	if got, want := requestLog["req-body"], `{"email":"janexxxx@exxxxle.com"}`; got != want {
+		t.Errorf("req-body = %q, want %q", got, want)
+	}
+	if got, want := responseLog["response-body"], `{"email":"janexxxx@exxxxle.com"}`; got != want {
+		t.Errorf("response-body = %q, want %q", got, want)
+	}
+	if got, want := responseLog["response-error"], "user janexxxx@exxxxle.com exists"; got != want {
+		t.Errorf("response-error = %q, want %q", got, want)
+	}
+}
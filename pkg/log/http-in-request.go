@@ -2,6 +2,7 @@ package log
 
 import (
 	"fmt"
+	"net"
 	"net/http"
 	"time"
 )
@@ -29,13 +30,18 @@ type inRequestLog struct {
 	ClientID string `json:"client-id,omitempty"`
 	// TenantID is the ID of the tenant to which the log belongs to
 	TenantID string `json:"tenant-id,omitempty"`
+	// RealIPHeaderUntrusted is the X-Real-Ip header, which any client can set
+	RealIPHeaderUntrusted string `json:"real-ip-header-untrusted,omitempty"`
 }
 
-func (h *HTTPLogger) httpInRequest(req *http.Request) error {
+func (h *HTTPLogger) httpInRequest(req *http.Request, logBody bool) error {
 	traceID, userID, clientID := parseContext(req.Context())
 	_ = req.ParseForm()
 
-	bodyStr := filteredBodyStrFromReq(req)
+	bodyStr := bodyExcludedStr
+	if logBody {
+		bodyStr, _ = filteredBodyStrFromReq(req, h.maxBodySize)
+	}
 
 	log := inRequestLog{
 		Timestamp:       time.Now(),
@@ -49,7 +55,7 @@ func (h *HTTPLogger) httpInRequest(req *http.Request) error {
 		ReqBody:         bodyStr,
 		ReqForm:         fmt.Sprintf("%s", req.Form),
 		ReqURL:          req.URL.String(),
-		RealIP:          req.Header.Get("X-Real-Ip"),
+		RealIP:          getFromContextWithDefault(req.Context(), CallerIPContextKey, peerIP(req)),
 		EventType:       "http-in-request",
 		UserID:          userID,
 		PayloadLength:   req.ContentLength,
@@ -58,6 +64,8 @@ func (h *HTTPLogger) httpInRequest(req *http.Request) error {
 		ContentEncoding: req.Header.Get("Content-Encoding"),
 		ClientID:        clientID,
 		TenantID:        getFromContextWithDefault(req.Context(), TenantIDContextKey, h.log.tenantID),
+
+		RealIPHeaderUntrusted: req.Header.Get("X-Real-Ip"),
 	}
 
 	log = h.obfuscateInRequest(log)
@@ -66,6 +74,15 @@ func (h *HTTPLogger) httpInRequest(req *http.Request) error {
 	return h.log.Log(log)
 }
 
+// peerIP returns the IP of the peer, which is the caller unless it is a proxy
+func peerIP(req *http.Request) string {
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		return req.RemoteAddr
+	}
+	return host
+}
+
 func (h *HTTPLogger) anonymizeIP(rlog inRequestLog) inRequestLog {
 	for _, a := range h.ipa {
 		rlog = a.anonymizeIPInRequest(rlog)
@@ -77,11 +94,13 @@ func (a *IPAnonymizer) anonymizeIPInRequest(rlog inRequestLog) inRequestLog {
 	switch a.IPType {
 	case IPTypeReal:
 		rlog.RealIP = a.With
+		rlog.RealIPHeaderUntrusted = a.With
 	case IPTypeReq:
 		rlog.ReqIP = a.With
 	case IPTypeAll:
 		rlog.ReqIP = a.With
 		rlog.RealIP = a.With
+		rlog.RealIPHeaderUntrusted = a.With
 	}
 	return rlog
 }
@@ -1,7 +1,6 @@
 package log
 
 import (
-	"bytes"
 	"net/http"
 	"time"
 )
@@ -34,13 +33,13 @@ func (h *HTTPLogger) httpInResponse(
 	req *http.Request,
 	responseHeader http.Header,
 	responseCode int,
-	responseBody *bytes.Buffer,
+	responseBody *bodyBuffer,
 	payloadLength int64,
 	requestTimestamp time.Time,
 ) error {
 	traceID, userID, clientID := parseContext(req.Context())
 
-	bodyStr := filteredBodyStrFromBuffer(responseBody, responseHeader)
+	bodyStr := filteredBodyStrFromBuffer(responseBody, responseHeader, h.maxBodySize)
 
 	level := LevelInfo
 	if responseCode >= http.StatusBadRequest {
@@ -53,12 +53,19 @@ func (l *Logger) HTTPOutRequest(
 	})
 }
 
+// HTTPOutReq logs the outgoing request with the first DefaultMaxLoggedBodySize bytes of the body
 func (l *Logger) HTTPOutReq(req *http.Request, obf map[string][]HTTPObfuscator) error {
+	return l.HTTPOutReqWithMaxBodySize(req, obf, DefaultMaxLoggedBodySize)
+}
+
+// HTTPOutReqWithMaxBodySize logs the outgoing request with the first maxBodySize bytes of the body (<= 0 logs complete bodies).
+// Truncated bodies end with "... [truncated]", only the logged part of the body is buffered.
+func (l *Logger) HTTPOutReqWithMaxBodySize(req *http.Request, obf map[string][]HTTPObfuscator, maxBodySize int) error {
 	traceID, userID, clientID := parseContext(req.Context())
 	if traceID == "" {
 		traceID = req.Header.Get(TraceIDHeaderKey)
 	}
-	bodyStr := filteredBodyStrFromReq(req)
+	bodyStr, payloadLength := filteredBodyStrFromReq(req, maxBodySize)
 
 	outLog := outRequestLog{
 		Timestamp:       time.Now(),
@@ -71,7 +78,7 @@ func (l *Logger) HTTPOutReq(req *http.Request, obf map[string][]HTTPObfuscator)
 		ReqURL:          req.URL.String(),
 		EventType:       HTTPOutRequest.String(),
 		UserID:          userID,
-		PayloadLength:   req.ContentLength,
+		PayloadLength:   payloadLength,
 		ReqBody:         bodyStr,
 		ContentType:     req.Header.Get("Content-Type"),
 		ContentEncoding: req.Header.Get("Content-Encoding"),
@@ -29,11 +29,24 @@ type outResponseLog struct {
 	TenantID string `json:"tenant-id,omitempty"`
 }
 
+// HTTPOutResponse logs the response of an outgoing request with the first DefaultMaxLoggedBodySize bytes of the body
 func (l *Logger) HTTPOutResponse(
 	req *http.Request,
 	resp *http.Response,
 	requestTimestamp time.Time,
 	obf map[string][]HTTPObfuscator,
+) error {
+	return l.HTTPOutResponseWithMaxBodySize(req, resp, requestTimestamp, obf, DefaultMaxLoggedBodySize)
+}
+
+// HTTPOutResponseWithMaxBodySize logs the response of an outgoing request with the first maxBodySize bytes of the body
+// (<= 0 logs complete bodies). Truncated bodies end with "... [truncated]", only the logged part of the body is buffered.
+func (l *Logger) HTTPOutResponseWithMaxBodySize(
+	req *http.Request,
+	resp *http.Response,
+	requestTimestamp time.Time,
+	obf map[string][]HTTPObfuscator,
+	maxBodySize int,
 ) error {
 	traceID, userID, clientID := parseContext(req.Context())
 	if traceID == "" {
@@ -44,11 +57,10 @@ func (l *Logger) HTTPOutResponse(
 	var code int
 	var cl int64
 	if resp != nil {
-		bodyStr = filteredBodyStrFromResp(resp)
+		bodyStr, cl = filteredBodyStrFromResp(resp, maxBodySize)
 		ct = resp.Header.Get("Content-Type")
 		ce = resp.Header.Get("Content-Encoding")
 		code = resp.StatusCode
-		cl = resp.ContentLength
 	}
 
 	now := time.Now()
@@ -5,8 +5,10 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"strings"
 	"testing"
 	"time"
@@ -475,3 +477,83 @@ func TestLogHTTPOutReqRespHeaderLogging(t *testing.T) {
 		}
 	})
 }
+
+func TestLogHTTPOutMaxLoggedBodySize(t *testing.T) {
+	var received string
+	srv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		body, _ := io.ReadAll(req.Body)
+		received = string(body)
+		// flushing before the end makes the response chunked, without Content-Length
+		for _, part := range strings.SplitAfter(req.URL.Query().Get("response"), "|") {
+			_, _ = rw.Write([]byte(part))
+			rw.(http.Flusher).Flush()
+		}
+	}))
+	defer srv.Close()
+
+	for _, tc := range [...]struct {
+		name               string
+		sent               string
+		body               io.Reader
+		response           string
+		wantReqBody        string
+		wantReqLength      any
+		wantResponseBody   string
+		wantResponseLength any
+	}{
+		{
+			name:               "truncated bodies",
+			sent:               strings.Repeat("q", 20),
+			body:               strings.NewReader(strings.Repeat("q", 20)),
+			response:           "rrrrrrrrrr|rrrrrrrrrr",
+			wantReqBody:        "qqqqqqqq... [truncated]",
+			wantReqLength:      float64(20),
+			wantResponseBody:   "rrrrrrrr... [truncated]",
+			wantResponseLength: nil, // the length of a chunked body is unknown when it is logged
+		},
+		{
+			name:               "chunked bodies are counted",
+			sent:               "qqq",
+			body:               io.NopCloser(strings.NewReader("qqq")),
+			response:           "rr|rrr",
+			wantReqBody:        "qqq",
+			wantReqLength:      float64(3),
+			wantResponseBody:   "rr|rrr",
+			wantResponseLength: float64(6),
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			buf := new(bytes.Buffer)
+			l := log.NewLogger("name", "version", "hostname", log.WithWriter(buf))
+			client := http.Client{Transport: transport.Log(l, transport.WithMaxLoggedBodySize(8))(nil)}
+
+			res, err := client.Post(srv.URL+"?response="+url.QueryEscape(tc.response), "text/plain", tc.body)
+			if err != nil {
+				t.Fatalf("request failed: %v", err)
+			}
+			body, _ := io.ReadAll(res.Body)
+			_ = res.Body.Close()
+
+			if string(body) != tc.response {
+				t.Errorf("client received %q, want the complete body %q", body, tc.response)
+			}
+			if received != tc.sent {
+				t.Errorf("server received %q, want the complete body %q", received, tc.sent)
+			}
+
+			requestLog, responseLog := decodeHTTPLogs(t, buf)
+			if got := requestLog["req-body"]; got != tc.wantReqBody {
+				t.Errorf("req-body = %q, want %q", got, tc.wantReqBody)
+			}
+			if got := requestLog["payload-length"]; got != tc.wantReqLength {
+				t.Errorf("request payload-length = %v, want %v", got, tc.wantReqLength)
+			}
+			if got := responseLog["response-body"]; got != tc.wantResponseBody {
+				t.Errorf("response-body = %q, want %q", got, tc.wantResponseBody)
+			}
+			if got := responseLog["payload-length"]; got != tc.wantResponseLength {
+				t.Errorf("response payload-length = %v, want %v", got, tc.wantResponseLength)
+			}
+		})
+	}
+}
@@ -1,14 +1,18 @@
 package log
 
 import (
+	"bufio"
 	"bytes"
 	"context"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
 	"regexp"
 	"strings"
 	"time"
+
+	"github.com/d4l-data4life/go-svc/pkg/compression"
 )
 
 type contextKey string
@@ -36,11 +40,47 @@ const (
 	RequestDomainContextKey contextKey = "req-domain"
 )
 
+// DefaultMaxLoggedBodySize is the amount of bytes of request and response bodies logged by default
+const DefaultMaxLoggedBodySize = 64 << 10
+
+// bodyBuffer keeps the first limit bytes written to it, a limit <= 0 keeps everything
+type bodyBuffer struct {
+	bytes.Buffer
+	limit     int
+	truncated bool
+}
+
+func (b *bodyBuffer) Write(p []byte) (int, error) {
+	n := len(p)
+	if b.limit > 0 && b.Len()+len(p) > b.limit {
+		b.truncated = true
+		p = p[:b.limit-b.Len()]
+	}
+	b.Buffer.Write(p)
+	return n, nil
+}
+
+// String returns the captured body with a truncation marker
+func (b *bodyBuffer) String() string {
+	if b.truncated {
+		return b.Buffer.String() + truncationMarker
+	}
+	return b.Buffer.String()
+}
+
+// truncationMarker is appended to truncated bodies, the original length is logged as payload-length
+const truncationMarker = "... [truncated]"
+
+// bodyExcludedStr replaces the bodies of routes excluded with WithoutBodies
+const bodyExcludedStr = "body of the route is excluded from logging"
+
+// responseWriter records the status, length and - unless body is nil - the beginning of the body of a response.
+// It keeps the Flusher, Hijacker and ReaderFrom of the wrapped writer, so streaming and websockets work behind the logger.
 type responseWriter struct {
 	http.ResponseWriter
 	statusCode    int
 	contentLength int64
-	body          *bytes.Buffer
+	body          *bodyBuffer
 }
 
 func (rw *responseWriter) WriteHeader(statusCode int) {
@@ -49,12 +89,46 @@ func (rw *responseWriter) WriteHeader(statusCode int) {
 }
 
 func (rw *responseWriter) Write(b []byte) (int, error) {
+	rw.captureEncoded()
 	n, err := rw.ResponseWriter.Write(b)
 	rw.contentLength += int64(n)
-	rw.body.Write(b)
+	if rw.body != nil {
+		_, _ = rw.body.Write(b[:n])
+	}
 	return n, err
 }
 
+// ReadFrom copies the reader to the wrapped writer, which uses sendfile for files once the body is captured completely
+func (rw *responseWriter) ReadFrom(src io.Reader) (int64, error) {
+	rw.captureEncoded()
+	if rw.body != nil && !rw.body.truncated && excludedBodyStr(rw.Header()) == "" {
+		src = io.TeeReader(src, rw.body)
+	}
+	n, err := io.Copy(rw.ResponseWriter, src)
+	rw.contentLength += n
+	return n, err
+}
+
+// captureEncoded raises the capture limit for encoded bodies, the logged limit applies to the decoded body
+func (rw *responseWriter) captureEncoded() {
+	if rw.body != nil && rw.body.Len() == 0 && compression.Supported(rw.Header().Get("Content-Encoding")) {
+		rw.body.limit = encodedBodyLimit(rw.body.limit)
+	}
+}
+
+func (rw *responseWriter) Flush() {
+	_ = http.NewResponseController(rw.ResponseWriter).Flush()
+}
+
+func (rw *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return http.NewResponseController(rw.ResponseWriter).Hijack()
+}
+
+// Unwrap allows http.ResponseController to reach further features of the wrapped writer
+func (rw *responseWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
+
 type HTTPLogger struct {
 	next http.Handler
 
@@ -67,6 +141,9 @@ type HTTPLogger struct {
 
 	obf map[string][]HTTPObfuscator
 	ipa []IPAnonymizer
+
+	maxBodySize    int
+	bodyExclusions []*regexp.Regexp
 }
 
 func ObfuscatorKey(et EventType, reqMethod string) string {
@@ -101,9 +178,13 @@ func (l HTTPLogger) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
 	req = req.WithContext(context.WithValue(req.Context(), RequestDomainContextKey, req.Host))
 
 	reqTime := time.Now()
-	_ = l.httpInRequest(req)
+	logBody := l.logsBody(req)
+	_ = l.httpInRequest(req, logBody)
 
-	recorder := responseWriter{ResponseWriter: rw, body: new(bytes.Buffer)}
+	recorder := responseWriter{ResponseWriter: rw}
+	if logBody {
+		recorder.body = &bodyBuffer{limit: l.maxBodySize}
+	}
 	l.next.ServeHTTP(&recorder, req)
 
 	if recorder.statusCode == 0 {
@@ -138,15 +219,42 @@ func WithClientIDParser(clientParser func(*http.Request) string) func(*HTTPLogge
 }
 
 // WithCallerIPParser is an option for NewHTTPLogger, that lets the caller pass a
-// function for extracting the caller IP out of the HTTP request.
+// function for extracting the caller IP out of the HTTP request, it is logged as real-ip instead of the peer address.
 func WithCallerIPParser(ipParser func(*http.Request) string) func(*HTTPLogger) {
 	return func(l *HTTPLogger) {
 		l.ipParser = ipParser
 	}
 }
 
+// WithMaxLoggedBodySize is an option for NewHTTPLogger, that limits the logged request and response bodies
+// to the given amount of bytes (defaults to DefaultMaxLoggedBodySize, <= 0 logs complete bodies).
+// Truncated bodies end with "... [truncated]", their complete length is logged as payload-length.
+// Only the logged part of the body is buffered, the rest is streamed.
+func WithMaxLoggedBodySize(size int) func(*HTTPLogger) {
+	return func(l *HTTPLogger) {
+		l.maxBodySize = size
+	}
+}
+
+// WithoutBodies is an option for NewHTTPLogger, that excludes the request and response bodies of routes
+// whose path matches one of the expressions from logging, e.g. uploads and downloads. Their bodies are not buffered.
+func WithoutBodies(routes ...*regexp.Regexp) func(*HTTPLogger) {
+	return func(l *HTTPLogger) {
+		l.bodyExclusions = append(l.bodyExclusions, routes...)
+	}
+}
+
+func (l HTTPLogger) logsBody(req *http.Request) bool {
+	for _, route := range l.bodyExclusions {
+		if route.MatchString(req.URL.Path) {
+			return false
+		}
+	}
+	return true
+}
+
 // WithTenantIDParser is an option for NewHTTPLogger, that lets the caller pass a
-// function for extracting the caller IP out of the HTTP request.
+// function for extracting the caller IP out of the HTTP request, it is logged as real-ip instead of the peer address.
 func WithTenantIDParser(tenantIDParser func(*http.Request) string) func(*HTTPLogger) {
 	return func(l *HTTPLogger) {
 		l.tenantIDParser = tenantIDParser
@@ -221,6 +329,10 @@ func (o Obfuscator) Obfuscate(log interface{}) interface{} {
 		return o.obfuscateOutRequest(l)
 	case outResponseLog:
 		return o.obfuscateOutResponse(l)
+	case grpcRequestLog:
+		return o.obfuscateGRPCRequest(l)
+	case grpcResponseLog:
+		return o.obfuscateGRPCResponse(l)
 	}
 
 	return log
@@ -256,6 +368,7 @@ func (l *Logger) WrapHTTP(h http.Handler, options ...func(*HTTPLogger)) HTTPLogg
 		tenantIDParser: func(_ *http.Request) string { return "" },
 		obf:            make(map[string][]HTTPObfuscator),
 		ipa:            make([]IPAnonymizer, 0),
+		maxBodySize:    DefaultMaxLoggedBodySize,
 	}
 
 	for _, apply := range options {
@@ -286,54 +399,134 @@ func excludedContentType(ct string) bool {
 }
 
 // excludedContentEncoding filters out content encodings that we do not want to log
-// (e.g. doesn't make much sense to log gzip'ed bodies consisting of binary data)
+// (gzip, zstd and br encoded bodies are decoded, the legacy codings are left out as binary data)
 // also see: https://developer.mozilla.org/en-US/docs/Web/HTTP/Headers/Content-Encoding
 func excludedContentEncoding(ce string) bool {
-	return ce == "gzip" || ce == "compress" || ce == "deflate" || ce == "br"
+	return ce == "compress" || ce == "deflate"
+}
+
+// encodedBodyLimit is the amount of encoded bytes read to log limit bytes of the decoded body
+func encodedBodyLimit(limit int) int {
+	if limit <= 0 {
+		return limit
+	}
+	return max(limit, DefaultMaxLoggedBodySize)
+}
+
+// decodedBodyStr decodes the encoded body, of which only the beginning is present if truncated, and keeps
+// the first limit bytes (DefaultMaxLoggedBodySize if limit <= 0), so a small body cannot blow up the log
+func decodedBodyStr(encoded []byte, truncated bool, header http.Header, limit int) string {
+	ce := header.Get("Content-Encoding")
+	if limit <= 0 {
+		limit = DefaultMaxLoggedBodySize
+	}
+
+	decoder, err := compression.NewDecoder(ce, bytes.NewReader(encoded))
+	if err != nil {
+		return fmt.Sprintf("Content-Type: %s, Content-Encoding: %s could not be decoded for logging", header.Get("Content-Type"), ce)
+	}
+	defer decoder.Close()
+
+	decoded, err := io.ReadAll(io.LimitReader(decoder, int64(limit)+1))
+	// the decoder runs out of input in the middle of a truncated body
+	if err != nil && !truncated {
+		return fmt.Sprintf("Content-Type: %s, Content-Encoding: %s could not be decoded for logging", header.Get("Content-Type"), ce)
+	}
+	if len(decoded) > limit {
+		return string(decoded[:limit]) + truncationMarker
+	}
+	if truncated {
+		return string(decoded) + truncationMarker
+	}
+	return string(decoded)
 }
 
-func filteredBodyStrFromBuffer(body *bytes.Buffer, header http.Header) string {
+func filteredBodyStrFromBuffer(body *bodyBuffer, header http.Header, limit int) string {
 	bodyStr := excludedBodyStr(header)
 	if bodyStr != "" {
 		return bodyStr
 	}
+	if body == nil {
+		return bodyExcludedStr
+	}
+	if compression.Supported(header.Get("Content-Encoding")) {
+		return decodedBodyStr(body.Bytes(), body.truncated, header, limit)
+	}
 	return body.String()
 }
 
-func filteredBodyStrFromReq(req *http.Request) string {
+// filteredBodyStrFromReq reads the first limit bytes of the request body (everything if limit <= 0)
+// and puts them back in front of the remaining body, which is left to the handler or transport.
+// It returns the logged body and the body length (see readLoggedBody).
+func filteredBodyStrFromReq(req *http.Request, limit int) (string, int64) {
 	bodyStr := excludedBodyStr(req.Header)
 	if bodyStr != "" {
-		return bodyStr
+		return bodyStr, max(req.ContentLength, 0)
 	}
 
-	if req.Body == nil {
-		return ""
+	if req.Body == nil || req.Body == http.NoBody {
+		return "", 0
 	}
 
-	bodyBytes, err := io.ReadAll(req.Body)
-	if err != nil {
-		return fmt.Sprintf("error reading body: %v", err)
-	}
-
-	req.Body = io.NopCloser(bytes.NewBuffer(bodyBytes))
-
-	return string(bodyBytes)
+	var length int64
+	bodyStr, req.Body, length = readLoggedBody(req.Body, req.Header, limit, req.ContentLength)
+	return bodyStr, length
 }
 
-func filteredBodyStrFromResp(resp *http.Response) string {
+// filteredBodyStrFromResp reads the first limit bytes of the response body (everything if limit <= 0)
+// and puts them back in front of the remaining body, which is left to the client.
+// It returns the logged body and the body length (see readLoggedBody).
+func filteredBodyStrFromResp(resp *http.Response, limit int) (string, int64) {
 	bodyStr := excludedBodyStr(resp.Header)
 	if bodyStr != "" {
-		return bodyStr
+		return bodyStr, max(resp.ContentLength, 0)
 	}
 
-	bodyBytes, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return fmt.Sprintf("error reading body: %v", err)
+	if resp.Body == nil || resp.Body == http.NoBody {
+		return "", 0
 	}
 
-	resp.Body = io.NopCloser(bytes.NewBuffer(bodyBytes))
+	var length int64
+	bodyStr, resp.Body, length = readLoggedBody(resp.Body, resp.Header, limit, resp.ContentLength)
+	return bodyStr, length
+}
+
+// readLoggedBody reads the first limit bytes of the body (everything if limit <= 0) and returns the logged body,
+// the body to put in place, which yields the read bytes in front of the remaining body, and the body length.
+// The length is the amount of bytes read if the whole body was read, otherwise the content length (0 if unknown).
+func readLoggedBody(body io.ReadCloser, header http.Header, limit int, contentLength int64) (string, io.ReadCloser, int64) {
+	encoded := compression.Supported(header.Get("Content-Encoding"))
+	readLimit := limit
+	if encoded && limit > 0 {
+		readLimit = encodedBodyLimit(limit)
+	}
 
-	return string(bodyBytes)
+	reader := io.Reader(body)
+	if limit > 0 {
+		reader = io.LimitReader(body, int64(readLimit)+1)
+	}
+	prefix, err := io.ReadAll(reader)
+	if err != nil {
+		return fmt.Sprintf("error reading body: %v", err), body, max(contentLength, 0)
+	}
+	rest := struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(prefix), body), body}
+
+	length := int64(len(prefix))
+	truncated := limit > 0 && len(prefix) > readLimit
+	if truncated {
+		prefix = prefix[:readLimit]
+		length = max(contentLength, 0)
+	}
+	if encoded {
+		return decodedBodyStr(prefix, truncated, header, limit), rest, length
+	}
+	if truncated {
+		return string(prefix) + truncationMarker, rest, length
+	}
+	return string(prefix), rest, length
 }
 
 func excludedBodyStr(header http.Header) string {
@@ -5,6 +5,7 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
@@ -14,6 +15,7 @@ import (
 
 	"github.com/gofrs/uuid"
 
+	"github.com/d4l-data4life/go-svc/pkg/compression"
 	"github.com/d4l-data4life/go-svc/pkg/log"
 )
 
@@ -336,6 +338,10 @@ func TestHTTPWrapper(t *testing.T) {
 			},
 			{
 				key:   "real-ip",
+				value: `"127.0.0.1"`,
+			},
+			{
+				key:   "real-ip-header-untrusted",
 				value: `"10.0.0.2"`,
 			},
 			{
@@ -721,7 +727,7 @@ func TestFilteredContentType(t *testing.T) {
 			},
 			{
 				key:   "req-body",
-				value: `"Content-Type: application/json, Content-Encoding: gzip is excluded from logging"`, // hello world
+				value: `"Content-Type: application/json, Content-Encoding: gzip could not be decoded for logging"`, // hello world, but not gzipped
 			},
 			{
 				key: "req-form",
@@ -735,6 +741,10 @@ func TestFilteredContentType(t *testing.T) {
 			},
 			{
 				key:   "real-ip",
+				value: `"127.0.0.1"`,
+			},
+			{
+				key:   "real-ip-header-untrusted",
 				value: `"10.0.0.2"`,
 			},
 			{
@@ -1282,3 +1292,227 @@ func TestAnonymizeIP(t *testing.T) {
 		}
 	})
 }
+
+func decodeHTTPLogs(t *testing.T, buf *bytes.Buffer) (map[string]any, map[string]any) {
+	t.Helper()
+	logs := json.NewDecoder(buf)
+	requestLog, responseLog := map[string]any{}, map[string]any{}
+	if err := logs.Decode(&requestLog); err != nil {
+		t.Fatalf("unmarshaling the request log: %v", err)
+	}
+	if err := logs.Decode(&responseLog); err != nil {
+		t.Fatalf("unmarshaling the response log: %v", err)
+	}
+	return requestLog, responseLog
+}
+
+func TestMaxLoggedBodySize(t *testing.T) {
+	buf := new(bytes.Buffer)
+	l := log.NewLogger("name", "version", "hostname", log.WithWriter(buf))
+
+	var received string
+	handler := l.WrapHTTP(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, _ := io.ReadAll(req.Body)
+		received = string(body)
+		_, _ = io.Copy(w, strings.NewReader(strings.Repeat("r", 20)))
+	}), log.WithMaxLoggedBodySize(8))
+
+	req := httptest.NewRequest(http.MethodPost, "/upload", strings.NewReader(strings.Repeat("q", 20)))
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	if received != strings.Repeat("q", 20) {
+		t.Errorf("handler received %q, want the complete body", received)
+	}
+
+	requestLog, responseLog := decodeHTTPLogs(t, buf)
+	if got, want := requestLog["req-body"], "qqqqqqqq... [truncated]"; got != want {
+		t.Errorf("req-body = %q, want %q", got, want)
+	}
+	if got, want := requestLog["payload-length"], float64(20); got != want {
+		t.Errorf("request payload-length = %v, want %v", got, want)
+	}
+	if got, want := responseLog["response-body"], "rrrrrrrr... [truncated]"; got != want {
+		t.Errorf("response-body = %q, want %q", got, want)
+	}
+	if got, want := responseLog["payload-length"], float64(20); got != want {
+		t.Errorf("response payload-length = %v, want %v", got, want)
+	}
+}
+
+func TestWithoutBodies(t *testing.T) {
+	buf := new(bytes.Buffer)
+	l := log.NewLogger("name", "version", "hostname", log.WithWriter(buf))
+
+	handler := l.WrapHTTP(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		_, _ = io.Copy(w, req.Body)
+	}), log.WithoutBodies(regexp.MustCompile(`^/files/`)))
+
+	res := httptest.NewRecorder()
+	handler.ServeHTTP(res, httptest.NewRequest(http.MethodPut, "/files/1", strings.NewReader("content")))
+	if res.Body.String() != "content" {
+		t.Errorf("response body = %q, want %q", res.Body.String(), "content")
+	}
+
+	requestLog, responseLog := decodeHTTPLogs(t, buf)
+	if requestLog["req-body"] == "content" {
+		t.Errorf("request body of excluded route was logged")
+	}
+	if responseLog["response-body"] == "content" {
+		t.Errorf("response body of excluded route was logged")
+	}
+	if got, want := responseLog["payload-length"], float64(7); got != want {
+		t.Errorf("response payload-length = %v, want %v", got, want)
+	}
+}
+
+func TestHTTPLoggerResponseWriterFeatures(t *testing.T) {
+	l := log.NewLogger("name", "version", "hostname", log.WithWriter(io.Discard))
+
+	handler := l.WrapHTTP(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if _, ok := w.(io.ReaderFrom); !ok {
+			t.Errorf("response writer does not implement io.ReaderFrom")
+		}
+		if _, ok := w.(http.Flusher); !ok {
+			t.Errorf("response writer does not implement http.Flusher")
+		}
+		hijacker, ok := w.(http.Hijacker)
+		if !ok {
+			t.Fatalf("response writer does not implement http.Hijacker")
+		}
+		conn, rw, err := hijacker.Hijack()
+		if err != nil {
+			t.Errorf("hijacking failed: %v", err)
+			return
+		}
+		defer conn.Close()
+		_, _ = rw.WriteString("HTTP/1.1 200 OK\r\nContent-Length: 8\r\nConnection: close\r\n\r\nhijacked")
+		_ = rw.Flush()
+	}))
+
+	srv := httptest.NewServer(handler)
+	defer srv.Close()
+
+	res, err := srv.Client().Get(srv.URL)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	defer res.Body.Close()
+	body, _ := io.ReadAll(res.Body)
+	if string(body) != "hijacked" {
+		t.Errorf("body = %q, want %q", body, "hijacked")
+	}
+}
+
+func encode(t *testing.T, encoding, body string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	encoder, err := compression.NewEncoder(encoding, &buf)
+	if err != nil {
+		t.Fatalf("creating %s encoder: %v", encoding, err)
+	}
+	_, _ = encoder.Write([]byte(body))
+	if err := encoder.Close(); err != nil {
+		t.Fatalf("encoding %s: %v", encoding, err)
+	}
+	return buf.Bytes()
+}
+
+func TestDecodedBodies(t *testing.T) {
+	buf := new(bytes.Buffer)
+	l := log.NewLogger("name", "version", "hostname", log.WithWriter(buf))
+
+	handler := l.WrapHTTP(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		_, _ = io.Copy(io.Discard, req.Body)
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-Encoding", compression.Zstd)
+		_, _ = w.Write(encode(t, compression.Zstd, `{"id":1}`))
+	}))
+
+	req := httptest.NewRequest(http.MethodPost, "/records", bytes.NewReader(encode(t, compression.Gzip, `{"name":"a"}`)))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Content-Encoding", compression.Gzip)
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	requestLog, responseLog := decodeHTTPLogs(t, buf)
+	if got, want := requestLog["req-body"], `{"name":"a"}`; got != want {
+		t.Errorf("req-body = %q, want %q", got, want)
+	}
+	if got, want := responseLog["response-body"], `{"id":1}`; got != want {
+		t.Errorf("response-body = %q, want %q", got, want)
+	}
+}
+
+func TestDecodedBodiesLimit(t *testing.T) {
+	buf := new(bytes.Buffer)
+	l := log.NewLogger("name", "version", "hostname", log.WithWriter(buf))
+
+	// a few bytes decode to a megabyte, only the limit is logged
+	bomb := encode(t, compression.Brotli, strings.Repeat("b", 1<<20))
+	handler := l.WrapHTTP(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		w.Header().Set("Content-Encoding", compression.Brotli)
+		_, _ = w.Write(bomb)
+	}), log.WithMaxLoggedBodySize(8))
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/bomb", nil))
+
+	_, responseLog := decodeHTTPLogs(t, buf)
+	if got, want := responseLog["response-body"], "bbbbbbbb... [truncated]"; got != want {
+		t.Errorf("response-body = %q, want %q", got, want)
+	}
+}
+
+func TestRealIPFromCallerIP(t *testing.T) {
+	buf := new(bytes.Buffer)
+	l := log.NewLogger("name", "version", "hostname", log.WithWriter(buf))
+	handler := l.WrapHTTP(
+		http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}),
+		log.WithCallerIPParser(func(*http.Request) string { return "203.0.113.7" }),
+	)
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("X-Real-Ip", "10.0.0.2")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	requestLog, _ := decodeHTTPLogs(t, buf)
+	if got, want := requestLog["real-ip"], "203.0.113.7"; got != want {
+		t.Errorf("real-ip = %q, want %q", got, want)
+	}
+}
+
+func TestRealIPFromPeer(t *testing.T) {
+	buf := new(bytes.Buffer)
+	l := log.NewLogger("name", "version", "hostname", log.WithWriter(buf))
+	handler := l.WrapHTTP(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.RemoteAddr = "198.51.100.4:43210"
+	req.Header.Set("X-Real-Ip", "10.0.0.2")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	requestLog, _ := decodeHTTPLogs(t, buf)
+	if got, want := requestLog["real-ip"], "198.51.100.4"; got != want {
+		t.Errorf("real-ip = %q, want the peer %q", got, want)
+	}
+	if got, want := requestLog["real-ip-header-untrusted"], "10.0.0.2"; got != want {
+		t.Errorf("real-ip-header-untrusted = %q, want %q", got, want)
+	}
+
+	t.Run("obfuscated", func(t *testing.T) {
+		buf := new(bytes.Buffer)
+		l := log.NewLogger("name", "version", "hostname", log.WithWriter(buf))
+		handler := l.WrapHTTP(
+			http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}),
+			log.WithObfuscators(log.IPObfuscator{EventType: log.HTTPInRequest, ReqMethod: http.MethodGet}),
+		)
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+
+		requestLog, _ := decodeHTTPLogs(t, buf)
+		if got, want := requestLog["real-ip"], "198.51.xxx.xxx"; got != want {
+			t.Errorf("real-ip = %q, want %q", got, want)
+		}
+		if got, want := requestLog["real-ip-header-untrusted"], "10.0.xxx.xxx"; got != want {
+			t.Errorf("real-ip-header-untrusted = %q, want %q", got, want)
+		}
+	})
+}
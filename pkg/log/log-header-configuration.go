@@ -1,5 +1,7 @@
 package log
 
+import "net/http"
+
 var defaultObfuscationHeaders = []string{"Authorization", "WWW-Authenticate"}
 var defaultIgnoreHeaders = []string{
 	"X-Real-Ip",
@@ -32,3 +34,14 @@ var hlcOutRequest = newHeaderObfuscator().
 var hlcOutResponse = newHeaderObfuscator().
 	obfuscateHeaders(defaultObfuscationHeaders).
 	ignoreHeaders(defaultIgnoreHeaders)
+
+// hlcRedact only obfuscates sensitive headers and keeps all others,
+// it is used where headers have to be stored outside of the log stream
+var hlcRedact = newHeaderObfuscator().
+	obfuscateHeaders(defaultObfuscationHeaders)
+
+// RedactHeaders returns a copy of the header in which sensitive values (e.g. `Authorization`, cookies)
+// are obfuscated with the same rules as in the HTTP logs. Other headers are kept unchanged.
+func RedactHeaders(header http.Header) http.Header {
+	return hlcRedact.processHeaders(header)
+}
@@ -233,3 +233,24 @@ func Test_headerObfuscator_ProcessHeaders(t *testing.T) {
 		})
 	}
 }
+
+func TestRedactHeaders(t *testing.T) {
+	header := http.Header{
+		"Authorization": []string{"Bearer secret"},
+		"Content-Type":  []string{"application/json"},
+		"Cookie":        []string{"session=abc"},
+	}
+
+	got := RedactHeaders(header)
+	want := http.Header{
+		"Authorization": []string{"Obfuscated{13}"},
+		"Content-Type":  []string{"application/json"},
+		"Cookie":        []string{"session=Obfuscated{3};"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("RedactHeaders() = %v, want %v", got, want)
+	}
+	if header.Get("Authorization") != "Bearer secret" {
+		t.Errorf("RedactHeaders() modified the passed header")
+	}
+}
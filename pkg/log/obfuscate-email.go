@@ -32,6 +32,13 @@ func (mo MailObfuscator) Obfuscate(log interface{}) interface{} {
 	case inResponseLog:
 		l.ResponseBody = ObfuscateEmail(l.ResponseBody)
 		return l
+	case grpcRequestLog:
+		l.ReqBody = ObfuscateEmail(l.ReqBody)
+		return l
+	case grpcResponseLog:
+		l.ResponseBody = ObfuscateEmail(l.ResponseBody)
+		l.ResponseError = ObfuscateEmail(l.ResponseError)
+		return l
 	}
 
 	return log
@@ -30,6 +30,10 @@ func (ipo IPObfuscator) Obfuscate(log interface{}) interface{} {
 	switch l := log.(type) {
 	case inRequestLog:
 		l.RealIP = ObfuscateIP(l.RealIP)
+		l.RealIPHeaderUntrusted = ObfuscateIP(l.RealIPHeaderUntrusted)
+		return l
+	case grpcRequestLog:
+		l.ReqIP = ObfuscateIP(l.ReqIP)
 		return l
 	default:
 		return log
@@ -3,6 +3,7 @@ package middlewares
 import (
 	"crypto/subtle"
 	"errors"
+	"fmt"
 	"net/http"
 	"strings"
 
@@ -20,11 +21,14 @@ const (
 type Auth struct {
 	*instrumented.Handler
 	serviceSecret            string
+	secrets                  *SecretSet
+	metrics                  *prom.ServiceSecretInstrumenter
 	instrumentLatencyBuckets []float64
 	instrumentSizeBuckets    []float64
 }
 
-// NewAuthentication initializes the auth middleware using JWT pub keys from ViperConfig
+// NewAuthentication initializes the service secret auth middleware, use AuthWithSecrets to accept several secrets.
+// User tokens are validated by JWTAuthenticator.
 func NewAuthentication(serviceSecret string, handlerFactory *instrumented.HandlerFactory, opts ...AuthOption) *Auth {
 	auth := &Auth{
 		serviceSecret:            serviceSecret,
@@ -35,6 +39,9 @@ func NewAuthentication(serviceSecret string, handlerFactory *instrumented.Handle
 	for _, opt := range opts {
 		opt(auth)
 	}
+	if auth.metrics == nil {
+		auth.metrics = prom.NewServiceSecretInstrumenter()
+	}
 
 	auth.Handler = handlerFactory.NewHandler("auth",
 		prom.WithLatencyBuckets(auth.instrumentLatencyBuckets),
@@ -60,24 +67,55 @@ func AuthWithSizeBuckets(sizeBuckets []float64) AuthOption {
 	}
 }
 
-// ServiceSecret is a middleware protecting routes with a service secret
+// AuthWithSecrets accepts all secrets of the set instead of the single service secret
+func AuthWithSecrets(secrets *SecretSet) AuthOption {
+	return func(a *Auth) {
+		a.secrets = secrets
+	}
+}
+
+// AuthWithInitOptions changes the subsystem of the service secret metrics, which are shared with ServiceSecretAuthenticator
+func AuthWithInitOptions(options ...prom.InitOption) AuthOption {
+	return func(a *Auth) {
+		a.metrics = prom.NewServiceSecretInstrumenter(options...)
+	}
+}
+
+// ServiceSecret is a middleware protecting routes with a service secret.
+// The key ID of the matched secret is counted like by ServiceSecretAuthenticator, so unused secrets can be retired.
 func (auth *Auth) ServiceSecret(next http.Handler) http.Handler {
 	handlerFunc := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		authToken, err := auth.getAuthSecret(r)
 		if err != nil {
-			WriteHTTPErrorCode(w, err, http.StatusUnauthorized)
+			auth.metrics.Failure("missing")
+			WriteProblem(w, r, err)
 			return
 		}
-		if subtle.ConstantTimeCompare([]byte(authToken), []byte(auth.serviceSecret)) == 0 {
+		keyID, ok := auth.match(authToken)
+		if !ok {
 			// If it is service based authentication authToken should be the appSecret
-			http.Error(w, "invalid Authorization header", http.StatusUnauthorized)
+			auth.metrics.Failure("invalid")
+			WriteProblem(w, r, ErrInvalidSecret)
 			return
 		}
+		logging.LogDebugfCtx(r.Context(), "service secret with key ID %s matched", keyID)
+		auth.metrics.Success(keyID)
 		next.ServeHTTP(w, r)
 	})
 	return auth.Instrumenter().Instrument("auth", handlerFunc)
 }
 
+// match compares the token in constant time with the secret set or, if none is configured, the service secret
+func (auth *Auth) match(authToken string) (string, bool) {
+	if auth.secrets != nil {
+		return auth.secrets.Match(authToken)
+	}
+	if subtle.ConstantTimeCompare([]byte(authToken), []byte(auth.serviceSecret)) == 1 {
+		return DefaultKeyID, true
+	}
+	return "", false
+}
+
 // getAuthSecret returns the contents of the authorization header
 func (auth *Auth) getAuthSecret(r *http.Request) (string, error) {
 	authHeaderContent := r.Header.Get(AuthHeaderName)
@@ -88,7 +126,7 @@ func (auth *Auth) getAuthSecret(r *http.Request) (string, error) {
 	}
 
 	if authHeaderContent == "" {
-		err := errors.New("missing authentication header")
+		err := fmt.Errorf("missing authentication header: %w", ErrNoSecretInRequest)
 		logging.LogErrorfCtx(r.Context(), err, "error in secret-based authorization")
 		return "", err
 	}
@@ -6,7 +6,9 @@ import (
 	"testing"
 
 	"github.com/d4l-data4life/go-svc/pkg/instrumented"
+	"github.com/d4l-data4life/go-svc/pkg/prom"
 
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -26,11 +28,14 @@ func TestServiceSecret(t *testing.T) {
 	}{
 		{"valid Service Auth", validAuthHeader, http.StatusOK},
 		{"invalid Service Auth", "random", http.StatusUnauthorized},
+		{"missing Service Auth", "", http.StatusUnauthorized},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			req, _ := http.NewRequest(http.MethodGet, "/route", nil)
-			req.Header.Add(AuthHeaderName, tt.AuthHeaderContent)
+			if tt.AuthHeaderContent != "" {
+				req.Header.Add(AuthHeaderName, tt.AuthHeaderContent)
+			}
 			res := httptest.NewRecorder()
 
 			// target handler after auth check
@@ -42,6 +47,63 @@ func TestServiceSecret(t *testing.T) {
 	}
 }
 
+func TestServiceSecretWithSecrets(t *testing.T) {
+	handlerFactory := instrumented.NewHandlerFactory(
+		"d4l",
+		instrumented.DefaultInstrumentInitOptions,
+		instrumented.DefaultInstrumentOptions,
+	)
+	secrets, err := NewSecretSet(StaticSecrets(map[string]string{"current": "new-secret", "previous": "old-secret"}))
+	assert.NoError(t, err)
+	auth := NewAuthentication("", handlerFactory, AuthWithSecrets(secrets))
+
+	tests := []struct {
+		name              string
+		AuthHeaderContent string
+		expectedStatus    int
+	}{
+		{"current secret", "new-secret", http.StatusOK},
+		{"previous secret", "old-secret", http.StatusOK},
+		{"invalid secret", "random", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest(http.MethodGet, "/route", nil)
+			req.Header.Add(AuthHeaderName, tt.AuthHeaderContent)
+			res := httptest.NewRecorder()
+
+			handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+			auth.ServiceSecret(handler).ServeHTTP(res, req)
+			assert.Equal(t, tt.expectedStatus, res.Code)
+		})
+	}
+}
+
+func TestServiceSecretMetrics(t *testing.T) {
+	handlerFactory := instrumented.NewHandlerFactory(
+		"d4l",
+		instrumented.DefaultInstrumentInitOptions,
+		instrumented.DefaultInstrumentOptions,
+	)
+	secrets, err := NewSecretSet(StaticSecrets(map[string]string{"current": "new-secret", "previous": "old-secret"}))
+	assert.NoError(t, err)
+	auth := NewAuthentication("", handlerFactory, AuthWithSecrets(secrets), AuthWithInitOptions(prom.WithSubsystem("auth_rotation")))
+
+	handler := auth.ServiceSecret(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	for _, header := range []string{"new-secret", "old-secret", "old-secret", "random", ""} {
+		req, _ := http.NewRequest(http.MethodGet, "/route", nil)
+		req.Header.Add(AuthHeaderName, header)
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	res := httptest.NewRecorder()
+	promhttp.Handler().ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	assert.Contains(t, res.Body.String(), `d4l_auth_rotation_service_secret_authentications_total{key_id="current"} 1`)
+	assert.Contains(t, res.Body.String(), `d4l_auth_rotation_service_secret_authentications_total{key_id="previous"} 2`)
+	assert.Contains(t, res.Body.String(), `d4l_auth_rotation_service_secret_failures_total{reason="invalid"} 1`)
+	assert.Contains(t, res.Body.String(), `d4l_auth_rotation_service_secret_failures_total{reason="missing"} 1`)
+}
+
 func TestGetAuthSecret(t *testing.T) {
 	tests := []struct {
 		name              string
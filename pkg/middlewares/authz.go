@@ -0,0 +1,190 @@
+package middlewares
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/d4l-data4life/go-svc/pkg/log"
+	"github.com/d4l-data4life/go-svc/pkg/logging"
+)
+
+// ErrForbidden happens when an authenticated caller lacks the scopes or roles required by a policy
+var ErrForbidden = errors.New("forbidden")
+
+type authzContextKey string
+
+// Context keys holding the granted permissions ([]string) of the caller, set by authenticators like JWTAuthenticator
+const (
+	ScopesContextKey authzContextKey = "scopes"
+	RolesContextKey  authzContextKey = "roles"
+)
+
+// SecurityEventAuthorization is the security event of audit logs written for denied requests
+const SecurityEventAuthorization = "authorization"
+
+// WithScopes stores the granted scopes of the caller in the context
+func WithScopes(ctx context.Context, scopes ...string) context.Context {
+	return context.WithValue(ctx, ScopesContextKey, scopes)
+}
+
+// WithRoles stores the granted roles of the caller in the context
+func WithRoles(ctx context.Context, roles ...string) context.Context {
+	return context.WithValue(ctx, RolesContextKey, roles)
+}
+
+// ScopesFromContext returns the granted scopes of the caller
+func ScopesFromContext(ctx context.Context) []string {
+	scopes, _ := ctx.Value(ScopesContextKey).([]string)
+	return scopes
+}
+
+// RolesFromContext returns the granted roles of the caller
+func RolesFromContext(ctx context.Context) []string {
+	roles, _ := ctx.Value(RolesContextKey).([]string)
+	return roles
+}
+
+// Policy is a declarative permission check, create it with RequireScopes or RequireAnyRole
+type Policy struct {
+	allScopes []string
+	anyRoles  []string
+}
+
+// RequireScopes creates a policy granting access if the caller has all of the given scopes
+func RequireScopes(scopes ...string) Policy {
+	return Policy{allScopes: scopes}
+}
+
+// RequireAnyRole creates a policy granting access if the caller has at least one of the given roles
+func RequireAnyRole(roles ...string) Policy {
+	return Policy{anyRoles: roles}
+}
+
+// Missing returns the permissions the caller in the context lacks, or nil if the policy is fulfilled
+func (p Policy) Missing(ctx context.Context) *MissingPermissions {
+	var missing MissingPermissions
+
+	granted := ScopesFromContext(ctx)
+	for _, scope := range p.allScopes {
+		if !slices.Contains(granted, scope) {
+			missing.Scopes = append(missing.Scopes, scope)
+		}
+	}
+
+	if len(p.anyRoles) > 0 {
+		roles := RolesFromContext(ctx)
+		hasRole := false
+		for _, role := range p.anyRoles {
+			if slices.Contains(roles, role) {
+				hasRole = true
+				break
+			}
+		}
+		if !hasRole {
+			missing.AnyRoles = slices.Clone(p.anyRoles)
+		}
+	}
+
+	if len(missing.Scopes) == 0 && len(missing.AnyRoles) == 0 {
+		return nil
+	}
+	return &missing
+}
+
+// MissingPermissions lists what a caller lacks to fulfill a policy, it is logged as additional data of denials
+type MissingPermissions struct {
+	Scopes   []string `json:"missing-scopes,omitempty"`
+	AnyRoles []string `json:"missing-any-role,omitempty"`
+}
+
+func (m *MissingPermissions) merge(other *MissingPermissions) {
+	m.Scopes = append(m.Scopes, other.Scopes...)
+	m.AnyRoles = append(m.AnyRoles, other.AnyRoles...)
+}
+
+func (m *MissingPermissions) String() string {
+	var parts []string
+	if len(m.Scopes) > 0 {
+		parts = append(parts, "scopes "+strings.Join(m.Scopes, ", "))
+	}
+	if len(m.AnyRoles) > 0 {
+		parts = append(parts, "any role of "+strings.Join(m.AnyRoles, ", "))
+	}
+	return "missing " + strings.Join(parts, " and ")
+}
+
+// Authorizer enforces policies on requests of authenticated callers
+type Authorizer struct {
+	logger *log.Logger
+}
+
+// AuthorizerOption is to be implemented by functional options
+type AuthorizerOption func(*Authorizer)
+
+// AuthorizerWithLogger sets the logger used for audit logs of denied requests (defaults to the logging singleton)
+func AuthorizerWithLogger(logger *log.Logger) AuthorizerOption {
+	return func(a *Authorizer) {
+		a.logger = logger
+	}
+}
+
+// NewAuthorizer creates an authorizer, the permissions of callers are read from ScopesContextKey and RolesContextKey
+func NewAuthorizer(options ...AuthorizerOption) *Authorizer {
+	a := &Authorizer{}
+	for _, apply := range options {
+		apply(a)
+	}
+	if a.logger == nil {
+		a.logger = logging.Logger()
+	}
+	return a
+}
+
+// Check verifies that the caller in the context fulfills all policies.
+// Denials are audit logged with the missing permissions and returned as ErrForbidden.
+func (a *Authorizer) Check(ctx context.Context, policies ...Policy) error {
+	var missing *MissingPermissions
+	for _, p := range policies {
+		m := p.Missing(ctx)
+		if m == nil {
+			continue
+		}
+		if missing == nil {
+			missing = m
+			continue
+		}
+		missing.merge(m)
+	}
+	if missing == nil {
+		return nil
+	}
+
+	_ = a.logger.AuditSecurityFailure(ctx, SecurityEventAuthorization,
+		log.Message(missing.String()),
+		log.AdditionalData(missing),
+	)
+	return fmt.Errorf("%w: %s", ErrForbidden, missing)
+}
+
+// Require is the decorator that protects a handler with the given policies, denied requests are answered with 403.
+//
+//	r.With(authorizer.Require(middlewares.RequireScopes("records:read"))).Get("/records", listRecords)
+func (a *Authorizer) Require(policies ...Policy) func(http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			ctx := context.WithValue(req.Context(), log.RequestURLContextKey, req.URL.Path)
+			ctx = context.WithValue(ctx, log.RequestDomainContextKey, req.Host)
+
+			if err := a.Check(ctx, policies...); err != nil {
+				WriteProblem(w, req, err)
+				return
+			}
+
+			h.ServeHTTP(w, req)
+		})
+	}
+}
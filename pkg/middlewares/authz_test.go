@@ -0,0 +1,103 @@
+package middlewares_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/d4l-data4life/go-svc/pkg/log"
+	"github.com/d4l-data4life/go-svc/pkg/middlewares"
+	"github.com/d4l-data4life/go-svc/pkg/problem"
+)
+
+func TestAuthorizerRequire(t *testing.T) {
+	buf := new(bytes.Buffer)
+	logger := log.NewLogger("test", "v0", "localhost", log.WithWriter(buf))
+	authorizer := middlewares.NewAuthorizer(middlewares.AuthorizerWithLogger(logger))
+
+	tests := []struct {
+		name        string
+		policies    []middlewares.Policy
+		ctx         context.Context
+		wantStatus  int
+		wantMissing map[string]any
+	}{
+		{
+			name:       "all scopes granted",
+			policies:   []middlewares.Policy{middlewares.RequireScopes("records:read", "records:write")},
+			ctx:        middlewares.WithScopes(context.Background(), "records:write", "records:read", "users:read"),
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:        "scope missing",
+			policies:    []middlewares.Policy{middlewares.RequireScopes("records:read", "records:write")},
+			ctx:         middlewares.WithScopes(context.Background(), "records:read"),
+			wantStatus:  http.StatusForbidden,
+			wantMissing: map[string]any{"missing-scopes": []any{"records:write"}},
+		},
+		{
+			name:       "one of the roles granted",
+			policies:   []middlewares.Policy{middlewares.RequireAnyRole("admin", "support")},
+			ctx:        middlewares.WithRoles(context.Background(), "support"),
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:        "no permissions in context",
+			policies:    []middlewares.Policy{middlewares.RequireAnyRole("admin", "support")},
+			ctx:         context.Background(),
+			wantStatus:  http.StatusForbidden,
+			wantMissing: map[string]any{"missing-any-role": []any{"admin", "support"}},
+		},
+		{
+			name: "all policies must be fulfilled",
+			policies: []middlewares.Policy{
+				middlewares.RequireScopes("records:read"),
+				middlewares.RequireAnyRole("admin"),
+			},
+			ctx:         middlewares.WithRoles(middlewares.WithScopes(context.Background(), "records:read"), "user"),
+			wantStatus:  http.StatusForbidden,
+			wantMissing: map[string]any{"missing-any-role": []any{"admin"}},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			buf.Reset()
+
+			handler := authorizer.Require(tc.policies...)(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {}))
+			req := httptest.NewRequest(http.MethodGet, "/records", nil).WithContext(tc.ctx)
+			res := httptest.NewRecorder()
+			handler.ServeHTTP(res, req)
+
+			require.Equal(t, tc.wantStatus, res.Code)
+			if tc.wantStatus == http.StatusOK {
+				assert.Empty(t, buf.String())
+				return
+			}
+
+			assert.Equal(t, problem.ContentType, res.Header().Get("Content-Type"))
+			assert.Contains(t, res.Body.String(), `"type":"urn:d4l:problem:forbidden"`)
+			auditLog := map[string]any{}
+			require.NoError(t, json.Unmarshal(buf.Bytes(), &auditLog))
+			assert.Equal(t, middlewares.SecurityEventAuthorization, auditLog["security-event"])
+			assert.Equal(t, false, auditLog["successful"])
+			assert.Equal(t, "/records", auditLog["req-url"])
+			assert.Equal(t, tc.wantMissing, auditLog["additional-data"])
+		})
+	}
+}
+
+func TestAuthorizerCheck(t *testing.T) {
+	logger := log.NewLogger("test", "v0", "localhost", log.WithWriter(new(bytes.Buffer)))
+	authorizer := middlewares.NewAuthorizer(middlewares.AuthorizerWithLogger(logger))
+
+	err := authorizer.Check(context.Background(), middlewares.RequireScopes("records:read"))
+	assert.ErrorIs(t, err, middlewares.ErrForbidden)
+	assert.EqualError(t, err, "forbidden: missing scopes records:read")
+}
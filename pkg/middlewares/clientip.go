@@ -0,0 +1,171 @@
+package middlewares
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+
+	"github.com/d4l-data4life/go-svc/pkg/log"
+)
+
+// ParseCIDRs parses CIDR ranges like 10.0.0.0/8 or 2001:db8::/32, single addresses are parsed as /32 or /128 ranges
+func ParseCIDRs(cidrs ...string) ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		cidr = strings.TrimSpace(cidr)
+		if cidr == "" {
+			continue
+		}
+		if !strings.Contains(cidr, "/") {
+			addr, err := netip.ParseAddr(cidr)
+			if err != nil {
+				return nil, fmt.Errorf("parsing CIDR %q: %w", cidr, err)
+			}
+			prefixes = append(prefixes, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("parsing CIDR %q: %w", cidr, err)
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, nil
+}
+
+type clientIPContextKey string
+
+// resolvedClientIPContextKey keeps the address resolved by ClientIP apart from log.CallerIPContextKey,
+// which HTTPLogger sets from its caller IP parser
+const resolvedClientIPContextKey clientIPContextKey = "client-ip"
+
+type clientIP struct {
+	header string
+}
+
+// ClientIPOption is to be implemented by functional options
+type ClientIPOption func(*clientIP)
+
+// ClientIPWithHeader sets the header the trusted proxies append the client address to (defaults to X-Forwarded-For).
+// Forwarded is parsed as RFC 7239, other headers as comma-separated list of addresses like X-Forwarded-For or X-Real-Ip.
+func ClientIPWithHeader(name string) ClientIPOption {
+	return func(c *clientIP) {
+		c.header = http.CanonicalHeaderKey(name)
+	}
+}
+
+// ClientIP is the decorator resolving the address of the client and storing it in log.CallerIPContextKey,
+// where HTTPLogger, audit logs and RateLimiter pick it up, and for IPAllowList.
+// Only the configured header is read and only if the peer is one of the trusted proxies, so the proxies have to
+// set or append to it. The client is the rightmost forwarded address which is not a trusted proxy itself,
+// so clients can't spoof it. Without trusted proxies the client is always the peer.
+func ClientIP(trustedProxies []netip.Prefix, options ...ClientIPOption) func(http.Handler) http.Handler {
+	c := &clientIP{header: "X-Forwarded-For"}
+	for _, apply := range options {
+		apply(c)
+	}
+
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if addr, ok := c.clientAddr(r, trustedProxies); ok {
+				ctx := context.WithValue(r.Context(), log.CallerIPContextKey, addr.String())
+				r = r.WithContext(context.WithValue(ctx, resolvedClientIPContextKey, addr))
+			}
+			h.ServeHTTP(w, r)
+		})
+	}
+}
+
+// CallerIP returns the client address resolved by ClientIP, else the peer address of the request.
+// log.CallerIPContextKey is ignored, since the caller IP parser of HTTPLogger may read it from any header.
+func CallerIP(r *http.Request) string {
+	if addr, ok := r.Context().Value(resolvedClientIPContextKey).(netip.Addr); ok {
+		return addr.String()
+	}
+	if addr, ok := peerAddr(r); ok {
+		return addr.String()
+	}
+	return ""
+}
+
+func (c *clientIP) clientAddr(r *http.Request, trustedProxies []netip.Prefix) (netip.Addr, bool) {
+	client, ok := peerAddr(r)
+	if !ok || !containsAddr(trustedProxies, client) {
+		return client, ok
+	}
+
+	var forwarded []string
+	if c.header == "Forwarded" {
+		forwarded = forwardedFor(r.Header.Values("Forwarded"))
+	} else {
+		for _, value := range r.Header.Values(c.header) {
+			forwarded = append(forwarded, strings.Split(value, ",")...)
+		}
+	}
+
+	// walk from the nearest hop towards the client, unparsable hops like "unknown" end the trusted chain
+	for i := len(forwarded) - 1; i >= 0; i-- {
+		addr, ok := parseForwardedAddr(forwarded[i])
+		if !ok {
+			break
+		}
+		client = addr
+		if !containsAddr(trustedProxies, addr) {
+			break
+		}
+	}
+	return client, true
+}
+
+func peerAddr(r *http.Request) (netip.Addr, bool) {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	return addr.Unmap().WithZone(""), true
+}
+
+// forwardedFor returns the for= parameters of the Forwarded headers (RFC 7239) in order
+func forwardedFor(values []string) []string {
+	var forwarded []string
+	for _, value := range values {
+		for _, element := range strings.Split(value, ",") {
+			for _, pair := range strings.Split(element, ";") {
+				name, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+				if ok && strings.EqualFold(name, "for") {
+					forwarded = append(forwarded, value)
+				}
+			}
+		}
+	}
+	return forwarded
+}
+
+// parseForwardedAddr parses addresses like 192.0.2.1, "192.0.2.1:4711" or "[2001:db8::1]:4711"
+func parseForwardedAddr(value string) (netip.Addr, bool) {
+	value = strings.Trim(strings.TrimSpace(value), `"`)
+	if addrPort, err := netip.ParseAddrPort(value); err == nil {
+		return addrPort.Addr().Unmap(), true
+	}
+	addr, err := netip.ParseAddr(strings.TrimSuffix(strings.TrimPrefix(value, "["), "]"))
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	return addr.Unmap().WithZone(""), true
+}
+
+func containsAddr(prefixes []netip.Prefix, addr netip.Addr) bool {
+	for _, prefix := range prefixes {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,133 @@
+package middlewares_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/d4l-data4life/go-svc/pkg/middlewares"
+)
+
+func TestParseCIDRs(t *testing.T) {
+	prefixes, err := middlewares.ParseCIDRs("10.1.2.3/8", " 192.0.2.1", "2001:db8::/32", "::1", "")
+	require.NoError(t, err)
+
+	var got []string
+	for _, prefix := range prefixes {
+		got = append(got, prefix.String())
+	}
+	assert.Equal(t, []string{"10.0.0.0/8", "192.0.2.1/32", "2001:db8::/32", "::1/128"}, got)
+
+	_, err = middlewares.ParseCIDRs("10.0.0.0/33")
+	assert.Error(t, err)
+	_, err = middlewares.ParseCIDRs("proxy.internal")
+	assert.Error(t, err)
+}
+
+func TestClientIP(t *testing.T) {
+	trusted, err := middlewares.ParseCIDRs("10.0.0.0/8", "fd00::/8")
+	require.NoError(t, err)
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		options    []middlewares.ClientIPOption
+		header     http.Header
+		want       string
+	}{
+		{
+			name:       "untrusted peer",
+			remoteAddr: "198.51.100.1:4711",
+			header:     http.Header{"X-Forwarded-For": {"203.0.113.7"}, "X-Real-Ip": {"203.0.113.7"}},
+			want:       "198.51.100.1",
+		},
+		{
+			name:       "trusted peer without headers",
+			remoteAddr: "10.0.0.1:4711",
+			want:       "10.0.0.1",
+		},
+		{
+			name:       "X-Forwarded-For",
+			remoteAddr: "10.0.0.1:4711",
+			header:     http.Header{"X-Forwarded-For": {"203.0.113.7, 10.0.0.2"}},
+			want:       "203.0.113.7",
+		},
+		{
+			name:       "X-Forwarded-For spoofed by the client",
+			remoteAddr: "10.0.0.1:4711",
+			header:     http.Header{"X-Forwarded-For": {"192.0.2.1", "203.0.113.7,10.0.0.2"}},
+			want:       "203.0.113.7",
+		},
+		{
+			name:       "X-Forwarded-For of trusted proxies only",
+			remoteAddr: "10.0.0.1:4711",
+			header:     http.Header{"X-Forwarded-For": {"10.0.0.3, 10.0.0.2"}},
+			want:       "10.0.0.3",
+		},
+		{
+			name:       "X-Forwarded-For with unknown hop",
+			remoteAddr: "10.0.0.1:4711",
+			header:     http.Header{"X-Forwarded-For": {"203.0.113.7, unknown, 10.0.0.2"}},
+			want:       "10.0.0.2",
+		},
+		{
+			name:       "Forwarded",
+			remoteAddr: "[fd00::1]:4711",
+			options:    []middlewares.ClientIPOption{middlewares.ClientIPWithHeader("Forwarded")},
+			header: http.Header{
+				"Forwarded":       {`for=192.0.2.60;proto=https, For="[2001:db8:cafe::17]:4711"`},
+				"X-Forwarded-For": {"203.0.113.7"},
+			},
+			want: "2001:db8:cafe::17",
+		},
+		{
+			name:       "Forwarded supplied by the client is ignored",
+			remoteAddr: "10.0.0.1:4711",
+			header: http.Header{
+				"Forwarded":       {"for=192.0.2.60"},
+				"X-Forwarded-For": {"203.0.113.7"},
+			},
+			want: "203.0.113.7",
+		},
+		{
+			name:       "X-Real-Ip",
+			remoteAddr: "10.0.0.1:4711",
+			options:    []middlewares.ClientIPOption{middlewares.ClientIPWithHeader("x-real-ip")},
+			header:     http.Header{"X-Real-Ip": {"2001:db8::7"}},
+			want:       "2001:db8::7",
+		},
+		{
+			name:       "X-Real-Ip supplied by the client is ignored",
+			remoteAddr: "10.0.0.1:4711",
+			header:     http.Header{"X-Real-Ip": {"2001:db8::7"}},
+			want:       "10.0.0.1",
+		},
+		{
+			name:       "IPv4-mapped peer",
+			remoteAddr: "[::ffff:10.0.0.1]:4711",
+			header:     http.Header{"X-Forwarded-For": {"203.0.113.7"}},
+			want:       "203.0.113.7",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var got string
+			handler := middlewares.ClientIP(trusted, tc.options...)(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+				got = middlewares.CallerIP(r)
+			}))
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.RemoteAddr = tc.remoteAddr
+			for name, values := range tc.header {
+				req.Header[name] = values
+			}
+			handler.ServeHTTP(httptest.NewRecorder(), req)
+
+			assert.Equal(t, tc.want, got)
+		})
+	}
+}
@@ -0,0 +1,240 @@
+package middlewares
+
+import (
+	"bufio"
+	"mime"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/d4l-data4life/go-svc/pkg/compression"
+)
+
+type compress struct {
+	encodings    []string
+	minSize      int
+	contentTypes []string
+}
+
+// CompressOption is to be implemented by functional options
+type CompressOption func(*compress)
+
+// CompressWithEncodings sets the offered content codings in the order of preference (defaults to zstd, br, gzip)
+func CompressWithEncodings(encodings ...string) CompressOption {
+	return func(c *compress) {
+		c.encodings = encodings
+	}
+}
+
+// CompressWithMinSize sets the size in bytes below which responses are sent uncompressed (defaults to 1 KiB)
+func CompressWithMinSize(size int) CompressOption {
+	return func(c *compress) {
+		c.minSize = size
+	}
+}
+
+// CompressWithContentTypes sets the media types of compressed responses, "text/*" matches all subtypes
+// (defaults to JSON, problem JSON, JavaScript, XML, SVG and text)
+func CompressWithContentTypes(contentTypes ...string) CompressOption {
+	return func(c *compress) {
+		c.contentTypes = contentTypes
+	}
+}
+
+// Compress is the decorator that compresses responses with the content coding of the Accept-Encoding header
+// preferred by the server. Responses are compressed if they are at least the minimum size and their Content-Type
+// is allowed; responses without body, partial responses and responses already encoded by the handler are left alone.
+// The beginning of the response is buffered until the size is known, flushing the response decides immediately.
+func Compress(options ...CompressOption) func(http.Handler) http.Handler {
+	c := &compress{
+		encodings: compression.Encodings(),
+		minSize:   1 << 10,
+		contentTypes: []string{
+			"application/json",
+			"application/problem+json",
+			"application/javascript",
+			"application/xml",
+			"image/svg+xml",
+			"text/*",
+		},
+	}
+	for _, apply := range options {
+		apply(c)
+	}
+
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Add("Vary", "Accept-Encoding")
+			encoding := compression.Negotiate(r.Header.Get("Accept-Encoding"), c.encodings)
+			if encoding == "" || r.Method == http.MethodHead {
+				h.ServeHTTP(w, r)
+				return
+			}
+
+			cw := &compressWriter{ResponseWriter: w, config: c, encoding: encoding, status: http.StatusOK}
+			defer cw.close()
+			h.ServeHTTP(cw, r)
+		})
+	}
+}
+
+func (c *compress) allowed(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	for _, allowed := range c.contentTypes {
+		if prefix, ok := strings.CutSuffix(allowed, "/*"); ok {
+			if strings.HasPrefix(mediaType, prefix+"/") {
+				return true
+			}
+		} else if mediaType == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+// compressWriter holds back the header and the beginning of the body until it decided whether to compress
+type compressWriter struct {
+	http.ResponseWriter
+	config      *compress
+	encoding    string
+	status      int
+	wroteHeader bool
+	decided     bool
+	buf         []byte
+	encoder     compression.Encoder
+}
+
+func (w *compressWriter) WriteHeader(statusCode int) {
+	if w.wroteHeader {
+		return
+	}
+	// informational responses are sent right away, the final one follows
+	if statusCode >= 100 && statusCode < 200 && statusCode != http.StatusSwitchingProtocols {
+		w.ResponseWriter.WriteHeader(statusCode)
+		return
+	}
+	w.status = statusCode
+	w.wroteHeader = true
+
+	if !w.compressible() {
+		_ = w.decide(false)
+		return
+	}
+	if length, err := strconv.Atoi(w.Header().Get("Content-Length")); err == nil {
+		_ = w.decide(length >= w.config.minSize)
+	}
+}
+
+func (w *compressWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.decided {
+		if w.encoder != nil {
+			return w.encoder.Write(b)
+		}
+		return w.ResponseWriter.Write(b)
+	}
+
+	w.buf = append(w.buf, b...)
+	if len(w.buf) >= w.config.minSize {
+		if err := w.decide(true); err != nil {
+			return 0, err
+		}
+	}
+	return len(b), nil
+}
+
+// Flush sends the buffered beginning of the response, compressed regardless of its size
+func (w *compressWriter) Flush() {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	if !w.decided {
+		_ = w.decide(true)
+	}
+	if w.encoder != nil {
+		_ = w.encoder.Flush()
+	}
+	_ = http.NewResponseController(w.ResponseWriter).Flush()
+}
+
+func (w *compressWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return http.NewResponseController(w.ResponseWriter).Hijack()
+}
+
+// Unwrap allows http.ResponseController to reach the wrapped writer
+func (w *compressWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// compressible tells whether the status and header written by the handler allow to compress the response
+func (w *compressWriter) compressible() bool {
+	switch w.status {
+	case http.StatusNoContent, http.StatusNotModified, http.StatusPartialContent, http.StatusSwitchingProtocols:
+		return false
+	}
+	header := w.Header()
+	return header.Get("Content-Encoding") == "" && !strings.Contains(header.Get("Cache-Control"), "no-transform")
+}
+
+// decide writes the header of the compressed or uncompressed response followed by the buffered body
+func (w *compressWriter) decide(large bool) error {
+	w.decided = true
+	header := w.Header()
+
+	compressed := large && w.compressible()
+	if compressed {
+		contentType := header.Get("Content-Type")
+		if contentType == "" && len(w.buf) > 0 {
+			// net/http does not sniff encoded bodies
+			contentType = http.DetectContentType(w.buf)
+			header.Set("Content-Type", contentType)
+		}
+		compressed = w.config.allowed(contentType)
+	}
+
+	if compressed {
+		// unsupported encodings configured by CompressWithEncodings are sent uncompressed
+		if encoder, err := compression.NewEncoder(w.encoding, w.ResponseWriter); err == nil {
+			w.encoder = encoder
+			header.Set("Content-Encoding", w.encoding)
+			header.Del("Content-Length")
+			// the encoded representation is not byte-for-byte identical
+			if etag := header.Get("ETag"); strings.HasPrefix(etag, `"`) {
+				header.Set("ETag", "W/"+etag)
+			}
+		}
+	}
+
+	w.ResponseWriter.WriteHeader(w.status)
+	if len(w.buf) == 0 {
+		return nil
+	}
+	buf := w.buf
+	w.buf = nil
+	var err error
+	if w.encoder != nil {
+		_, err = w.encoder.Write(buf)
+	} else {
+		_, err = w.ResponseWriter.Write(buf)
+	}
+	return err
+}
+
+// close sends a response smaller than the minimum size uncompressed and ends the compressed stream
+func (w *compressWriter) close() {
+	if !w.wroteHeader {
+		return
+	}
+	if !w.decided {
+		_ = w.decide(false)
+	}
+	if w.encoder != nil {
+		_ = w.encoder.Close()
+	}
+}
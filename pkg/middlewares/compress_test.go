@@ -0,0 +1,167 @@
+package middlewares_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/d4l-data4life/go-svc/pkg/compression"
+	"github.com/d4l-data4life/go-svc/pkg/middlewares"
+)
+
+func decodeBody(t *testing.T, res *httptest.ResponseRecorder) string {
+	t.Helper()
+	encoding := res.Header().Get("Content-Encoding")
+	if encoding == "" {
+		return res.Body.String()
+	}
+	decoder, err := compression.NewDecoder(encoding, res.Body)
+	require.NoError(t, err)
+	defer decoder.Close()
+	body, err := io.ReadAll(decoder)
+	require.NoError(t, err)
+	return string(body)
+}
+
+func TestCompress(t *testing.T) {
+	large := `{"items":"` + strings.Repeat("x", 2048) + `"}`
+
+	tests := []struct {
+		name           string
+		acceptEncoding string
+		contentType    string
+		header         http.Header
+		status         int
+		body           string
+		options        []middlewares.CompressOption
+		wantEncoding   string
+	}{
+		{name: "preferred encoding", acceptEncoding: "gzip, br, zstd", contentType: "application/json", body: large, wantEncoding: compression.Zstd},
+		{name: "client quality", acceptEncoding: "gzip, br;q=0.5, zstd;q=0", contentType: "application/json", body: large, wantEncoding: compression.Gzip},
+		{name: "wildcard", acceptEncoding: "*", contentType: "text/plain; charset=utf-8", body: large, wantEncoding: compression.Zstd},
+		{name: "no accepted encoding", acceptEncoding: "identity", contentType: "application/json", body: large},
+		{name: "small body", acceptEncoding: "gzip", contentType: "application/json", body: `{"items":[]}`},
+		{name: "excluded content type", acceptEncoding: "gzip", contentType: "image/png", body: large},
+		{name: "sniffed content type", acceptEncoding: "gzip", body: strings.Repeat("plain text ", 200), wantEncoding: compression.Gzip},
+		{
+			name:           "already encoded",
+			acceptEncoding: "gzip",
+			contentType:    "application/json",
+			header:         http.Header{"Content-Encoding": {"br"}},
+			body:           large,
+			wantEncoding:   "br",
+		},
+		{name: "no content", acceptEncoding: "gzip", contentType: "application/json", status: http.StatusNoContent},
+		{
+			name:           "configured options",
+			acceptEncoding: "gzip, zstd",
+			contentType:    "application/vnd.api+json",
+			body:           `{"items":[]}`,
+			options: []middlewares.CompressOption{
+				middlewares.CompressWithEncodings(compression.Gzip),
+				middlewares.CompressWithMinSize(0),
+				middlewares.CompressWithContentTypes("application/vnd.api+json"),
+			},
+			wantEncoding: compression.Gzip,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			handler := middlewares.Compress(tc.options...)(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				if tc.contentType != "" {
+					w.Header().Set("Content-Type", tc.contentType)
+				}
+				for name, values := range tc.header {
+					w.Header()[name] = values
+				}
+				if tc.status != 0 {
+					w.WriteHeader(tc.status)
+				}
+				// written in pieces to cover the buffering until the minimum size
+				for chunk := range chunks(tc.body, 100) {
+					_, _ = io.WriteString(w, chunk)
+				}
+			}))
+
+			req := httptest.NewRequest(http.MethodGet, "/items", nil)
+			req.Header.Set("Accept-Encoding", tc.acceptEncoding)
+			res := httptest.NewRecorder()
+			handler.ServeHTTP(res, req)
+
+			assert.Equal(t, tc.wantEncoding, res.Header().Get("Content-Encoding"))
+			assert.Equal(t, "Accept-Encoding", res.Header().Get("Vary"))
+			if tc.status != 0 {
+				assert.Equal(t, tc.status, res.Code)
+			}
+			if tc.header != nil {
+				assert.Equal(t, tc.body, res.Body.String())
+				return
+			}
+			assert.Equal(t, tc.body, decodeBody(t, res))
+		})
+	}
+}
+
+// chunks splits s into chunks of at most n bytes
+func chunks(s string, n int) func(func(string) bool) {
+	return func(yield func(string) bool) {
+		for len(s) > 0 {
+			chunk := s[:min(n, len(s))]
+			s = s[len(chunk):]
+			if !yield(chunk) {
+				return
+			}
+		}
+	}
+}
+
+func TestCompressHeaders(t *testing.T) {
+	body := strings.Repeat("a", 4096)
+	handler := middlewares.Compress()(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+		w.Header().Set("ETag", `"v1"`)
+		w.WriteHeader(http.StatusCreated)
+		_, _ = io.WriteString(w, body)
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/items", nil)
+	req.Header.Set("Accept-Encoding", "br")
+	res := httptest.NewRecorder()
+	handler.ServeHTTP(res, req)
+
+	assert.Equal(t, http.StatusCreated, res.Code)
+	assert.Equal(t, compression.Brotli, res.Header().Get("Content-Encoding"))
+	assert.Empty(t, res.Header().Get("Content-Length"))
+	assert.Equal(t, `W/"v1"`, res.Header().Get("ETag"))
+	assert.Less(t, res.Body.Len(), len(body))
+	assert.Equal(t, body, decodeBody(t, res))
+}
+
+func TestCompressFlush(t *testing.T) {
+	handler := middlewares.Compress()(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		_, _ = io.WriteString(w, "data: 1\n\n")
+		require.NoError(t, http.NewResponseController(w).Flush())
+
+		// the event is sent before the handler returns
+		res := w.(interface{ Unwrap() http.ResponseWriter }).Unwrap().(*httptest.ResponseRecorder)
+		assert.True(t, res.Flushed)
+		assert.Equal(t, compression.Gzip, res.Header().Get("Content-Encoding"))
+		assert.NotZero(t, res.Body.Len())
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/events", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	res := httptest.NewRecorder()
+	handler.ServeHTTP(res, req)
+
+	assert.Equal(t, "data: 1\n\n", decodeBody(t, res))
+}
@@ -0,0 +1,207 @@
+package middlewares
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/caarlos0/env"
+)
+
+// ErrInvalidCORSPolicy happens for policies allowing credentials from all origins
+var ErrInvalidCORSPolicy = errors.New("invalid CORS policy")
+
+// CORSPolicy decides which cross-origin requests browsers may send, a policy without allowed origins disables CORS
+type CORSPolicy struct {
+	// AllowedOrigins are origins like https://app.example.com, "*" allows all and https://*.example.com all subdomains
+	AllowedOrigins   []string      `env:"HTTP_CORS_ALLOWED_ORIGINS"`
+	AllowedMethods   []string      `env:"HTTP_CORS_ALLOWED_METHODS"   envDefault:"GET,HEAD,POST,PUT,PATCH,DELETE"`
+	AllowedHeaders   []string      `env:"HTTP_CORS_ALLOWED_HEADERS"   envDefault:"Authorization,Content-Type,X-Tenant-ID,Idempotency-Key,If-Match,If-None-Match"`
+	ExposedHeaders   []string      `env:"HTTP_CORS_EXPOSED_HEADERS"   envDefault:"ETag,Trace-Id"`
+	AllowCredentials bool          `env:"HTTP_CORS_ALLOW_CREDENTIALS" envDefault:"false"`
+	MaxAge           time.Duration `env:"HTTP_CORS_MAX_AGE"           envDefault:"10m"`
+}
+
+// CORSPolicyFromEnv reads the policy from the HTTP_CORS_* environment variables, lists are comma separated.
+// It fails for invalid policies, see CORSPolicy.Validate.
+func CORSPolicyFromEnv() (CORSPolicy, error) {
+	var policy CORSPolicy
+	if err := env.Parse(&policy); err != nil {
+		return policy, err
+	}
+	return policy, policy.Validate()
+}
+
+// Validate fails with ErrInvalidCORSPolicy if the policy allows credentials from all origins ("*"),
+// which would let every website send authenticated requests
+func (p CORSPolicy) Validate() error {
+	p = normalizeCORSPolicy(p)
+	if p.AllowCredentials && slices.Contains(p.AllowedOrigins, "*") {
+		return fmt.Errorf("%w: credentials cannot be allowed for all origins", ErrInvalidCORSPolicy)
+	}
+	return nil
+}
+
+type corsRoute struct {
+	pattern *regexp.Regexp
+	policy  CORSPolicy
+}
+
+type cors struct {
+	policy CORSPolicy
+	routes []corsRoute
+}
+
+// CORSOption is to be implemented by functional options
+type CORSOption func(*cors)
+
+// CORSWithRoute applies the policy to requests whose path matches the pattern instead of the default policy,
+// the first matching route wins
+func CORSWithRoute(pattern *regexp.Regexp, policy CORSPolicy) CORSOption {
+	return func(c *cors) {
+		c.routes = append(c.routes, corsRoute{pattern: pattern, policy: policy})
+	}
+}
+
+// CORS is the decorator answering preflight requests and setting the Access-Control-* headers of the policy
+// matching the request path. Requests from disallowed origins get no CORS headers, so browsers block them;
+// preflight requests are answered with 204 before reaching the handler.
+// It panics if a policy is invalid, see CORSPolicy.Validate.
+func CORS(policy CORSPolicy, options ...CORSOption) func(http.Handler) http.Handler {
+	if err := policy.Validate(); err != nil {
+		panic(err)
+	}
+	c := &cors{policy: normalizeCORSPolicy(policy)}
+	for _, apply := range options {
+		apply(c)
+	}
+	for i := range c.routes {
+		if err := c.routes[i].policy.Validate(); err != nil {
+			panic(fmt.Errorf("route %s: %w", c.routes[i].pattern, err))
+		}
+		c.routes[i].policy = normalizeCORSPolicy(c.routes[i].policy)
+	}
+
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			policy := c.policyOf(r.URL.Path)
+			if len(policy.AllowedOrigins) == 0 {
+				h.ServeHTTP(w, r)
+				return
+			}
+
+			header := w.Header()
+			header.Add("Vary", "Origin")
+			origin := r.Header.Get("Origin")
+			preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+			if preflight {
+				header.Add("Vary", "Access-Control-Request-Method")
+				header.Add("Vary", "Access-Control-Request-Headers")
+			}
+			if origin == "" {
+				h.ServeHTTP(w, r)
+				return
+			}
+
+			allowed := policy.allowsOrigin(origin)
+			if preflight {
+				if allowed && policy.allowsPreflight(r) {
+					policy.setOrigin(header, origin)
+					header.Set("Access-Control-Allow-Methods", strings.Join(policy.AllowedMethods, ", "))
+					if requested := r.Header.Get("Access-Control-Request-Headers"); requested != "" {
+						header.Set("Access-Control-Allow-Headers", requested)
+					}
+					if policy.MaxAge > 0 {
+						header.Set("Access-Control-Max-Age", strconv.FormatInt(int64(policy.MaxAge/time.Second), 10))
+					}
+				}
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+
+			if allowed {
+				policy.setOrigin(header, origin)
+				if len(policy.ExposedHeaders) > 0 {
+					header.Set("Access-Control-Expose-Headers", strings.Join(policy.ExposedHeaders, ", "))
+				}
+			}
+			h.ServeHTTP(w, r)
+		})
+	}
+}
+
+func (c *cors) policyOf(path string) CORSPolicy {
+	for _, route := range c.routes {
+		if route.pattern.MatchString(path) {
+			return route.policy
+		}
+	}
+	return c.policy
+}
+
+// normalizeCORSPolicy trims the list entries read from the environment and canonicalizes methods and headers
+func normalizeCORSPolicy(policy CORSPolicy) CORSPolicy {
+	normalize := func(values []string, canonical func(string) string) []string {
+		var normalized []string
+		for _, value := range values {
+			if value = strings.TrimSpace(value); value != "" {
+				normalized = append(normalized, canonical(value))
+			}
+		}
+		return normalized
+	}
+	policy.AllowedOrigins = normalize(policy.AllowedOrigins, strings.ToLower)
+	policy.AllowedMethods = normalize(policy.AllowedMethods, strings.ToUpper)
+	policy.AllowedHeaders = normalize(policy.AllowedHeaders, http.CanonicalHeaderKey)
+	policy.ExposedHeaders = normalize(policy.ExposedHeaders, http.CanonicalHeaderKey)
+	return policy
+}
+
+func (p CORSPolicy) allowsOrigin(origin string) bool {
+	origin = strings.ToLower(origin)
+	for _, allowed := range p.AllowedOrigins {
+		if allowed == "*" || allowed == origin {
+			return true
+		}
+		if scheme, domain, ok := strings.Cut(allowed, "://*."); ok &&
+			strings.HasPrefix(origin, scheme+"://") && strings.HasSuffix(origin, "."+domain) {
+			return true
+		}
+	}
+	return false
+}
+
+// allowsPreflight tells whether the requested method and headers are allowed, CORS-safelisted methods always are
+func (p CORSPolicy) allowsPreflight(r *http.Request) bool {
+	method := strings.ToUpper(r.Header.Get("Access-Control-Request-Method"))
+	if method != http.MethodGet && method != http.MethodHead && method != http.MethodPost && !slices.Contains(p.AllowedMethods, method) {
+		return false
+	}
+	if slices.Contains(p.AllowedHeaders, "*") {
+		return true
+	}
+	for _, requested := range strings.Split(r.Header.Get("Access-Control-Request-Headers"), ",") {
+		requested = strings.TrimSpace(requested)
+		if requested != "" && !slices.Contains(p.AllowedHeaders, http.CanonicalHeaderKey(requested)) {
+			return false
+		}
+	}
+	return true
+}
+
+// setOrigin allows the origin, valid policies with the wildcard never allow credentials
+func (p CORSPolicy) setOrigin(header http.Header, origin string) {
+	if slices.Contains(p.AllowedOrigins, "*") {
+		header.Set("Access-Control-Allow-Origin", "*")
+		return
+	}
+	header.Set("Access-Control-Allow-Origin", origin)
+	if p.AllowCredentials {
+		header.Set("Access-Control-Allow-Credentials", "true")
+	}
+}
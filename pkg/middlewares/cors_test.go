@@ -0,0 +1,174 @@
+package middlewares_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/d4l-data4life/go-svc/pkg/middlewares"
+)
+
+func TestCORS(t *testing.T) {
+	t.Setenv("HTTP_CORS_ALLOWED_ORIGINS", "https://app.example.com, https://*.preview.example.com")
+	policy, err := middlewares.CORSPolicyFromEnv()
+	require.NoError(t, err)
+
+	public := middlewares.CORSPolicy{AllowedOrigins: []string{"*"}, AllowedMethods: []string{"GET"}}
+	handler := middlewares.CORS(policy, middlewares.CORSWithRoute(regexp.MustCompile(`^/public/`), public))(
+		http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			w.WriteHeader(http.StatusTeapot)
+		}))
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		header     map[string]string
+		wantStatus int
+		wantHeader map[string]string
+	}{
+		{
+			name:       "same origin",
+			method:     http.MethodGet,
+			path:       "/records",
+			wantStatus: http.StatusTeapot,
+			wantHeader: map[string]string{"Access-Control-Allow-Origin": "", "Vary": "Origin"},
+		},
+		{
+			name:       "allowed origin",
+			method:     http.MethodGet,
+			path:       "/records",
+			header:     map[string]string{"Origin": "https://app.example.com"},
+			wantStatus: http.StatusTeapot,
+			wantHeader: map[string]string{"Access-Control-Allow-Origin": "https://app.example.com", "Access-Control-Expose-Headers": "Etag, Trace-Id"},
+		},
+		{
+			name:       "allowed subdomain",
+			method:     http.MethodPost,
+			path:       "/records",
+			header:     map[string]string{"Origin": "https://pr-1.preview.example.com"},
+			wantStatus: http.StatusTeapot,
+			wantHeader: map[string]string{"Access-Control-Allow-Origin": "https://pr-1.preview.example.com"},
+		},
+		{
+			name:       "disallowed origin",
+			method:     http.MethodGet,
+			path:       "/records",
+			header:     map[string]string{"Origin": "https://evil.example.org"},
+			wantStatus: http.StatusTeapot,
+			wantHeader: map[string]string{"Access-Control-Allow-Origin": ""},
+		},
+		{
+			name:   "preflight",
+			method: http.MethodOptions,
+			path:   "/records/1",
+			header: map[string]string{
+				"Origin":                         "https://app.example.com",
+				"Access-Control-Request-Method":  "DELETE",
+				"Access-Control-Request-Headers": "authorization, x-tenant-id",
+			},
+			wantStatus: http.StatusNoContent,
+			wantHeader: map[string]string{
+				"Access-Control-Allow-Origin":  "https://app.example.com",
+				"Access-Control-Allow-Methods": "GET, HEAD, POST, PUT, PATCH, DELETE",
+				"Access-Control-Allow-Headers": "authorization, x-tenant-id",
+				"Access-Control-Max-Age":       "600",
+			},
+		},
+		{
+			name:   "preflight with disallowed header",
+			method: http.MethodOptions,
+			path:   "/records/1",
+			header: map[string]string{
+				"Origin":                         "https://app.example.com",
+				"Access-Control-Request-Method":  "PUT",
+				"Access-Control-Request-Headers": "x-debug",
+			},
+			wantStatus: http.StatusNoContent,
+			wantHeader: map[string]string{"Access-Control-Allow-Origin": ""},
+		},
+		{
+			name:       "route policy",
+			method:     http.MethodGet,
+			path:       "/public/terms",
+			header:     map[string]string{"Origin": "https://evil.example.org"},
+			wantStatus: http.StatusTeapot,
+			wantHeader: map[string]string{"Access-Control-Allow-Origin": "*"},
+		},
+		{
+			name:   "route policy preflight",
+			method: http.MethodOptions,
+			path:   "/public/terms",
+			header: map[string]string{
+				"Origin":                        "https://evil.example.org",
+				"Access-Control-Request-Method": "DELETE",
+			},
+			wantStatus: http.StatusNoContent,
+			wantHeader: map[string]string{"Access-Control-Allow-Origin": ""},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(tc.method, tc.path, nil)
+			for name, value := range tc.header {
+				req.Header.Set(name, value)
+			}
+			res := httptest.NewRecorder()
+			handler.ServeHTTP(res, req)
+
+			assert.Equal(t, tc.wantStatus, res.Code)
+			for name, value := range tc.wantHeader {
+				assert.Equal(t, value, res.Header().Get(name), name)
+			}
+		})
+	}
+}
+
+func TestCORSCredentials(t *testing.T) {
+	policy := middlewares.CORSPolicy{AllowedOrigins: []string{"https://app.example.com"}, AllowCredentials: true}
+	handler := middlewares.CORS(policy)(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+
+	req := httptest.NewRequest(http.MethodGet, "/records", nil)
+	req.Header.Set("Origin", "https://app.example.com")
+	res := httptest.NewRecorder()
+	handler.ServeHTTP(res, req)
+
+	assert.Equal(t, "https://app.example.com", res.Header().Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "true", res.Header().Get("Access-Control-Allow-Credentials"))
+}
+
+func TestCORSCredentialsWithWildcardAreRejected(t *testing.T) {
+	policy := middlewares.CORSPolicy{AllowedOrigins: []string{" * "}, AllowCredentials: true}
+
+	assert.ErrorIs(t, policy.Validate(), middlewares.ErrInvalidCORSPolicy)
+	assert.Panics(t, func() { middlewares.CORS(policy) })
+	assert.Panics(t, func() {
+		middlewares.CORS(middlewares.CORSPolicy{}, middlewares.CORSWithRoute(regexp.MustCompile(`^/public/`), policy))
+	})
+
+	t.Setenv("HTTP_CORS_ALLOWED_ORIGINS", "*")
+	t.Setenv("HTTP_CORS_ALLOW_CREDENTIALS", "true")
+	_, err := middlewares.CORSPolicyFromEnv()
+	assert.ErrorIs(t, err, middlewares.ErrInvalidCORSPolicy)
+}
+
+func TestCORSDisabled(t *testing.T) {
+	var served bool
+	handler := middlewares.CORS(middlewares.CORSPolicy{})(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+		served = true
+	}))
+
+	req := httptest.NewRequest(http.MethodOptions, "/records", nil)
+	req.Header.Set("Origin", "https://app.example.com")
+	req.Header.Set("Access-Control-Request-Method", "PUT")
+	res := httptest.NewRecorder()
+	handler.ServeHTTP(res, req)
+
+	assert.True(t, served, "the handler answers preflight requests without policy")
+	assert.Empty(t, res.Header())
+}
@@ -1,10 +1,78 @@
 package middlewares
 
 import (
+	"errors"
 	"net/http"
+
+	"github.com/d4l-data4life/go-svc/pkg/gormer"
+	"github.com/d4l-data4life/go-svc/pkg/httpsig"
+	"github.com/d4l-data4life/go-svc/pkg/problem"
+)
+
+// Errors of the middlewares without own sentinel
+var (
+	ErrRequestBodyTooLarge = errors.New("request body too large")
+	ErrTooManyRequests     = errors.New("too many requests")
+	ErrOverloaded          = errors.New("service overloaded")
 )
 
-// WriteHTTPErrorCode writes given HTTP Code to the HTTP response and provides explanation - for errors
+// Problems maps the errors of the middlewares and gormer to problem types, services can register their own errors:
+//
+//	middlewares.Problems.Register(ErrRecordLocked, problem.Type{URI: "urn:acme:problem:record-locked", Title: "Record Locked", Status: http.StatusConflict})
+var Problems = defaultProblems() // nolint: gochecknoglobals
+
+func defaultProblems() *problem.Registry {
+	r := problem.NewRegistry()
+	r.Register(ErrInvalidQuery, problemType("invalid-query", "Invalid Query", http.StatusBadRequest))
+	r.Register(ErrInvalidToken, problemType("invalid-token", "Invalid Token", http.StatusUnauthorized))
+	r.Register(ErrNoSecretInRequest, problemType("missing-credentials", "Missing Credentials", http.StatusUnauthorized))
+	r.Register(ErrMalformedAuthHeader, problemType("malformed-authorization-header", "Malformed Authorization Header", http.StatusUnauthorized))
+	r.Register(ErrInvalidSecret, problemType("invalid-service-secret", "Invalid Service Secret", http.StatusUnauthorized))
+	r.Register(ErrNoSignatureInRequest, problemType("missing-signature", "Missing Signature", http.StatusUnauthorized))
+	r.Register(httpsig.ErrMalformedSignature, problemType("malformed-signature", "Malformed Signature", http.StatusUnauthorized))
+	r.Register(ErrInvalidSignature, problemType("invalid-signature", "Invalid Signature", http.StatusUnauthorized))
+	r.Register(ErrSignatureExpired, problemType("signature-expired", "Signature Expired", http.StatusUnauthorized))
+	r.Register(ErrReplayedRequest, problemType("replayed-request", "Replayed Request", http.StatusUnauthorized))
+	r.Register(ErrForbidden, problemType("forbidden", "Forbidden", http.StatusForbidden))
+	r.Register(ErrIPNotAllowed, problemType("ip-not-allowed", "IP Not Allowed", http.StatusForbidden))
+	r.Register(ErrInvalidIdempotencyKey, problemType("invalid-idempotency-key", "Invalid Idempotency Key", http.StatusBadRequest))
+	r.Register(ErrIdempotencyKeyReused, problemType("idempotency-key-reused", "Idempotency Key Reused", http.StatusConflict))
+	r.Register(ErrIdempotentRequestInProgress, problemType("idempotent-request-in-progress", "Request In Progress", http.StatusConflict))
+	r.Register(ErrPreconditionFailed, problemType("precondition-failed", "Precondition Failed", http.StatusPreconditionFailed))
+	r.Register(ErrPreconditionRequired, problemType("precondition-required", "Precondition Required", http.StatusPreconditionRequired))
+	r.Register(gormer.ErrNotFound, problemType("not-found", "Not Found", http.StatusNotFound))
+	r.Register(ErrRequestBodyTooLarge, problemType("request-body-too-large", "Request Body Too Large", http.StatusRequestEntityTooLarge))
+	r.Register(ErrTooManyRequests, problemType("too-many-requests", "Too Many Requests", http.StatusTooManyRequests))
+	r.Register(ErrOverloaded, problemType("overloaded", "Service Overloaded", http.StatusServiceUnavailable))
+	return r
+}
+
+func problemType(name, title string, status int) problem.Type {
+	return problem.Type{URI: "urn:d4l:problem:" + name, Title: title, Status: status}
+}
+
+// WriteProblem writes the error as problem details of its registered type, unregistered errors are answered with 500
+func WriteProblem(w http.ResponseWriter, r *http.Request, err error) {
+	Problems.Error(w, r, err)
+}
+
+// WriteHTTPErrorCode writes given HTTP Code to the HTTP response and provides explanation - for errors.
+// The response is a problem details document with the registered type of the error, if any.
+//
+// Deprecated: the response lacks the trace ID of the request, use WriteHTTPErrorCodeReq instead.
 func WriteHTTPErrorCode(w http.ResponseWriter, err error, code int) {
-	http.Error(w, err.Error(), code)
+	WriteHTTPErrorCodeReq(w, nil, err, code)
+}
+
+// WriteHTTPErrorCodeReq writes the error like WriteHTTPErrorCode with the given HTTP code instead of the registered one.
+// The trace ID of the request is added to the problem details, the request may be nil.
+func WriteHTTPErrorCodeReq(w http.ResponseWriter, r *http.Request, err error, code int) {
+	d := problem.New(code, "")
+	if t, ok := Problems.Lookup(err); ok {
+		d.Type, d.Title = t.URI, t.Title
+	}
+	if code < http.StatusInternalServerError {
+		d.Detail = err.Error()
+	}
+	problem.Write(w, r, d)
 }
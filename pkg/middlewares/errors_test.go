@@ -0,0 +1,64 @@
+package middlewares_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/d4l-data4life/go-svc/pkg/gormer"
+	"github.com/d4l-data4life/go-svc/pkg/log"
+	"github.com/d4l-data4life/go-svc/pkg/middlewares"
+	"github.com/d4l-data4life/go-svc/pkg/problem"
+)
+
+func TestWriteProblem(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        error
+		wantStatus int
+		wantBody   string
+	}{
+		{"invalid secret", middlewares.ErrInvalidSecret, http.StatusUnauthorized,
+			`{"type":"urn:d4l:problem:invalid-service-secret","title":"Invalid Service Secret","status":401,"detail":"provided service secret invalid"}`},
+		{"invalid query", middlewares.ErrInvalidQuery, http.StatusBadRequest,
+			`{"type":"urn:d4l:problem:invalid-query","title":"Invalid Query","status":400,"detail":"query contains invalid parameters or values"}`},
+		{"wrapped not found", fmt.Errorf("loading record: %w", gormer.ErrNotFound), http.StatusNotFound,
+			`{"type":"urn:d4l:problem:not-found","title":"Not Found","status":404,"detail":"loading record: resource not found"}`},
+		{"JWT with malformed header", fmt.Errorf("%w: %w", middlewares.ErrInvalidToken, middlewares.ErrMalformedAuthHeader), http.StatusUnauthorized,
+			`{"type":"urn:d4l:problem:invalid-token","title":"Invalid Token","status":401,"detail":"invalid bearer token: malformed authorization header content"}`},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			res := httptest.NewRecorder()
+			middlewares.WriteProblem(res, httptest.NewRequest(http.MethodGet, "/records/1", nil), tc.err)
+
+			assert.Equal(t, tc.wantStatus, res.Code)
+			assert.Equal(t, problem.ContentType, res.Header().Get("Content-Type"))
+			assert.JSONEq(t, tc.wantBody, res.Body.String())
+		})
+	}
+}
+
+func TestWriteHTTPErrorCode(t *testing.T) {
+	res := httptest.NewRecorder()
+	middlewares.WriteHTTPErrorCode(res, middlewares.ErrInvalidQuery, http.StatusUnprocessableEntity)
+
+	assert.Equal(t, http.StatusUnprocessableEntity, res.Code)
+	assert.JSONEq(t, `{"type":"urn:d4l:problem:invalid-query","title":"Invalid Query","status":422,"detail":"query contains invalid parameters or values"}`,
+		res.Body.String())
+}
+
+func TestWriteHTTPErrorCodeReq(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set(log.TraceIDHeaderKey, "trace-1")
+	res := httptest.NewRecorder()
+	middlewares.WriteHTTPErrorCodeReq(res, req, middlewares.ErrInvalidQuery, http.StatusUnprocessableEntity)
+
+	assert.Equal(t, http.StatusUnprocessableEntity, res.Code)
+	assert.JSONEq(t, `{"type":"urn:d4l:problem:invalid-query","title":"Invalid Query","status":422,"detail":"query contains invalid parameters or values","trace-id":"trace-1"}`,
+		res.Body.String())
+}
@@ -0,0 +1,353 @@
+package middlewares
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"hash"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// Errors of the ETag middleware
+var (
+	ErrPreconditionFailed   = errors.New("the resource does not match the preconditions of the request")
+	ErrPreconditionRequired = errors.New("the request has to be conditional, If-Match is missing")
+)
+
+type etag struct {
+	weak           bool
+	maxBodySize    int
+	requireIfMatch bool
+	currentFromGet bool
+	current        func(*http.Request) (string, error)
+}
+
+// ETagOption is to be implemented by functional options
+type ETagOption func(*etag)
+
+// ETagWithWeak generates weak ETags (W/"..."), which only match If-None-Match and never If-Match
+func ETagWithWeak() ETagOption {
+	return func(e *etag) {
+		e.weak = true
+	}
+}
+
+// ETagWithMaxBodySize sets the size of the largest response buffered to compute its ETag (defaults to 1 MiB),
+// larger responses are sent without ETag unless the handler sets one
+func ETagWithMaxBodySize(size int) ETagOption {
+	return func(e *etag) {
+		e.maxBodySize = size
+	}
+}
+
+// ETagWithRequiredIfMatch answers PUT, PATCH and DELETE requests without If-Match with 428 Precondition Required
+func ETagWithRequiredIfMatch() ETagOption {
+	return func(e *etag) {
+		e.requireIfMatch = true
+	}
+}
+
+// ETagWithCurrent sets the function returning the current ETag of the resource addressed by a PUT, PATCH or DELETE
+// request, or "" if it does not exist. Errors are written as problem details.
+func ETagWithCurrent(current func(*http.Request) (string, error)) ETagOption {
+	return func(e *etag) {
+		e.current = current
+	}
+}
+
+// ETagWithCurrentFromGet takes the current ETag of the resource addressed by a PUT, PATCH or DELETE request
+// from a GET request of the same URL served by the wrapped handler. The ETag of large responses is computed as well,
+// so If-Match: * matches every existing resource.
+// The wrapped handler has to dispatch by method, e.g. a router, otherwise it executes the write request as GET.
+func ETagWithCurrentFromGet() ETagOption {
+	return func(e *etag) {
+		e.currentFromGet = true
+	}
+}
+
+// ETag is the decorator for conditional requests. It sets an ETag computed from the body on 200 responses to GET
+// and HEAD requests without one and answers them with 304 Not Modified if the ETag matches If-None-Match.
+// The ETag of a HEAD request is computed from the response to a GET request of the same URL.
+// With ETagWithCurrent or ETagWithCurrentFromGet, PUT, PATCH and DELETE requests are answered with 412 Precondition
+// Failed if the current ETag of the resource does not match If-Match or matches If-None-Match, which gives optimistic
+// concurrency control if the handler changes the resource in the same transaction as ETagWithCurrent reads it.
+// Without them the preconditions of these requests are left to the handler.
+// Install it after log.HTTPLogger and prom.HandlerInstrumenter, so they see the 304 and 412 responses.
+func ETag(options ...ETagOption) func(http.Handler) http.Handler {
+	e := &etag{maxBodySize: 1 << 20}
+	for _, apply := range options {
+		apply(e)
+	}
+
+	return func(h http.Handler) http.Handler {
+		current := e.current
+		if current == nil && e.currentFromGet {
+			current = func(r *http.Request) (string, error) {
+				rec := e.serveGet(h, r)
+				if rec.status < 200 || rec.status >= 300 {
+					return "", nil
+				}
+				return rec.etag(e), nil
+			}
+		}
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.Method {
+			case http.MethodGet, http.MethodHead:
+				ew := &etagWriter{ResponseWriter: w, config: e, ifNoneMatch: r.Header.Get("If-None-Match"), status: http.StatusOK}
+				if r.Method == http.MethodHead {
+					// handlers may skip the body of HEAD requests, so its hash is no ETag of the resource
+					ew.fromGet = func() string {
+						rec := e.serveGet(h, r)
+						// the GET response is only sent with ETag if it is small enough to be buffered
+						if rec.status != http.StatusOK || (rec.header.Get("ETag") == "" && rec.size > e.maxBodySize) {
+							return ""
+						}
+						return rec.etag(e)
+					}
+				}
+				h.ServeHTTP(ew, r)
+				ew.finish()
+			case http.MethodPut, http.MethodPatch, http.MethodDelete:
+				ifMatch, ifNoneMatch := r.Header.Get("If-Match"), r.Header.Get("If-None-Match")
+				if ifMatch == "" && e.requireIfMatch {
+					WriteProblem(w, r, ErrPreconditionRequired)
+					return
+				}
+				if (ifMatch == "" && ifNoneMatch == "") || current == nil {
+					h.ServeHTTP(w, r)
+					return
+				}
+
+				tag, err := current(r)
+				if err != nil {
+					WriteProblem(w, r, err)
+					return
+				}
+				if (ifMatch != "" && !matchETag(ifMatch, tag, true)) || (ifNoneMatch != "" && matchETag(ifNoneMatch, tag, false)) {
+					WriteProblem(w, r, ErrPreconditionFailed)
+					return
+				}
+				h.ServeHTTP(w, r)
+			default:
+				h.ServeHTTP(w, r)
+			}
+		})
+	}
+}
+
+// serveGet serves a GET request of the URL and records the status, header and hash of the body of the response
+func (e *etag) serveGet(h http.Handler, r *http.Request) *etagRecorder {
+	get := r.Clone(r.Context())
+	get.Method = http.MethodGet
+	get.Body = http.NoBody
+	get.ContentLength = 0
+	for _, name := range []string{"If-Match", "If-None-Match", "If-Modified-Since", "If-Unmodified-Since", "Content-Type", "Content-Length"} {
+		get.Header.Del(name)
+	}
+
+	rec := &etagRecorder{header: http.Header{}, status: http.StatusOK, hash: sha256.New()}
+	h.ServeHTTP(rec, get)
+	return rec
+}
+
+// computeETag returns the quoted hash of the body
+func (e *etag) computeETag(body []byte) string {
+	sum := sha256.Sum256(body)
+	return e.formatETag(sum[:])
+}
+
+// formatETag returns the quoted ETag of the sha256 sum of a body
+func (e *etag) formatETag(sum []byte) string {
+	tag := `"` + base64.RawURLEncoding.EncodeToString(sum[:16]) + `"`
+	if e.weak {
+		return "W/" + tag
+	}
+	return tag
+}
+
+// matchETag tells whether the list of entity tags of an If-Match or If-None-Match header matches the ETag.
+// Strong comparison (If-Match) requires both tags to be strong, weak comparison (If-None-Match) ignores W/.
+// The wildcard matches every existing resource.
+func matchETag(header, tag string, strong bool) bool {
+	if tag == "" {
+		return false
+	}
+	if strings.TrimSpace(header) == "*" {
+		return true
+	}
+	if strong && strings.HasPrefix(tag, "W/") {
+		return false
+	}
+	tag = strings.TrimPrefix(tag, "W/")
+
+	for header != "" {
+		header = strings.TrimLeft(header, " \t,")
+		weak := strings.HasPrefix(header, "W/")
+		candidate := strings.TrimPrefix(header, "W/")
+		if !strings.HasPrefix(candidate, `"`) {
+			return false
+		}
+		end := strings.IndexByte(candidate[1:], '"')
+		if end < 0 {
+			return false
+		}
+		if candidate[:end+2] == tag && !(strong && weak) {
+			return true
+		}
+		header = candidate[end+2:]
+	}
+	return false
+}
+
+// etagWriter buffers a 200 response to compute its ETag, other and large responses are passed through
+type etagWriter struct {
+	http.ResponseWriter
+	config      *etag
+	ifNoneMatch string
+	fromGet     func() string
+	status      int
+	wroteHeader bool
+	passthrough bool
+	notModified bool
+	buf         bytes.Buffer
+}
+
+func (w *etagWriter) WriteHeader(statusCode int) {
+	if w.wroteHeader {
+		return
+	}
+	if statusCode >= 100 && statusCode < 200 && statusCode != http.StatusSwitchingProtocols {
+		w.ResponseWriter.WriteHeader(statusCode)
+		return
+	}
+	w.status = statusCode
+	w.wroteHeader = true
+	if statusCode != http.StatusOK {
+		w.startPassthrough()
+	}
+}
+
+func (w *etagWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	switch {
+	case w.notModified:
+		return len(b), nil
+	case w.passthrough:
+		return w.ResponseWriter.Write(b)
+	case w.buf.Len()+len(b) > w.config.maxBodySize:
+		w.startPassthrough()
+		return w.Write(b)
+	}
+	return w.buf.Write(b)
+}
+
+// Flush sends the response without computing an ETag
+func (w *etagWriter) Flush() {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	w.startPassthrough()
+	_ = http.NewResponseController(w.ResponseWriter).Flush()
+}
+
+func (w *etagWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return http.NewResponseController(w.ResponseWriter).Hijack()
+}
+
+// Unwrap allows http.ResponseController to reach the wrapped writer
+func (w *etagWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// startPassthrough writes the header and the buffered body, a matching ETag set by the handler still gives 304
+func (w *etagWriter) startPassthrough() {
+	if w.passthrough {
+		return
+	}
+	w.passthrough = true
+	if w.status == http.StatusOK && matchETag(w.ifNoneMatch, w.Header().Get("ETag"), false) {
+		w.writeNotModified()
+		return
+	}
+	w.ResponseWriter.WriteHeader(w.status)
+	if w.buf.Len() > 0 {
+		_, _ = w.ResponseWriter.Write(w.buf.Bytes())
+		w.buf.Reset()
+	}
+}
+
+func (w *etagWriter) writeNotModified() {
+	w.notModified = true
+	w.buf.Reset()
+	header := w.Header()
+	header.Del("Content-Type")
+	header.Del("Content-Length")
+	w.ResponseWriter.WriteHeader(http.StatusNotModified)
+}
+
+// finish sets the ETag of the buffered response and sends it or 304
+func (w *etagWriter) finish() {
+	if w.passthrough {
+		return
+	}
+	header := w.Header()
+	tag := header.Get("ETag")
+	switch {
+	case tag != "":
+	case w.fromGet != nil:
+		if tag = w.fromGet(); tag == "" {
+			w.startPassthrough()
+			return
+		}
+		header.Set("ETag", tag)
+	default:
+		tag = w.config.computeETag(w.buf.Bytes())
+		header.Set("ETag", tag)
+	}
+	if matchETag(w.ifNoneMatch, tag, false) {
+		w.writeNotModified()
+		return
+	}
+	w.startPassthrough()
+}
+
+// etagRecorder keeps the status, header and the hash and size of the body of the GET request reading the current ETag
+type etagRecorder struct {
+	header      http.Header
+	status      int
+	wroteHeader bool
+	hash        hash.Hash
+	size        int
+}
+
+// etag returns the ETag set by the handler or computed from the body
+func (r *etagRecorder) etag(e *etag) string {
+	if tag := r.header.Get("ETag"); tag != "" {
+		return tag
+	}
+	return e.formatETag(r.hash.Sum(nil))
+}
+
+func (r *etagRecorder) Header() http.Header {
+	return r.header
+}
+
+func (r *etagRecorder) WriteHeader(statusCode int) {
+	if !r.wroteHeader && (statusCode >= 200 || statusCode == http.StatusSwitchingProtocols) {
+		r.status = statusCode
+		r.wroteHeader = true
+	}
+}
+
+func (r *etagRecorder) Write(b []byte) (int, error) {
+	r.wroteHeader = true
+	r.size += len(b)
+	return r.hash.Write(b)
+}
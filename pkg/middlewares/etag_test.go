@@ -0,0 +1,324 @@
+package middlewares_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/go-chi/chi"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/d4l-data4life/go-svc/pkg/gormer"
+	"github.com/d4l-data4life/go-svc/pkg/log"
+	"github.com/d4l-data4life/go-svc/pkg/middlewares"
+	"github.com/d4l-data4life/go-svc/pkg/problem"
+	"github.com/d4l-data4life/go-svc/pkg/prom"
+)
+
+// documentHandler serves a document which PUT replaces and DELETE removes
+type documentHandler struct {
+	mu       sync.Mutex
+	document string
+	puts     int
+}
+
+func (h *documentHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		if h.document == "" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = io.WriteString(w, h.document)
+	case http.MethodPut:
+		body, _ := io.ReadAll(r.Body)
+		h.document = string(body)
+		h.puts++
+		w.WriteHeader(http.StatusNoContent)
+	case http.MethodDelete:
+		h.document = ""
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func serve(handler http.Handler, method, body string, header map[string]string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, "/documents/1", strings.NewReader(body))
+	for name, value := range header {
+		req.Header.Set(name, value)
+	}
+	res := httptest.NewRecorder()
+	handler.ServeHTTP(res, req)
+	return res
+}
+
+func TestETagConditionalGet(t *testing.T) {
+	handler := middlewares.ETag()(&documentHandler{document: `{"v":1}`})
+
+	res := serve(handler, http.MethodGet, "", nil)
+	require.Equal(t, http.StatusOK, res.Code)
+	tag := res.Header().Get("ETag")
+	assert.Regexp(t, `^"[A-Za-z0-9_-]{22}"$`, tag)
+	assert.Equal(t, `{"v":1}`, res.Body.String())
+
+	res = serve(handler, http.MethodGet, "", map[string]string{"If-None-Match": `"other", ` + tag})
+	assert.Equal(t, http.StatusNotModified, res.Code)
+	assert.Equal(t, tag, res.Header().Get("ETag"))
+	assert.Empty(t, res.Header().Get("Content-Type"))
+	assert.Empty(t, res.Body.String())
+
+	res = serve(handler, http.MethodGet, "", map[string]string{"If-None-Match": "W/" + tag})
+	assert.Equal(t, http.StatusNotModified, res.Code, "If-None-Match uses weak comparison")
+
+	res = serve(handler, http.MethodGet, "", map[string]string{"If-None-Match": `"other"`})
+	assert.Equal(t, http.StatusOK, res.Code)
+	assert.Equal(t, `{"v":1}`, res.Body.String())
+
+	res = serve(handler, http.MethodHead, "", map[string]string{"If-None-Match": tag})
+	assert.Equal(t, http.StatusNotModified, res.Code)
+}
+
+func TestETagHead(t *testing.T) {
+	var gets int
+	handler := middlewares.ETag()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.Method == http.MethodGet {
+			gets++
+			_, _ = io.WriteString(w, `{"v":1}`)
+		}
+	}))
+
+	tag := serve(handler, http.MethodGet, "", nil).Header().Get("ETag")
+	require.NotEmpty(t, tag)
+
+	res := serve(handler, http.MethodHead, "", nil)
+	assert.Equal(t, http.StatusOK, res.Code)
+	assert.Equal(t, tag, res.Header().Get("ETag"), "a HEAD request without body gets the ETag of the GET response")
+
+	res = serve(handler, http.MethodHead, "", map[string]string{"If-None-Match": tag})
+	assert.Equal(t, http.StatusNotModified, res.Code)
+	assert.Equal(t, 3, gets)
+
+	tagged := middlewares.ETag()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", `"v7"`)
+		if r.Method == http.MethodGet {
+			t.Error("the ETag set by the handler is used for HEAD requests")
+		}
+	}))
+	res = serve(tagged, http.MethodHead, "", nil)
+	assert.Equal(t, `"v7"`, res.Header().Get("ETag"))
+}
+
+func TestETagResponses(t *testing.T) {
+	tests := []struct {
+		name     string
+		options  []middlewares.ETagOption
+		handler  http.HandlerFunc
+		wantCode int
+		wantETag string
+		wantBody string
+	}{
+		{
+			name:    "weak",
+			options: []middlewares.ETagOption{middlewares.ETagWithWeak()},
+			handler: func(w http.ResponseWriter, _ *http.Request) {
+				_, _ = io.WriteString(w, "weak")
+			},
+			wantCode: http.StatusOK,
+			wantETag: `W/"`,
+			wantBody: "weak",
+		},
+		{
+			name: "handler supplied",
+			handler: func(w http.ResponseWriter, _ *http.Request) {
+				w.Header().Set("ETag", `"v7"`)
+				_, _ = io.WriteString(w, "supplied")
+			},
+			wantCode: http.StatusOK,
+			wantETag: `"v7"`,
+			wantBody: "supplied",
+		},
+		{
+			name: "error response",
+			handler: func(w http.ResponseWriter, _ *http.Request) {
+				w.WriteHeader(http.StatusNotFound)
+				_, _ = io.WriteString(w, "missing")
+			},
+			wantCode: http.StatusNotFound,
+			wantBody: "missing",
+		},
+		{
+			name:    "large response",
+			options: []middlewares.ETagOption{middlewares.ETagWithMaxBodySize(4)},
+			handler: func(w http.ResponseWriter, _ *http.Request) {
+				_, _ = io.WriteString(w, "lar")
+				_, _ = io.WriteString(w, "ge")
+			},
+			wantCode: http.StatusOK,
+			wantBody: "large",
+		},
+		{
+			name: "flushed response",
+			handler: func(w http.ResponseWriter, _ *http.Request) {
+				_, _ = io.WriteString(w, "data: 1\n\n")
+				_ = http.NewResponseController(w).Flush()
+			},
+			wantCode: http.StatusOK,
+			wantBody: "data: 1\n\n",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			res := serve(middlewares.ETag(tc.options...)(tc.handler), http.MethodGet, "", nil)
+
+			assert.Equal(t, tc.wantCode, res.Code)
+			assert.Equal(t, tc.wantBody, res.Body.String())
+			if tc.wantETag == "" {
+				assert.Empty(t, res.Header().Get("ETag"))
+			} else {
+				assert.True(t, strings.HasPrefix(res.Header().Get("ETag"), tc.wantETag), res.Header().Get("ETag"))
+			}
+		})
+	}
+}
+
+func TestETagLargeResponseWithHandlerETag(t *testing.T) {
+	handler := middlewares.ETag(middlewares.ETagWithMaxBodySize(4))(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("ETag", `"v7"`)
+		_, _ = io.WriteString(w, "large body")
+	}))
+
+	res := serve(handler, http.MethodGet, "", map[string]string{"If-None-Match": `"v7"`})
+
+	assert.Equal(t, http.StatusNotModified, res.Code)
+	assert.Empty(t, res.Body.String())
+}
+
+func TestETagIfMatch(t *testing.T) {
+	documents := &documentHandler{document: `{"v":1}`}
+	handler := middlewares.ETag(middlewares.ETagWithCurrentFromGet())(documents)
+	tag := serve(handler, http.MethodGet, "", nil).Header().Get("ETag")
+
+	res := serve(handler, http.MethodPut, `{"v":2}`, map[string]string{"If-Match": `"stale"`})
+	assert.Equal(t, http.StatusPreconditionFailed, res.Code)
+	assert.Equal(t, problem.ContentType, res.Header().Get("Content-Type"))
+	assert.Equal(t, 0, documents.puts)
+
+	res = serve(handler, http.MethodPut, `{"v":2}`, map[string]string{"If-Match": "W/" + tag})
+	assert.Equal(t, http.StatusPreconditionFailed, res.Code, "If-Match uses strong comparison")
+
+	res = serve(handler, http.MethodPut, `{"v":2}`, map[string]string{"If-Match": tag})
+	assert.Equal(t, http.StatusNoContent, res.Code)
+	assert.Equal(t, `{"v":2}`, documents.document)
+
+	// the second update with the same ETag lost the race
+	res = serve(handler, http.MethodPut, `{"v":3}`, map[string]string{"If-Match": tag})
+	assert.Equal(t, http.StatusPreconditionFailed, res.Code)
+	assert.Equal(t, `{"v":2}`, documents.document)
+
+	res = serve(handler, http.MethodPut, `{"v":1}`, map[string]string{"If-None-Match": "*"})
+	assert.Equal(t, http.StatusPreconditionFailed, res.Code, "the document already exists")
+
+	res = serve(handler, http.MethodDelete, "", map[string]string{"If-Match": "*"})
+	assert.Equal(t, http.StatusNoContent, res.Code)
+
+	res = serve(handler, http.MethodDelete, "", map[string]string{"If-Match": "*"})
+	assert.Equal(t, http.StatusPreconditionFailed, res.Code, "the document does not exist anymore")
+
+	res = serve(handler, http.MethodPut, `{"v":1}`, map[string]string{"If-None-Match": "*"})
+	assert.Equal(t, http.StatusNoContent, res.Code)
+
+	res = serve(handler, http.MethodPut, `{"v":4}`, nil)
+	assert.Equal(t, http.StatusNoContent, res.Code, "unconditional requests pass")
+}
+
+func TestETagIfMatchWildcardOnLargeResponses(t *testing.T) {
+	documents := &documentHandler{document: strings.Repeat("x", 10)}
+	handler := middlewares.ETag(middlewares.ETagWithCurrentFromGet(), middlewares.ETagWithMaxBodySize(4))(documents)
+
+	assert.Empty(t, serve(handler, http.MethodGet, "", nil).Header().Get("ETag"))
+	assert.Empty(t, serve(handler, http.MethodHead, "", nil).Header().Get("ETag"), "HEAD matches the GET response")
+
+	res := serve(handler, http.MethodPut, `{"v":2}`, map[string]string{"If-Match": "*"})
+	assert.Equal(t, http.StatusNoContent, res.Code)
+	assert.Equal(t, 1, documents.puts)
+}
+
+func TestETagRouteMountedPut(t *testing.T) {
+	var bodies []string
+	r := chi.NewRouter()
+	r.With(middlewares.ETag()).Put("/documents/{id}", func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		bodies = append(bodies, string(body))
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	res := serve(r, http.MethodPut, `{"v":2}`, map[string]string{"If-Match": `"v1"`})
+
+	// without ETagWithCurrent the precondition is left to the handler, which is not executed as GET
+	assert.Equal(t, http.StatusNoContent, res.Code)
+	assert.Equal(t, []string{`{"v":2}`}, bodies)
+}
+
+func TestETagRequiredIfMatch(t *testing.T) {
+	documents := &documentHandler{document: `{"v":1}`}
+	handler := middlewares.ETag(middlewares.ETagWithRequiredIfMatch())(documents)
+
+	res := serve(handler, http.MethodPatch, `{"v":2}`, nil)
+
+	assert.Equal(t, http.StatusPreconditionRequired, res.Code)
+	assert.Equal(t, 0, documents.puts)
+}
+
+func TestETagWithCurrent(t *testing.T) {
+	errUnavailable := errors.New("database unavailable")
+	var currentErr error
+	handler := middlewares.ETag(middlewares.ETagWithCurrent(func(_ *http.Request) (string, error) {
+		return `"version-3"`, currentErr
+	}))(&documentHandler{document: `{"v":3}`})
+
+	assert.Equal(t, http.StatusNoContent, serve(handler, http.MethodPut, `{"v":4}`, map[string]string{"If-Match": `"version-3"`}).Code)
+	assert.Equal(t, http.StatusPreconditionFailed, serve(handler, http.MethodPut, `{"v":4}`, map[string]string{"If-Match": `"version-2"`}).Code)
+
+	currentErr = gormer.ErrNotFound
+	assert.Equal(t, http.StatusNotFound, serve(handler, http.MethodPut, `{"v":4}`, map[string]string{"If-Match": `"version-3"`}).Code)
+	currentErr = errUnavailable
+	assert.Equal(t, http.StatusInternalServerError, serve(handler, http.MethodPut, `{"v":4}`, map[string]string{"If-Match": `"version-3"`}).Code)
+}
+
+func TestETagLoggedAndCounted(t *testing.T) {
+	buf := new(bytes.Buffer)
+	logger := log.NewLogger("test", "v0", "localhost", log.WithWriter(buf))
+	instrumenter := prom.NewHandlerInstrumenter(prom.WithSubsystem("etag"))
+
+	handler := logger.HTTPMiddleware()(instrumenter.Instrument("documents",
+		middlewares.ETag()(&documentHandler{document: `{"v":1}`})))
+	tag := serve(handler, http.MethodGet, "", nil).Header().Get("ETag")
+	buf.Reset()
+
+	res := serve(handler, http.MethodGet, "", map[string]string{"If-None-Match": tag})
+	require.Equal(t, http.StatusNotModified, res.Code)
+
+	logs := json.NewDecoder(buf)
+	var requestLog, responseLog map[string]any
+	require.NoError(t, logs.Decode(&requestLog))
+	require.NoError(t, logs.Decode(&responseLog))
+	assert.Equal(t, float64(http.StatusNotModified), responseLog["response-code"])
+	assert.Equal(t, "", responseLog["response-body"])
+
+	metrics := httptest.NewRecorder()
+	promhttp.Handler().ServeHTTP(metrics, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	assert.Contains(t, metrics.Body.String(), `d4l_etag_http_requests_total{code="304",handler="documents",method="get"} 1`)
+}
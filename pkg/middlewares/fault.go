@@ -0,0 +1,38 @@
+package middlewares
+
+import (
+	"net/http"
+
+	"github.com/d4l-data4life/go-svc/pkg/fault"
+	"github.com/d4l-data4life/go-svc/pkg/problem"
+)
+
+// FaultInjector middleware injects latency, aborted connections or status codes into incoming requests
+// matching the rules of the injector. The rules can be changed at runtime with injector.Handler().
+func FaultInjector(injector *fault.Injector) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			rule, ok := injector.Match(fault.Server, r, r.Host)
+			if !ok {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if err := fault.Delay(r.Context(), rule); err != nil {
+				return
+			}
+
+			if rule.Error {
+				// makes net/http close the connection without writing a response
+				panic(http.ErrAbortHandler)
+			}
+
+			if rule.StatusCode != 0 {
+				problem.Write(w, r, problem.New(rule.StatusCode, "fault injected by rule "+rule.Name))
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,42 @@
+package middlewares_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/d4l-data4life/go-svc/pkg/fault"
+	"github.com/d4l-data4life/go-svc/pkg/log"
+	"github.com/d4l-data4life/go-svc/pkg/middlewares"
+)
+
+func TestFaultInjector(t *testing.T) {
+	injector := fault.NewInjector(fault.WithLogger(log.NewLogger("test", "v0", "localhost", log.WithWriter(io.Discard))))
+	handler := middlewares.FaultInjector(injector)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	t.Run("status code", func(t *testing.T) {
+		require.NoError(t, injector.SetRules(fault.Rule{Name: "status", Path: "^/api", Percentage: 100, StatusCode: http.StatusBadGateway}))
+
+		res := httptest.NewRecorder()
+		handler.ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/api/records", nil))
+		assert.Equal(t, http.StatusBadGateway, res.Code)
+
+		res = httptest.NewRecorder()
+		handler.ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/health", nil))
+		assert.Equal(t, http.StatusOK, res.Code)
+	})
+
+	t.Run("aborted connection", func(t *testing.T) {
+		require.NoError(t, injector.SetRules(fault.Rule{Name: "error", Percentage: 100, Error: true}))
+
+		srv := httptest.NewServer(handler)
+		defer srv.Close()
+
+		_, err := srv.Client().Get(srv.URL)
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,194 @@
+package middlewares
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/d4l-data4life/go-svc/pkg/httpsig"
+	"github.com/d4l-data4life/go-svc/pkg/log"
+	"github.com/d4l-data4life/go-svc/pkg/logging"
+	"github.com/d4l-data4life/go-svc/pkg/problem"
+)
+
+// Errors of the HMAC signature verification
+var (
+	ErrNoSignatureInRequest = errors.New("no signature present in request")
+	ErrInvalidSignature     = errors.New("invalid request signature")
+	ErrSignatureExpired     = errors.New("request signature outside of the allowed clock skew")
+	ErrReplayedRequest      = errors.New("request signature nonce already used")
+)
+
+// NonceCache remembers the nonces of verified signatures to reject replayed requests.
+// Implementations shared between instances (e.g. backed by a database) also detect replays sent to other instances.
+type NonceCache interface {
+	// Add stores the nonce until the expiry and reports false if it is already stored
+	Add(ctx context.Context, nonce string, expiry time.Time) (bool, error)
+}
+
+// MemoryNonceCache is a NonceCache of a single instance
+type MemoryNonceCache struct {
+	mu        sync.Mutex
+	nonces    map[string]time.Time
+	lastSweep time.Time
+}
+
+// NewMemoryNonceCache creates an empty in-memory nonce cache
+func NewMemoryNonceCache() *MemoryNonceCache {
+	return &MemoryNonceCache{nonces: map[string]time.Time{}, lastSweep: time.Now()}
+}
+
+func (c *MemoryNonceCache) Add(_ context.Context, nonce string, expiry time.Time) (bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	// expired nonces are removed at most once per minute to keep Add cheap
+	if now.Sub(c.lastSweep) > time.Minute {
+		for n, e := range c.nonces {
+			if now.After(e) {
+				delete(c.nonces, n)
+			}
+		}
+		c.lastSweep = now
+	}
+
+	if e, ok := c.nonces[nonce]; ok && now.Before(e) {
+		return false, nil
+	}
+	c.nonces[nonce] = expiry
+	return true, nil
+}
+
+// HMACVerifier validates requests signed by transport.HMACSign
+type HMACVerifier struct {
+	secrets     *SecretSet
+	clockSkew   time.Duration
+	nonces      NonceCache
+	maxBodySize int64
+	logger      *log.Logger
+}
+
+// HMACOption is to be implemented by functional options
+type HMACOption func(*HMACVerifier)
+
+// HMACWithClockSkew sets how far the signature timestamp may deviate from the local clock (defaults to 5 minutes)
+func HMACWithClockSkew(skew time.Duration) HMACOption {
+	return func(v *HMACVerifier) {
+		v.clockSkew = skew
+	}
+}
+
+// HMACWithNonceCache sets the cache used to detect replayed requests (defaults to a MemoryNonceCache)
+func HMACWithNonceCache(cache NonceCache) HMACOption {
+	return func(v *HMACVerifier) {
+		v.nonces = cache
+	}
+}
+
+// HMACWithMaxBodySize limits the size of request bodies read for the digest (defaults to 10 MiB)
+func HMACWithMaxBodySize(size int64) HMACOption {
+	return func(v *HMACVerifier) {
+		v.maxBodySize = size
+	}
+}
+
+// HMACWithLogger sets the logger used for audit logs of failed verifications (defaults to the logging singleton)
+func HMACWithLogger(logger *log.Logger) HMACOption {
+	return func(v *HMACVerifier) {
+		v.logger = logger
+	}
+}
+
+// NewHMACVerifier creates a verifier accepting signatures made with any key of the secret set
+func NewHMACVerifier(secrets *SecretSet, options ...HMACOption) *HMACVerifier {
+	v := &HMACVerifier{
+		secrets:     secrets,
+		clockSkew:   5 * time.Minute,
+		maxBodySize: 10 << 20,
+	}
+	for _, apply := range options {
+		apply(v)
+	}
+	if v.nonces == nil {
+		v.nonces = NewMemoryNonceCache()
+	}
+	if v.logger == nil {
+		v.logger = logging.Logger()
+	}
+	return v
+}
+
+// HMACVerify is the decorator that protects a handler with request signatures made by transport.HMACSign.
+// Requests with invalid, expired or replayed signatures are audit logged and answered with 401.
+func HMACVerify(secrets *SecretSet, options ...HMACOption) func(http.Handler) http.Handler {
+	return NewHMACVerifier(secrets, options...).Verify()
+}
+
+// Verify is the decorator that protects a handler with request signatures, see HMACVerify
+func (v *HMACVerifier) Verify() func(http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			ctx := context.WithValue(req.Context(), log.RequestURLContextKey, req.URL.Path)
+			ctx = context.WithValue(ctx, log.RequestDomainContextKey, req.Host)
+			req = req.WithContext(ctx)
+
+			body, err := io.ReadAll(http.MaxBytesReader(w, req.Body, v.maxBodySize))
+			if err != nil {
+				var maxBytesErr *http.MaxBytesError
+				if errors.As(err, &maxBytesErr) {
+					WriteProblem(w, req, ErrRequestBodyTooLarge)
+					return
+				}
+				problem.Write(w, req, problem.New(http.StatusBadRequest, "reading request body failed"))
+				return
+			}
+			req.Body = io.NopCloser(bytes.NewReader(body))
+
+			if err := v.verify(req, body); err != nil {
+				_ = v.logger.AuditSecurityFailure(ctx, SecurityEventAuthentication, log.Message(err.Error()))
+				WriteProblem(w, req, err)
+				return
+			}
+
+			h.ServeHTTP(w, req)
+		})
+	}
+}
+
+func (v *HMACVerifier) verify(req *http.Request, body []byte) error {
+	header := req.Header.Get(httpsig.SignatureHeader)
+	if header == "" {
+		return ErrNoSignatureInRequest
+	}
+	params, err := httpsig.ParseParams(header)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidSignature, err)
+	}
+
+	key, ok := v.secrets.Secret(params.KeyID)
+	if !ok {
+		return fmt.Errorf("%w: unknown key ID %q", ErrInvalidSignature, params.KeyID)
+	}
+	if skew := time.Since(params.Timestamp); skew > v.clockSkew || skew < -v.clockSkew {
+		return ErrSignatureExpired
+	}
+	if !httpsig.Verify(key, req, params, httpsig.Digest(body)) {
+		return ErrInvalidSignature
+	}
+
+	// only nonces of valid signatures are stored, so the cache cannot be flooded by unauthenticated callers
+	fresh, err := v.nonces.Add(req.Context(), params.KeyID+":"+params.Nonce, params.Timestamp.Add(v.clockSkew))
+	if err != nil {
+		return fmt.Errorf("checking signature nonce: %w", err)
+	}
+	if !fresh {
+		return ErrReplayedRequest
+	}
+	return nil
+}
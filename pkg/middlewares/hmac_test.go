@@ -0,0 +1,134 @@
+package middlewares_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/d4l-data4life/go-svc/pkg/httpsig"
+	"github.com/d4l-data4life/go-svc/pkg/log"
+	"github.com/d4l-data4life/go-svc/pkg/middlewares"
+	"github.com/d4l-data4life/go-svc/pkg/transport"
+)
+
+// tamperingTransport modifies signed requests before they are sent
+type tamperingTransport struct {
+	tamper func(*http.Request)
+}
+
+func (t tamperingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.tamper(req)
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func TestHMACVerify(t *testing.T) {
+	secrets, err := middlewares.NewSecretSet(middlewares.StaticSecrets(map[string]string{"svc-a": "key-a"}))
+	require.NoError(t, err)
+
+	buf := new(bytes.Buffer)
+	logger := log.NewLogger("test", "v0", "localhost", log.WithWriter(buf))
+
+	var gotBody string
+	srv := httptest.NewServer(middlewares.HMACVerify(secrets,
+		middlewares.HMACWithLogger(logger),
+		middlewares.HMACWithClockSkew(time.Minute),
+	)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		gotBody = string(body)
+	})))
+	defer srv.Close()
+
+	send := func(t *testing.T, rt http.RoundTripper) int {
+		t.Helper()
+		req, err := http.NewRequest(http.MethodPost, srv.URL+"/records?owner=1", strings.NewReader(`{"a":1}`))
+		require.NoError(t, err)
+		req.Header.Set("Content-Type", "application/json")
+
+		res, err := (&http.Client{Transport: rt}).Do(req)
+		require.NoError(t, err)
+		_ = res.Body.Close()
+		return res.StatusCode
+	}
+
+	tests := []struct {
+		name       string
+		rt         http.RoundTripper
+		wantStatus int
+	}{
+		{"valid signature", transport.HMACSign("svc-a", "key-a")(nil), http.StatusOK},
+		{"unsigned request", http.DefaultTransport, http.StatusUnauthorized},
+		{"wrong key", transport.HMACSign("svc-a", "key-b")(nil), http.StatusUnauthorized},
+		{"unknown key ID", transport.HMACSign("svc-b", "key-a")(nil), http.StatusUnauthorized},
+		{"tampered body", transport.HMACSign("svc-a", "key-a")(tamperingTransport{func(r *http.Request) {
+			r.Body = io.NopCloser(strings.NewReader(`{"a":2}`))
+		}}), http.StatusUnauthorized},
+		{"tampered signed header", transport.HMACSign("svc-a", "key-a")(tamperingTransport{func(r *http.Request) {
+			r.Header.Set("Content-Type", "text/plain")
+		}}), http.StatusUnauthorized},
+		{"expired signature", tamperingTransport{func(r *http.Request) {
+			params := httpsig.Params{KeyID: "svc-a", Timestamp: time.Now().Add(-2 * time.Minute), Nonce: "expired", Headers: httpsig.DefaultHeaders}
+			params.Signature = httpsig.Sign([]byte("key-a"), r, params, httpsig.Digest([]byte(`{"a":1}`)))
+			r.Header.Set(httpsig.SignatureHeader, params.String())
+		}}, http.StatusUnauthorized},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			buf.Reset()
+			gotBody = ""
+
+			require.Equal(t, tc.wantStatus, send(t, tc.rt))
+			if tc.wantStatus == http.StatusOK {
+				assert.Equal(t, `{"a":1}`, gotBody, "the body must be readable by the handler")
+				return
+			}
+
+			auditLog := map[string]any{}
+			require.NoError(t, json.Unmarshal(buf.Bytes(), &auditLog))
+			assert.Equal(t, middlewares.SecurityEventAuthentication, auditLog["security-event"])
+			assert.Equal(t, false, auditLog["successful"])
+		})
+	}
+
+	t.Run("replayed request", func(t *testing.T) {
+		var signed *http.Request
+		capture := tamperingTransport{func(r *http.Request) { signed = r }}
+		require.Equal(t, http.StatusOK, send(t, transport.HMACSign("svc-a", "key-a")(capture)))
+
+		replay := tamperingTransport{func(r *http.Request) {
+			r.Header.Set(httpsig.SignatureHeader, signed.Header.Get(httpsig.SignatureHeader))
+		}}
+		buf.Reset()
+		assert.Equal(t, http.StatusUnauthorized, send(t, replay))
+		assert.Contains(t, buf.String(), middlewares.ErrReplayedRequest.Error())
+	})
+}
+
+func TestMemoryNonceCache(t *testing.T) {
+	cache := middlewares.NewMemoryNonceCache()
+	ctx := context.Background()
+
+	fresh, err := cache.Add(ctx, "n1", time.Now().Add(time.Minute))
+	require.NoError(t, err)
+	assert.True(t, fresh)
+
+	fresh, err = cache.Add(ctx, "n1", time.Now().Add(time.Minute))
+	require.NoError(t, err)
+	assert.False(t, fresh)
+
+	fresh, err = cache.Add(ctx, "n2", time.Now().Add(-time.Second))
+	require.NoError(t, err)
+	assert.True(t, fresh)
+	fresh, err = cache.Add(ctx, "n2", time.Now().Add(time.Minute))
+	require.NoError(t, err)
+	assert.True(t, fresh, "expired nonces can be used again")
+}
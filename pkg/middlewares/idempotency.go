@@ -0,0 +1,341 @@
+package middlewares
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/d4l-data4life/go-svc/pkg/log"
+	"github.com/d4l-data4life/go-svc/pkg/logging"
+	"github.com/d4l-data4life/go-svc/pkg/problem"
+)
+
+// IdempotencyKeyHeader is the header carrying the idempotency key of a request
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// IdempotentReplayedHeader is set on responses replayed from the store
+const IdempotentReplayedHeader = "Idempotent-Replayed"
+
+// Errors of the idempotency middleware
+var (
+	ErrInvalidIdempotencyKey       = errors.New("idempotency key is longer than 255 characters")
+	ErrIdempotencyKeyReused        = errors.New("idempotency key already used for a different request")
+	ErrIdempotentRequestInProgress = errors.New("request with the same idempotency key is still in progress")
+)
+
+// IdempotentResponse is the stored response of a completed request
+type IdempotentResponse struct {
+	Status int
+	Header http.Header
+	Body   []byte
+}
+
+// IdempotencyStore keeps the idempotency keys of a scope (the tenant) with the fingerprint of their request and its response
+type IdempotencyStore interface {
+	// Begin claims the key for a request with the fingerprint until the expiry and returns nil.
+	// If the key is already claimed and not expired, it returns the response of the completed request,
+	// ErrIdempotencyKeyReused if the request had a different fingerprint
+	// or ErrIdempotentRequestInProgress if the request has not completed yet.
+	// A claim of a request with the same fingerprint which did not complete until lockedUntil is taken over,
+	// so a crashed instance does not block the key until it expires.
+	Begin(ctx context.Context, scope, key, fingerprint string, lockedUntil, expiry time.Time) (*IdempotentResponse, error)
+	// Complete stores the response of the request which claimed the key
+	Complete(ctx context.Context, scope, key string, resp IdempotentResponse) error
+	// Release removes the claim of a request which did not complete, so the key can be retried
+	Release(ctx context.Context, scope, key string) error
+}
+
+type memoryIdempotencyEntry struct {
+	fingerprint string
+	lockedUntil time.Time
+	expiry      time.Time
+	response    *IdempotentResponse
+}
+
+// MemoryIdempotencyStore keeps the keys in memory, repeats are only detected by the same instance
+type MemoryIdempotencyStore struct {
+	mu        sync.Mutex
+	entries   map[string]*memoryIdempotencyEntry
+	lastSweep time.Time
+}
+
+// NewMemoryIdempotencyStore creates an empty in-memory store
+func NewMemoryIdempotencyStore() *MemoryIdempotencyStore {
+	return &MemoryIdempotencyStore{entries: map[string]*memoryIdempotencyEntry{}, lastSweep: time.Now()}
+}
+
+func (s *MemoryIdempotencyStore) Begin(_ context.Context, scope, key, fingerprint string, lockedUntil, expiry time.Time) (*IdempotentResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	// expired keys are removed at most once per minute to keep Begin cheap
+	if now.Sub(s.lastSweep) > time.Minute {
+		for k, e := range s.entries {
+			if now.After(e.expiry) {
+				delete(s.entries, k)
+			}
+		}
+		s.lastSweep = now
+	}
+
+	e, ok := s.entries[scope+"\x00"+key]
+	switch {
+	case !ok || now.After(e.expiry):
+		s.entries[scope+"\x00"+key] = &memoryIdempotencyEntry{fingerprint: fingerprint, lockedUntil: lockedUntil, expiry: expiry}
+		return nil, nil
+	case e.fingerprint != fingerprint:
+		return nil, ErrIdempotencyKeyReused
+	case e.response == nil && now.After(e.lockedUntil):
+		e.lockedUntil, e.expiry = lockedUntil, expiry
+		return nil, nil
+	case e.response == nil:
+		return nil, ErrIdempotentRequestInProgress
+	default:
+		return e.response, nil
+	}
+}
+
+func (s *MemoryIdempotencyStore) Complete(_ context.Context, scope, key string, resp IdempotentResponse) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if e, ok := s.entries[scope+"\x00"+key]; ok {
+		e.response = &resp
+	}
+	return nil
+}
+
+func (s *MemoryIdempotencyStore) Release(_ context.Context, scope, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if e, ok := s.entries[scope+"\x00"+key]; ok && e.response == nil {
+		delete(s.entries, scope+"\x00"+key)
+	}
+	return nil
+}
+
+type idempotency struct {
+	store       IdempotencyStore
+	ttl         time.Duration
+	lockTimeout time.Duration
+	maxBodySize int64
+	logger      *log.Logger
+}
+
+// IdempotencyOption is to be implemented by functional options
+type IdempotencyOption func(*idempotency)
+
+// IdempotencyWithTTL sets how long keys and their responses are kept (defaults to 24 hours)
+func IdempotencyWithTTL(ttl time.Duration) IdempotencyOption {
+	return func(i *idempotency) {
+		i.ttl = ttl
+	}
+}
+
+// IdempotencyWithLockTimeout sets after which time a request still in progress is considered lost (defaults to 1 minute).
+// Repeats of the request are then executed again instead of being answered with 409,
+// so the timeout should exceed the longest duration of a request.
+func IdempotencyWithLockTimeout(timeout time.Duration) IdempotencyOption {
+	return func(i *idempotency) {
+		i.lockTimeout = timeout
+	}
+}
+
+// IdempotencyWithMaxBodySize limits the size of the buffered request and response bodies (defaults to 10 MiB).
+// Larger requests are rejected with 413, larger responses are not stored.
+func IdempotencyWithMaxBodySize(size int64) IdempotencyOption {
+	return func(i *idempotency) {
+		i.maxBodySize = size
+	}
+}
+
+// IdempotencyWithLogger sets the logger used for store errors (defaults to the logging singleton)
+func IdempotencyWithLogger(logger *log.Logger) IdempotencyOption {
+	return func(i *idempotency) {
+		i.logger = logger
+	}
+}
+
+// Idempotency is the decorator that executes unsafe requests carrying an Idempotency-Key header at most once
+// per key and tenant (log.TenantIDContextKey), so it has to be installed after the tenant middleware.
+// Repeats with the same method, path, query and body get the stored response with the Idempotent-Replayed header,
+// repeats while the first request is in progress and reuses of a key for a different request are answered with 409.
+// Repeats after the lock timeout of a request which did not complete, e.g. due to a crash, are executed again.
+// Responses with 5xx status are not stored, so the request can be retried.
+// Only the headers set by the handler are stored, the replay keeps the headers of the outer middlewares.
+// Requests are executed without deduplication if the store fails, so an unavailable database does not take the service down.
+func Idempotency(store IdempotencyStore, options ...IdempotencyOption) func(http.Handler) http.Handler {
+	i := &idempotency{
+		store:       store,
+		ttl:         24 * time.Hour,
+		lockTimeout: time.Minute,
+		maxBodySize: 10 << 20,
+	}
+	for _, apply := range options {
+		apply(i)
+	}
+	if i.logger == nil {
+		i.logger = logging.Logger()
+	}
+
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := r.Header.Get(IdempotencyKeyHeader)
+			if key == "" || r.Method == http.MethodGet || r.Method == http.MethodHead || r.Method == http.MethodOptions {
+				h.ServeHTTP(w, r)
+				return
+			}
+			if len(key) > 255 {
+				WriteProblem(w, r, ErrInvalidIdempotencyKey)
+				return
+			}
+
+			body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, i.maxBodySize))
+			if err != nil {
+				var maxBytesErr *http.MaxBytesError
+				if errors.As(err, &maxBytesErr) {
+					WriteProblem(w, r, ErrRequestBodyTooLarge)
+					return
+				}
+				problem.Write(w, r, problem.New(http.StatusBadRequest, "reading request body failed"))
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(body))
+
+			ctx := r.Context()
+			scope, _ := ctx.Value(log.TenantIDContextKey).(string)
+			now := time.Now()
+			stored, err := i.store.Begin(ctx, scope, key, fingerprint(r, body), now.Add(i.lockTimeout), now.Add(i.ttl))
+			switch {
+			case errors.Is(err, ErrIdempotencyKeyReused) || errors.Is(err, ErrIdempotentRequestInProgress):
+				WriteProblem(w, r, err)
+				return
+			case err != nil:
+				_ = i.logger.ErrGeneric(ctx, fmt.Errorf("idempotency store: %w", err))
+				h.ServeHTTP(w, r)
+				return
+			case stored != nil:
+				replay(w, stored)
+				return
+			}
+
+			rec := &recordingWriter{ResponseWriter: w, status: http.StatusOK, limit: i.maxBodySize, before: w.Header().Clone()}
+			// the outcome is stored even if the client went away, so its retry gets the response
+			storeCtx := context.WithoutCancel(ctx)
+			completed := false
+			defer func() {
+				if completed {
+					return
+				}
+				if err := i.store.Release(storeCtx, scope, key); err != nil {
+					_ = i.logger.ErrGeneric(ctx, fmt.Errorf("idempotency store: %w", err))
+				}
+			}()
+
+			h.ServeHTTP(rec, r)
+
+			if rec.status >= http.StatusInternalServerError || rec.overflow {
+				return
+			}
+			header := rec.header
+			if header == nil {
+				header = handlerHeader(rec.before, w.Header())
+			}
+			err = i.store.Complete(storeCtx, scope, key, IdempotentResponse{
+				Status: rec.status,
+				Header: header,
+				Body:   rec.body.Bytes(),
+			})
+			if err != nil {
+				_ = i.logger.ErrGeneric(ctx, fmt.Errorf("idempotency store: %w", err))
+				return
+			}
+			completed = true
+		})
+	}
+}
+
+// fingerprint identifies a request by its method, path with query and body
+func fingerprint(r *http.Request, body []byte) string {
+	sum := sha256.New()
+	_, _ = fmt.Fprintf(sum, "%s\n%s\n", r.Method, r.URL.RequestURI())
+	_, _ = sum.Write(body)
+	return hex.EncodeToString(sum.Sum(nil))
+}
+
+// replay writes the stored response, the headers set by the outer middlewares for this request
+// (e.g. RateLimit-*, Trace-Id, Set-Cookie or CORS) take precedence over the stored ones
+func replay(w http.ResponseWriter, resp *IdempotentResponse) {
+	header := w.Header()
+	for name, values := range resp.Header {
+		if _, ok := header[name]; !ok {
+			header[name] = values
+		}
+	}
+	header.Set(IdempotentReplayedHeader, "true")
+	w.WriteHeader(resp.Status)
+	_, _ = w.Write(resp.Body)
+}
+
+// handlerHeader returns the headers the handler added or changed compared to the headers before the handler ran
+func handlerHeader(before, after http.Header) http.Header {
+	header := http.Header{}
+	for name, values := range after {
+		if !slices.Equal(before[name], values) {
+			header[name] = slices.Clone(values)
+		}
+	}
+	return header
+}
+
+// recordingWriter captures the status, header and body (up to the limit) written by the handler,
+// the header only contains what the handler added to the headers set before (by the outer middlewares)
+type recordingWriter struct {
+	http.ResponseWriter
+	status      int
+	before      http.Header
+	header      http.Header
+	wroteHeader bool
+	body        bytes.Buffer
+	limit       int64
+	overflow    bool
+}
+
+func (w *recordingWriter) WriteHeader(statusCode int) {
+	if !w.wroteHeader {
+		w.status = statusCode
+		w.header = handlerHeader(w.before, w.ResponseWriter.Header())
+		w.wroteHeader = true
+	}
+	w.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (w *recordingWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	if !w.overflow {
+		if int64(w.body.Len()+len(b)) > w.limit {
+			w.overflow = true
+			w.body.Reset()
+		} else {
+			w.body.Write(b)
+		}
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// Unwrap allows http.ResponseController to reach the Flusher and Hijacker of the wrapped writer
+func (w *recordingWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
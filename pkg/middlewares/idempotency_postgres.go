@@ -0,0 +1,124 @@
+package middlewares
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/d4l-data4life/go-svc/pkg/db"
+	"github.com/d4l-data4life/go-svc/pkg/migrate"
+)
+
+//go:embed migrations/idempotency_keys/*.sql
+var idempotencyKeysMigrations embed.FS
+
+// IdempotencyKeysMigrationVersion is the latest version of the migrations of the idempotency_keys table
+const IdempotencyKeysMigrationVersion = 1
+
+// NewIdempotencyKeysMigration returns the migrations creating the table of the PostgresIdempotencyStore.
+// They are tracked in the idempotency_keys_migrations table, apart from the migrations of the service.
+//
+//	m := middlewares.NewIdempotencyKeysMigration(sqlDB, logging.Logger())
+//	err := m.MigrateDB(ctx, middlewares.IdempotencyKeysMigrationVersion, true)
+func NewIdempotencyKeysMigration(db *sql.DB, log interface {
+	InfoGeneric(context.Context, string) error
+}) *migrate.Migration {
+	// fs.Sub only fails for invalid paths
+	source, _ := fs.Sub(idempotencyKeysMigrations, "migrations/idempotency_keys")
+	return migrate.NewMigrationFromFS(db, source, "idempotency_keys_migrations", log)
+}
+
+// IdempotencyKey is a row of the idempotency_keys table, Status is 0 while the request is in progress
+type IdempotencyKey struct {
+	TenantID    string `gorm:"primaryKey"`
+	Key         string `gorm:"primaryKey"`
+	Fingerprint string
+	Status      int
+	Header      string
+	Body        []byte
+	LockedUntil time.Time
+	ExpiresAt   time.Time
+}
+
+// PostgresIdempotencyStore keeps the keys in the database of db.Get(), repeats are detected across all replicas
+type PostgresIdempotencyStore struct{}
+
+// NewPostgresIdempotencyStore creates a store using the database connection of db.Get()
+func NewPostgresIdempotencyStore() *PostgresIdempotencyStore {
+	return &PostgresIdempotencyStore{}
+}
+
+func (s *PostgresIdempotencyStore) Begin(ctx context.Context, scope, key, fingerprint string, lockedUntil, expiry time.Time) (*IdempotentResponse, error) {
+	var stored *IdempotentResponse
+
+	err := db.Get().WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// inserts the key or takes over an expired one or a lost claim of the same request,
+		// a claimed key is left untouched
+		now := time.Now()
+		claim := IdempotencyKey{TenantID: scope, Key: key, Fingerprint: fingerprint, LockedUntil: lockedUntil, ExpiresAt: expiry}
+		result := tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "tenant_id"}, {Name: "key"}},
+			DoUpdates: clause.AssignmentColumns([]string{"fingerprint", "status", "header", "body", "locked_until", "expires_at"}),
+			Where: clause.Where{Exprs: []clause.Expression{
+				clause.Expr{
+					SQL: "idempotency_keys.expires_at < ? OR (idempotency_keys.status = 0 AND idempotency_keys.locked_until < ? " +
+						"AND idempotency_keys.fingerprint = excluded.fingerprint)",
+					Vars: []any{now, now},
+				},
+			}},
+		}).Create(&claim)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 1 {
+			return nil
+		}
+
+		var existing IdempotencyKey
+		if err := tx.Take(&existing, "tenant_id = ? AND key = ?", scope, key).Error; err != nil {
+			return err
+		}
+		switch {
+		case existing.Fingerprint != fingerprint:
+			return ErrIdempotencyKeyReused
+		case existing.Status == 0:
+			return ErrIdempotentRequestInProgress
+		}
+
+		stored = &IdempotentResponse{Status: existing.Status, Body: existing.Body}
+		if err := json.Unmarshal([]byte(existing.Header), &stored.Header); err != nil {
+			return fmt.Errorf("decoding stored header: %w", err)
+		}
+		return nil
+	})
+
+	return stored, err
+}
+
+func (s *PostgresIdempotencyStore) Complete(ctx context.Context, scope, key string, resp IdempotentResponse) error {
+	header, err := json.Marshal(resp.Header)
+	if err != nil {
+		return fmt.Errorf("encoding header: %w", err)
+	}
+	return db.Get().WithContext(ctx).Model(&IdempotencyKey{}).
+		Where("tenant_id = ? AND key = ?", scope, key).
+		Updates(map[string]any{"status": resp.Status, "header": string(header), "body": resp.Body}).Error
+}
+
+func (s *PostgresIdempotencyStore) Release(ctx context.Context, scope, key string) error {
+	return db.Get().WithContext(ctx).
+		Where("tenant_id = ? AND key = ? AND status = 0", scope, key).
+		Delete(&IdempotencyKey{}).Error
+}
+
+// DeleteExpired removes the keys expired before the given time, run it periodically to keep the table small
+func (s *PostgresIdempotencyStore) DeleteExpired(ctx context.Context, before time.Time) error {
+	return db.Get().WithContext(ctx).Where("expires_at < ?", before).Delete(&IdempotencyKey{}).Error
+}
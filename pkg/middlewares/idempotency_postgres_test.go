@@ -0,0 +1,99 @@
+package middlewares_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+
+	"github.com/d4l-data4life/go-svc/pkg/db"
+	"github.com/d4l-data4life/go-svc/pkg/log"
+	"github.com/d4l-data4life/go-svc/pkg/middlewares"
+)
+
+func initIdempotencyDB(t *testing.T) {
+	t.Helper()
+	db.InitializeTestPostgres(db.NewConnection(
+		db.WithHost("localhost"),
+		db.WithPort("5432"),
+		db.WithDatabaseName("test"),
+		db.WithDatabaseSchema("testing"),
+		db.WithUser("user"),
+		db.WithPassword("test"),
+		db.WithSSLMode("disable"),
+		db.WithMigrationFunc(func(conn *gorm.DB) error {
+			conn.Exec("CREATE SCHEMA IF NOT EXISTS \"testing\"")
+			sqlDB, err := conn.DB()
+			if err != nil {
+				return err
+			}
+			logger := log.NewLogger("test", "v0", "localhost", log.WithWriter(io.Discard))
+			return middlewares.NewIdempotencyKeysMigration(sqlDB, logger).MigrateDB(context.Background(), middlewares.IdempotencyKeysMigrationVersion, true)
+		}),
+		db.WithDriverFunc(db.TXDBPostgresDriver),
+	))
+	if db.Get() == nil || db.Ping() != nil {
+		t.Skip("postgres is not available")
+	}
+	t.Cleanup(db.Close)
+}
+
+func TestPostgresIdempotencyStore(t *testing.T) {
+	initIdempotencyDB(t)
+
+	store := middlewares.NewPostgresIdempotencyStore()
+	ctx := context.Background()
+	lockedUntil, expiry := time.Now().Add(time.Minute), time.Now().Add(time.Hour)
+
+	stored, err := store.Begin(ctx, "tenant-1", "key-1", "fp-1", lockedUntil, expiry)
+	require.NoError(t, err)
+	assert.Nil(t, stored)
+
+	_, err = store.Begin(ctx, "tenant-1", "key-1", "fp-1", lockedUntil, expiry)
+	assert.ErrorIs(t, err, middlewares.ErrIdempotentRequestInProgress)
+	_, err = store.Begin(ctx, "tenant-1", "key-1", "fp-2", lockedUntil, expiry)
+	assert.ErrorIs(t, err, middlewares.ErrIdempotencyKeyReused)
+
+	resp := middlewares.IdempotentResponse{Status: http.StatusCreated, Header: http.Header{"Location": {"/records/1"}}, Body: []byte("created")}
+	require.NoError(t, store.Complete(ctx, "tenant-1", "key-1", resp))
+	stored, err = store.Begin(ctx, "tenant-1", "key-1", "fp-1", lockedUntil, expiry)
+	require.NoError(t, err)
+	assert.Equal(t, &resp, stored)
+
+	stored, err = store.Begin(ctx, "tenant-2", "key-1", "fp-1", lockedUntil, expiry)
+	require.NoError(t, err, "keys are scoped per tenant")
+	assert.Nil(t, stored)
+	require.NoError(t, store.Release(ctx, "tenant-2", "key-1"))
+	stored, err = store.Begin(ctx, "tenant-2", "key-1", "fp-2", lockedUntil, expiry)
+	require.NoError(t, err, "released keys can be reused")
+	assert.Nil(t, stored)
+
+	require.NoError(t, store.DeleteExpired(ctx, expiry.Add(time.Second)))
+	stored, err = store.Begin(ctx, "tenant-1", "key-1", "fp-3", lockedUntil, expiry)
+	require.NoError(t, err, "deleted keys can be reused")
+	assert.Nil(t, stored)
+}
+
+func TestPostgresIdempotencyStoreLockTimeout(t *testing.T) {
+	initIdempotencyDB(t)
+
+	store := middlewares.NewPostgresIdempotencyStore()
+	ctx := context.Background()
+	expiry := time.Now().Add(time.Hour)
+
+	_, err := store.Begin(ctx, "tenant-1", "key-1", "fp-1", time.Now().Add(-time.Second), expiry)
+	require.NoError(t, err)
+
+	_, err = store.Begin(ctx, "tenant-1", "key-1", "fp-2", time.Now().Add(time.Minute), expiry)
+	assert.ErrorIs(t, err, middlewares.ErrIdempotencyKeyReused, "lost claims are only taken over by the same request")
+	stored, err := store.Begin(ctx, "tenant-1", "key-1", "fp-1", time.Now().Add(time.Minute), expiry)
+	require.NoError(t, err, "lost claims are taken over")
+	assert.Nil(t, stored)
+	_, err = store.Begin(ctx, "tenant-1", "key-1", "fp-1", time.Now().Add(time.Minute), expiry)
+	assert.ErrorIs(t, err, middlewares.ErrIdempotentRequestInProgress)
+}
@@ -0,0 +1,206 @@
+package middlewares_test
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/d4l-data4life/go-svc/pkg/log"
+	"github.com/d4l-data4life/go-svc/pkg/middlewares"
+)
+
+func idempotentRequest(method, tenantID, key, body string) *http.Request {
+	req := httptest.NewRequest(method, "/records", strings.NewReader(body))
+	if key != "" {
+		req.Header.Set(middlewares.IdempotencyKeyHeader, key)
+	}
+	return req.WithContext(context.WithValue(req.Context(), log.TenantIDContextKey, tenantID))
+}
+
+func TestIdempotency(t *testing.T) {
+	var calls atomic.Int32
+	handler := middlewares.Idempotency(middlewares.NewMemoryIdempotencyStore())(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			n := calls.Add(1)
+			body, _ := io.ReadAll(r.Body)
+			w.Header().Set("Location", fmt.Sprintf("/records/%d", n))
+			w.WriteHeader(http.StatusCreated)
+			_, _ = fmt.Fprintf(w, "created %d from %s", n, body)
+		}),
+	)
+	serve := func(req *http.Request) *httptest.ResponseRecorder {
+		res := httptest.NewRecorder()
+		handler.ServeHTTP(res, req)
+		return res
+	}
+
+	res := serve(idempotentRequest(http.MethodPost, "tenant-1", "key-1", "a"))
+	assert.Equal(t, http.StatusCreated, res.Code)
+	assert.Equal(t, "created 1 from a", res.Body.String())
+	assert.Empty(t, res.Header().Get(middlewares.IdempotentReplayedHeader))
+
+	t.Run("repeat is replayed", func(t *testing.T) {
+		res := serve(idempotentRequest(http.MethodPost, "tenant-1", "key-1", "a"))
+		assert.Equal(t, http.StatusCreated, res.Code)
+		assert.Equal(t, "created 1 from a", res.Body.String())
+		assert.Equal(t, "/records/1", res.Header().Get("Location"))
+		assert.Equal(t, "true", res.Header().Get(middlewares.IdempotentReplayedHeader))
+	})
+
+	t.Run("different request with the same key", func(t *testing.T) {
+		res := serve(idempotentRequest(http.MethodPost, "tenant-1", "key-1", "b"))
+		assert.Equal(t, http.StatusConflict, res.Code)
+		assert.Contains(t, res.Body.String(), "urn:d4l:problem:idempotency-key-reused")
+	})
+
+	t.Run("keys are scoped per tenant", func(t *testing.T) {
+		res := serve(idempotentRequest(http.MethodPost, "tenant-2", "key-1", "a"))
+		assert.Equal(t, http.StatusCreated, res.Code)
+		assert.Equal(t, "created 2 from a", res.Body.String())
+	})
+
+	t.Run("requests without key", func(t *testing.T) {
+		serve(idempotentRequest(http.MethodPost, "tenant-1", "", "a"))
+		res := serve(idempotentRequest(http.MethodPost, "tenant-1", "", "a"))
+		assert.Equal(t, "created 4 from a", res.Body.String())
+	})
+
+	t.Run("too long key", func(t *testing.T) {
+		res := serve(idempotentRequest(http.MethodPost, "tenant-1", strings.Repeat("k", 256), "a"))
+		assert.Equal(t, http.StatusBadRequest, res.Code)
+	})
+
+	assert.Equal(t, int32(4), calls.Load())
+}
+
+func TestIdempotencyInProgress(t *testing.T) {
+	started, finish := make(chan struct{}), make(chan struct{})
+	handler := middlewares.Idempotency(middlewares.NewMemoryIdempotencyStore())(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			close(started)
+			<-finish
+		}),
+	)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		handler.ServeHTTP(httptest.NewRecorder(), idempotentRequest(http.MethodPost, "tenant-1", "key-1", "a"))
+	}()
+	<-started
+
+	res := httptest.NewRecorder()
+	handler.ServeHTTP(res, idempotentRequest(http.MethodPost, "tenant-1", "key-1", "a"))
+	assert.Equal(t, http.StatusConflict, res.Code)
+	assert.Contains(t, res.Body.String(), "urn:d4l:problem:idempotent-request-in-progress")
+
+	close(finish)
+	<-done
+}
+
+func TestIdempotencyServerErrorsAreRetried(t *testing.T) {
+	var calls atomic.Int32
+	handler := middlewares.Idempotency(middlewares.NewMemoryIdempotencyStore())(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if calls.Add(1) == 1 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			w.WriteHeader(http.StatusCreated)
+		}),
+	)
+
+	for _, want := range []int{http.StatusServiceUnavailable, http.StatusCreated, http.StatusCreated} {
+		res := httptest.NewRecorder()
+		handler.ServeHTTP(res, idempotentRequest(http.MethodPost, "tenant-1", "key-1", "a"))
+		assert.Equal(t, want, res.Code)
+	}
+	assert.Equal(t, int32(2), calls.Load())
+}
+
+func TestIdempotencyKeepsOuterHeaders(t *testing.T) {
+	var requests atomic.Int32
+	idempotency := middlewares.Idempotency(middlewares.NewMemoryIdempotencyStore())(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Location", "/records/1")
+			w.Header().Set("RateLimit-Remaining", "handler")
+			w.WriteHeader(http.StatusCreated)
+		}),
+	)
+	// the outer middleware sets headers per request before the idempotency middleware
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := requests.Add(1)
+		w.Header().Set("Trace-Id", fmt.Sprintf("trace-%d", n))
+		w.Header().Set("RateLimit-Remaining", fmt.Sprintf("%d", 10-n))
+		idempotency.ServeHTTP(w, r)
+	})
+
+	handler.ServeHTTP(httptest.NewRecorder(), idempotentRequest(http.MethodPost, "tenant-1", "key-1", "a"))
+	res := httptest.NewRecorder()
+	handler.ServeHTTP(res, idempotentRequest(http.MethodPost, "tenant-1", "key-1", "a"))
+
+	assert.Equal(t, "true", res.Header().Get(middlewares.IdempotentReplayedHeader))
+	assert.Equal(t, "/records/1", res.Header().Get("Location"))
+	assert.Equal(t, "trace-2", res.Header().Get("Trace-Id"))
+	assert.Equal(t, "8", res.Header().Get("RateLimit-Remaining"))
+}
+
+func TestIdempotencyExpiry(t *testing.T) {
+	store := middlewares.NewMemoryIdempotencyStore()
+	ctx := context.Background()
+
+	_, err := store.Begin(ctx, "tenant-1", "key-1", "fp", time.Now().Add(-time.Second), time.Now().Add(-time.Second))
+	require.NoError(t, err)
+
+	stored, err := store.Begin(ctx, "tenant-1", "key-1", "other", time.Now().Add(time.Minute), time.Now().Add(time.Hour))
+	require.NoError(t, err, "expired keys can be reused")
+	assert.Nil(t, stored)
+}
+
+func TestIdempotencyLockTimeout(t *testing.T) {
+	var calls atomic.Int32
+	started, finish := make(chan struct{}), make(chan struct{})
+	handler := middlewares.Idempotency(middlewares.NewMemoryIdempotencyStore(),
+		middlewares.IdempotencyWithLockTimeout(20*time.Millisecond),
+	)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 1 {
+			close(started)
+			<-finish
+		}
+		w.WriteHeader(http.StatusCreated)
+	}))
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		handler.ServeHTTP(httptest.NewRecorder(), idempotentRequest(http.MethodPost, "tenant-1", "key-1", "a"))
+	}()
+	<-started
+
+	res := httptest.NewRecorder()
+	handler.ServeHTTP(res, idempotentRequest(http.MethodPost, "tenant-1", "key-1", "a"))
+	assert.Equal(t, http.StatusConflict, res.Code, "the claim is held until the lock timeout")
+
+	time.Sleep(30 * time.Millisecond)
+	res = httptest.NewRecorder()
+	handler.ServeHTTP(res, idempotentRequest(http.MethodPost, "tenant-1", "key-1", "b"))
+	assert.Equal(t, http.StatusConflict, res.Code, "a different request can't take over the claim")
+	assert.Contains(t, res.Body.String(), "urn:d4l:problem:idempotency-key-reused")
+
+	res = httptest.NewRecorder()
+	handler.ServeHTTP(res, idempotentRequest(http.MethodPost, "tenant-1", "key-1", "a"))
+	assert.Equal(t, http.StatusCreated, res.Code, "the same request takes over the claim after the lock timeout")
+	assert.Equal(t, int32(2), calls.Load())
+
+	close(finish)
+	<-done
+}
@@ -0,0 +1,65 @@
+package middlewares
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/netip"
+
+	"github.com/d4l-data4life/go-svc/pkg/log"
+	"github.com/d4l-data4life/go-svc/pkg/logging"
+)
+
+// ErrIPNotAllowed happens when the caller IP is not in the ranges of an IPAllowList
+var ErrIPNotAllowed = errors.New("caller IP not allowed")
+
+type ipAllowList struct {
+	allowed []netip.Prefix
+	logger  *log.Logger
+}
+
+// IPAllowListOption is to be implemented by functional options
+type IPAllowListOption func(*ipAllowList)
+
+// IPAllowListWithLogger sets the logger used for audit logs of denied requests (defaults to the logging singleton)
+func IPAllowListWithLogger(logger *log.Logger) IPAllowListOption {
+	return func(l *ipAllowList) {
+		l.logger = logger
+	}
+}
+
+// IPAllowList is the decorator restricting a handler to callers from the given IPv4 and IPv6 ranges.
+// The caller IP is the address resolved by ClientIP, else the peer, so install ClientIP before it when running
+// behind proxies. log.CallerIPContextKey is not trusted, see CallerIP.
+// Denied requests are audit logged and answered with 403.
+//
+//	admins, err := middlewares.ParseCIDRs("10.20.0.0/16", "fd00:20::/64")
+//	r.With(middlewares.IPAllowList(admins)).Mount("/admin", adminRouter)
+func IPAllowList(allowed []netip.Prefix, options ...IPAllowListOption) func(http.Handler) http.Handler {
+	l := &ipAllowList{allowed: allowed}
+	for _, apply := range options {
+		apply(l)
+	}
+	if l.logger == nil {
+		l.logger = logging.Logger()
+	}
+
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			callerIP := CallerIP(r)
+			addr, err := netip.ParseAddr(callerIP)
+			if err == nil && containsAddr(l.allowed, addr.Unmap()) {
+				h.ServeHTTP(w, r)
+				return
+			}
+
+			ctx := context.WithValue(r.Context(), log.RequestURLContextKey, r.URL.Path)
+			ctx = context.WithValue(ctx, log.RequestDomainContextKey, r.Host)
+			ctx = context.WithValue(ctx, log.CallerIPContextKey, callerIP)
+			err = fmt.Errorf("%w: %q", ErrIPNotAllowed, callerIP)
+			_ = l.logger.AuditSecurityFailure(ctx, SecurityEventAuthorization, log.Message(err.Error()))
+			WriteProblem(w, r, err)
+		})
+	}
+}
@@ -0,0 +1,124 @@
+package middlewares_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/d4l-data4life/go-svc/pkg/log"
+	"github.com/d4l-data4life/go-svc/pkg/middlewares"
+	"github.com/d4l-data4life/go-svc/pkg/problem"
+)
+
+func TestIPAllowList(t *testing.T) {
+	buf := new(bytes.Buffer)
+	logger := log.NewLogger("test", "v0", "localhost", log.WithWriter(buf))
+
+	trusted, err := middlewares.ParseCIDRs("10.0.0.0/8")
+	require.NoError(t, err)
+	allowed, err := middlewares.ParseCIDRs("192.0.2.0/24", "2001:db8::/48")
+	require.NoError(t, err)
+
+	handler := middlewares.ClientIP(trusted)(
+		middlewares.IPAllowList(allowed, middlewares.IPAllowListWithLogger(logger))(
+			http.HandlerFunc(func(http.ResponseWriter, *http.Request) {})))
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		forwarded  string
+		wantStatus int
+		wantIP     string
+	}{
+		{
+			name:       "allowed IPv4 peer",
+			remoteAddr: "192.0.2.10:4711",
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "allowed IPv6 peer",
+			remoteAddr: "[2001:db8:0:1::10]:4711",
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "allowed client behind proxy",
+			remoteAddr: "10.0.0.1:4711",
+			forwarded:  "192.0.2.10",
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "denied IPv6 peer",
+			remoteAddr: "[2001:db8:1::10]:4711",
+			wantStatus: http.StatusForbidden,
+			wantIP:     "2001:db8:1::10",
+		},
+		{
+			name:       "denied client behind proxy",
+			remoteAddr: "10.0.0.1:4711",
+			forwarded:  "198.51.100.1",
+			wantStatus: http.StatusForbidden,
+			wantIP:     "198.51.100.1",
+		},
+		{
+			name:       "denied spoofing client",
+			remoteAddr: "198.51.100.1:4711",
+			forwarded:  "192.0.2.10",
+			wantStatus: http.StatusForbidden,
+			wantIP:     "198.51.100.1",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			buf.Reset()
+
+			req := httptest.NewRequest(http.MethodGet, "/admin/users", nil)
+			req.RemoteAddr = tc.remoteAddr
+			if tc.forwarded != "" {
+				req.Header.Set("X-Forwarded-For", tc.forwarded)
+			}
+			res := httptest.NewRecorder()
+			handler.ServeHTTP(res, req)
+
+			require.Equal(t, tc.wantStatus, res.Code)
+			if tc.wantStatus == http.StatusOK {
+				assert.Empty(t, buf.String())
+				return
+			}
+
+			assert.Equal(t, problem.ContentType, res.Header().Get("Content-Type"))
+			assert.Contains(t, res.Body.String(), `"type":"urn:d4l:problem:ip-not-allowed"`)
+			auditLog := map[string]any{}
+			require.NoError(t, json.Unmarshal(buf.Bytes(), &auditLog))
+			assert.Equal(t, middlewares.SecurityEventAuthorization, auditLog["security-event"])
+			assert.Equal(t, false, auditLog["successful"])
+			assert.Equal(t, "/admin/users", auditLog["req-url"])
+			assert.Equal(t, tc.wantIP, auditLog["caller-ip"])
+		})
+	}
+}
+
+func TestIPAllowListIgnoresLoggedCallerIP(t *testing.T) {
+	logger := log.NewLogger("test", "v0", "localhost", log.WithWriter(new(bytes.Buffer)))
+	allowed, err := middlewares.ParseCIDRs("192.0.2.0/24")
+	require.NoError(t, err)
+
+	handler := logger.WrapHTTP(
+		middlewares.IPAllowList(allowed, middlewares.IPAllowListWithLogger(logger))(
+			http.HandlerFunc(func(http.ResponseWriter, *http.Request) {})),
+		log.WithCallerIPParser(func(r *http.Request) string { return r.Header.Get("X-Real-Ip") }),
+	)
+
+	req := httptest.NewRequest(http.MethodGet, "/admin/users", nil)
+	req.RemoteAddr = "198.51.100.1:4711"
+	req.Header.Set("X-Real-Ip", "192.0.2.10")
+	res := httptest.NewRecorder()
+	handler.ServeHTTP(res, req)
+
+	assert.Equal(t, http.StatusForbidden, res.Code, "the caller IP of the HTTPLogger is not trusted")
+}
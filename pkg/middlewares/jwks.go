@@ -0,0 +1,279 @@
+package middlewares
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+// ErrJWKSKeyNotFound happens when a token is signed with a key that is not part of the JWKS
+var ErrJWKSKeyNotFound = errors.New("signing key not found in JWKS")
+
+// jwk is a single JSON Web Key as defined by RFC 7517, only the public parts of RSA, EC and OKP keys are read
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Crv string `json:"crv"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+func (k jwk) publicKey() (any, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, fmt.Errorf("decoding modulus: %w", err)
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return nil, fmt.Errorf("decoding exponent: %w", err)
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %s", k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, fmt.Errorf("decoding x: %w", err)
+		}
+		y, err := base64.RawURLEncoding.DecodeString(k.Y)
+		if err != nil {
+			return nil, fmt.Errorf("decoding y: %w", err)
+		}
+		size := (curve.Params().BitSize + 7) / 8
+		if len(x) > size || len(y) > size {
+			return nil, errors.New("invalid EC coordinates")
+		}
+		// the uncompressed point encoding 0x04 || X || Y is validated to be on the curve
+		point := make([]byte, 1+2*size)
+		point[0] = 4
+		copy(point[1+size-len(x):1+size], x)
+		copy(point[1+2*size-len(y):], y)
+		return ecdsa.ParseUncompressedPublicKey(curve, point)
+	case "OKP":
+		if k.Crv != "Ed25519" {
+			return nil, fmt.Errorf("unsupported curve %s", k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, fmt.Errorf("decoding x: %w", err)
+		}
+		if len(x) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("invalid Ed25519 key size %d", len(x))
+		}
+		return ed25519.PublicKey(x), nil
+	}
+	return nil, fmt.Errorf("unsupported key type %s", k.Kty)
+}
+
+// parseJWKS returns the signing keys of a JWKS document by key ID. Encryption keys and unsupported keys are skipped.
+func parseJWKS(data []byte) (map[string]any, error) {
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, fmt.Errorf("parsing JWKS: %w", err)
+	}
+
+	keys := make(map[string]any, len(set.Keys))
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		key, err := k.publicKey()
+		if err != nil {
+			continue
+		}
+		keys[k.Kid] = key
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("parsing JWKS: no usable signing keys")
+	}
+	return keys, nil
+}
+
+// JWKS holds the public keys of a JSON Web Key Set loaded from a file or an HTTP URL.
+// The keys are refreshed after the refresh interval and when a token refers to an unknown key ID,
+// so rotated keys are picked up without restart.
+type JWKS struct {
+	source             string
+	client             *http.Client
+	refreshInterval    time.Duration
+	minRefreshInterval time.Duration
+
+	mu          sync.RWMutex
+	keys        map[string]any
+	fetchedAt   time.Time
+	attemptedAt time.Time
+	group       singleflight.Group
+}
+
+// JWKSOption is to be implemented by functional options
+type JWKSOption func(*JWKS)
+
+// JWKSWithHTTPClient sets the client used for fetching the JWKS from an URL (defaults to a client with 10s timeout)
+func JWKSWithHTTPClient(client *http.Client) JWKSOption {
+	return func(j *JWKS) {
+		j.client = client
+	}
+}
+
+// JWKSWithRefreshInterval sets how long fetched keys are used before they are refreshed (defaults to 1 hour)
+func JWKSWithRefreshInterval(d time.Duration) JWKSOption {
+	return func(j *JWKS) {
+		j.refreshInterval = d
+	}
+}
+
+// JWKSWithMinRefreshInterval limits how often unknown key IDs trigger a refresh (defaults to 1 minute)
+func JWKSWithMinRefreshInterval(d time.Duration) JWKSOption {
+	return func(j *JWKS) {
+		j.minRefreshInterval = d
+	}
+}
+
+// NewJWKS creates a key set for the given source, which is either an http(s) URL or a file path.
+// The keys are loaded on first use.
+func NewJWKS(source string, options ...JWKSOption) *JWKS {
+	j := &JWKS{
+		source:             source,
+		client:             &http.Client{Timeout: 10 * time.Second},
+		refreshInterval:    time.Hour,
+		minRefreshInterval: time.Minute,
+	}
+	for _, apply := range options {
+		apply(j)
+	}
+	return j
+}
+
+// Key returns the public key with the given key ID. An empty key ID matches if the set contains a single key only.
+func (j *JWKS) Key(ctx context.Context, kid string) (any, error) {
+	j.mu.RLock()
+	keys, fetchedAt, attemptedAt := j.keys, j.fetchedAt, j.attemptedAt
+	j.mu.RUnlock()
+
+	stale := keys == nil || time.Since(fetchedAt) > j.refreshInterval
+	if !stale {
+		if key, ok := lookupKey(keys, kid); ok {
+			return key, nil
+		}
+	}
+
+	// unknown key IDs refresh the keys to pick up rotated keys, but not more often than the min refresh interval
+	if stale || time.Since(attemptedAt) > j.minRefreshInterval {
+		refreshed, err := j.refresh(ctx)
+		if err != nil && keys == nil {
+			return nil, err
+		}
+		if err == nil {
+			keys = refreshed
+		}
+	}
+
+	if key, ok := lookupKey(keys, kid); ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("%w: kid %q", ErrJWKSKeyNotFound, kid)
+}
+
+func lookupKey(keys map[string]any, kid string) (any, bool) {
+	if key, ok := keys[kid]; ok {
+		return key, true
+	}
+	if kid == "" && len(keys) == 1 {
+		for _, key := range keys {
+			return key, true
+		}
+	}
+	return nil, false
+}
+
+// Refresh loads the keys from the source
+func (j *JWKS) Refresh(ctx context.Context) error {
+	_, err := j.refresh(ctx)
+	return err
+}
+
+func (j *JWKS) refresh(ctx context.Context) (map[string]any, error) {
+	ch := j.group.DoChan("jwks", func() (interface{}, error) {
+		keys, err := j.load(context.WithoutCancel(ctx))
+
+		j.mu.Lock()
+		defer j.mu.Unlock()
+		j.attemptedAt = time.Now()
+		if err != nil {
+			return nil, err
+		}
+		j.keys = keys
+		j.fetchedAt = j.attemptedAt
+		return keys, nil
+	})
+
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case res := <-ch:
+		if res.Err != nil {
+			return nil, res.Err
+		}
+		return res.Val.(map[string]any), nil
+	}
+}
+
+func (j *JWKS) load(ctx context.Context) (map[string]any, error) {
+	if !strings.HasPrefix(j.source, "http://") && !strings.HasPrefix(j.source, "https://") {
+		data, err := os.ReadFile(j.source)
+		if err != nil {
+			return nil, fmt.Errorf("reading JWKS: %w", err)
+		}
+		return parseJWKS(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, j.source, nil)
+	if err != nil {
+		return nil, fmt.Errorf("creating JWKS request: %w", err)
+	}
+	res, err := j.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("fetching JWKS: %w", err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetching JWKS: unexpected status %d", res.StatusCode)
+	}
+	data, err := io.ReadAll(io.LimitReader(res.Body, 1<<20))
+	if err != nil {
+		return nil, fmt.Errorf("reading JWKS: %w", err)
+	}
+	return parseJWKS(data)
+}
@@ -0,0 +1,210 @@
+package middlewares
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/d4l-data4life/go-svc/pkg/log"
+	"github.com/d4l-data4life/go-svc/pkg/logging"
+)
+
+// ErrInvalidToken happens when a bearer token is missing, malformed, expired or not signed by a key of the JWKS
+var ErrInvalidToken = errors.New("invalid bearer token")
+
+type jwtContextKey string
+
+// ClaimsContextKey is the key to store the validated claims (jwt.MapClaims) of a bearer token in the context
+const ClaimsContextKey jwtContextKey = "jwt-claims"
+
+// SecurityEventAuthentication is the security event of audit logs written for failed authentications
+const SecurityEventAuthentication = "authentication"
+
+// jwtValidMethods are the asymmetric algorithms accepted for tokens signed with JWKS keys
+var jwtValidMethods = []string{ // nolint: gochecknoglobals
+	jwt.SigningMethodRS256.Alg(), jwt.SigningMethodRS384.Alg(), jwt.SigningMethodRS512.Alg(),
+	jwt.SigningMethodES256.Alg(), jwt.SigningMethodES384.Alg(), jwt.SigningMethodES512.Alg(),
+	jwt.SigningMethodEdDSA.Alg(),
+}
+
+// JWTAuthenticator validates bearer tokens (JWTs) of users against the keys of a JWKS
+type JWTAuthenticator struct {
+	jwks          *JWKS
+	issuer        string
+	audience      string
+	leeway        time.Duration
+	tenantClaim   string
+	clientIDClaim string
+	logger        *log.Logger
+}
+
+// JWTOption is to be implemented by functional options
+type JWTOption func(*JWTAuthenticator)
+
+// JWTWithLeeway allows for clock skew when validating exp and nbf (defaults to 30 seconds)
+func JWTWithLeeway(leeway time.Duration) JWTOption {
+	return func(a *JWTAuthenticator) {
+		a.leeway = leeway
+	}
+}
+
+// JWTWithTenantClaim sets the claim holding the tenant ID (defaults to "tenant_id")
+func JWTWithTenantClaim(claim string) JWTOption {
+	return func(a *JWTAuthenticator) {
+		a.tenantClaim = claim
+	}
+}
+
+// JWTWithClientIDClaim sets the claim holding the OAuth client ID (defaults to "client_id", falling back to "azp")
+func JWTWithClientIDClaim(claim string) JWTOption {
+	return func(a *JWTAuthenticator) {
+		a.clientIDClaim = claim
+	}
+}
+
+// JWTWithLogger sets the logger used for audit logs of failed authentications (defaults to the logging singleton)
+func JWTWithLogger(logger *log.Logger) JWTOption {
+	return func(a *JWTAuthenticator) {
+		a.logger = logger
+	}
+}
+
+// NewJWTAuthenticator creates an authenticator accepting RS*, ES* and EdDSA signed tokens of the given issuer
+// for the given audience. exp is required, nbf is checked if present.
+// Issuer and audience are required, since empty values would disable their checks.
+func NewJWTAuthenticator(jwks *JWKS, issuer, audience string, options ...JWTOption) (*JWTAuthenticator, error) {
+	if issuer == "" || audience == "" {
+		return nil, fmt.Errorf("JWT authenticator requires issuer and audience, got issuer %q and audience %q", issuer, audience)
+	}
+	a := &JWTAuthenticator{
+		jwks:          jwks,
+		issuer:        issuer,
+		audience:      audience,
+		leeway:        30 * time.Second,
+		tenantClaim:   "tenant_id",
+		clientIDClaim: "client_id",
+	}
+	for _, apply := range options {
+		apply(a)
+	}
+	if a.logger == nil {
+		a.logger = logging.Logger()
+	}
+	return a, nil
+}
+
+// Authenticate is the decorator that protects a handler with a bearer token.
+// The subject, client ID and tenant ID of valid tokens are stored in the log context keys,
+// the claims in ClaimsContextKey. Failures are audit logged and answered with 401.
+func (a *JWTAuthenticator) Authenticate() func(http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			ctx := context.WithValue(req.Context(), log.RequestURLContextKey, req.URL.Path)
+			ctx = context.WithValue(ctx, log.RequestDomainContextKey, req.Host)
+
+			ctx, err := a.Validate(ctx, req.Header.Get(AuthHeaderName))
+			if err != nil {
+				w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+				WriteProblem(w, req, err)
+				return
+			}
+
+			h.ServeHTTP(w, req.WithContext(ctx))
+		})
+	}
+}
+
+// Validate checks the content of an Authorization header ("Bearer <jwt>") and returns the context
+// enriched with the identity of the caller. The "scope"/"scp" and "roles" claims are stored
+// in ScopesContextKey and RolesContextKey for the Authorizer.
+// Failures are audit logged and returned as ErrInvalidToken.
+func (a *JWTAuthenticator) Validate(ctx context.Context, authHeaderContent string) (context.Context, error) {
+	claims, err := a.parse(ctx, authHeaderContent)
+	if err != nil {
+		_ = a.logger.AuditSecurityFailure(ctx, SecurityEventAuthentication, log.Message(err.Error()))
+		return ctx, err
+	}
+
+	if subject, _ := claims.GetSubject(); subject != "" {
+		ctx = context.WithValue(ctx, log.UserIDContextKey, subject)
+	}
+	if clientID := claimString(claims, a.clientIDClaim, "azp"); clientID != "" {
+		ctx = context.WithValue(ctx, log.ClientIDContextKey, clientID)
+	}
+	if tenantID := claimString(claims, a.tenantClaim); tenantID != "" {
+		ctx = context.WithValue(ctx, log.TenantIDContextKey, tenantID)
+	}
+	if scopes := claimStrings(claims, "scope", "scp"); len(scopes) > 0 {
+		ctx = WithScopes(ctx, scopes...)
+	}
+	if roles := claimStrings(claims, "roles"); len(roles) > 0 {
+		ctx = WithRoles(ctx, roles...)
+	}
+	return context.WithValue(ctx, ClaimsContextKey, claims), nil
+}
+
+func (a *JWTAuthenticator) parse(ctx context.Context, authHeaderContent string) (jwt.MapClaims, error) {
+	token, ok := strings.CutPrefix(authHeaderContent, "Bearer ")
+	if !ok || token == "" {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidToken, ErrMalformedAuthHeader)
+	}
+
+	parser := jwt.NewParser(
+		jwt.WithValidMethods(jwtValidMethods),
+		jwt.WithIssuer(a.issuer),
+		jwt.WithAudience(a.audience),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(a.leeway),
+	)
+
+	claims := jwt.MapClaims{}
+	_, err := parser.ParseWithClaims(token, claims, func(t *jwt.Token) (any, error) {
+		kid, _ := t.Header["kid"].(string)
+		return a.jwks.Key(ctx, kid)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidToken, err)
+	}
+	return claims, nil
+}
+
+// claimString returns the first non-empty string claim of the given names
+func claimString(claims jwt.MapClaims, names ...string) string {
+	for _, name := range names {
+		if value, ok := claims[name].(string); ok && value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+// claimStrings returns the values of the first present claim of the given names,
+// which is either a space separated string (like "scope" in RFC 8693) or an array of strings
+func claimStrings(claims jwt.MapClaims, names ...string) []string {
+	for _, name := range names {
+		switch value := claims[name].(type) {
+		case string:
+			return strings.Fields(value)
+		case []any:
+			values := make([]string, 0, len(value))
+			for _, v := range value {
+				if s, ok := v.(string); ok {
+					values = append(values, s)
+				}
+			}
+			return values
+		}
+	}
+	return nil
+}
+
+// ClaimsFromContext returns the claims of the bearer token validated by JWTAuthenticator
+func ClaimsFromContext(ctx context.Context) (jwt.MapClaims, bool) {
+	claims, ok := ctx.Value(ClaimsContextKey).(jwt.MapClaims)
+	return claims, ok
+}
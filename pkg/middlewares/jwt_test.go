@@ -0,0 +1,291 @@
+package middlewares_test
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/d4l-data4life/go-svc/pkg/log"
+	"github.com/d4l-data4life/go-svc/pkg/middlewares"
+)
+
+const (
+	testIssuer   = "https://issuer.example.org"
+	testAudience = "records-service"
+)
+
+type testKey struct {
+	kid     string
+	method  jwt.SigningMethod
+	private crypto.Signer
+}
+
+func (k testKey) jwk() map[string]string {
+	b64 := func(b []byte) string { return base64.RawURLEncoding.EncodeToString(b) }
+	switch pub := k.private.Public().(type) {
+	case *rsa.PublicKey:
+		return map[string]string{"kty": "RSA", "kid": k.kid, "use": "sig",
+			"n": b64(pub.N.Bytes()), "e": b64(big.NewInt(int64(pub.E)).Bytes())}
+	case *ecdsa.PublicKey:
+		point, _ := pub.Bytes()
+		size := (len(point) - 1) / 2
+		return map[string]string{"kty": "EC", "kid": k.kid, "crv": "P-256",
+			"x": b64(point[1 : 1+size]), "y": b64(point[1+size:])}
+	case ed25519.PublicKey:
+		return map[string]string{"kty": "OKP", "kid": k.kid, "crv": "Ed25519", "x": b64(pub)}
+	}
+	return nil
+}
+
+func (k testKey) sign(t *testing.T, claims jwt.MapClaims) string {
+	t.Helper()
+	token := jwt.NewWithClaims(k.method, claims)
+	token.Header["kid"] = k.kid
+	signed, err := token.SignedString(k.private)
+	require.NoError(t, err)
+	return signed
+}
+
+func newTestKeys(t *testing.T) (rsaKey, ecKey, edKey testKey) {
+	t.Helper()
+	rsaPrivate, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	ecPrivate, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	_, edPrivate, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	return testKey{"rsa", jwt.SigningMethodRS256, rsaPrivate},
+		testKey{"ec", jwt.SigningMethodES256, ecPrivate},
+		testKey{"ed", jwt.SigningMethodEdDSA, edPrivate}
+}
+
+func jwksDocument(t *testing.T, keys ...testKey) []byte {
+	t.Helper()
+	set := map[string][]map[string]string{"keys": {}}
+	for _, k := range keys {
+		set["keys"] = append(set["keys"], k.jwk())
+	}
+	doc, err := json.Marshal(set)
+	require.NoError(t, err)
+	return doc
+}
+
+// jwksServer serves the current JWKS document and counts the fetches
+type jwksServer struct {
+	mu      sync.Mutex
+	doc     []byte
+	fetches int
+}
+
+func (s *jwksServer) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.fetches++
+	_, _ = w.Write(s.doc)
+}
+
+func (s *jwksServer) set(doc []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.doc = doc
+}
+
+func validClaims() jwt.MapClaims {
+	return jwt.MapClaims{
+		"iss":       testIssuer,
+		"aud":       testAudience,
+		"sub":       "user-1",
+		"client_id": "client-1",
+		"tenant_id": "tenant-1",
+		"exp":       time.Now().Add(time.Minute).Unix(),
+	}
+}
+
+func withClaims(overrides jwt.MapClaims) jwt.MapClaims {
+	claims := validClaims()
+	for key, value := range overrides {
+		if value == nil {
+			delete(claims, key)
+			continue
+		}
+		claims[key] = value
+	}
+	return claims
+}
+
+func TestJWTAuthenticator(t *testing.T) {
+	rsaKey, ecKey, edKey := newTestKeys(t)
+	unknownKey, _, _ := newTestKeys(t)
+	unknownKey.kid = "unknown"
+
+	server := &jwksServer{doc: jwksDocument(t, rsaKey, ecKey, edKey)}
+	jwksSrv := httptest.NewServer(server)
+	defer jwksSrv.Close()
+
+	buf := new(bytes.Buffer)
+	logger := log.NewLogger("test", "v0", "localhost", log.WithWriter(buf))
+	authenticator, err := middlewares.NewJWTAuthenticator(
+		middlewares.NewJWKS(jwksSrv.URL),
+		testIssuer, testAudience,
+		middlewares.JWTWithLogger(logger),
+		middlewares.JWTWithLeeway(0),
+	)
+	require.NoError(t, err)
+
+	var gotCtx context.Context
+	handler := authenticator.Authenticate()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotCtx = r.Context()
+	}))
+
+	tests := []struct {
+		name       string
+		authHeader string
+		wantStatus int
+	}{
+		{"valid RS256 token", "Bearer " + rsaKey.sign(t, validClaims()), http.StatusOK},
+		{"valid ES256 token", "Bearer " + ecKey.sign(t, validClaims()), http.StatusOK},
+		{"valid EdDSA token", "Bearer " + edKey.sign(t, validClaims()), http.StatusOK},
+		{"missing header", "", http.StatusUnauthorized},
+		{"malformed header", rsaKey.sign(t, validClaims()), http.StatusUnauthorized},
+		{"wrong issuer", "Bearer " + rsaKey.sign(t, withClaims(jwt.MapClaims{"iss": "https://evil.example.org"})), http.StatusUnauthorized},
+		{"wrong audience", "Bearer " + rsaKey.sign(t, withClaims(jwt.MapClaims{"aud": "other-service"})), http.StatusUnauthorized},
+		{"expired", "Bearer " + rsaKey.sign(t, withClaims(jwt.MapClaims{"exp": time.Now().Add(-time.Minute).Unix()})), http.StatusUnauthorized},
+		{"missing exp", "Bearer " + rsaKey.sign(t, withClaims(jwt.MapClaims{"exp": nil})), http.StatusUnauthorized},
+		{"not yet valid", "Bearer " + rsaKey.sign(t, withClaims(jwt.MapClaims{"nbf": time.Now().Add(time.Minute).Unix()})), http.StatusUnauthorized},
+		{"unknown key", "Bearer " + unknownKey.sign(t, validClaims()), http.StatusUnauthorized},
+		{"symmetric algorithm", "Bearer " + func() string {
+			token, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, validClaims()).SignedString([]byte("secret"))
+			return token
+		}(), http.StatusUnauthorized},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			buf.Reset()
+			gotCtx = nil
+
+			req := httptest.NewRequest(http.MethodGet, "/records", nil)
+			if tc.authHeader != "" {
+				req.Header.Set(middlewares.AuthHeaderName, tc.authHeader)
+			}
+			res := httptest.NewRecorder()
+			handler.ServeHTTP(res, req)
+
+			require.Equal(t, tc.wantStatus, res.Code)
+			if tc.wantStatus != http.StatusOK {
+				auditLog := map[string]any{}
+				require.NoError(t, json.Unmarshal(buf.Bytes(), &auditLog))
+				assert.Equal(t, middlewares.SecurityEventAuthentication, auditLog["security-event"])
+				assert.Equal(t, false, auditLog["successful"])
+				assert.Equal(t, "/records", auditLog["req-url"])
+				return
+			}
+
+			assert.Equal(t, "user-1", gotCtx.Value(log.UserIDContextKey))
+			assert.Equal(t, "client-1", gotCtx.Value(log.ClientIDContextKey))
+			assert.Equal(t, "tenant-1", gotCtx.Value(log.TenantIDContextKey))
+			claims, ok := middlewares.ClaimsFromContext(gotCtx)
+			require.True(t, ok)
+			assert.Equal(t, "user-1", claims["sub"])
+		})
+	}
+}
+
+func TestJWTAuthenticatorPermissions(t *testing.T) {
+	key, _, _ := newTestKeys(t)
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	require.NoError(t, os.WriteFile(path, jwksDocument(t, key), 0o600))
+
+	logger := log.NewLogger("test", "v0", "localhost", log.WithWriter(new(bytes.Buffer)))
+	authenticator, err := middlewares.NewJWTAuthenticator(middlewares.NewJWKS(path), testIssuer, testAudience, middlewares.JWTWithLogger(logger))
+	require.NoError(t, err)
+
+	tests := []struct {
+		name       string
+		claims     jwt.MapClaims
+		wantScopes []string
+		wantRoles  []string
+	}{
+		{"space separated scope", jwt.MapClaims{"scope": "records:read records:write", "roles": []any{"admin"}}, []string{"records:read", "records:write"}, []string{"admin"}},
+		{"scp array", jwt.MapClaims{"scp": []any{"records:read"}}, []string{"records:read"}, nil},
+		{"no permissions", jwt.MapClaims{}, nil, nil},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx, err := authenticator.Validate(context.Background(), "Bearer "+key.sign(t, withClaims(tc.claims)))
+			require.NoError(t, err)
+			assert.Equal(t, tc.wantScopes, middlewares.ScopesFromContext(ctx))
+			assert.Equal(t, tc.wantRoles, middlewares.RolesFromContext(ctx))
+		})
+	}
+}
+
+func TestJWKSKeyRotation(t *testing.T) {
+	oldKey, _, _ := newTestKeys(t)
+	newKey, _, _ := newTestKeys(t)
+	oldKey.kid, newKey.kid = "2024", "2025"
+
+	server := &jwksServer{doc: jwksDocument(t, oldKey)}
+	jwksSrv := httptest.NewServer(server)
+	defer jwksSrv.Close()
+
+	jwks := middlewares.NewJWKS(jwksSrv.URL, middlewares.JWKSWithMinRefreshInterval(0))
+	logger := log.NewLogger("test", "v0", "localhost", log.WithWriter(new(bytes.Buffer)))
+	authenticator, err := middlewares.NewJWTAuthenticator(jwks, testIssuer, testAudience, middlewares.JWTWithLogger(logger))
+	require.NoError(t, err)
+
+	_, err = authenticator.Validate(context.Background(), "Bearer "+oldKey.sign(t, validClaims()))
+	require.NoError(t, err)
+	_, err = authenticator.Validate(context.Background(), "Bearer "+oldKey.sign(t, validClaims()))
+	require.NoError(t, err)
+	assert.Equal(t, 1, server.fetches, "keys must be cached")
+
+	server.set(jwksDocument(t, newKey))
+	_, err = authenticator.Validate(context.Background(), "Bearer "+newKey.sign(t, validClaims()))
+	require.NoError(t, err)
+	assert.Equal(t, 2, server.fetches, "unknown key ids must refresh the keys")
+}
+
+func TestJWKSFromFile(t *testing.T) {
+	key, _, _ := newTestKeys(t)
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	require.NoError(t, os.WriteFile(path, jwksDocument(t, key), 0o600))
+
+	logger := log.NewLogger("test", "v0", "localhost", log.WithWriter(new(bytes.Buffer)))
+	authenticator, err := middlewares.NewJWTAuthenticator(middlewares.NewJWKS(path), testIssuer, testAudience, middlewares.JWTWithLogger(logger))
+	require.NoError(t, err)
+
+	ctx, err := authenticator.Validate(context.Background(), "Bearer "+key.sign(t, validClaims()))
+	require.NoError(t, err)
+	assert.Equal(t, "user-1", ctx.Value(log.UserIDContextKey))
+}
+
+func TestJWTAuthenticatorRequiresIssuerAndAudience(t *testing.T) {
+	jwks := middlewares.NewJWKS("https://auth.example.com/jwks.json")
+
+	_, err := middlewares.NewJWTAuthenticator(jwks, "", testAudience)
+	assert.Error(t, err, "an empty issuer disables the iss check")
+	_, err = middlewares.NewJWTAuthenticator(jwks, testIssuer, "")
+	assert.Error(t, err, "an empty audience disables the aud check")
+}
@@ -0,0 +1,240 @@
+package middlewares
+
+import (
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/d4l-data4life/go-svc/pkg/prom"
+)
+
+// PriorityHeaderName is the header read by PriorityFromHeader
+const PriorityHeaderName = "X-Priority"
+
+// Priority decides which requests are shed first
+type Priority int
+
+const (
+	// PriorityLow requests are shed once the in-flight requests reach 75% of the limit
+	PriorityLow Priority = iota
+	// PriorityNormal requests are shed once the in-flight requests reach the limit
+	PriorityNormal
+	// PriorityCritical requests are only shed once the in-flight requests reach the max limit
+	PriorityCritical
+)
+
+func (p Priority) String() string {
+	switch p {
+	case PriorityLow:
+		return "low"
+	case PriorityCritical:
+		return "critical"
+	default:
+		return "normal"
+	}
+}
+
+// ParsePriority reads "low", "normal" or "critical" and falls back to PriorityNormal
+func ParsePriority(value string) Priority {
+	switch strings.ToLower(value) {
+	case "low":
+		return PriorityLow
+	case "critical":
+		return PriorityCritical
+	default:
+		return PriorityNormal
+	}
+}
+
+// PriorityFromHeader reads the priority of a request from the X-Priority header.
+// Only use it behind authentication, otherwise any caller can claim critical priority.
+func PriorityFromHeader(r *http.Request) Priority {
+	return ParsePriority(r.Header.Get(PriorityHeaderName))
+}
+
+// PriorityByPath returns the priority of the longest matching path prefix or PriorityNormal
+func PriorityByPath(prefixes map[string]Priority) func(*http.Request) Priority {
+	return func(r *http.Request) Priority {
+		priority, matched := PriorityNormal, -1
+		for prefix, p := range prefixes {
+			if len(prefix) > matched && strings.HasPrefix(r.URL.Path, prefix) {
+				priority, matched = p, len(prefix)
+			}
+		}
+		return priority
+	}
+}
+
+// LoadShedder rejects requests exceeding an adaptive concurrency limit (AIMD):
+// the limit grows by one per limit-many fast responses and is multiplied by the backoff
+// for every response that is slower than the latency threshold or signals overload.
+type LoadShedder struct {
+	name             string
+	minLimit         float64
+	maxLimit         float64
+	latencyThreshold time.Duration
+	backoff          float64
+	priority         func(*http.Request) Priority
+	metrics          *prom.LoadShedInstrumenter
+
+	mu       sync.Mutex
+	limit    float64
+	inFlight int
+}
+
+// LoadShedOption is to be implemented by functional options
+type LoadShedOption func(*LoadShedder)
+
+// LoadShedWithName sets the shedder name used in metrics (defaults to "default")
+func LoadShedWithName(name string) LoadShedOption {
+	return func(s *LoadShedder) {
+		s.name = name
+	}
+}
+
+// LoadShedWithLimits sets the initial, min and max concurrency limits (defaults to 20, 5 and 1000)
+func LoadShedWithLimits(initial, minLimit, maxLimit int) LoadShedOption {
+	return func(s *LoadShedder) {
+		s.limit, s.minLimit, s.maxLimit = float64(initial), float64(minLimit), float64(maxLimit)
+	}
+}
+
+// LoadShedWithLatencyThreshold sets the latency above which responses decrease the limit (defaults to 1 second)
+func LoadShedWithLatencyThreshold(threshold time.Duration) LoadShedOption {
+	return func(s *LoadShedder) {
+		s.latencyThreshold = threshold
+	}
+}
+
+// LoadShedWithBackoff sets the factor applied to the limit on overload (defaults to 0.9)
+func LoadShedWithBackoff(backoff float64) LoadShedOption {
+	return func(s *LoadShedder) {
+		s.backoff = backoff
+	}
+}
+
+// LoadShedWithPriority sets how the priority of HTTP requests is determined, e.g. PriorityByPath
+// (defaults to PriorityNormal for all requests)
+func LoadShedWithPriority(priority func(*http.Request) Priority) LoadShedOption {
+	return func(s *LoadShedder) {
+		s.priority = priority
+	}
+}
+
+// LoadShedWithInitOptions changes the subsystem of the exported metrics
+func LoadShedWithInitOptions(options ...prom.InitOption) LoadShedOption {
+	return func(s *LoadShedder) {
+		s.metrics = prom.NewLoadShedInstrumenter(options...)
+	}
+}
+
+// NewLoadShedder creates a load shedder, share it between the HTTP middleware and the gRPC interceptors
+// of a service so both count against the same limit
+func NewLoadShedder(options ...LoadShedOption) *LoadShedder {
+	s := &LoadShedder{
+		name:             "default",
+		limit:            20,
+		minLimit:         5,
+		maxLimit:         1000,
+		latencyThreshold: time.Second,
+		backoff:          0.9,
+		priority:         func(*http.Request) Priority { return PriorityNormal },
+	}
+	for _, apply := range options {
+		apply(s)
+	}
+	if s.metrics == nil {
+		s.metrics = prom.NewLoadShedInstrumenter()
+	}
+	s.metrics.Limit(s.name, s.limit)
+	return s
+}
+
+// Limit returns the current concurrency limit
+func (s *LoadShedder) Limit() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return int(s.limit)
+}
+
+// Acquire admits a request of the priority if the limit allows it. Admitted requests must call release
+// once they are done and tell whether they observed overload (e.g. 503 or a timeout).
+func (s *LoadShedder) Acquire(priority Priority) (release func(overloaded bool), ok bool) {
+	return s.acquire(priority, true)
+}
+
+// AcquireStream is Acquire for long-lived requests like streams, whose duration does not change the limit
+func (s *LoadShedder) AcquireStream(priority Priority) (release func(overloaded bool), ok bool) {
+	return s.acquire(priority, false)
+}
+
+func (s *LoadShedder) acquire(priority Priority, measureLatency bool) (func(bool), bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	capacity := s.limit
+	switch priority {
+	case PriorityLow:
+		capacity = 0.75 * s.limit
+	case PriorityCritical:
+		capacity = s.maxLimit
+	}
+	if float64(s.inFlight) >= capacity {
+		s.metrics.Shed(s.name, priority.String())
+		return nil, false
+	}
+
+	s.inFlight++
+	s.metrics.InFlight(s.name, s.inFlight)
+
+	start := time.Now()
+	return func(overloaded bool) {
+		var latency time.Duration
+		if measureLatency {
+			latency = time.Since(start)
+		}
+		s.release(latency, overloaded)
+	}, true
+}
+
+func (s *LoadShedder) release(latency time.Duration, overloaded bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// the limit only grows while it is used, idle services would otherwise reach the max limit
+	utilized := float64(s.inFlight) >= s.limit/2
+	s.inFlight--
+	s.metrics.InFlight(s.name, s.inFlight)
+
+	switch {
+	case overloaded || latency > s.latencyThreshold:
+		s.limit = max(s.minLimit, s.limit*s.backoff)
+	case utilized:
+		s.limit = min(s.maxLimit, s.limit+1/s.limit)
+	default:
+		return
+	}
+	s.metrics.Limit(s.name, s.limit)
+}
+
+// Shed is the decorator that rejects requests exceeding the limit with 503 before they reach the handler.
+// Responses with 503 and responses slower than the latency threshold decrease the limit.
+func (s *LoadShedder) Shed() func(http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			release, ok := s.Acquire(s.priority(r))
+			if !ok {
+				w.Header().Set("Retry-After", "1")
+				WriteProblem(w, r, ErrOverloaded)
+				return
+			}
+
+			sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+			defer func() {
+				release(sw.status == http.StatusServiceUnavailable || sw.status == http.StatusGatewayTimeout)
+			}()
+			h.ServeHTTP(sw, r)
+		})
+	}
+}
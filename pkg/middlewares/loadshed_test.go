@@ -0,0 +1,191 @@
+package middlewares_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/d4l-data4life/go-svc/pkg/middlewares"
+	"github.com/d4l-data4life/go-svc/pkg/prom"
+)
+
+func TestLoadShedderPriorities(t *testing.T) {
+	shedder := middlewares.NewLoadShedder(
+		middlewares.LoadShedWithName("priorities"),
+		middlewares.LoadShedWithLimits(4, 1, 6),
+		middlewares.LoadShedWithInitOptions(prom.WithSubsystem("loadshed")),
+	)
+
+	var releases []func(bool)
+	acquire := func(p middlewares.Priority) bool {
+		release, ok := shedder.Acquire(p)
+		if ok {
+			releases = append(releases, release)
+		}
+		return ok
+	}
+
+	for i := 0; i < 3; i++ {
+		require.True(t, acquire(middlewares.PriorityLow))
+	}
+	assert.False(t, acquire(middlewares.PriorityLow), "low priority is shed at 75% of the limit")
+	assert.True(t, acquire(middlewares.PriorityNormal))
+	assert.False(t, acquire(middlewares.PriorityNormal), "normal priority is shed at the limit")
+	assert.True(t, acquire(middlewares.PriorityCritical))
+	assert.True(t, acquire(middlewares.PriorityCritical))
+	assert.False(t, acquire(middlewares.PriorityCritical), "critical priority is shed at the max limit")
+
+	for _, release := range releases {
+		release(false)
+	}
+	assert.True(t, acquire(middlewares.PriorityNormal))
+
+	res := httptest.NewRecorder()
+	promhttp.Handler().ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	assert.Contains(t, res.Body.String(), `d4l_loadshed_load_shedder_shed_total{priority="low",shedder="priorities"} 1`)
+	assert.Contains(t, res.Body.String(), `d4l_loadshed_load_shedder_shed_total{priority="normal",shedder="priorities"} 1`)
+	assert.Contains(t, res.Body.String(), `d4l_loadshed_load_shedder_in_flight{shedder="priorities"} 1`)
+	assert.Contains(t, res.Body.String(), `d4l_loadshed_load_shedder_limit{shedder="priorities"}`)
+}
+
+func TestLoadShedderAIMD(t *testing.T) {
+	shedder := middlewares.NewLoadShedder(
+		middlewares.LoadShedWithLimits(10, 5, 20),
+		middlewares.LoadShedWithLatencyThreshold(20*time.Millisecond),
+	)
+
+	// overload multiplies the limit with the backoff
+	release, ok := shedder.Acquire(middlewares.PriorityNormal)
+	require.True(t, ok)
+	release(true)
+	assert.Equal(t, 9, shedder.Limit())
+
+	// slow responses count as overload
+	release, ok = shedder.Acquire(middlewares.PriorityNormal)
+	require.True(t, ok)
+	time.Sleep(30 * time.Millisecond)
+	release(false)
+	assert.Equal(t, 8, shedder.Limit())
+
+	// the limit does not drop below the min limit
+	for i := 0; i < 20; i++ {
+		release, _ = shedder.Acquire(middlewares.PriorityNormal)
+		release(true)
+	}
+	assert.Equal(t, 5, shedder.Limit())
+
+	// fast responses of an idle shedder keep the limit
+	for i := 0; i < 10; i++ {
+		release, _ = shedder.Acquire(middlewares.PriorityNormal)
+		release(false)
+	}
+	assert.Equal(t, 5, shedder.Limit(), "the limit only grows while at least half of it is used")
+
+	// fast responses under load grow the limit by one per limit-many responses
+	var releases []func(bool)
+	for i := 0; i < 3; i++ {
+		release, ok := shedder.Acquire(middlewares.PriorityNormal)
+		require.True(t, ok)
+		releases = append(releases, release)
+	}
+	for i := 0; i < 6; i++ {
+		release, ok := shedder.Acquire(middlewares.PriorityNormal)
+		require.True(t, ok)
+		release(false)
+	}
+	assert.Equal(t, 6, shedder.Limit())
+	for _, release := range releases {
+		release(true)
+	}
+}
+
+func TestLoadShedderShed(t *testing.T) {
+	shedder := middlewares.NewLoadShedder(
+		middlewares.LoadShedWithLimits(5, 1, 10),
+		middlewares.LoadShedWithPriority(middlewares.PriorityFromHeader),
+	)
+
+	block := make(chan struct{})
+	var started sync.WaitGroup
+	handler := shedder.Shed()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			started.Done()
+			<-block
+		}
+	}))
+
+	var done sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		started.Add(1)
+		done.Add(1)
+		go func() {
+			defer done.Done()
+			handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/slow", nil))
+		}()
+	}
+	started.Wait()
+
+	res := httptest.NewRecorder()
+	handler.ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/fast", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, res.Code)
+	assert.Equal(t, "1", res.Header().Get("Retry-After"))
+
+	req := httptest.NewRequest(http.MethodGet, "/fast", nil)
+	req.Header.Set(middlewares.PriorityHeaderName, "critical")
+	res = httptest.NewRecorder()
+	handler.ServeHTTP(res, req)
+	assert.Equal(t, http.StatusOK, res.Code, "critical requests are admitted up to the max limit")
+
+	close(block)
+	done.Wait()
+
+	res = httptest.NewRecorder()
+	handler.ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/fast", nil))
+	assert.Equal(t, http.StatusOK, res.Code)
+}
+
+func TestLoadShedderIgnoresPriorityHeaderByDefault(t *testing.T) {
+	shedder := middlewares.NewLoadShedder(middlewares.LoadShedWithLimits(1, 1, 10))
+
+	block := make(chan struct{})
+	started := make(chan struct{})
+	handler := shedder.Shed()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			close(started)
+			<-block
+		}
+	}))
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/slow", nil))
+	}()
+	<-started
+
+	req := httptest.NewRequest(http.MethodGet, "/fast", nil)
+	req.Header.Set(middlewares.PriorityHeaderName, "critical")
+	res := httptest.NewRecorder()
+	handler.ServeHTTP(res, req)
+	assert.Equal(t, http.StatusServiceUnavailable, res.Code, "callers can't claim critical priority")
+
+	close(block)
+	<-done
+}
+
+func TestPriorityByPath(t *testing.T) {
+	priority := middlewares.PriorityByPath(map[string]middlewares.Priority{
+		"/api/v1/exports":       middlewares.PriorityLow,
+		"/api/v1/exports/admin": middlewares.PriorityCritical,
+	})
+
+	assert.Equal(t, middlewares.PriorityLow, priority(httptest.NewRequest(http.MethodGet, "/api/v1/exports/1", nil)))
+	assert.Equal(t, middlewares.PriorityCritical, priority(httptest.NewRequest(http.MethodGet, "/api/v1/exports/admin/1", nil)))
+	assert.Equal(t, middlewares.PriorityNormal, priority(httptest.NewRequest(http.MethodGet, "/api/v1/records", nil)))
+}
@@ -0,0 +1,80 @@
+package middlewares
+
+import (
+	"errors"
+	"io"
+	"net/http"
+)
+
+// MaxBodySize is the decorator that rejects requests with bodies larger than limit bytes with 413.
+// Requests announcing a larger Content-Length are rejected before the handler runs. For chunked requests
+// reading beyond the limit fails with *http.MaxBytesError and the response of the handler is replaced by the 413.
+func MaxBodySize(limit int64) func(http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.ContentLength > limit {
+				WriteProblem(w, r, ErrRequestBodyTooLarge)
+				return
+			}
+
+			mw := &maxBodyWriter{ResponseWriter: w, req: r}
+			r.Body = &maxBodyReader{ReadCloser: http.MaxBytesReader(w, r.Body, limit), writer: mw}
+			h.ServeHTTP(mw, r)
+			if !mw.wroteHeader && mw.exceeded {
+				mw.WriteHeader(http.StatusOK)
+			}
+		})
+	}
+}
+
+// maxBodyReader tells the writer once the body exceeded the limit
+type maxBodyReader struct {
+	io.ReadCloser
+	writer *maxBodyWriter
+}
+
+func (r *maxBodyReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		r.writer.exceeded = true
+	}
+	return n, err
+}
+
+// maxBodyWriter replaces the response with 413 if the body exceeded the limit before the response started
+type maxBodyWriter struct {
+	http.ResponseWriter
+	req         *http.Request
+	exceeded    bool
+	wroteHeader bool
+	rejected    bool
+}
+
+func (w *maxBodyWriter) WriteHeader(statusCode int) {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+	if w.exceeded {
+		w.rejected = true
+		WriteProblem(w.ResponseWriter, w.req, ErrRequestBodyTooLarge)
+		return
+	}
+	w.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (w *maxBodyWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.rejected {
+		return len(b), nil
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// Unwrap allows http.ResponseController to reach the Flusher and Hijacker of the wrapped writer
+func (w *maxBodyWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
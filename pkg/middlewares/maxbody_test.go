@@ -0,0 +1,48 @@
+package middlewares_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/d4l-data4life/go-svc/pkg/middlewares"
+)
+
+func TestMaxBodySize(t *testing.T) {
+	handler := middlewares.MaxBodySize(8)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		_, _ = w.Write(body)
+	}))
+
+	tests := []struct {
+		name          string
+		body          string
+		contentLength int64
+		wantStatus    int
+		wantBody      string
+	}{
+		{"within limit", "12345678", 8, http.StatusOK, "12345678"},
+		{"content length above limit", "123456789", 9, http.StatusRequestEntityTooLarge, "urn:d4l:problem:request-body-too-large"},
+		{"chunked body above limit", "123456789", -1, http.StatusRequestEntityTooLarge, "urn:d4l:problem:request-body-too-large"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/upload", strings.NewReader(tc.body))
+			req.ContentLength = tc.contentLength
+			res := httptest.NewRecorder()
+			handler.ServeHTTP(res, req)
+
+			assert.Equal(t, tc.wantStatus, res.Code)
+			assert.Contains(t, res.Body.String(), tc.wantBody)
+		})
+	}
+}
@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS idempotency_keys (
+	tenant_id    TEXT        NOT NULL,
+	key          TEXT        NOT NULL,
+	fingerprint  TEXT        NOT NULL,
+	status       INTEGER     NOT NULL DEFAULT 0,
+	header       TEXT        NOT NULL DEFAULT '',
+	body         BYTEA,
+	locked_until TIMESTAMPTZ NOT NULL,
+	expires_at   TIMESTAMPTZ NOT NULL,
+	PRIMARY KEY (tenant_id, key)
+);
+CREATE INDEX IF NOT EXISTS idempotency_keys_expires_at_idx ON idempotency_keys (expires_at);
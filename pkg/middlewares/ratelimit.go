@@ -0,0 +1,319 @@
+package middlewares
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/d4l-data4life/go-svc/pkg/log"
+	"github.com/d4l-data4life/go-svc/pkg/logging"
+	"github.com/d4l-data4life/go-svc/pkg/prom"
+)
+
+// Key classes of the default rate limit key, used as metric label instead of the unbounded keys
+const (
+	RateLimitClassTenant = "tenant"
+	RateLimitClassClient = "client"
+	RateLimitClassIP     = "ip"
+)
+
+// RateLimitAlgorithm decides how the budget of a key recovers over time
+type RateLimitAlgorithm int
+
+const (
+	// TokenBucketAlgorithm refills the budget continuously and allows bursts up to the full budget
+	TokenBucketAlgorithm RateLimitAlgorithm = iota
+	// SlidingWindowAlgorithm counts the requests of the last window, weighting the previous fixed window
+	SlidingWindowAlgorithm
+)
+
+// ErrInvalidLimit happens for limits without requests or window
+var ErrInvalidLimit = errors.New("invalid rate limit")
+
+// Limit allows Requests per Window for every key
+type Limit struct {
+	Algorithm RateLimitAlgorithm
+	Requests  int
+	Window    time.Duration
+}
+
+// Validate returns ErrInvalidLimit unless the limit allows a positive amount of requests per positive window
+func (l Limit) Validate() error {
+	if l.Requests <= 0 || l.Window <= 0 {
+		return fmt.Errorf("%w: %d requests per %v", ErrInvalidLimit, l.Requests, l.Window)
+	}
+	return nil
+}
+
+// TokenBucket allows bursts of up to requests, which are refilled evenly over the window
+func TokenBucket(requests int, window time.Duration) Limit {
+	return Limit{Algorithm: TokenBucketAlgorithm, Requests: requests, Window: window}
+}
+
+// SlidingWindow allows up to requests within any window
+func SlidingWindow(requests int, window time.Duration) Limit {
+	return Limit{Algorithm: SlidingWindowAlgorithm, Requests: requests, Window: window}
+}
+
+// RateLimitState is the persisted state of a key. Its meaning depends on the algorithm:
+// the token bucket stores the available tokens in Value, the sliding window stores the request counts
+// of the previous and the current fixed window in Previous and Value and the start of the current window in Time.
+type RateLimitState struct {
+	Value    float64
+	Previous float64
+	Time     time.Time
+}
+
+// RateLimitDecision is the result of taking a request from the budget of a key
+type RateLimitDecision struct {
+	Allowed    bool
+	Limit      int
+	Remaining  int
+	Reset      time.Duration
+	RetryAfter time.Duration
+}
+
+// Take consumes one request of the budget and returns the new state. The zero state is a full budget.
+func (l Limit) Take(state RateLimitState, now time.Time) (RateLimitState, RateLimitDecision) {
+	if l.Algorithm == SlidingWindowAlgorithm {
+		return l.takeSlidingWindow(state, now)
+	}
+	return l.takeTokenBucket(state, now)
+}
+
+func (l Limit) takeTokenBucket(state RateLimitState, now time.Time) (RateLimitState, RateLimitDecision) {
+	capacity := float64(l.Requests)
+	perToken := l.Window / time.Duration(l.Requests)
+
+	tokens := capacity
+	if !state.Time.IsZero() {
+		tokens = math.Min(capacity, state.Value+now.Sub(state.Time).Seconds()/perToken.Seconds())
+	}
+
+	decision := RateLimitDecision{Limit: l.Requests, Allowed: tokens >= 1}
+	if decision.Allowed {
+		tokens--
+	} else {
+		decision.RetryAfter = time.Duration((1 - tokens) * float64(perToken))
+	}
+	decision.Remaining = int(tokens)
+	decision.Reset = time.Duration((capacity - tokens) * float64(perToken))
+
+	return RateLimitState{Value: tokens, Time: now}, decision
+}
+
+func (l Limit) takeSlidingWindow(state RateLimitState, now time.Time) (RateLimitState, RateLimitDecision) {
+	start := now.Truncate(l.Window)
+	switch elapsedWindows := start.Sub(state.Time) / l.Window; {
+	case state.Time.IsZero() || elapsedWindows > 1:
+		state = RateLimitState{Time: start}
+	case elapsedWindows == 1:
+		state = RateLimitState{Previous: state.Value, Time: start}
+	}
+
+	// the previous window counts with the share it overlaps the sliding window
+	elapsed := now.Sub(start)
+	weight := 1 - float64(elapsed)/float64(l.Window)
+	count := state.Previous*weight + state.Value
+
+	requests, window := float64(l.Requests), float64(l.Window)
+	decision := RateLimitDecision{Limit: l.Requests, Allowed: count+1 <= requests}
+	switch {
+	case decision.Allowed:
+		state.Value++
+		count++
+	case state.Value+1 <= requests:
+		// the weighted count of the previous window decreases until the request fits into the current window
+		fits := window * (1 - (requests-state.Value-1)/state.Previous)
+		decision.RetryAfter = time.Duration(fits) - elapsed
+	default:
+		// the request fits once the current window became the previous one and its weight decreased enough
+		fits := math.Max(0, window*(1-(requests-1)/state.Value))
+		decision.RetryAfter = l.Window - elapsed + time.Duration(fits)
+	}
+	decision.Remaining = max(0, l.Requests-int(math.Ceil(count)))
+	decision.Reset = l.Window - elapsed
+
+	return state, decision
+}
+
+// RateLimitStore keeps the state of the rate limited keys
+type RateLimitStore interface {
+	// Take applies the limit to the state of the key atomically
+	Take(ctx context.Context, key string, limit Limit, now time.Time) (RateLimitDecision, error)
+}
+
+// MemoryRateLimitStore keeps the state in memory, limits are enforced per instance
+type MemoryRateLimitStore struct {
+	mu        sync.Mutex
+	states    map[string]RateLimitState
+	lastSweep time.Time
+}
+
+// NewMemoryRateLimitStore creates an empty in-memory store
+func NewMemoryRateLimitStore() *MemoryRateLimitStore {
+	return &MemoryRateLimitStore{states: map[string]RateLimitState{}, lastSweep: time.Now()}
+}
+
+func (s *MemoryRateLimitStore) Take(_ context.Context, key string, limit Limit, now time.Time) (RateLimitDecision, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// keys idle for two windows have a full budget again and are removed at most once per window
+	if now.Sub(s.lastSweep) > limit.Window {
+		for k, state := range s.states {
+			if now.Sub(state.Time) > 2*limit.Window {
+				delete(s.states, k)
+			}
+		}
+		s.lastSweep = now
+	}
+
+	state, decision := limit.Take(s.states[key], now)
+	s.states[key] = state
+	return decision, nil
+}
+
+// RateLimitKey returns the key of the request and its class, which is used as metric label.
+// Requests with an empty key are not limited.
+type RateLimitKey func(*http.Request) (class, key string)
+
+// DefaultRateLimitKey limits by the tenant ID in the context, else the client ID, else the caller IP
+func DefaultRateLimitKey(r *http.Request) (string, string) {
+	ctx := r.Context()
+	if tenantID, _ := ctx.Value(log.TenantIDContextKey).(string); tenantID != "" {
+		return RateLimitClassTenant, tenantID
+	}
+	if clientID, _ := ctx.Value(log.ClientIDContextKey).(string); clientID != "" {
+		return RateLimitClassClient, clientID
+	}
+	if callerIP, _ := ctx.Value(log.CallerIPContextKey).(string); callerIP != "" {
+		return RateLimitClassIP, callerIP
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return RateLimitClassIP, host
+}
+
+type rateLimiter struct {
+	name    string
+	limit   Limit
+	key     RateLimitKey
+	store   RateLimitStore
+	logger  *log.Logger
+	metrics *prom.RateLimitInstrumenter
+}
+
+// RateLimitOption is to be implemented by functional options
+type RateLimitOption func(*rateLimiter)
+
+// RateLimitWithName sets the limiter name used in logs and metrics (defaults to "default")
+func RateLimitWithName(name string) RateLimitOption {
+	return func(l *rateLimiter) {
+		l.name = name
+	}
+}
+
+// RateLimitWithKey sets the function deriving the limited key from the request (defaults to DefaultRateLimitKey)
+func RateLimitWithKey(key RateLimitKey) RateLimitOption {
+	return func(l *rateLimiter) {
+		l.key = key
+	}
+}
+
+// RateLimitWithStore sets the store of the limiter state (defaults to a MemoryRateLimitStore),
+// use a PostgresRateLimitStore to share the limits between replicas
+func RateLimitWithStore(store RateLimitStore) RateLimitOption {
+	return func(l *rateLimiter) {
+		l.store = store
+	}
+}
+
+// RateLimitWithLogger sets the logger used for throttled requests and store errors (defaults to the logging singleton)
+func RateLimitWithLogger(logger *log.Logger) RateLimitOption {
+	return func(l *rateLimiter) {
+		l.logger = logger
+	}
+}
+
+// RateLimitWithInitOptions changes the subsystem of the exported metrics
+func RateLimitWithInitOptions(options ...prom.InitOption) RateLimitOption {
+	return func(l *rateLimiter) {
+		l.metrics = prom.NewRateLimitInstrumenter(options...)
+	}
+}
+
+// RateLimit is the decorator that limits the requests of every key, by default the tenant, client or caller IP.
+// All responses carry the RateLimit-Limit, RateLimit-Remaining and RateLimit-Reset headers,
+// throttled requests are logged and answered with 429 and Retry-After.
+// Requests are allowed if the store fails, so an unavailable database does not take the service down.
+// It panics if the limit is invalid, see Limit.Validate.
+func RateLimit(limit Limit, options ...RateLimitOption) func(http.Handler) http.Handler {
+	if err := limit.Validate(); err != nil {
+		panic(err)
+	}
+	l := &rateLimiter{
+		name:  "default",
+		limit: limit,
+		key:   DefaultRateLimitKey,
+	}
+	for _, apply := range options {
+		apply(l)
+	}
+	if l.store == nil {
+		l.store = NewMemoryRateLimitStore()
+	}
+	if l.logger == nil {
+		l.logger = logging.Logger()
+	}
+	if l.metrics == nil {
+		l.metrics = prom.NewRateLimitInstrumenter()
+	}
+
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			class, key := l.key(r)
+			if key == "" {
+				h.ServeHTTP(w, r)
+				return
+			}
+
+			decision, err := l.store.Take(r.Context(), l.name+":"+class+":"+key, l.limit, time.Now())
+			if err != nil {
+				l.metrics.StoreError(l.name)
+				_ = l.logger.ErrGeneric(r.Context(), fmt.Errorf("rate limiter %s: %w", l.name, err))
+				h.ServeHTTP(w, r)
+				return
+			}
+			l.metrics.Decision(l.name, class, decision.Allowed)
+
+			header := w.Header()
+			header.Set("RateLimit-Limit", strconv.Itoa(decision.Limit))
+			header.Set("RateLimit-Remaining", strconv.Itoa(decision.Remaining))
+			header.Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(decision.Reset)))
+			header.Set("RateLimit-Policy", fmt.Sprintf("%d;w=%d", l.limit.Requests, ceilSeconds(l.limit.Window)))
+
+			if !decision.Allowed {
+				header.Set("Retry-After", strconv.Itoa(max(1, ceilSeconds(decision.RetryAfter))))
+				_ = l.logger.WarnGeneric(r.Context(),
+					fmt.Sprintf("rate limiter %s throttled %s %s", l.name, class, key), nil)
+				WriteProblem(w, r, ErrTooManyRequests)
+				return
+			}
+
+			h.ServeHTTP(w, r)
+		})
+	}
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
@@ -0,0 +1,61 @@
+package middlewares
+
+import (
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/d4l-data4life/go-svc/pkg/db"
+)
+
+// RateLimitEntry is the table of the PostgresRateLimitStore, add it to the migrations of the service:
+//
+//	conn.AutoMigrate(&middlewares.RateLimitEntry{})
+type RateLimitEntry struct {
+	Key      string `gorm:"primaryKey"`
+	Value    float64
+	Previous float64
+	Since    *time.Time `gorm:"index"`
+}
+
+// PostgresRateLimitStore keeps the state in the database of db.Get(), limits are shared between all replicas.
+// Every request locks the row of its key for the duration of a short transaction.
+type PostgresRateLimitStore struct{}
+
+// NewPostgresRateLimitStore creates a store using the database connection of db.Get()
+func NewPostgresRateLimitStore() *PostgresRateLimitStore {
+	return &PostgresRateLimitStore{}
+}
+
+func (s *PostgresRateLimitStore) Take(ctx context.Context, key string, limit Limit, now time.Time) (RateLimitDecision, error) {
+	var decision RateLimitDecision
+
+	err := db.Get().WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		entry := RateLimitEntry{Key: key}
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&entry).Error; err != nil {
+			return err
+		}
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Take(&entry, "key = ?", key).Error; err != nil {
+			return err
+		}
+
+		state := RateLimitState{Value: entry.Value, Previous: entry.Previous}
+		if entry.Since != nil {
+			state.Time = *entry.Since
+		}
+		state, decision = limit.Take(state, now)
+
+		entry.Value, entry.Previous, entry.Since = state.Value, state.Previous, &state.Time
+		return tx.Save(&entry).Error
+	})
+
+	return decision, err
+}
+
+// DeleteIdle removes the state of keys not used since the given time, e.g. two windows ago.
+// Removed keys start with a full budget again.
+func (s *PostgresRateLimitStore) DeleteIdle(ctx context.Context, before time.Time) error {
+	return db.Get().WithContext(ctx).Where("since < ?", before).Delete(&RateLimitEntry{}).Error
+}
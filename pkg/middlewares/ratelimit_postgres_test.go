@@ -0,0 +1,63 @@
+package middlewares_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+
+	"github.com/d4l-data4life/go-svc/pkg/db"
+	"github.com/d4l-data4life/go-svc/pkg/middlewares"
+)
+
+func initRateLimitDB(t *testing.T) {
+	t.Helper()
+	db.InitializeTestPostgres(db.NewConnection(
+		db.WithHost("localhost"),
+		db.WithPort("5432"),
+		db.WithDatabaseName("test"),
+		db.WithDatabaseSchema("testing"),
+		db.WithUser("user"),
+		db.WithPassword("test"),
+		db.WithSSLMode("disable"),
+		db.WithMigrationFunc(func(conn *gorm.DB) error {
+			conn.Exec("CREATE SCHEMA IF NOT EXISTS \"testing\"")
+			return conn.AutoMigrate(&middlewares.RateLimitEntry{})
+		}),
+		db.WithDriverFunc(db.TXDBPostgresDriver),
+	))
+	if db.Get() == nil || db.Ping() != nil {
+		t.Skip("postgres is not available")
+	}
+	t.Cleanup(db.Close)
+}
+
+func TestPostgresRateLimitStore(t *testing.T) {
+	initRateLimitDB(t)
+
+	store := middlewares.NewPostgresRateLimitStore()
+	limit := middlewares.SlidingWindow(2, time.Minute)
+	ctx := context.Background()
+	now := time.Now()
+
+	for i := 0; i < 2; i++ {
+		decision, err := store.Take(ctx, "tenant:tenant-1", limit, now)
+		require.NoError(t, err)
+		assert.True(t, decision.Allowed)
+	}
+	decision, err := store.Take(ctx, "tenant:tenant-1", limit, now)
+	require.NoError(t, err)
+	assert.False(t, decision.Allowed)
+
+	decision, err = store.Take(ctx, "tenant:tenant-2", limit, now)
+	require.NoError(t, err)
+	assert.True(t, decision.Allowed)
+
+	require.NoError(t, store.DeleteIdle(ctx, now.Add(time.Minute)))
+	decision, err = store.Take(ctx, "tenant:tenant-1", limit, now)
+	require.NoError(t, err)
+	assert.True(t, decision.Allowed, "deleted keys have a full budget")
+}
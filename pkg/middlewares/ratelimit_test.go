@@ -0,0 +1,154 @@
+package middlewares_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/d4l-data4life/go-svc/pkg/log"
+	"github.com/d4l-data4life/go-svc/pkg/middlewares"
+	"github.com/d4l-data4life/go-svc/pkg/prom"
+)
+
+func TestTokenBucket(t *testing.T) {
+	limit := middlewares.TokenBucket(2, 10*time.Second)
+	now := time.Unix(1700000000, 0)
+
+	var state middlewares.RateLimitState
+	var decision middlewares.RateLimitDecision
+	for i := 0; i < 2; i++ {
+		state, decision = limit.Take(state, now)
+		require.True(t, decision.Allowed, "burst request %d", i)
+	}
+	assert.Equal(t, 0, decision.Remaining)
+	assert.Equal(t, 10*time.Second, decision.Reset)
+
+	state, decision = limit.Take(state, now)
+	assert.False(t, decision.Allowed)
+	assert.Equal(t, 5*time.Second, decision.RetryAfter)
+
+	// one token is refilled every 5 seconds
+	state, decision = limit.Take(state, now.Add(5*time.Second))
+	assert.True(t, decision.Allowed)
+	_, decision = limit.Take(state, now.Add(6*time.Second))
+	assert.False(t, decision.Allowed)
+	assert.Equal(t, 4*time.Second, decision.RetryAfter)
+}
+
+func TestSlidingWindow(t *testing.T) {
+	limit := middlewares.SlidingWindow(4, 10*time.Second)
+	start := time.Unix(1700000000, 0).Truncate(10 * time.Second)
+
+	var state middlewares.RateLimitState
+	var decision middlewares.RateLimitDecision
+	for i := 0; i < 4; i++ {
+		state, decision = limit.Take(state, start.Add(time.Second))
+		require.True(t, decision.Allowed, "request %d", i)
+	}
+	assert.Equal(t, 0, decision.Remaining)
+
+	_, decision = limit.Take(state, start.Add(2*time.Second))
+	assert.False(t, decision.Allowed)
+	// the 4 requests become the previous window, 1 request fits once their weight dropped to 3/4
+	assert.Equal(t, 8*time.Second+2500*time.Millisecond, decision.RetryAfter)
+
+	// 2.5 seconds into the next window the previous requests count 4 * 0.75 = 3
+	state, decision = limit.Take(state, start.Add(12500*time.Millisecond))
+	assert.True(t, decision.Allowed)
+	_, decision = limit.Take(state, start.Add(12500*time.Millisecond))
+	assert.False(t, decision.Allowed)
+	assert.Equal(t, 2500*time.Millisecond, decision.RetryAfter)
+
+	// windows without requests reset the count
+	_, decision = limit.Take(state, start.Add(30*time.Second))
+	assert.True(t, decision.Allowed)
+	assert.Equal(t, 3, decision.Remaining)
+}
+
+type failingRateLimitStore struct{}
+
+func (failingRateLimitStore) Take(context.Context, string, middlewares.Limit, time.Time) (middlewares.RateLimitDecision, error) {
+	return middlewares.RateLimitDecision{}, errors.New("database unavailable")
+}
+
+func TestRateLimit(t *testing.T) {
+	buf := new(bytes.Buffer)
+	logger := log.NewLogger("test", "v0", "localhost", log.WithWriter(buf))
+	handler := middlewares.RateLimit(middlewares.TokenBucket(2, time.Minute),
+		middlewares.RateLimitWithName("records"),
+		middlewares.RateLimitWithLogger(logger),
+		middlewares.RateLimitWithInitOptions(prom.WithSubsystem("ratelimit")),
+	)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	send := func(tenantID, remoteAddr string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/records", nil)
+		req.RemoteAddr = remoteAddr
+		if tenantID != "" {
+			req = req.WithContext(context.WithValue(req.Context(), log.TenantIDContextKey, tenantID))
+		}
+		res := httptest.NewRecorder()
+		handler.ServeHTTP(res, req)
+		return res
+	}
+
+	res := send("tenant-1", "10.0.0.1:1234")
+	require.Equal(t, http.StatusOK, res.Code)
+	assert.Equal(t, "2", res.Header().Get("RateLimit-Limit"))
+	assert.Equal(t, "1", res.Header().Get("RateLimit-Remaining"))
+	assert.Equal(t, "30", res.Header().Get("RateLimit-Reset"))
+	assert.Equal(t, "2;w=60", res.Header().Get("RateLimit-Policy"))
+
+	require.Equal(t, http.StatusOK, send("tenant-1", "10.0.0.2:1234").Code)
+
+	res = send("tenant-1", "10.0.0.3:1234")
+	require.Equal(t, http.StatusTooManyRequests, res.Code)
+	assert.Equal(t, "30", res.Header().Get("Retry-After"))
+	assert.Equal(t, "0", res.Header().Get("RateLimit-Remaining"))
+	assert.Contains(t, buf.String(), "rate limiter records throttled tenant tenant-1")
+
+	// other tenants and callers without tenant have their own budget
+	assert.Equal(t, http.StatusOK, send("tenant-2", "10.0.0.1:1234").Code)
+	assert.Equal(t, http.StatusOK, send("", "10.0.0.1:1234").Code)
+	assert.Equal(t, http.StatusOK, send("", "10.0.0.1:5678").Code)
+	assert.Equal(t, http.StatusTooManyRequests, send("", "10.0.0.1:9012").Code)
+
+	metrics := httptest.NewRecorder()
+	promhttp.Handler().ServeHTTP(metrics, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	assert.Contains(t, metrics.Body.String(), `d4l_ratelimit_http_rate_limit_decisions_total{class="tenant",limiter="records",result="allowed"} 3`)
+	assert.Contains(t, metrics.Body.String(), `d4l_ratelimit_http_rate_limit_decisions_total{class="tenant",limiter="records",result="throttled"} 1`)
+	assert.Contains(t, metrics.Body.String(), `d4l_ratelimit_http_rate_limit_decisions_total{class="ip",limiter="records",result="throttled"} 1`)
+}
+
+func TestRateLimitStoreFailure(t *testing.T) {
+	logger := log.NewLogger("test", "v0", "localhost", log.WithWriter(new(bytes.Buffer)))
+	handler := middlewares.RateLimit(middlewares.TokenBucket(1, time.Minute),
+		middlewares.RateLimitWithStore(failingRateLimitStore{}),
+		middlewares.RateLimitWithLogger(logger),
+	)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	for i := 0; i < 3; i++ {
+		res := httptest.NewRecorder()
+		handler.ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/records", nil))
+		assert.Equal(t, http.StatusOK, res.Code, "requests are allowed if the store fails")
+	}
+}
+
+func TestRateLimitInvalidLimit(t *testing.T) {
+	for _, limit := range []middlewares.Limit{
+		middlewares.TokenBucket(0, time.Minute),
+		middlewares.SlidingWindow(10, 0),
+		{Requests: -1, Window: time.Second},
+	} {
+		assert.ErrorIs(t, limit.Validate(), middlewares.ErrInvalidLimit)
+		assert.Panics(t, func() { middlewares.RateLimit(limit) })
+	}
+	assert.NoError(t, middlewares.TokenBucket(1, time.Second).Validate())
+}
@@ -0,0 +1,107 @@
+package middlewares
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"runtime/debug"
+
+	"github.com/d4l-data4life/go-svc/pkg/log"
+	"github.com/d4l-data4life/go-svc/pkg/logging"
+	"github.com/d4l-data4life/go-svc/pkg/problem"
+	"github.com/d4l-data4life/go-svc/pkg/prom"
+)
+
+// PanicHook is called for every recovered panic after it has been logged, e.g. to alert an on-call channel.
+// It runs on the request goroutine and must not block the response for long.
+type PanicHook func(ctx context.Context, where string, value any, stack []byte)
+
+// Recoverer turns panics of handlers into internal errors, logs them with the stack and counts them
+type Recoverer struct {
+	logger  *log.Logger
+	metrics *prom.PanicInstrumenter
+	hooks   []PanicHook
+}
+
+// RecoverOption is to be implemented by functional options
+type RecoverOption func(*Recoverer)
+
+// RecoverWithLogger sets the logger used for recovered panics (defaults to the logging singleton)
+func RecoverWithLogger(logger *log.Logger) RecoverOption {
+	return func(r *Recoverer) {
+		r.logger = logger
+	}
+}
+
+// RecoverWithHook adds a hook called for every recovered panic
+func RecoverWithHook(hook PanicHook) RecoverOption {
+	return func(r *Recoverer) {
+		r.hooks = append(r.hooks, hook)
+	}
+}
+
+// RecoverWithInitOptions changes the subsystem of the exported metrics
+func RecoverWithInitOptions(options ...prom.InitOption) RecoverOption {
+	return func(r *Recoverer) {
+		r.metrics = prom.NewPanicInstrumenter(options...)
+	}
+}
+
+// NewRecoverer creates a Recoverer, share it between the HTTP middleware and the gRPC interceptors of a service
+func NewRecoverer(options ...RecoverOption) *Recoverer {
+	r := &Recoverer{}
+	for _, apply := range options {
+		apply(r)
+	}
+	if r.logger == nil {
+		r.logger = logging.Logger()
+	}
+	if r.metrics == nil {
+		r.metrics = prom.NewPanicInstrumenter()
+	}
+	return r
+}
+
+// HandlePanic logs the recovered panic value with the stack as ErrInternal, increments the panics_total metric
+// of the protocol and calls the hooks. where names the handler, e.g. the request method and path.
+func (rc *Recoverer) HandlePanic(ctx context.Context, protocol, where string, value any) {
+	stack := debug.Stack()
+	_ = rc.logger.ErrInternal(ctx, fmt.Errorf("panic in %s: %v\n%s", where, value, stack))
+	rc.metrics.Panic(protocol)
+	for _, hook := range rc.hooks {
+		hook(ctx, where, value, stack)
+	}
+}
+
+// Recover is the decorator answering requests whose handler panicked with 500.
+// The panic is logged with the trace, user and tenant ID of the request context,
+// so it has to be installed after the middlewares setting them (e.g. Trace, HTTPLogger and the tenant middleware).
+// A response which has already been started cannot be changed anymore and is only logged.
+// http.ErrAbortHandler is passed on to net/http, which aborts the response silently.
+func (rc *Recoverer) Recover() func(http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+			defer func() {
+				p := recover()
+				if p == nil {
+					return
+				}
+				if err, ok := p.(error); ok && errors.Is(err, http.ErrAbortHandler) {
+					panic(p)
+				}
+				rc.HandlePanic(r.Context(), "http", r.Method+" "+r.URL.Path, p)
+				if !sw.wroteHeader {
+					problem.Write(w, r, problem.New(http.StatusInternalServerError, ""))
+				}
+			}()
+			h.ServeHTTP(sw, r)
+		})
+	}
+}
+
+// Recover is the decorator answering requests whose handler panicked with 500, see Recoverer.Recover
+func Recover(options ...RecoverOption) func(http.Handler) http.Handler {
+	return NewRecoverer(options...).Recover()
+}
@@ -0,0 +1,71 @@
+package middlewares_test
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/d4l-data4life/go-svc/pkg/log"
+	"github.com/d4l-data4life/go-svc/pkg/middlewares"
+	"github.com/d4l-data4life/go-svc/pkg/prom"
+)
+
+func TestRecover(t *testing.T) {
+	buf := new(bytes.Buffer)
+	logger := log.NewLogger("test", "v0", "localhost", log.WithWriter(buf))
+
+	var hooked []string
+	recoverer := middlewares.NewRecoverer(
+		middlewares.RecoverWithLogger(logger),
+		middlewares.RecoverWithInitOptions(prom.WithSubsystem("recover")),
+		middlewares.RecoverWithHook(func(_ context.Context, where string, value any, stack []byte) {
+			hooked = append(hooked, where)
+			assert.Equal(t, "boom", value)
+			assert.NotEmpty(t, stack)
+		}),
+	)
+
+	handler := middlewares.Trace(recoverer.Recover()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/started" {
+			w.WriteHeader(http.StatusAccepted)
+		}
+		panic("boom")
+	})))
+
+	req := httptest.NewRequest(http.MethodGet, "/records", nil)
+	req.Header.Set(log.TraceIDHeaderKey, "b24caeb7-4250-428f-be62-844e041a5109")
+	res := httptest.NewRecorder()
+	handler.ServeHTTP(res, req)
+
+	assert.Equal(t, http.StatusInternalServerError, res.Code)
+	assert.Equal(t, []string{"GET /records"}, hooked)
+	assert.Contains(t, buf.String(), `"event-type":"err-internal"`)
+	assert.Contains(t, buf.String(), `"trace-id":"b24caeb7-4250-428f-be62-844e041a5109"`)
+	assert.Contains(t, buf.String(), "panic in GET /records: boom")
+	assert.Contains(t, buf.String(), "recover_test.go")
+
+	// a started response is kept
+	res = httptest.NewRecorder()
+	handler.ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/started", nil))
+	assert.Equal(t, http.StatusAccepted, res.Code)
+
+	metrics := httptest.NewRecorder()
+	promhttp.Handler().ServeHTTP(metrics, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	assert.Contains(t, metrics.Body.String(), `d4l_recover_panics_total{protocol="http"} 2`)
+}
+
+func TestRecoverAbortHandler(t *testing.T) {
+	handler := middlewares.Recover()(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+		panic(http.ErrAbortHandler)
+	}))
+
+	require.PanicsWithValue(t, http.ErrAbortHandler, func() {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	})
+}
@@ -0,0 +1,190 @@
+package middlewares
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/d4l-data4life/go-svc/pkg/logging"
+)
+
+// ErrNoSecrets happens when a secret source does not provide any secret
+var ErrNoSecrets = errors.New("no service secrets configured")
+
+// DefaultKeyID is the key ID of a single secret without name, e.g. the secret passed to NewServiceSecretAuthenticator
+const DefaultKeyID = "default"
+
+// SecretSource loads service secrets by key ID
+type SecretSource func() (map[string]string, error)
+
+// StaticSecrets provides the given secrets by key ID
+func StaticSecrets(secrets map[string]string) SecretSource {
+	return func() (map[string]string, error) {
+		return secrets, nil
+	}
+}
+
+// SecretsFromEnv reads the secret in the env variable name (key ID "default")
+// and in all env variables name_<KEY_ID>, e.g. SERVICE_SECRET_PREVIOUS for key ID "previous".
+func SecretsFromEnv(name string) SecretSource {
+	return func() (map[string]string, error) {
+		secrets := map[string]string{}
+		for _, env := range os.Environ() {
+			key, value, _ := strings.Cut(env, "=")
+			if value == "" {
+				continue
+			}
+			if key == name {
+				secrets[DefaultKeyID] = value
+				continue
+			}
+			if keyID, ok := strings.CutPrefix(key, name+"_"); ok && keyID != "" {
+				secrets[strings.ToLower(keyID)] = value
+			}
+		}
+		return secrets, nil
+	}
+}
+
+// SecretsFromFile reads the secrets from a JSON object of key IDs and secrets, e.g. {"2025-01": "...", "2024-07": "..."}
+func SecretsFromFile(path string) SecretSource {
+	return func() (map[string]string, error) {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("reading service secrets: %w", err)
+		}
+		secrets := map[string]string{}
+		if err := json.Unmarshal(data, &secrets); err != nil {
+			return nil, fmt.Errorf("parsing service secrets: %w", err)
+		}
+		return secrets, nil
+	}
+}
+
+// SecretsFromDir reads every regular file of the directory as secret named by the file name,
+// which is the layout of a mounted Kubernetes secret. Hidden files are skipped.
+func SecretsFromDir(dir string) SecretSource {
+	return func() (map[string]string, error) {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			return nil, fmt.Errorf("reading service secrets: %w", err)
+		}
+		secrets := map[string]string{}
+		for _, entry := range entries {
+			if strings.HasPrefix(entry.Name(), ".") {
+				continue
+			}
+			// Kubernetes mounts the files as symlinks, os.Stat follows them
+			info, err := os.Stat(filepath.Join(dir, entry.Name()))
+			if err != nil || !info.Mode().IsRegular() {
+				continue
+			}
+			data, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+			if err != nil {
+				return nil, fmt.Errorf("reading service secret %s: %w", entry.Name(), err)
+			}
+			secrets[entry.Name()] = strings.TrimSpace(string(data))
+		}
+		return secrets, nil
+	}
+}
+
+// SecretSet holds the accepted service secrets by key ID, e.g. the current and the previous secret during a rotation.
+// The secrets can be reloaded from their source at runtime.
+type SecretSet struct {
+	source SecretSource
+
+	mu      sync.RWMutex
+	secrets map[string][]byte
+}
+
+// NewSecretSet loads the secrets of the source, it fails with ErrNoSecrets if the source is empty
+func NewSecretSet(source SecretSource) (*SecretSet, error) {
+	s := &SecretSet{source: source}
+	if err := s.Reload(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Reload replaces the secrets with the current content of the source.
+// The secrets are kept if the source fails or is empty.
+func (s *SecretSet) Reload() error {
+	loaded, err := s.source()
+	if err != nil {
+		return err
+	}
+
+	secrets := make(map[string][]byte, len(loaded))
+	for keyID, secret := range loaded {
+		if secret != "" {
+			secrets[keyID] = []byte(secret)
+		}
+	}
+	if len(secrets) == 0 {
+		return ErrNoSecrets
+	}
+
+	s.mu.Lock()
+	s.secrets = secrets
+	s.mu.Unlock()
+	return nil
+}
+
+// ReloadEvery reloads the secrets periodically until the context is done. Failed reloads are logged.
+func (s *SecretSet) ReloadEvery(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.Reload(); err != nil {
+				logging.LogErrorfCtx(ctx, err, "reloading service secrets")
+			}
+		}
+	}
+}
+
+// KeyIDs returns the sorted IDs of the accepted secrets
+func (s *SecretSet) KeyIDs() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return slices.Sorted(maps.Keys(s.secrets))
+}
+
+// Secret returns the secret of the key ID
+func (s *SecretSet) Secret(keyID string) ([]byte, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	secret, ok := s.secrets[keyID]
+	return secret, ok
+}
+
+// Match returns the key ID of the secret equal to the given one. All secrets are compared in constant time,
+// so the timing reveals neither the secrets nor which of them matched.
+func (s *SecretSet) Match(secret string) (string, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	matched, ok := "", false
+	for keyID, candidate := range s.secrets {
+		if subtle.ConstantTimeCompare([]byte(secret), candidate) == 1 {
+			matched, ok = keyID, true
+		}
+	}
+	return matched, ok
+}
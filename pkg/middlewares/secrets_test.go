@@ -0,0 +1,114 @@
+package middlewares_test
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/d4l-data4life/go-svc/pkg/log"
+	"github.com/d4l-data4life/go-svc/pkg/middlewares"
+	"github.com/d4l-data4life/go-svc/pkg/prom"
+)
+
+func TestSecretSources(t *testing.T) {
+	t.Setenv("TEST_SERVICE_SECRET", "current")
+	t.Setenv("TEST_SERVICE_SECRET_PREVIOUS", "previous")
+	t.Setenv("TEST_SERVICE_SECRET_EMPTY", "")
+
+	secretsFile := filepath.Join(t.TempDir(), "secrets.json")
+	require.NoError(t, os.WriteFile(secretsFile, []byte(`{"2025-01": "current", "2024-07": "previous"}`), 0o600))
+
+	secretsDir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(secretsDir, "current"), []byte("current\n"), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(secretsDir, ".hidden"), []byte("hidden"), 0o600))
+	require.NoError(t, os.Mkdir(filepath.Join(secretsDir, "subdir"), 0o700))
+
+	tests := []struct {
+		name       string
+		source     middlewares.SecretSource
+		wantKeyIDs []string
+	}{
+		{"env", middlewares.SecretsFromEnv("TEST_SERVICE_SECRET"), []string{"default", "previous"}},
+		{"file", middlewares.SecretsFromFile(secretsFile), []string{"2024-07", "2025-01"}},
+		{"dir", middlewares.SecretsFromDir(secretsDir), []string{"current"}},
+		{"static", middlewares.StaticSecrets(map[string]string{"a": "current"}), []string{"a"}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			secrets, err := middlewares.NewSecretSet(tc.source)
+			require.NoError(t, err)
+			assert.Equal(t, tc.wantKeyIDs, secrets.KeyIDs())
+
+			_, ok := secrets.Match("current")
+			assert.True(t, ok)
+			_, ok = secrets.Match("wrong")
+			assert.False(t, ok)
+		})
+	}
+
+	t.Run("empty source", func(t *testing.T) {
+		_, err := middlewares.NewSecretSet(middlewares.SecretsFromEnv("TEST_SERVICE_SECRET_MISSING"))
+		assert.ErrorIs(t, err, middlewares.ErrNoSecrets)
+	})
+}
+
+func TestSecretSetReload(t *testing.T) {
+	secretsFile := filepath.Join(t.TempDir(), "secrets.json")
+	require.NoError(t, os.WriteFile(secretsFile, []byte(`{"v1": "old"}`), 0o600))
+
+	secrets, err := middlewares.NewSecretSet(middlewares.SecretsFromFile(secretsFile))
+	require.NoError(t, err)
+
+	// rotation: the new secret is added, the old one is still accepted
+	require.NoError(t, os.WriteFile(secretsFile, []byte(`{"v1": "old", "v2": "new"}`), 0o600))
+	require.NoError(t, secrets.Reload())
+	keyID, ok := secrets.Match("new")
+	assert.True(t, ok)
+	assert.Equal(t, "v2", keyID)
+	keyID, ok = secrets.Match("old")
+	assert.True(t, ok)
+	assert.Equal(t, "v1", keyID)
+
+	// broken files keep the secrets
+	require.NoError(t, os.WriteFile(secretsFile, []byte(`{`), 0o600))
+	assert.Error(t, secrets.Reload())
+	_, ok = secrets.Match("new")
+	assert.True(t, ok)
+
+	// the old secret is retired
+	require.NoError(t, os.WriteFile(secretsFile, []byte(`{"v2": "new"}`), 0o600))
+	require.NoError(t, secrets.Reload())
+	_, ok = secrets.Match("old")
+	assert.False(t, ok)
+}
+
+func TestServiceSecretAuthenticatorWithSecrets(t *testing.T) {
+	secrets, err := middlewares.NewSecretSet(middlewares.StaticSecrets(map[string]string{"current": "new", "previous": "old"}))
+	require.NoError(t, err)
+
+	logger := log.NewLogger("test", "v0", "localhost", log.WithWriter(new(bytes.Buffer)))
+	authenticator := middlewares.NewServiceSecretAuthenticator("", logger,
+		middlewares.ServiceSecretWithSecrets(secrets),
+		middlewares.ServiceSecretWithInitOptions(prom.WithSubsystem("rotation")),
+	)
+
+	for _, header := range []string{"Bearer new", "Bearer old", "Bearer old", "Bearer wrong", "Bearer "} {
+		_ = authenticator.Validate(context.Background(), header)
+	}
+
+	res := httptest.NewRecorder()
+	promhttp.Handler().ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	assert.Contains(t, res.Body.String(), `d4l_rotation_service_secret_authentications_total{key_id="current"} 1`)
+	assert.Contains(t, res.Body.String(), `d4l_rotation_service_secret_authentications_total{key_id="previous"} 2`)
+	assert.Contains(t, res.Body.String(), `d4l_rotation_service_secret_failures_total{reason="invalid"} 1`)
+	assert.Contains(t, res.Body.String(), `d4l_rotation_service_secret_failures_total{reason="malformed"} 1`)
+}
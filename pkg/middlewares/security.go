@@ -0,0 +1,72 @@
+package middlewares
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/caarlos0/env"
+)
+
+// SecurityHeadersConfig are the security headers set on every response, empty values are not set.
+// The defaults fit JSON APIs, services serving HTML have to relax the Content-Security-Policy.
+// HSTS does not cover subdomains by default, only set HSTSIncludeSubdomains if all of them serve HTTPS.
+type SecurityHeadersConfig struct {
+	// HSTSMaxAge is the max-age of Strict-Transport-Security, 0 disables HSTS
+	HSTSMaxAge            time.Duration `env:"HTTP_SECURITY_HSTS_MAX_AGE"            envDefault:"8760h"`
+	HSTSIncludeSubdomains bool          `env:"HTTP_SECURITY_HSTS_INCLUDE_SUBDOMAINS" envDefault:"false"`
+	HSTSPreload           bool          `env:"HTTP_SECURITY_HSTS_PRELOAD"            envDefault:"false"`
+	ContentSecurityPolicy string        `env:"HTTP_SECURITY_CONTENT_SECURITY_POLICY" envDefault:"default-src 'none'; frame-ancestors 'none'"`
+	// NoSniff sets X-Content-Type-Options: nosniff
+	NoSniff           bool   `env:"HTTP_SECURITY_NO_SNIFF"          envDefault:"true"`
+	FrameOptions      string `env:"HTTP_SECURITY_FRAME_OPTIONS"      envDefault:"DENY"`
+	ReferrerPolicy    string `env:"HTTP_SECURITY_REFERRER_POLICY"    envDefault:"no-referrer"`
+	PermissionsPolicy string `env:"HTTP_SECURITY_PERMISSIONS_POLICY" envDefault:"camera=(), microphone=(), geolocation=()"`
+}
+
+// SecurityHeadersConfigFromEnv reads the config from the HTTP_SECURITY_* environment variables,
+// unset variables keep their defaults
+func SecurityHeadersConfigFromEnv() (SecurityHeadersConfig, error) {
+	var cfg SecurityHeadersConfig
+	err := env.Parse(&cfg)
+	return cfg, err
+}
+
+// SecurityHeaders is the decorator setting the configured security headers on all responses.
+// Headers set by the handler take precedence.
+func SecurityHeaders(cfg SecurityHeadersConfig) func(http.Handler) http.Handler {
+	headers := map[string]string{
+		"Content-Security-Policy": cfg.ContentSecurityPolicy,
+		"X-Frame-Options":         cfg.FrameOptions,
+		"Referrer-Policy":         cfg.ReferrerPolicy,
+		"Permissions-Policy":      cfg.PermissionsPolicy,
+	}
+	if cfg.NoSniff {
+		headers["X-Content-Type-Options"] = "nosniff"
+	}
+	if cfg.HSTSMaxAge > 0 {
+		hsts := "max-age=" + strconv.FormatInt(int64(cfg.HSTSMaxAge/time.Second), 10)
+		if cfg.HSTSIncludeSubdomains {
+			hsts += "; includeSubDomains"
+		}
+		if cfg.HSTSPreload {
+			hsts += "; preload"
+		}
+		headers["Strict-Transport-Security"] = hsts
+	}
+	for name, value := range headers {
+		if value == "" {
+			delete(headers, name)
+		}
+	}
+
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			header := w.Header()
+			for name, value := range headers {
+				header.Set(name, value)
+			}
+			h.ServeHTTP(w, r)
+		})
+	}
+}
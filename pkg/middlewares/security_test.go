@@ -0,0 +1,55 @@
+package middlewares_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/d4l-data4life/go-svc/pkg/middlewares"
+)
+
+func TestSecurityHeadersFromEnv(t *testing.T) {
+	t.Setenv("HTTP_SECURITY_HSTS_MAX_AGE", "1h")
+	t.Setenv("HTTP_SECURITY_HSTS_INCLUDE_SUBDOMAINS", "true")
+	t.Setenv("HTTP_SECURITY_HSTS_PRELOAD", "true")
+	t.Setenv("HTTP_SECURITY_FRAME_OPTIONS", "")
+
+	cfg, err := middlewares.SecurityHeadersConfigFromEnv()
+	require.NoError(t, err)
+
+	handler := middlewares.SecurityHeaders(cfg)(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Referrer-Policy", "strict-origin")
+	}))
+	res := httptest.NewRecorder()
+	handler.ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	assert.Equal(t, "max-age=3600; includeSubDomains; preload", res.Header().Get("Strict-Transport-Security"))
+	assert.Equal(t, "default-src 'none'; frame-ancestors 'none'", res.Header().Get("Content-Security-Policy"))
+	assert.Equal(t, "nosniff", res.Header().Get("X-Content-Type-Options"))
+	assert.Equal(t, "camera=(), microphone=(), geolocation=()", res.Header().Get("Permissions-Policy"))
+	assert.Equal(t, "strict-origin", res.Header().Get("Referrer-Policy"), "the handler overrides the header")
+	assert.NotContains(t, res.Header(), "X-Frame-Options", "empty values are not set")
+}
+
+func TestSecurityHeadersDefaults(t *testing.T) {
+	cfg, err := middlewares.SecurityHeadersConfigFromEnv()
+	require.NoError(t, err)
+
+	handler := middlewares.SecurityHeaders(cfg)(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	res := httptest.NewRecorder()
+	handler.ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	assert.Equal(t, "max-age=31536000", res.Header().Get("Strict-Transport-Security"), "subdomains are opt-in")
+}
+
+func TestSecurityHeadersWithoutHSTS(t *testing.T) {
+	handler := middlewares.SecurityHeaders(middlewares.SecurityHeadersConfig{HSTSMaxAge: 0, FrameOptions: "SAMEORIGIN"})(
+		http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	res := httptest.NewRecorder()
+	handler.ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	assert.Equal(t, http.Header{"X-Frame-Options": {"SAMEORIGIN"}}, res.Header())
+}
@@ -2,10 +2,14 @@ package middlewares
 
 import (
 	"context"
+	"crypto/subtle"
 	"errors"
 	"fmt"
 	"net/http"
 	"strings"
+
+	"github.com/d4l-data4life/go-svc/pkg/logging"
+	"github.com/d4l-data4life/go-svc/pkg/prom"
 )
 
 // Errors
@@ -21,12 +25,41 @@ type logger interface {
 
 // ServiceSecretAuthenticator is the type that provides a service secret authentication middleware
 type ServiceSecretAuthenticator struct {
-	Secret string
-	logger logger
+	Secret  string
+	secrets *SecretSet
+	logger  logger
+	metrics *prom.ServiceSecretInstrumenter
+}
+
+// ServiceSecretOption is to be implemented by functional options
+type ServiceSecretOption func(*ServiceSecretAuthenticator)
+
+// ServiceSecretWithSecrets accepts all secrets of the set instead of the single service secret,
+// which allows rotating the secret without a synchronized deploy of all callers
+func ServiceSecretWithSecrets(secrets *SecretSet) ServiceSecretOption {
+	return func(sa *ServiceSecretAuthenticator) {
+		sa.secrets = secrets
+	}
+}
+
+// ServiceSecretWithInitOptions changes the subsystem of the exported metrics
+func ServiceSecretWithInitOptions(options ...prom.InitOption) ServiceSecretOption {
+	return func(sa *ServiceSecretAuthenticator) {
+		sa.metrics = prom.NewServiceSecretInstrumenter(options...)
+	}
 }
 
-func NewServiceSecretAuthenticator(serviceSecret string, l logger) *ServiceSecretAuthenticator {
-	return &ServiceSecretAuthenticator{logger: l, Secret: serviceSecret}
+// NewServiceSecretAuthenticator creates an authenticator accepting the service secret
+// or, with ServiceSecretWithSecrets, any secret of a secret set
+func NewServiceSecretAuthenticator(serviceSecret string, l logger, options ...ServiceSecretOption) *ServiceSecretAuthenticator {
+	sa := &ServiceSecretAuthenticator{logger: l, Secret: serviceSecret}
+	for _, apply := range options {
+		apply(sa)
+	}
+	if sa.metrics == nil {
+		sa.metrics = prom.NewServiceSecretInstrumenter()
+	}
+	return sa
 }
 
 // Authenticate is the decorator that protects a handler using a service secret.
@@ -35,34 +68,63 @@ func NewServiceSecretAuthenticator(serviceSecret string, l logger) *ServiceSecre
 func (sa ServiceSecretAuthenticator) Authenticate() func(http.Handler) http.Handler {
 	return func(h http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
-			authHeaderContent := req.Header.Get("Authorization")
-			if authHeaderContent == "" {
-				_ = sa.logger.ErrGeneric(req.Context(), fmt.Errorf("extracting auth secret: %w", ErrNoSecretInRequest))
-				http.Error(w, "unauthorized", http.StatusUnauthorized)
+			if err := sa.Validate(req.Context(), req.Header.Get("Authorization")); err != nil {
+				WriteProblem(w, req, err)
 				return
 			}
 
-			headerContentSplit := strings.Split(authHeaderContent, "Bearer ")
-			if len(headerContentSplit) != 2 {
-				_ = sa.logger.ErrGeneric(req.Context(), fmt.Errorf("parsing auth secret: %w", ErrMalformedAuthHeader))
-				http.Error(w, "unauthorized", http.StatusUnauthorized)
-				return
-			}
+			h.ServeHTTP(w, req)
+		})
+	}
+}
 
-			headerSecret := headerContentSplit[1]
-			if headerSecret == "" {
-				_ = sa.logger.ErrGeneric(req.Context(), fmt.Errorf("parsing auth secret: %w", ErrMalformedAuthHeader))
-				http.Error(w, "unauthorized", http.StatusUnauthorized)
-				return
-			}
+// Validate checks the content of an Authorization header ("Bearer <secret>") against the configured service secrets.
+// Failures are logged and returned as ErrNoSecretInRequest, ErrMalformedAuthHeader or ErrInvalidSecret.
+// The key ID of the matched secret is logged on debug level and counted, so unused secrets can be retired.
+func (sa ServiceSecretAuthenticator) Validate(ctx context.Context, authHeaderContent string) error {
+	if authHeaderContent == "" {
+		err := fmt.Errorf("extracting auth secret: %w", ErrNoSecretInRequest)
+		_ = sa.logger.ErrGeneric(ctx, err)
+		sa.metrics.Failure("missing")
+		return err
+	}
 
-			if headerSecret != sa.Secret {
-				_ = sa.logger.ErrGeneric(req.Context(), fmt.Errorf("%w", ErrInvalidSecret))
-				http.Error(w, "unauthorized", http.StatusUnauthorized)
-				return
-			}
+	headerContentSplit := strings.Split(authHeaderContent, "Bearer ")
+	if len(headerContentSplit) != 2 {
+		err := fmt.Errorf("parsing auth secret: %w", ErrMalformedAuthHeader)
+		_ = sa.logger.ErrGeneric(ctx, err)
+		sa.metrics.Failure("malformed")
+		return err
+	}
 
-			h.ServeHTTP(w, req)
-		})
+	headerSecret := headerContentSplit[1]
+	if headerSecret == "" {
+		err := fmt.Errorf("parsing auth secret: %w", ErrMalformedAuthHeader)
+		_ = sa.logger.ErrGeneric(ctx, err)
+		sa.metrics.Failure("malformed")
+		return err
+	}
+
+	keyID, ok := sa.match(headerSecret)
+	if !ok {
+		err := fmt.Errorf("%w", ErrInvalidSecret)
+		_ = sa.logger.ErrGeneric(ctx, err)
+		sa.metrics.Failure("invalid")
+		return err
+	}
+
+	logging.LogDebugfCtx(ctx, "service secret with key ID %s matched", keyID)
+	sa.metrics.Success(keyID)
+	return nil
+}
+
+// match compares the secret in constant time with the secret set or, if none is configured, the single service secret
+func (sa ServiceSecretAuthenticator) match(secret string) (string, bool) {
+	if sa.secrets != nil {
+		return sa.secrets.Match(secret)
+	}
+	if sa.Secret != "" && subtle.ConstantTimeCompare([]byte(secret), []byte(sa.Secret)) == 1 {
+		return DefaultKeyID, true
 	}
+	return "", false
 }
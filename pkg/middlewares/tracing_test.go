@@ -0,0 +1,44 @@
+package middlewares_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	otelcodes "go.opentelemetry.io/otel/codes"
+
+	"github.com/d4l-data4life/go-svc/pkg/log"
+	"github.com/d4l-data4life/go-svc/pkg/middlewares"
+	"github.com/d4l-data4life/go-svc/pkg/tracing"
+)
+
+func TestTracing(t *testing.T) {
+	exporter := tracing.NewInMemoryExporter()
+	shutdown, err := tracing.Init("test", tracing.WithSyncExporter(exporter))
+	require.NoError(t, err)
+	defer func() { _ = shutdown(context.Background()) }()
+
+	var traceID string
+	router := chi.NewRouter()
+	router.Use(middlewares.Tracing)
+	router.Get("/users/{id}", func(w http.ResponseWriter, r *http.Request) {
+		traceID, _ = r.Context().Value(log.TraceIDContextKey).(string)
+		w.WriteHeader(http.StatusBadGateway)
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/users/42", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	router.ServeHTTP(httptest.NewRecorder(), req)
+
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", traceID)
+
+	spans := exporter.GetSpans()
+	require.Len(t, spans, 1)
+	assert.Equal(t, "HTTP GET /users/{id}", spans[0].Name)
+	assert.Equal(t, "00f067aa0ba902b7", spans[0].Parent.SpanID().String())
+	assert.Equal(t, otelcodes.Error, spans[0].Status.Code)
+}
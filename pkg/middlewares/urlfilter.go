@@ -40,7 +40,7 @@ func URLValidator(next http.Handler) http.Handler {
 		for param, values := range queryValues {
 			if stringContainsCTLByte(param) || stringsContainCTLByte(values) {
 				logging.LogErrorfCtx(r.Context(), ErrInvalidQuery, "")
-				WriteHTTPErrorCode(w, ErrInvalidQuery, http.StatusBadRequest)
+				WriteProblem(w, r, ErrInvalidQuery)
 				return
 			}
 		}
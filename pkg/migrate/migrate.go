@@ -4,6 +4,7 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
+	"io/fs"
 	"os"
 	"strings"
 	"text/template"
@@ -14,6 +15,7 @@ import (
 
 	// import the file driver for reading the migration scripts from files
 	_ "github.com/golang-migrate/migrate/v4/source/file"
+	"github.com/golang-migrate/migrate/v4/source/iofs"
 	"github.com/pkg/errors"
 )
 
@@ -29,6 +31,7 @@ type Migration struct {
 	migrationTable  string
 	foreignDatabase *ForeignDatabase
 	sourceFolder    string
+	sourceFS        fs.FS
 	log             logger
 }
 
@@ -51,6 +54,17 @@ func NewMigration(db *sql.DB, sourceFolder, migrationTable string, log logger) *
 	}
 }
 
+// NewMigrationFromFS returns a new migration instance reading the sql scripts from the root of sourceFS instead of a folder,
+// e.g. an embed.FS with the migrations shipped by a library
+func NewMigrationFromFS(db *sql.DB, sourceFS fs.FS, migrationTable string, log logger) *Migration {
+	return &Migration{
+		db:             db,
+		migrationTable: migrationTable,
+		sourceFS:       sourceFS,
+		log:            log,
+	}
+}
+
 // NewMigrationWithFdw returns a new migration instances for the given database connection
 // with support forpostgres_fdwvia fdw.up.sql and fdw.down.sql scripts
 func NewMigrationWithFdw(db *sql.DB, sourceFolder, migrationTable string, foreignDB *ForeignDatabase, log logger) *Migration {
@@ -90,11 +104,7 @@ func (m *Migration) MigrateDB(ctx context.Context, migrationVersion uint, startF
 		return errors.Wrap(err, "error creating database driver")
 	}
 
-	mpg, err := migrate.NewWithDatabaseInstance(
-		"file://"+m.sourceFolder,
-		"postgres",
-		driver,
-	)
+	mpg, err := m.newMigrate(driver)
 	if err != nil {
 		return errors.Wrap(err, "error creating migrate instance")
 	}
@@ -130,10 +140,25 @@ func (m *Migration) MigrateDB(ctx context.Context, migrationVersion uint, startF
 	return nil
 }
 
+// newMigrate creates the golang-migrate instance reading the migration steps from the source folder or FS
+func (m *Migration) newMigrate(driver database.Driver) (*migrate.Migrate, error) {
+	if m.sourceFS == nil {
+		return migrate.NewWithDatabaseInstance("file://"+m.sourceFolder, "postgres", driver)
+	}
+	source, err := iofs.New(m.sourceFS, ".")
+	if err != nil {
+		return nil, errors.Wrap(err, "error reading the migrations")
+	}
+	return migrate.NewWithInstance("iofs", source, "postgres", driver)
+}
+
 func (m *Migration) parseFile(ctx context.Context, filename string, templateData interface{}) (string, error) {
 	path := m.sourceFolder + "/" + filename
+	if m.sourceFS != nil {
+		path = filename
+	}
 
-	exists, err := fileExists(path)
+	exists, err := m.fileExists(path)
 	if err != nil {
 		return "", errors.Wrap(err, fmt.Sprintf("could not access the file on path %s", path))
 	}
@@ -143,7 +168,7 @@ func (m *Migration) parseFile(ctx context.Context, filename string, templateData
 		return "", nil
 	}
 
-	c, err := os.ReadFile(path)
+	c, err := m.readFile(path)
 	if err != nil {
 		return "", errors.Wrap(err, fmt.Sprintf("could not open the file on path %s", path))
 	}
@@ -181,6 +206,24 @@ func (m *Migration) execute(ctx context.Context, filename string, templateData i
 	return err
 }
 
+func (m *Migration) fileExists(path string) (bool, error) {
+	if m.sourceFS == nil {
+		return fileExists(path)
+	}
+	_, err := fs.Stat(m.sourceFS, path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (m *Migration) readFile(path string) ([]byte, error) {
+	if m.sourceFS == nil {
+		return os.ReadFile(path)
+	}
+	return fs.ReadFile(m.sourceFS, path)
+}
+
 func fileExists(path string) (bool, error) {
 	_, err := os.Stat(path)
 	if err == nil {
@@ -2,8 +2,10 @@ package migrate
 
 import (
 	"context"
+	"io/fs"
 	"log"
 	"testing"
+	"testing/fstest"
 
 	_ "github.com/golang-migrate/migrate/v4/source/file"
 )
@@ -18,6 +20,7 @@ func (l *testLog) InfoGeneric(_ context.Context, msg string) error {
 func TestMigration_parseFile(t *testing.T) {
 	type fields struct {
 		sourceFolder string
+		sourceFS     fs.FS
 		log          logger
 	}
 	type args struct {
@@ -63,6 +66,30 @@ func TestMigration_parseFile(t *testing.T) {
 			want:    wantParsedSetup,
 			wantErr: false,
 		},
+		{
+			name: "success - from fs",
+			fields: fields{
+				sourceFS: fstest.MapFS{"setup.sql": {Data: []byte(wantParsedSetup)}},
+				log:      &testLog{},
+			},
+			args: args{
+				filename: "setup.sql",
+			},
+			want:    wantParsedSetup,
+			wantErr: false,
+		},
+		{
+			name: "file not exists in fs",
+			fields: fields{
+				sourceFS: fstest.MapFS{},
+				log:      &testLog{},
+			},
+			args: args{
+				filename: "setup.sql",
+			},
+			want:    "",
+			wantErr: false,
+		},
 		{
 			name: "file not exists",
 			fields: fields{
@@ -88,6 +115,7 @@ func TestMigration_parseFile(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			m := &Migration{
 				sourceFolder: tt.fields.sourceFolder,
+				sourceFS:     tt.fields.sourceFS,
 				log:          tt.fields.log,
 			}
 			got, err := m.parseFile(context.Background(), tt.args.filename, tt.args.templateData)
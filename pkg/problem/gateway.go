@@ -0,0 +1,41 @@
+package problem
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"google.golang.org/grpc/status"
+)
+
+// GatewayErrorHandler renders the errors of a grpc-gateway mux as problem details.
+// Errors matching the registry get their registered type, gRPC status errors get the blank type
+// with the HTTP status of their code and, for client errors, their message as detail.
+//
+//	gwmux := runtime.NewServeMux(runtime.WithErrorHandler(problem.GatewayErrorHandler(middlewares.Problems)))
+func GatewayErrorHandler(registry *Registry) runtime.ErrorHandlerFunc {
+	return func(_ context.Context, _ *runtime.ServeMux, _ runtime.Marshaler, w http.ResponseWriter, r *http.Request, err error) {
+		if _, ok := registry.Lookup(err); ok {
+			registry.Error(w, r, err)
+			return
+		}
+
+		// routing errors of the mux carry their HTTP status
+		code := 0
+		var statusErr *runtime.HTTPStatusError
+		if errors.As(err, &statusErr) {
+			code, err = statusErr.HTTPStatus, statusErr.Err
+		}
+
+		s := status.Convert(err)
+		if code == 0 {
+			code = runtime.HTTPStatusFromCode(s.Code())
+		}
+		detail := ""
+		if code < http.StatusInternalServerError {
+			detail = s.Message()
+		}
+		Write(w, r, New(code, detail))
+	}
+}
@@ -0,0 +1,124 @@
+// Package problem renders errors as RFC 7807 problem details (application/problem+json):
+//
+//	{"type":"urn:d4l:problem:invalid-query","title":"Invalid Query","status":400,"detail":"...","trace-id":"..."}
+//
+// A Registry maps sentinel errors to problem types, so handlers, middlewares and the gRPC gateway
+// answer the same error with the same shape.
+package problem
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync"
+
+	"github.com/d4l-data4life/go-svc/pkg/log"
+)
+
+// ContentType is the media type of problem details
+const ContentType = "application/problem+json"
+
+// BlankType is the type of problems without further semantics than their HTTP status
+const BlankType = "about:blank"
+
+// Details is the problem details document. Detail is only set for client errors,
+// so internal error messages are not exposed to callers.
+type Details struct {
+	Type     string `json:"type"`
+	Title    string `json:"title"`
+	Status   int    `json:"status"`
+	Detail   string `json:"detail,omitempty"`
+	Instance string `json:"instance,omitempty"`
+	TraceID  string `json:"trace-id,omitempty"`
+}
+
+// Type describes a class of problems
+type Type struct {
+	URI    string
+	Title  string
+	Status int
+}
+
+type entry struct {
+	err error
+	typ Type
+}
+
+// Registry maps sentinel errors to problem types, it is safe for concurrent use
+type Registry struct {
+	mu      sync.RWMutex
+	entries []entry
+}
+
+// NewRegistry creates an empty registry
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+// Register maps all errors matching err (errors.Is) to the problem type.
+// Errors matching several sentinels get the type registered first.
+func (r *Registry) Register(err error, t Type) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.entries = append(r.entries, entry{err: err, typ: t})
+}
+
+// Lookup returns the problem type of the first registered sentinel matching the error
+func (r *Registry) Lookup(err error) (Type, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, e := range r.entries {
+		if errors.Is(err, e.err) {
+			return e.typ, true
+		}
+	}
+	return Type{}, false
+}
+
+// Resolve returns the problem details of the error. Unregistered errors are internal server errors.
+func (r *Registry) Resolve(err error) Details {
+	t, ok := r.Lookup(err)
+	if !ok {
+		return New(http.StatusInternalServerError, "")
+	}
+	d := Details{Type: t.URI, Title: t.Title, Status: t.Status}
+	if d.Status < http.StatusInternalServerError {
+		d.Detail = err.Error()
+	}
+	return d
+}
+
+// Error writes the problem details of the error to the response
+func (r *Registry) Error(w http.ResponseWriter, req *http.Request, err error) {
+	Write(w, req, r.Resolve(err))
+}
+
+// New returns problem details of the blank type with the status text as title
+func New(status int, detail string) Details {
+	return Details{Type: BlankType, Title: http.StatusText(status), Status: status, Detail: detail}
+}
+
+// Write writes the problem details to the response, adding the trace ID of the request context or header
+func Write(w http.ResponseWriter, req *http.Request, d Details) {
+	if d.TraceID == "" && req != nil {
+		d.TraceID, _ = req.Context().Value(log.TraceIDContextKey).(string)
+		if d.TraceID == "" {
+			d.TraceID = req.Header.Get(log.TraceIDHeaderKey)
+		}
+	}
+
+	body, err := json.Marshal(d)
+	if err != nil {
+		http.Error(w, http.StatusText(d.Status), d.Status)
+		return
+	}
+
+	header := w.Header()
+	header.Del("Content-Length")
+	header.Set("Content-Type", ContentType)
+	header.Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(d.Status)
+	_, _ = w.Write(body)
+}
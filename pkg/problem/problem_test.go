@@ -0,0 +1,133 @@
+package problem_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/d4l-data4life/go-svc/pkg/log"
+	"github.com/d4l-data4life/go-svc/pkg/problem"
+)
+
+var (
+	errLocked = errors.New("record locked")
+	errBroken = errors.New("storage broken")
+)
+
+func newRegistry() *problem.Registry {
+	registry := problem.NewRegistry()
+	registry.Register(errLocked, problem.Type{URI: "urn:test:problem:locked", Title: "Record Locked", Status: http.StatusConflict})
+	registry.Register(errBroken, problem.Type{URI: "urn:test:problem:broken", Title: "Storage Broken", Status: http.StatusBadGateway})
+	return registry
+}
+
+func decode(t *testing.T, res *httptest.ResponseRecorder) problem.Details {
+	t.Helper()
+	assert.Equal(t, problem.ContentType, res.Header().Get("Content-Type"))
+	var d problem.Details
+	require.NoError(t, json.Unmarshal(res.Body.Bytes(), &d))
+	return d
+}
+
+func TestRegistryError(t *testing.T) {
+	registry := newRegistry()
+
+	tests := []struct {
+		name string
+		err  error
+		want problem.Details
+	}{
+		{
+			name: "registered client error",
+			err:  fmt.Errorf("updating record 1: %w", errLocked),
+			want: problem.Details{Type: "urn:test:problem:locked", Title: "Record Locked", Status: http.StatusConflict,
+				Detail: "updating record 1: record locked", TraceID: "trace-1"},
+		},
+		{
+			name: "registered server error hides the detail",
+			err:  fmt.Errorf("writing record 1: %w", errBroken),
+			want: problem.Details{Type: "urn:test:problem:broken", Title: "Storage Broken", Status: http.StatusBadGateway, TraceID: "trace-1"},
+		},
+		{
+			name: "unregistered error",
+			err:  errors.New("connection to 10.0.0.1 refused"),
+			want: problem.Details{Type: problem.BlankType, Title: "Internal Server Error", Status: http.StatusInternalServerError, TraceID: "trace-1"},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/records/1", nil)
+			req = req.WithContext(context.WithValue(req.Context(), log.TraceIDContextKey, "trace-1"))
+			res := httptest.NewRecorder()
+
+			registry.Error(res, req, tc.err)
+
+			assert.Equal(t, tc.want.Status, res.Code)
+			assert.Equal(t, tc.want, decode(t, res))
+		})
+	}
+}
+
+func TestWriteTraceIDFromHeader(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/records/1", nil)
+	req.Header.Set(log.TraceIDHeaderKey, "trace-2")
+	res := httptest.NewRecorder()
+
+	problem.Write(res, req, problem.New(http.StatusNotFound, "record 1 not found"))
+
+	assert.Equal(t, http.StatusNotFound, res.Code)
+	assert.Equal(t, problem.Details{Type: problem.BlankType, Title: "Not Found", Status: http.StatusNotFound,
+		Detail: "record 1 not found", TraceID: "trace-2"}, decode(t, res))
+}
+
+func TestGatewayErrorHandler(t *testing.T) {
+	handler := problem.GatewayErrorHandler(newRegistry())
+
+	tests := []struct {
+		name string
+		err  error
+		want problem.Details
+	}{
+		{
+			name: "status error",
+			err:  status.Error(codes.NotFound, "record 1 not found"),
+			want: problem.Details{Type: problem.BlankType, Title: "Not Found", Status: http.StatusNotFound, Detail: "record 1 not found"},
+		},
+		{
+			name: "internal status error hides the message",
+			err:  status.Error(codes.Internal, "pq: relation records does not exist"),
+			want: problem.Details{Type: problem.BlankType, Title: "Internal Server Error", Status: http.StatusInternalServerError},
+		},
+		{
+			name: "routing error",
+			err:  &runtime.HTTPStatusError{HTTPStatus: http.StatusMethodNotAllowed, Err: status.Error(codes.Unimplemented, "Method Not Allowed")},
+			want: problem.Details{Type: problem.BlankType, Title: "Method Not Allowed", Status: http.StatusMethodNotAllowed, Detail: "Method Not Allowed"},
+		},
+		{
+			name: "registered error",
+			err:  errLocked,
+			want: problem.Details{Type: "urn:test:problem:locked", Title: "Record Locked", Status: http.StatusConflict, Detail: "record locked"},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			res := httptest.NewRecorder()
+			handler(context.Background(), nil, nil, res, httptest.NewRequest(http.MethodGet, "/v1/records/1", nil), tc.err)
+
+			assert.Equal(t, tc.want.Status, res.Code)
+			assert.Equal(t, tc.want, decode(t, res))
+		})
+	}
+}
@@ -0,0 +1,44 @@
+package prom
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Results of cache lookups
+const (
+	CacheHit         = "hit"
+	CacheMiss        = "miss"
+	CacheRevalidated = "revalidated"
+	CacheStale       = "stale"
+)
+
+func registerHTTPCacheRequestsMetric(subsystem string) *prometheus.CounterVec {
+	return registerCounterVec(subsystem, "http_out_cache_requests_total",
+		"The amount of outgoing HTTP requests looked up in a response cache, partitioned by cache name and result "+
+			"(hit, miss, revalidated, stale)",
+		[]string{"name", "result"})
+}
+
+// CacheInstrumenter keeps pointers to the before registered metrics of response caches
+type CacheInstrumenter struct {
+	requests *prometheus.CounterVec
+}
+
+// NewCacheInstrumenter returns a new Instrumenter with the default metrics for response caches
+func NewCacheInstrumenter(options ...InitOption) *CacheInstrumenter {
+	o := &InitOptions{
+		subsystem: defaultSubsystem,
+	}
+	for _, option := range options {
+		option(o)
+	}
+
+	return &CacheInstrumenter{
+		requests: registerHTTPCacheRequestsMetric(o.subsystem),
+	}
+}
+
+// Lookup records the result of a cache lookup of the named cache
+func (i *CacheInstrumenter) Lookup(name string, result string) {
+	i.requests.WithLabelValues(name, result).Inc()
+}
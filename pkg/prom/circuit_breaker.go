@@ -0,0 +1,65 @@
+package prom
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func registerCircuitBreakerStateMetric(subsystem string) *prometheus.GaugeVec {
+	return registerGaugeVec(subsystem, "circuit_breaker_state",
+		"Current state of a circuit breaker, 1 for the active state and 0 otherwise, partitioned by breaker name and state",
+		[]string{"name", "state"})
+}
+
+func registerCircuitBreakerTransitionsMetric(subsystem string) *prometheus.CounterVec {
+	return registerCounterVec(subsystem, "circuit_breaker_transitions_total",
+		"The amount of circuit breaker state changes, partitioned by breaker name and target state",
+		[]string{"name", "state"})
+}
+
+func registerCircuitBreakerRejectedMetric(subsystem string) *prometheus.CounterVec {
+	return registerCounterVec(subsystem, "circuit_breaker_rejected_requests_total",
+		"The amount of outgoing HTTP requests rejected by an open circuit breaker, partitioned by breaker name",
+		[]string{"name"})
+}
+
+// CircuitBreakerInstrumenter keeps pointers to the before registered circuit breaker metrics
+type CircuitBreakerInstrumenter struct {
+	state       *prometheus.GaugeVec
+	transitions *prometheus.CounterVec
+	rejected    *prometheus.CounterVec
+}
+
+// NewCircuitBreakerInstrumenter returns a new Instrumenter with the default metrics for circuit breakers
+func NewCircuitBreakerInstrumenter(options ...InitOption) *CircuitBreakerInstrumenter {
+	o := &InitOptions{
+		subsystem: defaultSubsystem,
+	}
+	for _, option := range options {
+		option(o)
+	}
+
+	return &CircuitBreakerInstrumenter{
+		state:       registerCircuitBreakerStateMetric(o.subsystem),
+		transitions: registerCircuitBreakerTransitionsMetric(o.subsystem),
+		rejected:    registerCircuitBreakerRejectedMetric(o.subsystem),
+	}
+}
+
+// SetState marks current as the active state of the named breaker.
+// All other given states are reset to 0, so that exactly one state per breaker is active.
+func (i *CircuitBreakerInstrumenter) SetState(name string, current string, states ...string) {
+	for _, s := range states {
+		i.state.WithLabelValues(name, s).Set(0)
+	}
+	i.state.WithLabelValues(name, current).Set(1)
+}
+
+// Transition records a state change of the named breaker to the given state
+func (i *CircuitBreakerInstrumenter) Transition(name string, to string) {
+	i.transitions.WithLabelValues(name, to).Inc()
+}
+
+// Reject records a request that was rejected by the named breaker
+func (i *CircuitBreakerInstrumenter) Reject(name string) {
+	i.rejected.WithLabelValues(name).Inc()
+}
@@ -78,6 +78,18 @@ func defaultLatencyBuckets() []float64 {
 }
 
 func registerHistogramMetric(subsystem string, name string, help string, buckets []float64) *prometheus.HistogramVec {
+	return registerHistogramVec(subsystem, name, help, buckets, []string{"code", "method", "handler"})
+}
+
+func registerCountMetric(subsystem string, name string, help string) *prometheus.CounterVec {
+	return registerCounterVec(subsystem, name, help, []string{"code", "method", "handler"})
+}
+
+func registerGaugeMetric(subsystem string, name string, help string) *prometheus.GaugeVec {
+	return registerGaugeVec(subsystem, name, help, []string{"method", "handler"})
+}
+
+func registerHistogramVec(subsystem string, name string, help string, buckets []float64, labels []string) *prometheus.HistogramVec {
 	histogram := prometheus.NewHistogramVec(
 		prometheus.HistogramOpts{
 			Namespace: namespace,
@@ -86,7 +98,7 @@ func registerHistogramMetric(subsystem string, name string, help string, buckets
 			Help:      help,
 			Buckets:   buckets,
 		},
-		[]string{"code", "method", "handler"},
+		labels,
 	)
 	if err := prometheus.Register(histogram); err != nil {
 		if are, ok := err.(prometheus.AlreadyRegisteredError); ok {
@@ -98,7 +110,7 @@ func registerHistogramMetric(subsystem string, name string, help string, buckets
 	return histogram
 }
 
-func registerCountMetric(subsystem string, name string, help string) *prometheus.CounterVec {
+func registerCounterVec(subsystem string, name string, help string, labels []string) *prometheus.CounterVec {
 	count := prometheus.NewCounterVec(
 		prometheus.CounterOpts{
 			Namespace: namespace,
@@ -106,7 +118,7 @@ func registerCountMetric(subsystem string, name string, help string) *prometheus
 			Name:      name,
 			Help:      help,
 		},
-		[]string{"code", "method", "handler"},
+		labels,
 	)
 	if err := prometheus.Register(count); err != nil {
 		if are, ok := err.(prometheus.AlreadyRegisteredError); ok {
@@ -118,7 +130,7 @@ func registerCountMetric(subsystem string, name string, help string) *prometheus
 	return count
 }
 
-func registerGaugeMetric(subsystem string, name string, help string) *prometheus.GaugeVec {
+func registerGaugeVec(subsystem string, name string, help string, labels []string) *prometheus.GaugeVec {
 	gauge := prometheus.NewGaugeVec(
 		prometheus.GaugeOpts{
 			Namespace: namespace,
@@ -126,7 +138,7 @@ func registerGaugeMetric(subsystem string, name string, help string) *prometheus
 			Name:      name,
 			Help:      help,
 		},
-		[]string{"method", "handler"},
+		labels,
 	)
 	if err := prometheus.Register(gauge); err != nil {
 		if are, ok := err.(prometheus.AlreadyRegisteredError); ok {
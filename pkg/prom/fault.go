@@ -0,0 +1,35 @@
+package prom
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func registerFaultInjectionsMetric(subsystem string) *prometheus.CounterVec {
+	return registerCounterVec(subsystem, "fault_injections_total",
+		"The amount of injected faults, partitioned by side (client or server), rule name and fault type",
+		[]string{"side", "rule", "fault"})
+}
+
+// FaultInstrumenter keeps pointers to the before registered fault injection metrics
+type FaultInstrumenter struct {
+	injections *prometheus.CounterVec
+}
+
+// NewFaultInstrumenter returns a new Instrumenter with the default metrics for fault injection
+func NewFaultInstrumenter(options ...InitOption) *FaultInstrumenter {
+	o := &InitOptions{
+		subsystem: defaultSubsystem,
+	}
+	for _, option := range options {
+		option(o)
+	}
+
+	return &FaultInstrumenter{
+		injections: registerFaultInjectionsMetric(o.subsystem),
+	}
+}
+
+// Inject records a fault injected by the named rule
+func (i *FaultInstrumenter) Inject(side string, rule string, fault string) {
+	i.injections.WithLabelValues(side, rule, fault).Inc()
+}
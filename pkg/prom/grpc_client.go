@@ -0,0 +1,63 @@
+package prom
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func registerGRPCOutCountMetric(subsystem string) *prometheus.CounterVec {
+	return registerCounterVec(subsystem, "grpc_out_requests_total",
+		"How many outgoing gRPC calls made, partitioned by full method and status code.",
+		[]string{"code", "handler"})
+}
+
+func registerGRPCOutDurationMetric(subsystem string, latencyBuckets []float64) *prometheus.HistogramVec {
+	return registerHistogramVec(subsystem, "grpc_out_request_duration_seconds",
+		"A histogram of latencies for outgoing gRPC calls, partitioned by full method and status code.",
+		latencyBuckets,
+		[]string{"code", "handler"})
+}
+
+func registerGRPCOutGaugeMetric(subsystem string) *prometheus.GaugeVec {
+	return registerGaugeVec(subsystem, "grpc_out_requests",
+		"Amount of concurrent outgoing gRPC calls, partitioned by full method",
+		[]string{"handler"})
+}
+
+// GRPCClientInstrumenter keeps pointers to the before registered metrics of outgoing gRPC calls
+type GRPCClientInstrumenter struct {
+	gauge    *prometheus.GaugeVec
+	count    *prometheus.CounterVec
+	duration *prometheus.HistogramVec
+}
+
+// NewGRPCClientInstrumenter returns a new Instrumenter with the default metrics for outgoing gRPC calls
+func NewGRPCClientInstrumenter(options ...InitOption) *GRPCClientInstrumenter {
+	o := &InitOptions{
+		subsystem:      defaultSubsystem,
+		latencyBuckets: defaultLatencyBuckets(),
+	}
+	for _, option := range options {
+		option(o)
+	}
+
+	return &GRPCClientInstrumenter{
+		gauge:    registerGRPCOutGaugeMetric(o.subsystem),
+		count:    registerGRPCOutCountMetric(o.subsystem),
+		duration: registerGRPCOutDurationMetric(o.subsystem, o.latencyBuckets),
+	}
+}
+
+// Start records the begin of a call of the full gRPC method.
+// The returned function has to be called with the name of the resulting status code (e.g. OK) when the call is done.
+func (i *GRPCClientInstrumenter) Start(fullMethod string) func(code string) {
+	start := time.Now()
+	i.gauge.WithLabelValues(fullMethod).Inc()
+
+	return func(code string) {
+		i.gauge.WithLabelValues(fullMethod).Dec()
+		i.count.WithLabelValues(code, fullMethod).Inc()
+		i.duration.WithLabelValues(code, fullMethod).Observe(time.Since(start).Seconds())
+	}
+}
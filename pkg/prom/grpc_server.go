@@ -0,0 +1,63 @@
+package prom
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func registerGRPCCountMetric(subsystem string) *prometheus.CounterVec {
+	return registerCounterVec(subsystem, "grpc_requests_total",
+		"How many gRPC calls processed, partitioned by full method and status code.",
+		[]string{"code", "handler"})
+}
+
+func registerGRPCDurationMetric(subsystem string, latencyBuckets []float64) *prometheus.HistogramVec {
+	return registerHistogramVec(subsystem, "grpc_request_duration_seconds",
+		"A histogram of latencies for gRPC calls, partitioned by full method and status code.",
+		latencyBuckets,
+		[]string{"code", "handler"})
+}
+
+func registerGRPCGaugeMetric(subsystem string) *prometheus.GaugeVec {
+	return registerGaugeVec(subsystem, "grpc_requests",
+		"Amount of concurrently processed gRPC calls, partitioned by full method",
+		[]string{"handler"})
+}
+
+// GRPCServerInstrumenter keeps pointers to the before registered metrics of incoming gRPC calls
+type GRPCServerInstrumenter struct {
+	gauge    *prometheus.GaugeVec
+	count    *prometheus.CounterVec
+	duration *prometheus.HistogramVec
+}
+
+// NewGRPCServerInstrumenter returns a new Instrumenter with the default metrics for incoming gRPC calls
+func NewGRPCServerInstrumenter(options ...InitOption) *GRPCServerInstrumenter {
+	o := &InitOptions{
+		subsystem:      defaultSubsystem,
+		latencyBuckets: defaultLatencyBuckets(),
+	}
+	for _, option := range options {
+		option(o)
+	}
+
+	return &GRPCServerInstrumenter{
+		gauge:    registerGRPCGaugeMetric(o.subsystem),
+		count:    registerGRPCCountMetric(o.subsystem),
+		duration: registerGRPCDurationMetric(o.subsystem, o.latencyBuckets),
+	}
+}
+
+// Start records the begin of a call of the full gRPC method.
+// The returned function has to be called with the name of the resulting status code (e.g. OK) when the call is done.
+func (i *GRPCServerInstrumenter) Start(fullMethod string) func(code string) {
+	start := time.Now()
+	i.gauge.WithLabelValues(fullMethod).Inc()
+
+	return func(code string) {
+		i.gauge.WithLabelValues(fullMethod).Dec()
+		i.count.WithLabelValues(code, fullMethod).Inc()
+		i.duration.WithLabelValues(code, fullMethod).Observe(time.Since(start).Seconds())
+	}
+}
@@ -0,0 +1,48 @@
+package prom
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func registerHTTPOutHedgesMetric(subsystem string) *prometheus.CounterVec {
+	return registerCounterVec(subsystem, "http_out_hedged_requests_total",
+		"The amount of hedged duplicates of outgoing HTTP requests, partitioned by target",
+		[]string{"handler"})
+}
+
+func registerHTTPOutHedgeWinsMetric(subsystem string) *prometheus.CounterVec {
+	return registerCounterVec(subsystem, "http_out_hedge_wins_total",
+		"The amount of outgoing HTTP requests answered by a hedged duplicate instead of the original request, partitioned by target",
+		[]string{"handler"})
+}
+
+// HedgeInstrumenter keeps pointers to the before registered metrics of hedged requests
+type HedgeInstrumenter struct {
+	hedges *prometheus.CounterVec
+	wins   *prometheus.CounterVec
+}
+
+// NewHedgeInstrumenter returns a new Instrumenter with the default metrics for hedged requests
+func NewHedgeInstrumenter(options ...InitOption) *HedgeInstrumenter {
+	o := &InitOptions{
+		subsystem: defaultSubsystem,
+	}
+	for _, option := range options {
+		option(o)
+	}
+
+	return &HedgeInstrumenter{
+		hedges: registerHTTPOutHedgesMetric(o.subsystem),
+		wins:   registerHTTPOutHedgeWinsMetric(o.subsystem),
+	}
+}
+
+// Hedge records a hedged duplicate sent for the given target
+func (i *HedgeInstrumenter) Hedge(handlerName string) {
+	i.hedges.WithLabelValues(handlerName).Inc()
+}
+
+// Win records a request answered by a hedged duplicate
+func (i *HedgeInstrumenter) Win(handlerName string) {
+	i.wins.WithLabelValues(handlerName).Inc()
+}
@@ -2,10 +2,13 @@ package prom
 
 import (
 	"net/http"
+	"sort"
 	"strings"
+	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+	dto "github.com/prometheus/client_model/go"
 )
 
 func registerHTTPOutCountMetric(subsystem string) *prometheus.CounterVec {
@@ -65,3 +68,64 @@ func instrumentRoundTripperInFlight(g *prometheus.GaugeVec, next http.RoundTripp
 		return next.RoundTrip(r)
 	})
 }
+
+// DurationQuantile estimates the q-quantile (0 < q < 1) of the request durations recorded for handlerName
+// across all status codes and methods, interpolating linearly within histogram buckets.
+// It returns false if no request has been recorded yet.
+func (t *RoundTripperInstrumenter) DurationQuantile(handlerName string, q float64) (time.Duration, bool) {
+	ch := make(chan prometheus.Metric)
+	go func() {
+		t.duration.Collect(ch)
+		close(ch)
+	}()
+
+	var count uint64
+	cumulative := make(map[float64]uint64)
+	for m := range ch {
+		pb := &dto.Metric{}
+		if err := m.Write(pb); err != nil || !hasLabel(pb, "handler", handlerName) {
+			continue
+		}
+		h := pb.GetHistogram()
+		count += h.GetSampleCount()
+		for _, b := range h.GetBucket() {
+			cumulative[b.GetUpperBound()] += b.GetCumulativeCount()
+		}
+	}
+	if count == 0 {
+		return 0, false
+	}
+
+	bounds := make([]float64, 0, len(cumulative))
+	for bound := range cumulative {
+		bounds = append(bounds, bound)
+	}
+	sort.Float64s(bounds)
+
+	rank := q * float64(count)
+	var lowerBound float64
+	var lowerCount uint64
+	for _, bound := range bounds {
+		c := cumulative[bound]
+		if float64(c) >= rank {
+			fraction := 1.0
+			if c > lowerCount {
+				fraction = (rank - float64(lowerCount)) / float64(c-lowerCount)
+			}
+			return time.Duration((lowerBound + (bound-lowerBound)*fraction) * float64(time.Second)), true
+		}
+		lowerBound, lowerCount = bound, c
+	}
+
+	// the quantile lies in the +Inf bucket, the highest bound is the best estimate
+	return time.Duration(lowerBound * float64(time.Second)), true
+}
+
+func hasLabel(m *dto.Metric, name string, value string) bool {
+	for _, l := range m.GetLabel() {
+		if l.GetName() == name {
+			return l.GetValue() == value
+		}
+	}
+	return false
+}
@@ -4,6 +4,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
@@ -64,3 +65,33 @@ func TestClientInstrumentation(t *testing.T) {
 		}, t)
 	})
 }
+
+func TestDurationQuantile(t *testing.T) {
+	instrumenter := NewRoundTripperInstrumenter(WithSubsystem("quantile"), WithLatencyBuckets([]float64{0.1, 0.2, 0.4}))
+
+	if _, ok := instrumenter.DurationQuantile("quantile-1", 0.5); ok {
+		t.Fatalf("expected no quantile without observations")
+	}
+
+	observer := instrumenter.duration.WithLabelValues("200", "get", "quantile-1")
+	for _, d := range []float64{0.05, 0.05, 0.15, 0.3} {
+		observer.Observe(d)
+	}
+	instrumenter.duration.WithLabelValues("200", "get", "quantile-2").Observe(5)
+
+	tests := []struct {
+		q    float64
+		want time.Duration
+	}{
+		{0.5, 100 * time.Millisecond},
+		{0.75, 200 * time.Millisecond},
+		{0.875, 300 * time.Millisecond},
+		{1, 400 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		got, ok := instrumenter.DurationQuantile("quantile-1", tt.q)
+		if !ok || got != tt.want {
+			t.Fatalf("DurationQuantile(%v) = %v, want %v", tt.q, got, tt.want)
+		}
+	}
+}
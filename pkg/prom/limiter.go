@@ -0,0 +1,56 @@
+package prom
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func defaultWaitBuckets() []float64 {
+	return []float64{.001, .005, .01, .05, .1, .25, .5, 1, 2.5, 5} // seconds
+}
+
+func registerHTTPOutLimiterWaitMetric(subsystem string, latencyBuckets []float64) *prometheus.HistogramVec {
+	return registerHistogramVec(subsystem, "http_out_limiter_wait_seconds",
+		"A histogram of the time outgoing requests waited for a rate limiter or bulkhead, partitioned by limiter and target",
+		latencyBuckets,
+		[]string{"limiter", "handler"})
+}
+
+func registerHTTPOutLimiterRejectedMetric(subsystem string) *prometheus.CounterVec {
+	return registerCounterVec(subsystem, "http_out_limiter_rejected_total",
+		"The amount of outgoing HTTP requests rejected by a rate limiter or bulkhead, partitioned by limiter and target",
+		[]string{"limiter", "handler"})
+}
+
+// LimiterInstrumenter keeps pointers to the before registered metrics of client-side limiters
+type LimiterInstrumenter struct {
+	wait     *prometheus.HistogramVec
+	rejected *prometheus.CounterVec
+}
+
+// NewLimiterInstrumenter returns a new Instrumenter with the default metrics for client-side limiters
+func NewLimiterInstrumenter(options ...InitOption) *LimiterInstrumenter {
+	o := &InitOptions{
+		subsystem:      defaultSubsystem,
+		latencyBuckets: defaultWaitBuckets(),
+	}
+	for _, option := range options {
+		option(o)
+	}
+
+	return &LimiterInstrumenter{
+		wait:     registerHTTPOutLimiterWaitMetric(o.subsystem, o.latencyBuckets),
+		rejected: registerHTTPOutLimiterRejectedMetric(o.subsystem),
+	}
+}
+
+// ObserveWait records the time a request waited for the given limiter
+func (i *LimiterInstrumenter) ObserveWait(limiter string, handlerName string, d time.Duration) {
+	i.wait.WithLabelValues(limiter, handlerName).Observe(d.Seconds())
+}
+
+// Reject records a request rejected by the given limiter
+func (i *LimiterInstrumenter) Reject(limiter string, handlerName string) {
+	i.rejected.WithLabelValues(limiter, handlerName).Inc()
+}
@@ -0,0 +1,61 @@
+package prom
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func registerLoadShedLimitMetric(subsystem string) *prometheus.GaugeVec {
+	return registerGaugeVec(subsystem, "load_shedder_limit",
+		"The current adaptive concurrency limit of a load shedder",
+		[]string{"shedder"})
+}
+
+func registerLoadShedInFlightMetric(subsystem string) *prometheus.GaugeVec {
+	return registerGaugeVec(subsystem, "load_shedder_in_flight",
+		"The amount of requests currently admitted by a load shedder",
+		[]string{"shedder"})
+}
+
+func registerLoadShedShedMetric(subsystem string) *prometheus.CounterVec {
+	return registerCounterVec(subsystem, "load_shedder_shed_total",
+		"The amount of requests rejected by a load shedder, partitioned by priority",
+		[]string{"shedder", "priority"})
+}
+
+// LoadShedInstrumenter keeps pointers to the before registered metrics of load shedders
+type LoadShedInstrumenter struct {
+	limit    *prometheus.GaugeVec
+	inFlight *prometheus.GaugeVec
+	shed     *prometheus.CounterVec
+}
+
+// NewLoadShedInstrumenter returns a new Instrumenter with the default metrics for load shedders
+func NewLoadShedInstrumenter(options ...InitOption) *LoadShedInstrumenter {
+	o := &InitOptions{
+		subsystem: defaultSubsystem,
+	}
+	for _, option := range options {
+		option(o)
+	}
+
+	return &LoadShedInstrumenter{
+		limit:    registerLoadShedLimitMetric(o.subsystem),
+		inFlight: registerLoadShedInFlightMetric(o.subsystem),
+		shed:     registerLoadShedShedMetric(o.subsystem),
+	}
+}
+
+// Limit records the current concurrency limit
+func (i *LoadShedInstrumenter) Limit(shedder string, limit float64) {
+	i.limit.WithLabelValues(shedder).Set(limit)
+}
+
+// InFlight records the amount of admitted requests
+func (i *LoadShedInstrumenter) InFlight(shedder string, inFlight int) {
+	i.inFlight.WithLabelValues(shedder).Set(float64(inFlight))
+}
+
+// Shed records a rejected request of the priority
+func (i *LoadShedInstrumenter) Shed(shedder, priority string) {
+	i.shed.WithLabelValues(shedder, priority).Inc()
+}
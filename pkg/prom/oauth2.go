@@ -0,0 +1,46 @@
+package prom
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func registerOAuth2TokenFetchesMetric(subsystem string) *prometheus.CounterVec {
+	return registerCounterVec(subsystem, "oauth2_token_fetches_total",
+		"The amount of OAuth2 tokens fetched from a token endpoint, partitioned by client name",
+		[]string{"name"})
+}
+
+func registerOAuth2TokenFailuresMetric(subsystem string) *prometheus.CounterVec {
+	return registerCounterVec(subsystem, "oauth2_token_fetch_failures_total",
+		"The amount of failed OAuth2 token fetches, partitioned by client name",
+		[]string{"name"})
+}
+
+// OAuth2Instrumenter keeps pointers to the before registered OAuth2 token metrics
+type OAuth2Instrumenter struct {
+	fetches  *prometheus.CounterVec
+	failures *prometheus.CounterVec
+}
+
+// NewOAuth2Instrumenter returns a new Instrumenter with the default metrics for OAuth2 token fetches
+func NewOAuth2Instrumenter(options ...InitOption) *OAuth2Instrumenter {
+	o := &InitOptions{
+		subsystem: defaultSubsystem,
+	}
+	for _, option := range options {
+		option(o)
+	}
+
+	return &OAuth2Instrumenter{
+		fetches:  registerOAuth2TokenFetchesMetric(o.subsystem),
+		failures: registerOAuth2TokenFailuresMetric(o.subsystem),
+	}
+}
+
+// Fetch records a token fetch of the named client and whether it failed
+func (i *OAuth2Instrumenter) Fetch(name string, err error) {
+	i.fetches.WithLabelValues(name).Inc()
+	if err != nil {
+		i.failures.WithLabelValues(name).Inc()
+	}
+}
@@ -0,0 +1,35 @@
+package prom
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func registerPanicsMetric(subsystem string) *prometheus.CounterVec {
+	return registerCounterVec(subsystem, "panics_total",
+		"The amount of recovered panics of request handlers, partitioned by protocol (http or grpc)",
+		[]string{"protocol"})
+}
+
+// PanicInstrumenter keeps pointers to the before registered panic metrics
+type PanicInstrumenter struct {
+	panics *prometheus.CounterVec
+}
+
+// NewPanicInstrumenter returns a new Instrumenter with the default metrics for recovered panics
+func NewPanicInstrumenter(options ...InitOption) *PanicInstrumenter {
+	o := &InitOptions{
+		subsystem: defaultSubsystem,
+	}
+	for _, option := range options {
+		option(o)
+	}
+
+	return &PanicInstrumenter{
+		panics: registerPanicsMetric(o.subsystem),
+	}
+}
+
+// Panic records a recovered panic of a handler of the protocol
+func (i *PanicInstrumenter) Panic(protocol string) {
+	i.panics.WithLabelValues(protocol).Inc()
+}
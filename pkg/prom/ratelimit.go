@@ -0,0 +1,53 @@
+package prom
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func registerRateLimitDecisionsMetric(subsystem string) *prometheus.CounterVec {
+	return registerCounterVec(subsystem, "http_rate_limit_decisions_total",
+		"The amount of incoming HTTP requests checked by a rate limiter, partitioned by limiter, key class and result",
+		[]string{"limiter", "class", "result"})
+}
+
+func registerRateLimitStoreErrorsMetric(subsystem string) *prometheus.CounterVec {
+	return registerCounterVec(subsystem, "http_rate_limit_store_errors_total",
+		"The amount of failed rate limit store operations, partitioned by limiter",
+		[]string{"limiter"})
+}
+
+// RateLimitInstrumenter keeps pointers to the before registered metrics of server-side rate limiters.
+// The limited keys (e.g. tenant IDs) are not used as labels, only their class (e.g. "tenant").
+type RateLimitInstrumenter struct {
+	decisions   *prometheus.CounterVec
+	storeErrors *prometheus.CounterVec
+}
+
+// NewRateLimitInstrumenter returns a new Instrumenter with the default metrics for server-side rate limiters
+func NewRateLimitInstrumenter(options ...InitOption) *RateLimitInstrumenter {
+	o := &InitOptions{
+		subsystem: defaultSubsystem,
+	}
+	for _, option := range options {
+		option(o)
+	}
+
+	return &RateLimitInstrumenter{
+		decisions:   registerRateLimitDecisionsMetric(o.subsystem),
+		storeErrors: registerRateLimitStoreErrorsMetric(o.subsystem),
+	}
+}
+
+// Decision records whether a request of the key class was allowed or throttled
+func (i *RateLimitInstrumenter) Decision(limiter, class string, allowed bool) {
+	result := "allowed"
+	if !allowed {
+		result = "throttled"
+	}
+	i.decisions.WithLabelValues(limiter, class, result).Inc()
+}
+
+// StoreError records a failed store operation, the request is allowed in that case
+func (i *RateLimitInstrumenter) StoreError(limiter string) {
+	i.storeErrors.WithLabelValues(limiter).Inc()
+}
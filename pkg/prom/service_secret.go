@@ -0,0 +1,48 @@
+package prom
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func registerServiceSecretAuthenticationsMetric(subsystem string) *prometheus.CounterVec {
+	return registerCounterVec(subsystem, "service_secret_authentications_total",
+		"The amount of successful service secret authentications, partitioned by the ID of the matched secret",
+		[]string{"key_id"})
+}
+
+func registerServiceSecretFailuresMetric(subsystem string) *prometheus.CounterVec {
+	return registerCounterVec(subsystem, "service_secret_failures_total",
+		"The amount of failed service secret authentications, partitioned by reason",
+		[]string{"reason"})
+}
+
+// ServiceSecretInstrumenter keeps pointers to the before registered service secret metrics
+type ServiceSecretInstrumenter struct {
+	authentications *prometheus.CounterVec
+	failures        *prometheus.CounterVec
+}
+
+// NewServiceSecretInstrumenter returns a new Instrumenter with the default metrics for service secret authentications
+func NewServiceSecretInstrumenter(options ...InitOption) *ServiceSecretInstrumenter {
+	o := &InitOptions{
+		subsystem: defaultSubsystem,
+	}
+	for _, option := range options {
+		option(o)
+	}
+
+	return &ServiceSecretInstrumenter{
+		authentications: registerServiceSecretAuthenticationsMetric(o.subsystem),
+		failures:        registerServiceSecretFailuresMetric(o.subsystem),
+	}
+}
+
+// Success records an authentication with the secret of the given key ID
+func (i *ServiceSecretInstrumenter) Success(keyID string) {
+	i.authentications.WithLabelValues(keyID).Inc()
+}
+
+// Failure records a rejected authentication, reason is one of "missing", "malformed" or "invalid"
+func (i *ServiceSecretInstrumenter) Failure(reason string) {
+	i.failures.WithLabelValues(reason).Inc()
+}
@@ -18,8 +18,34 @@ import (
 	"google.golang.org/grpc/grpclog"
 
 	"github.com/d4l-data4life/go-svc/pkg/logging"
+	"github.com/d4l-data4life/go-svc/pkg/middlewares"
+	"github.com/d4l-data4life/go-svc/pkg/problem"
 )
 
+type gatewayConfig struct {
+	dialOptions    []grpc.DialOption
+	problemDetails bool
+}
+
+// GatewayOption is to be implemented by functional options
+type GatewayOption func(*gatewayConfig)
+
+// GatewayWithDialOptions adds dial options to the connection from the gateway to the gRPC server,
+// e.g. grpcmw.ClientChain() to propagate trace and tenant and to authenticate the proxied calls
+func GatewayWithDialOptions(options ...grpc.DialOption) GatewayOption {
+	return func(c *gatewayConfig) {
+		c.dialOptions = append(c.dialOptions, options...)
+	}
+}
+
+// GatewayWithProblemDetails answers errors of the proxied calls with problem details like the errors of the middlewares
+// instead of the JSON status of the grpc-gateway, which changes the error body for existing clients
+func GatewayWithProblemDetails() GatewayOption {
+	return func(c *gatewayConfig) {
+		c.problemDetails = true
+	}
+}
+
 // NewGRPCGatewayServer creates a gRPC-Gateway server with given grpc handler registration functions and the given metrics handler.
 func NewGRPCGatewayServer(
 	server *grpc.Server,
@@ -27,7 +53,13 @@ func NewGRPCGatewayServer(
 	corsOptions cors.Options,
 	handlerRegisterFunctions []func(context.Context, *runtime.ServeMux, *grpc.ClientConn) error,
 	metricsHandler runtime.HandlerFunc,
+	options ...GatewayOption,
 ) (*http.Server, error) {
+	config := &gatewayConfig{}
+	for _, apply := range options {
+		apply(config)
+	}
+
 	// Adds gRPC internal logs. This is quite verbose, so adjust as desired!
 	log := grpclog.NewLoggerV2(io.Discard, io.Discard, os.Stderr)
 	grpclog.SetLoggerV2(log)
@@ -36,14 +68,20 @@ func NewGRPCGatewayServer(
 	// This is where the gRPC-Gateway proxies the requests.
 	conn, err := grpc.NewClient(
 		"dns:///"+grpcPort,
-		grpc.WithTransportCredentials(insecure.NewCredentials()),
-		grpc.WithDefaultCallOptions(grpc.MaxCallRecvMsgSize(math.MaxInt32)),
+		append([]grpc.DialOption{
+			grpc.WithTransportCredentials(insecure.NewCredentials()),
+			grpc.WithDefaultCallOptions(grpc.MaxCallRecvMsgSize(math.MaxInt32)),
+		}, config.dialOptions...)...,
 	)
 	if err != nil {
 		return nil, fmt.Errorf("failed to dial server: %w", err)
 	}
 
-	gwmux := runtime.NewServeMux()
+	var muxOptions []runtime.ServeMuxOption
+	if config.problemDetails {
+		muxOptions = append(muxOptions, runtime.WithErrorHandler(problem.GatewayErrorHandler(middlewares.Problems)))
+	}
+	gwmux := runtime.NewServeMux(muxOptions...)
 	// Register all handlers
 	for _, f := range handlerRegisterFunctions {
 		if err := f(context.Background(), gwmux, conn); err != nil {
@@ -0,0 +1,42 @@
+package standard
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/rs/cors"
+	"google.golang.org/grpc"
+
+	"github.com/d4l-data4life/go-svc/pkg/problem"
+)
+
+func TestGatewayErrors(t *testing.T) {
+	metrics := func(http.ResponseWriter, *http.Request, map[string]string) {}
+
+	for _, tc := range []struct {
+		name            string
+		options         []GatewayOption
+		wantContentType string
+	}{
+		{name: "gateway status by default", wantContentType: "application/json"},
+		{name: "opt-in problem details", options: []GatewayOption{GatewayWithProblemDetails()}, wantContentType: problem.ContentType},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			server, err := NewGRPCGatewayServer(grpc.NewServer(), "localhost:0", "0", cors.Options{}, nil, metrics, tc.options...)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			res := httptest.NewRecorder()
+			server.Handler.ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/unknown", nil))
+
+			if res.Code != http.StatusNotFound {
+				t.Fatalf("expected status %d, got %d", http.StatusNotFound, res.Code)
+			}
+			if got := res.Header().Get("Content-Type"); got != tc.wantContentType {
+				t.Fatalf("expected content type %q, got %q", tc.wantContentType, got)
+			}
+		})
+	}
+}
@@ -2,6 +2,7 @@ package standard
 
 import (
 	"context"
+	"fmt"
 	"net"
 	"net/http"
 	"time"
@@ -9,15 +10,46 @@ import (
 	"github.com/go-chi/chi"
 
 	"github.com/d4l-data4life/go-svc/pkg/logging"
+	"github.com/d4l-data4life/go-svc/pkg/middlewares"
 )
 
-// ListenAndServe starts the server
-func ListenAndServe(runCtx context.Context, mux *chi.Mux, port string) <-chan struct{} {
+// DefaultMiddlewares are the security headers and the CORS policy configured by the HTTP_SECURITY_* and HTTP_CORS_*
+// environment variables. Without HTTP_CORS_ALLOWED_ORIGINS no cross-origin requests are allowed.
+func DefaultMiddlewares() ([]func(http.Handler) http.Handler, error) {
+	security, err := middlewares.SecurityHeadersConfigFromEnv()
+	if err != nil {
+		return nil, fmt.Errorf("reading security headers config: %w", err)
+	}
+	policy, err := middlewares.CORSPolicyFromEnv()
+	if err != nil {
+		return nil, fmt.Errorf("reading CORS policy: %w", err)
+	}
+	return []func(http.Handler) http.Handler{middlewares.SecurityHeaders(security), middlewares.CORS(policy)}, nil
+}
+
+// ListenAndServeWithDefaults starts the server with the mux wrapped in the DefaultMiddlewares, they run before the
+// routing of the mux, so preflight requests are answered for all routes. The server is not started if the
+// environment variables of the DefaultMiddlewares are invalid.
+func ListenAndServeWithDefaults(runCtx context.Context, mux *chi.Mux, port string) (<-chan struct{}, error) {
+	defaults, err := DefaultMiddlewares()
+	if err != nil {
+		return nil, fmt.Errorf("resolving default middlewares: %w", err)
+	}
+	return ListenAndServe(runCtx, mux, port, defaults...), nil
+}
+
+// ListenAndServe starts the server with the mux wrapped in the middleware stack, the first middleware is the outermost
+func ListenAndServe(runCtx context.Context, mux *chi.Mux, port string, stack ...func(http.Handler) http.Handler) <-chan struct{} {
 	serverStopped := make(chan struct{})
 
+	var handler http.Handler = mux
+	for i := len(stack) - 1; i >= 0; i-- {
+		handler = stack[i](handler)
+	}
+
 	listenAddress := net.JoinHostPort("", port)
 	logging.LogInfof("listeninig on %s", listenAddress)
-	server := &http.Server{Addr: listenAddress, Handler: mux, ReadHeaderTimeout: 0}
+	server := &http.Server{Addr: listenAddress, Handler: handler, ReadHeaderTimeout: 0}
 
 	// goroutine that runs the server
 	go func() {
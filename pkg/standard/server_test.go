@@ -0,0 +1,67 @@
+package standard
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/d4l-data4life/go-svc/pkg/middlewares"
+)
+
+func TestDefaultMiddlewares(t *testing.T) {
+	t.Run("applies security headers and CORS from env", func(t *testing.T) {
+		t.Setenv("HTTP_CORS_ALLOWED_ORIGINS", "https://app.example.com")
+
+		stack, err := DefaultMiddlewares()
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		var h http.Handler = http.HandlerFunc(func(http.ResponseWriter, *http.Request) {})
+		for i := len(stack) - 1; i >= 0; i-- {
+			h = stack[i](h)
+		}
+
+		req := httptest.NewRequest(http.MethodGet, "http://example/records", nil)
+		req.Header.Set("Origin", "https://app.example.com")
+		res := httptest.NewRecorder()
+		h.ServeHTTP(res, req)
+
+		if got := res.Header().Get("X-Content-Type-Options"); got != "nosniff" {
+			t.Fatalf("expected nosniff, got %q", got)
+		}
+		if got := res.Header().Get("Access-Control-Allow-Origin"); got != "https://app.example.com" {
+			t.Fatalf("expected allowed origin, got %q", got)
+		}
+	})
+
+	t.Run("fails on invalid env", func(t *testing.T) {
+		t.Setenv("HTTP_CORS_MAX_AGE", "ten minutes")
+
+		if _, err := DefaultMiddlewares(); err == nil {
+			t.Fatal("expected error")
+		}
+	})
+
+	t.Run("fails on credentials for all origins", func(t *testing.T) {
+		t.Setenv("HTTP_CORS_ALLOWED_ORIGINS", "*")
+		t.Setenv("HTTP_CORS_ALLOW_CREDENTIALS", "true")
+
+		if _, err := DefaultMiddlewares(); !errors.Is(err, middlewares.ErrInvalidCORSPolicy) {
+			t.Fatalf("expected ErrInvalidCORSPolicy, got %v", err)
+		}
+	})
+}
+
+func TestListenAndServeWithDefaults(t *testing.T) {
+	t.Setenv("HTTP_SECURITY_HSTS_MAX_AGE", "one year")
+
+	serverStopped, err := ListenAndServeWithDefaults(context.Background(), nil, "0")
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	if serverStopped != nil {
+		t.Fatal("expected the server not to be started")
+	}
+}
@@ -0,0 +1,26 @@
+package tracing
+
+import (
+	"io"
+	"os"
+
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// InMemoryExporter keeps all exported spans in memory, see GetSpans and Reset
+type InMemoryExporter = tracetest.InMemoryExporter
+
+// NewInMemoryExporter returns an exporter that keeps the spans in memory, to be used with WithSyncExporter in tests
+func NewInMemoryExporter() *InMemoryExporter {
+	return tracetest.NewInMemoryExporter()
+}
+
+// NewStdoutExporter returns an exporter writing the spans as JSON lines to w (defaults to os.Stdout)
+func NewStdoutExporter(w io.Writer) (sdktrace.SpanExporter, error) {
+	if w == nil {
+		w = os.Stdout
+	}
+	return stdouttrace.New(stdouttrace.WithWriter(w))
+}
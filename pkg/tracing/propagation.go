@@ -0,0 +1,142 @@
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc/metadata"
+
+	"github.com/d4l-data4life/go-svc/pkg/log"
+)
+
+// Extract reads the W3C trace context and the legacy trace ID (Trace-Id) from the carrier
+func Extract(ctx context.Context, carrier propagation.TextMapCarrier) context.Context {
+	ctx = propagator.Extract(ctx, carrier)
+	if legacy := carrier.Get(log.TraceIDHeaderKey); legacy != "" {
+		ctx = context.WithValue(ctx, log.TraceIDContextKey, legacy)
+	}
+	return ctx
+}
+
+// Inject writes the W3C trace context and the legacy trace ID (Trace-Id) to the carrier
+func Inject(ctx context.Context, carrier propagation.TextMapCarrier) {
+	propagator.Inject(ctx, carrier)
+	if legacy := LegacyTraceID(ctx); legacy != "" {
+		carrier.Set(log.TraceIDHeaderKey, legacy)
+	}
+}
+
+// LegacyTraceID returns the trace ID used by the logger
+func LegacyTraceID(ctx context.Context) string {
+	legacy, _ := ctx.Value(log.TraceIDContextKey).(string)
+	return legacy
+}
+
+// SyncLegacyTraceID sets the legacy trace ID used by the logger to the trace ID of the current span.
+// A legacy trace ID that is no valid W3C trace ID is kept. Without a valid span a missing legacy trace ID is generated.
+func SyncLegacyTraceID(ctx context.Context) context.Context {
+	legacy := LegacyTraceID(ctx)
+
+	sc := trace.SpanContextFromContext(ctx)
+	if !sc.IsValid() {
+		if legacy == "" {
+			return context.WithValue(ctx, log.TraceIDContextKey, newTraceID().String())
+		}
+		return ctx
+	}
+
+	if legacy != "" {
+		if _, err := trace.TraceIDFromHex(legacy); err != nil {
+			return ctx
+		}
+	}
+	return context.WithValue(ctx, log.TraceIDContextKey, sc.TraceID().String())
+}
+
+// StartServerSpan continues the trace of an incoming request or starts a new one
+// and keeps the legacy trace ID in sync. The span must be ended by the caller.
+func StartServerSpan(
+	ctx context.Context, carrier propagation.TextMapCarrier, name string, attrs ...attribute.KeyValue,
+) (context.Context, trace.Span) {
+	ctx = Extract(ctx, carrier)
+	ctx, span := Tracer().Start(ctx, name, trace.WithSpanKind(trace.SpanKindServer), trace.WithAttributes(attrs...))
+	legacyAttribute(ctx, span)
+	return SyncLegacyTraceID(ctx), span
+}
+
+// StartClientSpan starts the span of an outgoing request, which has to be injected into the request with Inject.
+// The span must be ended by the caller.
+func StartClientSpan(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	ctx, span := Tracer().Start(ctx, name, trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(attrs...))
+	legacyAttribute(ctx, span)
+	return SyncLegacyTraceID(ctx), span
+}
+
+// legacyAttribute records a legacy trace ID that differs from the trace ID of the span
+func legacyAttribute(ctx context.Context, span trace.Span) {
+	legacy := LegacyTraceID(ctx)
+	if legacy != "" && legacy != span.SpanContext().TraceID().String() {
+		span.SetAttributes(attribute.String("legacy.trace_id", legacy))
+	}
+}
+
+// MetadataCarrier adapts gRPC metadata to propagation.TextMapCarrier
+type MetadataCarrier metadata.MD
+
+func (c MetadataCarrier) Get(key string) string {
+	values := metadata.MD(c).Get(key)
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
+
+func (c MetadataCarrier) Set(key string, value string) {
+	metadata.MD(c).Set(key, value)
+}
+
+func (c MetadataCarrier) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for key := range c {
+		keys = append(keys, strings.ToLower(key))
+	}
+	return keys
+}
+
+// legacyIDGenerator uses a legacy trace ID of the context as trace ID of new root spans,
+// so traces started by services that only know the Trace-Id header keep their ID
+type legacyIDGenerator struct{}
+
+var _ sdktrace.IDGenerator = legacyIDGenerator{}
+
+func (legacyIDGenerator) NewIDs(ctx context.Context) (trace.TraceID, trace.SpanID) {
+	if traceID, err := trace.TraceIDFromHex(LegacyTraceID(ctx)); err == nil {
+		return traceID, newSpanID()
+	}
+	return newTraceID(), newSpanID()
+}
+
+func (legacyIDGenerator) NewSpanID(_ context.Context, _ trace.TraceID) trace.SpanID {
+	return newSpanID()
+}
+
+func newTraceID() trace.TraceID {
+	var id trace.TraceID
+	for !id.IsValid() {
+		_, _ = rand.Read(id[:])
+	}
+	return id
+}
+
+func newSpanID() trace.SpanID {
+	var id trace.SpanID
+	for !id.IsValid() {
+		_, _ = rand.Read(id[:])
+	}
+	return id
+}
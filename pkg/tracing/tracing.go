@@ -0,0 +1,102 @@
+// Package tracing propagates W3C Trace Context (traceparent, tracestate) and creates OpenTelemetry spans.
+// The legacy Trace-Id header and log.TraceIDContextKey are kept in sync with the trace ID of the spans,
+// so log entries of services with and without tracing can still be correlated.
+package tracing
+
+import (
+	"context"
+	"fmt"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const instrumentationName = "github.com/d4l-data4life/go-svc"
+
+// propagator is used regardless of the global otel propagator, so the trace context is propagated even without Init
+var propagator = propagation.NewCompositeTextMapPropagator( // nolint: gochecknoglobals
+	propagation.TraceContext{},
+	propagation.Baggage{},
+)
+
+type config struct {
+	serviceVersion string
+	sampler        sdktrace.Sampler
+	processors     []sdktrace.SpanProcessor
+}
+
+// Option is to be implemented by functional options
+type Option func(*config)
+
+// WithExporter exports finished spans in batches, e.g. to an OTLP collector or NewStdoutExporter
+func WithExporter(exporter sdktrace.SpanExporter) Option {
+	return func(c *config) {
+		c.processors = append(c.processors, sdktrace.NewBatchSpanProcessor(exporter))
+	}
+}
+
+// WithSyncExporter exports every span as soon as it ends, which is meant for tests with NewInMemoryExporter
+func WithSyncExporter(exporter sdktrace.SpanExporter) Option {
+	return func(c *config) {
+		c.processors = append(c.processors, sdktrace.NewSimpleSpanProcessor(exporter))
+	}
+}
+
+// WithSampler sets the sampler (defaults to sampling all root spans and following the sampling decision of the parent)
+func WithSampler(sampler sdktrace.Sampler) Option {
+	return func(c *config) {
+		c.sampler = sampler
+	}
+}
+
+// WithServiceVersion adds the service version to the exported spans
+func WithServiceVersion(version string) Option {
+	return func(c *config) {
+		c.serviceVersion = version
+	}
+}
+
+// Init installs a tracer provider and the W3C propagator as otel globals.
+// Without exporter spans are created and propagated, but not exported.
+// The returned function flushes and stops the exporters and must be called before the service exits.
+func Init(serviceName string, options ...Option) (func(context.Context) error, error) {
+	c := &config{
+		sampler: sdktrace.ParentBased(sdktrace.AlwaysSample()),
+	}
+	for _, apply := range options {
+		apply(c)
+	}
+
+	attrs := []attribute.KeyValue{attribute.String("service.name", serviceName)}
+	if c.serviceVersion != "" {
+		attrs = append(attrs, attribute.String("service.version", c.serviceVersion))
+	}
+	res, err := resource.Merge(resource.Default(), resource.NewSchemaless(attrs...))
+	if err != nil {
+		return nil, fmt.Errorf("creating tracing resource: %w", err)
+	}
+
+	providerOptions := []sdktrace.TracerProviderOption{
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(c.sampler),
+		sdktrace.WithIDGenerator(legacyIDGenerator{}),
+	}
+	for _, processor := range c.processors {
+		providerOptions = append(providerOptions, sdktrace.WithSpanProcessor(processor))
+	}
+
+	provider := sdktrace.NewTracerProvider(providerOptions...)
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagator)
+
+	return provider.Shutdown, nil
+}
+
+// Tracer returns the tracer of the global tracer provider used by all instrumentations of this module
+func Tracer() trace.Tracer {
+	return otel.Tracer(instrumentationName)
+}
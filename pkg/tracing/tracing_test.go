@@ -0,0 +1,130 @@
+package tracing_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/d4l-data4life/go-svc/pkg/log"
+	"github.com/d4l-data4life/go-svc/pkg/tracing"
+)
+
+const (
+	traceparent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	parentTrace = "4bf92f3577b34da6a3ce929d0e0e4736"
+	legacyTrace = "0af7651916cd43dd8448eb211c80319c"
+)
+
+func initTracing(t *testing.T) *tracing.InMemoryExporter {
+	t.Helper()
+	exporter := tracing.NewInMemoryExporter()
+	shutdown, err := tracing.Init("test", tracing.WithSyncExporter(exporter))
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = shutdown(context.Background()) })
+	return exporter
+}
+
+func TestStartServerSpan(t *testing.T) {
+	exporter := initTracing(t)
+
+	for _, tc := range []struct {
+		name        string
+		header      http.Header
+		wantTraceID string
+		wantLegacy  string
+	}{
+		{
+			name:        "continues traceparent",
+			header:      http.Header{"Traceparent": {traceparent}},
+			wantTraceID: parentTrace,
+			wantLegacy:  parentTrace,
+		},
+		{
+			name:        "traceparent wins over legacy trace id",
+			header:      http.Header{"Traceparent": {traceparent}, log.TraceIDHeaderKey: {legacyTrace}},
+			wantTraceID: parentTrace,
+			wantLegacy:  parentTrace,
+		},
+		{
+			name:        "uses legacy trace id for new traces",
+			header:      http.Header{log.TraceIDHeaderKey: {legacyTrace}},
+			wantTraceID: legacyTrace,
+			wantLegacy:  legacyTrace,
+		},
+		{
+			name:       "keeps legacy trace id that is no W3C trace id",
+			header:     http.Header{log.TraceIDHeaderKey: {"my-trace"}},
+			wantLegacy: "my-trace",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			exporter.Reset()
+
+			ctx, span := tracing.StartServerSpan(context.Background(), propagation.HeaderCarrier(tc.header), "test")
+			span.End()
+
+			traceID := span.SpanContext().TraceID().String()
+			if tc.wantTraceID != "" {
+				assert.Equal(t, tc.wantTraceID, traceID)
+			}
+			assert.Equal(t, tc.wantLegacy, tracing.LegacyTraceID(ctx))
+
+			spans := exporter.GetSpans()
+			require.Len(t, spans, 1)
+			assert.Equal(t, trace.SpanKindServer, spans[0].SpanKind)
+		})
+	}
+}
+
+func TestInject(t *testing.T) {
+	initTracing(t)
+
+	ctx, span := tracing.StartClientSpan(context.Background(), "test")
+	defer span.End()
+
+	header := http.Header{}
+	tracing.Inject(ctx, propagation.HeaderCarrier(header))
+
+	traceID := span.SpanContext().TraceID().String()
+	assert.Equal(t, "00-"+traceID+"-"+span.SpanContext().SpanID().String()+"-01", header.Get("traceparent"))
+	assert.Equal(t, traceID, header.Get(log.TraceIDHeaderKey))
+}
+
+func TestSyncLegacyTraceIDWithoutSpan(t *testing.T) {
+	ctx := tracing.SyncLegacyTraceID(context.Background())
+	assert.Len(t, tracing.LegacyTraceID(ctx), 32)
+
+	ctx = context.WithValue(context.Background(), log.TraceIDContextKey, legacyTrace)
+	assert.Equal(t, legacyTrace, tracing.LegacyTraceID(tracing.SyncLegacyTraceID(ctx)))
+}
+
+func TestUnaryServerInterceptor(t *testing.T) {
+	exporter := initTracing(t)
+
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("traceparent", traceparent))
+	info := &grpc.UnaryServerInfo{FullMethod: "/test.Service/Method"}
+
+	var handlerCtx context.Context
+	_, err := tracing.UnaryServerInterceptor()(ctx, nil, info, func(ctx context.Context, req any) (any, error) {
+		handlerCtx = ctx
+		return nil, status.Error(codes.Internal, "failed")
+	})
+	require.Error(t, err)
+
+	assert.Equal(t, parentTrace, tracing.LegacyTraceID(handlerCtx))
+
+	spans := exporter.GetSpans()
+	require.Len(t, spans, 1)
+	assert.Equal(t, "test.Service/Method", spans[0].Name)
+	assert.Equal(t, parentTrace, spans[0].Parent.TraceID().String())
+	assert.Equal(t, "Internal", spans[0].Status.Description)
+}
@@ -0,0 +1,149 @@
+package transport
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/d4l-data4life/go-svc/pkg/prom"
+)
+
+// ErrBulkheadFull happens when all slots of a bulkhead and its wait queue are taken.
+var ErrBulkheadFull = errors.New("bulkhead full")
+
+const bulkheadLimiterName = "bulkhead"
+
+type BulkheadTransport struct {
+	name     string
+	slots    chan struct{}
+	maxQueue int64
+	queued   atomic.Int64
+	maxWait  time.Duration
+	metrics  *prom.LimiterInstrumenter
+
+	rt http.RoundTripper
+}
+
+func (t *BulkheadTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := t.acquire(req); err != nil {
+		return nil, err
+	}
+
+	res, err := t.rt.RoundTrip(req)
+	if err != nil || res.Body == nil {
+		t.release()
+		return res, err
+	}
+
+	// the slot is held until the response body is consumed
+	res.Body = &releasingBody{ReadCloser: res.Body, release: t.release}
+	return res, nil
+}
+
+func (t *BulkheadTransport) acquire(req *http.Request) error {
+	start := time.Now()
+
+	select {
+	case t.slots <- struct{}{}:
+		t.metrics.ObserveWait(bulkheadLimiterName, t.name, 0)
+		return nil
+	default:
+	}
+
+	if t.queued.Add(1) > t.maxQueue {
+		t.queued.Add(-1)
+		t.metrics.Reject(bulkheadLimiterName, t.name)
+		return fmt.Errorf("%w: %s", ErrBulkheadFull, t.name)
+	}
+	defer t.queued.Add(-1)
+
+	var timeout <-chan time.Time
+	if t.maxWait > 0 {
+		timer := time.NewTimer(t.maxWait)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	select {
+	case t.slots <- struct{}{}:
+		t.metrics.ObserveWait(bulkheadLimiterName, t.name, time.Since(start))
+		return nil
+	case <-timeout:
+		t.metrics.Reject(bulkheadLimiterName, t.name)
+		return fmt.Errorf("%w: %s waited %v", ErrBulkheadFull, t.name, t.maxWait)
+	case <-req.Context().Done():
+		t.metrics.Reject(bulkheadLimiterName, t.name)
+		return req.Context().Err()
+	}
+}
+
+func (t *BulkheadTransport) release() {
+	<-t.slots
+}
+
+// releasingBody calls release exactly once when the body is closed
+type releasingBody struct {
+	io.ReadCloser
+	once    sync.Once
+	release func()
+}
+
+func (b *releasingBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(b.release)
+	return err
+}
+
+// BulkheadOption is to be implemented by functional options
+type BulkheadOption func(*BulkheadTransport)
+
+// BulkheadWithMaxWait rejects queued requests with ErrBulkheadFull after waiting for the given duration.
+// By default queued requests wait until a slot is free or their context is done.
+func BulkheadWithMaxWait(d time.Duration) BulkheadOption {
+	return func(t *BulkheadTransport) {
+		t.maxWait = d
+	}
+}
+
+// BulkheadWithInitOptions changes the subsystem and buckets of the exported metrics
+func BulkheadWithInitOptions(options ...prom.InitOption) BulkheadOption {
+	return func(t *BulkheadTransport) {
+		t.metrics = prom.NewLimiterInstrumenter(options...)
+	}
+}
+
+// Bulkhead caps the amount of concurrent outgoing http requests at maxConcurrent.
+// Up to maxQueue further requests wait for a free slot, all others are rejected with ErrBulkheadFull.
+// A slot is taken until the response body is closed. With maxConcurrent <= 0 all requests fail with ErrInvalidLimit.
+func Bulkhead(name string, maxConcurrent int, maxQueue int, options ...BulkheadOption) TransportFunc {
+	return func(rt http.RoundTripper) http.RoundTripper {
+		if rt == nil {
+			rt = http.DefaultTransport
+		}
+
+		if maxConcurrent <= 0 {
+			return &errorTransport{err: fmt.Errorf("%w: bulkhead %s with %d concurrent requests", ErrInvalidLimit, name, maxConcurrent)}
+		}
+
+		bh := &BulkheadTransport{
+			name:     name,
+			slots:    make(chan struct{}, maxConcurrent),
+			maxQueue: int64(maxQueue),
+			rt:       rt,
+		}
+
+		for _, apply := range options {
+			apply(bh)
+		}
+
+		if bh.metrics == nil {
+			bh.metrics = prom.NewLimiterInstrumenter()
+		}
+
+		return bh
+	}
+}
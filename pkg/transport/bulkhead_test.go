@@ -0,0 +1,116 @@
+package transport_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/d4l-data4life/go-svc/pkg/transport"
+)
+
+type BlockingRoundTrip struct {
+	started chan struct{}
+	unblock chan struct{}
+}
+
+func (b *BlockingRoundTrip) RoundTrip(req *http.Request) (*http.Response, error) {
+	b.started <- struct{}{}
+	<-b.unblock
+	rec := httptest.NewRecorder()
+	return rec.Result(), nil
+}
+
+func TestBulkheadTransport(t *testing.T) {
+	newRequest := func(t *testing.T, ctx context.Context) *http.Request {
+		t.Helper()
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://example.org", nil)
+		if err != nil {
+			t.Fatalf("error creating http request: %v", err)
+		}
+		return req
+	}
+
+	t.Run("rejects when slots and queue are full", func(t *testing.T) {
+		downstream := &BlockingRoundTrip{started: make(chan struct{}, 2), unblock: make(chan struct{})}
+		rt := transport.Bulkhead("bulkhead-full", 1, 1)(downstream)
+
+		results := make(chan error, 2)
+		for i := 0; i < 2; i++ {
+			go func() {
+				res, err := rt.RoundTrip(newRequest(t, context.Background()))
+				if err == nil {
+					res.Body.Close()
+				}
+				results <- err
+			}()
+		}
+		<-downstream.started
+		// wait for the second request to be queued
+		time.Sleep(20 * time.Millisecond)
+
+		if _, err := rt.RoundTrip(newRequest(t, context.Background())); !errors.Is(err, transport.ErrBulkheadFull) {
+			t.Fatalf("expected ErrBulkheadFull, got %v", err)
+		}
+
+		close(downstream.unblock)
+		for i := 0; i < 2; i++ {
+			if err := <-results; err != nil {
+				t.Fatalf("round trip failed: %v", err)
+			}
+		}
+	})
+
+	t.Run("slot is held until body is closed", func(t *testing.T) {
+		downstream := &StatusRoundTrip{statusCode: http.StatusOK}
+		rt := transport.Bulkhead("bulkhead-body", 1, 0)(downstream)
+
+		res, err := rt.RoundTrip(newRequest(t, context.Background()))
+		if err != nil {
+			t.Fatalf("round trip failed: %v", err)
+		}
+		if _, err := rt.RoundTrip(newRequest(t, context.Background())); !errors.Is(err, transport.ErrBulkheadFull) {
+			t.Fatalf("expected ErrBulkheadFull, got %v", err)
+		}
+
+		res.Body.Close()
+		res.Body.Close()
+
+		res, err = rt.RoundTrip(newRequest(t, context.Background()))
+		if err != nil {
+			t.Fatalf("round trip failed: %v", err)
+		}
+		res.Body.Close()
+	})
+
+	t.Run("queued requests respect context and max wait", func(t *testing.T) {
+		downstream := &StatusRoundTrip{statusCode: http.StatusOK}
+		rt := transport.Bulkhead("bulkhead-wait", 1, 1, transport.BulkheadWithMaxWait(10*time.Millisecond))(downstream)
+
+		res, err := rt.RoundTrip(newRequest(t, context.Background()))
+		if err != nil {
+			t.Fatalf("round trip failed: %v", err)
+		}
+		defer res.Body.Close()
+
+		if _, err := rt.RoundTrip(newRequest(t, context.Background())); !errors.Is(err, transport.ErrBulkheadFull) {
+			t.Fatalf("expected ErrBulkheadFull after max wait, got %v", err)
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		if _, err := rt.RoundTrip(newRequest(t, ctx)); !errors.Is(err, context.Canceled) {
+			t.Fatalf("expected context canceled, got %v", err)
+		}
+	})
+
+	t.Run("rejects invalid concurrency", func(t *testing.T) {
+		rt := transport.Bulkhead("bulkhead-invalid", 0, 10)(&StatusRoundTrip{statusCode: http.StatusOK})
+
+		if _, err := rt.RoundTrip(newRequest(t, context.Background())); !errors.Is(err, transport.ErrInvalidLimit) {
+			t.Fatalf("expected ErrInvalidLimit, got %v", err)
+		}
+	})
+}
@@ -0,0 +1,408 @@
+package transport
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/d4l-data4life/go-svc/pkg/prom"
+)
+
+// cacheTenantHeader separates the cached responses of tenants, it is the header of middlewares.TenantIDHeaderName
+const cacheTenantHeader = "X-Tenant-ID"
+
+// heuristically cacheable status codes of RFC 9110 section 15.1
+var cacheableStatus = []int{200, 203, 204, 300, 301, 308, 404, 405, 410, 414, 501} // nolint: gochecknoglobals
+
+type CacheTransport struct {
+	name         string
+	storage      CacheStorage
+	private      bool
+	staleIfError time.Duration
+	maxEntrySize int64
+	metrics      *prom.CacheInstrumenter
+
+	rt http.RoundTripper
+}
+
+// cacheEntry is a stored response with the request header values selected by its Vary header
+type cacheEntry struct {
+	StatusCode   int                 `json:"status"`
+	Header       http.Header         `json:"header"`
+	Body         []byte              `json:"body"`
+	Vary         map[string][]string `json:"vary,omitempty"`
+	InitialAge   time.Duration       `json:"initialAge"`
+	ResponseTime time.Time           `json:"responseTime"`
+}
+
+func (t *CacheTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Method != http.MethodGet {
+		res, err := t.rt.RoundTrip(req)
+		// unsafe requests change the resource, its cached response is outdated
+		if err == nil && req.Method != http.MethodHead && req.Method != http.MethodOptions && res.StatusCode < http.StatusBadRequest {
+			t.storage.Delete(cacheKey(req))
+		}
+		return res, err
+	}
+
+	reqCC := parseCacheControl(req.Header)
+	if reqCC.has("no-store") || conditionalRequest(req) {
+		t.metrics.Lookup(t.name, prom.CacheMiss)
+		return t.rt.RoundTrip(req)
+	}
+
+	key := cacheKey(req)
+	entry := t.load(key, req)
+	if entry == nil {
+		t.metrics.Lookup(t.name, prom.CacheMiss)
+		return t.fetch(key, req)
+	}
+
+	resCC := parseCacheControl(entry.Header)
+	age := entry.age(time.Now())
+	lifetime := t.freshnessLifetime(entry, resCC)
+	maxAge, limited := reqCC.duration("max-age")
+	if age < lifetime && !resCC.has("no-cache") && !reqCC.has("no-cache") && (!limited || age <= maxAge) {
+		t.metrics.Lookup(t.name, prom.CacheHit)
+		return entry.response(req, age), nil
+	}
+
+	// the stale response is revalidated with its validators
+	revalidation := req.Clone(req.Context())
+	if etag := entry.Header.Get("ETag"); etag != "" {
+		revalidation.Header.Set("If-None-Match", etag)
+	}
+	if lastModified := entry.Header.Get("Last-Modified"); lastModified != "" {
+		revalidation.Header.Set("If-Modified-Since", lastModified)
+	}
+	requestTime := time.Now()
+	res, err := t.rt.RoundTrip(revalidation)
+
+	if err != nil || res.StatusCode >= http.StatusInternalServerError {
+		if t.serveStale(resCC, reqCC, age-lifetime) {
+			if res != nil {
+				drain(res)
+			}
+			t.metrics.Lookup(t.name, prom.CacheStale)
+			return entry.response(req, age), nil
+		}
+		t.metrics.Lookup(t.name, prom.CacheMiss)
+		return res, err
+	}
+
+	if res.StatusCode == http.StatusNotModified && revalidation.Header.Get("If-None-Match")+revalidation.Header.Get("If-Modified-Since") != "" {
+		drain(res)
+		for name, values := range res.Header {
+			if name != "Content-Length" {
+				entry.Header[name] = values
+			}
+		}
+		entry.InitialAge, entry.ResponseTime = initialAge(res, requestTime, time.Now())
+		t.save(key, entry)
+		t.metrics.Lookup(t.name, prom.CacheRevalidated)
+		return entry.response(req, entry.age(time.Now())), nil
+	}
+
+	t.metrics.Lookup(t.name, prom.CacheMiss)
+	return t.store(key, req, res, requestTime), nil
+}
+
+// fetch sends the request and stores the response if it is cacheable
+func (t *CacheTransport) fetch(key string, req *http.Request) (*http.Response, error) {
+	requestTime := time.Now()
+	res, err := t.rt.RoundTrip(req)
+	if err != nil {
+		return res, err
+	}
+	return t.store(key, req, res, requestTime), nil
+}
+
+// store saves a cacheable response, replacing the stored one, and returns it with a rewound body
+func (t *CacheTransport) store(key string, req *http.Request, res *http.Response, requestTime time.Time) *http.Response {
+	if !t.storable(req, res) {
+		t.storage.Delete(key)
+		return res
+	}
+
+	body, err := io.ReadAll(io.LimitReader(res.Body, t.maxEntrySize+1))
+	if err != nil || int64(len(body)) > t.maxEntrySize {
+		// the response is passed on as it is, the read part in front of the remaining body
+		res.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(body), res.Body), res.Body}
+		return res
+	}
+	_ = res.Body.Close()
+	res.Body = io.NopCloser(bytes.NewReader(body))
+
+	entry := &cacheEntry{
+		StatusCode: res.StatusCode,
+		Header:     res.Header.Clone(),
+		Body:       body,
+		Vary:       map[string][]string{},
+	}
+	for _, name := range varyFields(res.Header) {
+		entry.Vary[name] = req.Header.Values(name)
+	}
+	entry.InitialAge, entry.ResponseTime = initialAge(res, requestTime, time.Now())
+	t.save(key, entry)
+
+	return res
+}
+
+// storable implements the conditions of RFC 9111 section 3 for storing a response
+func (t *CacheTransport) storable(req *http.Request, res *http.Response) bool {
+	if !slices.Contains(cacheableStatus, res.StatusCode) || slices.Contains(varyFields(res.Header), "*") {
+		return false
+	}
+	cc := parseCacheControl(res.Header)
+	if cc.has("no-store") || (!t.private && cc.has("private")) {
+		return false
+	}
+	// a shared cache only keeps responses to authorized requests which are explicitly allowed
+	if !t.private && req.Header.Get("Authorization") != "" && !cc.has("public") && !cc.has("s-maxage") && !cc.has("must-revalidate") {
+		return false
+	}
+	return cc.has("max-age") || cc.has("s-maxage") || cc.has("public") || res.Header.Get("Expires") != "" ||
+		res.Header.Get("ETag") != "" || res.Header.Get("Last-Modified") != ""
+}
+
+// freshnessLifetime implements RFC 9111 section 4.2.1, with 10% of the time since the last modification as heuristic
+func (t *CacheTransport) freshnessLifetime(entry *cacheEntry, cc cacheControl) time.Duration {
+	if d, ok := cc.duration("s-maxage"); ok && !t.private {
+		return d
+	}
+	if d, ok := cc.duration("max-age"); ok {
+		return d
+	}
+	date := entry.date()
+	if expires := entry.Header.Get("Expires"); expires != "" {
+		// invalid dates, like 0, mean already expired
+		e, err := http.ParseTime(expires)
+		if err != nil {
+			return 0
+		}
+		return e.Sub(date)
+	}
+	if lastModified, err := http.ParseTime(entry.Header.Get("Last-Modified")); err == nil && !cc.has("no-cache") {
+		return min(date.Sub(lastModified)/10, 24*time.Hour)
+	}
+	return 0
+}
+
+// serveStale tells whether a stale response may be served if the origin failed (RFC 5861 stale-if-error)
+func (t *CacheTransport) serveStale(resCC, reqCC cacheControl, staleness time.Duration) bool {
+	if resCC.has("must-revalidate") || (!t.private && resCC.has("proxy-revalidate")) {
+		return false
+	}
+	window := t.staleIfError
+	if d, ok := resCC.duration("stale-if-error"); ok {
+		window = d
+	}
+	if d, ok := reqCC.duration("stale-if-error"); ok {
+		window = d
+	}
+	return staleness <= window
+}
+
+func (t *CacheTransport) load(key string, req *http.Request) *cacheEntry {
+	data, ok := t.storage.Get(key)
+	if !ok {
+		return nil
+	}
+	var entry cacheEntry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		t.storage.Delete(key)
+		return nil
+	}
+	// only one variant per URL is kept, a different variant is a miss and replaces it
+	for name, values := range entry.Vary {
+		if !slices.Equal(values, req.Header.Values(name)) {
+			return nil
+		}
+	}
+	return &entry
+}
+
+func (t *CacheTransport) save(key string, entry *cacheEntry) {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return
+	}
+	t.storage.Set(key, data)
+}
+
+// age implements the current_age of RFC 9111 section 4.2.3
+func (e *cacheEntry) age(now time.Time) time.Duration {
+	return e.InitialAge + max(0, now.Sub(e.ResponseTime))
+}
+
+func (e *cacheEntry) date() time.Time {
+	if date, err := http.ParseTime(e.Header.Get("Date")); err == nil {
+		return date
+	}
+	return e.ResponseTime
+}
+
+func (e *cacheEntry) response(req *http.Request, age time.Duration) *http.Response {
+	header := e.Header.Clone()
+	header.Set("Age", strconv.FormatInt(int64(age/time.Second), 10))
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", e.StatusCode, http.StatusText(e.StatusCode)),
+		StatusCode:    e.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(e.Body)),
+		ContentLength: int64(len(e.Body)),
+		Request:       req,
+	}
+}
+
+// initialAge implements the corrected_initial_age of RFC 9111 section 4.2.3
+func initialAge(res *http.Response, requestTime, responseTime time.Time) (time.Duration, time.Time) {
+	var apparentAge time.Duration
+	if date, err := http.ParseTime(res.Header.Get("Date")); err == nil {
+		apparentAge = max(0, responseTime.Sub(date))
+	}
+	var ageValue time.Duration
+	if seconds, err := strconv.ParseInt(res.Header.Get("Age"), 10, 64); err == nil && seconds > 0 {
+		ageValue = time.Duration(seconds) * time.Second
+	}
+	return max(apparentAge, ageValue+responseTime.Sub(requestTime)), responseTime
+}
+
+// cacheKey separates the responses of the tenants
+func cacheKey(req *http.Request) string {
+	return req.Header.Get(cacheTenantHeader) + "\x00" + req.URL.String()
+}
+
+// conditionalRequest tells whether the caller validates or requests a range itself, which the cache passes through
+func conditionalRequest(req *http.Request) bool {
+	for _, name := range []string{"If-None-Match", "If-Modified-Since", "If-Match", "If-Unmodified-Since", "If-Range", "Range"} {
+		if req.Header.Get(name) != "" {
+			return true
+		}
+	}
+	return false
+}
+
+func varyFields(header http.Header) []string {
+	var fields []string
+	for _, value := range header.Values("Vary") {
+		for _, field := range strings.Split(value, ",") {
+			if field = strings.TrimSpace(field); field != "" {
+				fields = append(fields, http.CanonicalHeaderKey(field))
+			}
+		}
+	}
+	return fields
+}
+
+func drain(res *http.Response) {
+	_, _ = io.Copy(io.Discard, io.LimitReader(res.Body, 64<<10))
+	_ = res.Body.Close()
+}
+
+// cacheControl are the directives of Cache-Control headers, Pragma: no-cache counts as no-cache
+type cacheControl map[string]string
+
+func parseCacheControl(header http.Header) cacheControl {
+	cc := cacheControl{}
+	for _, value := range header.Values("Cache-Control") {
+		for _, directive := range strings.Split(value, ",") {
+			name, arg, _ := strings.Cut(strings.TrimSpace(directive), "=")
+			if name != "" {
+				cc[strings.ToLower(name)] = strings.Trim(arg, `"`)
+			}
+		}
+	}
+	if len(cc) == 0 && strings.EqualFold(header.Get("Pragma"), "no-cache") {
+		cc["no-cache"] = ""
+	}
+	return cc
+}
+
+func (cc cacheControl) has(directive string) bool {
+	_, ok := cc[directive]
+	return ok
+}
+
+func (cc cacheControl) duration(directive string) (time.Duration, bool) {
+	seconds, err := strconv.ParseInt(cc[directive], 10, 64)
+	if err != nil || seconds < 0 {
+		return 0, false
+	}
+	return time.Duration(seconds) * time.Second, true
+}
+
+// CacheOption is to be implemented by functional options
+type CacheOption func(*CacheTransport)
+
+// CacheWithPrivate makes the cache behave as private cache of a single user: responses marked private and
+// responses to requests with Authorization are stored. By default it is a shared cache.
+func CacheWithPrivate() CacheOption {
+	return func(t *CacheTransport) {
+		t.private = true
+	}
+}
+
+// CacheWithStaleIfError serves stale responses up to the given staleness if the origin fails with an error or 5xx
+// and neither the request nor the response have a stale-if-error directive (defaults to 0)
+func CacheWithStaleIfError(d time.Duration) CacheOption {
+	return func(t *CacheTransport) {
+		t.staleIfError = d
+	}
+}
+
+// CacheWithMaxEntrySize sets the size of the largest stored response body (defaults to 1 MiB)
+func CacheWithMaxEntrySize(size int64) CacheOption {
+	return func(t *CacheTransport) {
+		t.maxEntrySize = size
+	}
+}
+
+// CacheWithInitOptions changes the subsystem of the exported metrics
+func CacheWithInitOptions(options ...prom.InitOption) CacheOption {
+	return func(t *CacheTransport) {
+		t.metrics = prom.NewCacheInstrumenter(options...)
+	}
+}
+
+// Cache answers GET requests from the storage following the HTTP caching rules of RFC 9111: responses are stored
+// according to Cache-Control, Expires and Vary, served while fresh, revalidated with ETag and Last-Modified once stale
+// and served stale if the origin fails within stale-if-error. Unsafe requests invalidate the response of their URL.
+// Responses are kept per tenant of the X-Tenant-ID header, so they never leak between tenants.
+// The lookups are counted by the given cache name.
+func Cache(name string, storage CacheStorage, options ...CacheOption) TransportFunc {
+	return func(rt http.RoundTripper) http.RoundTripper {
+		if rt == nil {
+			rt = http.DefaultTransport
+		}
+
+		ct := &CacheTransport{
+			name:         name,
+			storage:      storage,
+			maxEntrySize: 1 << 20,
+			rt:           rt,
+		}
+
+		for _, apply := range options {
+			apply(ct)
+		}
+
+		if ct.metrics == nil {
+			ct.metrics = prom.NewCacheInstrumenter()
+		}
+
+		return ct
+	}
+}
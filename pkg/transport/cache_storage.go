@@ -0,0 +1,146 @@
+package transport
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// CacheStorage keeps the serialized responses of a Cache transport by key
+type CacheStorage interface {
+	// Get returns the value stored for the key and whether there is one
+	Get(key string) ([]byte, bool)
+	// Set stores the value for the key, storages with limited space may evict other values or drop it
+	Set(key string, value []byte)
+	// Delete removes the value of the key
+	Delete(key string)
+}
+
+type memoryCacheItem struct {
+	key   string
+	value []byte
+}
+
+// MemoryCacheStorage keeps the values in memory up to a byte budget, evicting the least recently used ones
+type MemoryCacheStorage struct {
+	mu       sync.Mutex
+	maxBytes int64
+	size     int64
+	lru      *list.List
+	items    map[string]*list.Element
+}
+
+// NewMemoryCacheStorage creates a storage keeping at most maxBytes of values
+func NewMemoryCacheStorage(maxBytes int64) *MemoryCacheStorage {
+	return &MemoryCacheStorage{
+		maxBytes: maxBytes,
+		lru:      list.New(),
+		items:    map[string]*list.Element{},
+	}
+}
+
+func (s *MemoryCacheStorage) Get(key string) ([]byte, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.items[key]
+	if !ok {
+		return nil, false
+	}
+	s.lru.MoveToFront(e)
+	return e.Value.(*memoryCacheItem).value, true
+}
+
+func (s *MemoryCacheStorage) Set(key string, value []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.remove(key)
+	if int64(len(value)) > s.maxBytes {
+		return
+	}
+	s.items[key] = s.lru.PushFront(&memoryCacheItem{key: key, value: value})
+	s.size += int64(len(value))
+	for s.size > s.maxBytes {
+		s.remove(s.lru.Back().Value.(*memoryCacheItem).key)
+	}
+}
+
+func (s *MemoryCacheStorage) Delete(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.remove(key)
+}
+
+// Size returns the amount of bytes of the stored values
+func (s *MemoryCacheStorage) Size() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.size
+}
+
+func (s *MemoryCacheStorage) remove(key string) {
+	e, ok := s.items[key]
+	if !ok {
+		return
+	}
+	s.lru.Remove(e)
+	delete(s.items, key)
+	s.size -= int64(len(e.Value.(*memoryCacheItem).value))
+}
+
+// DiskCacheStorage keeps the values as files in a directory, so they survive restarts.
+// It does not evict values, the size is bound by the amount of cached URLs.
+type DiskCacheStorage struct {
+	dir string
+}
+
+// NewDiskCacheStorage creates a storage in the directory, which is created if it does not exist
+func NewDiskCacheStorage(dir string) (*DiskCacheStorage, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("creating cache directory: %w", err)
+	}
+	return &DiskCacheStorage{dir: dir}, nil
+}
+
+func (s *DiskCacheStorage) Get(key string) ([]byte, bool) {
+	value, err := os.ReadFile(s.path(key))
+	if err != nil {
+		return nil, false
+	}
+	return value, true
+}
+
+// Set writes the value to a temporary file first, so concurrent readers never see a partial value
+func (s *DiskCacheStorage) Set(key string, value []byte) {
+	f, err := os.CreateTemp(s.dir, "tmp-*")
+	if err != nil {
+		return
+	}
+	_, err = f.Write(value)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), s.path(key))
+	}
+	if err != nil {
+		_ = os.Remove(f.Name())
+	}
+}
+
+func (s *DiskCacheStorage) Delete(key string) {
+	_ = os.Remove(s.path(key))
+}
+
+// path hashes the key, which contains the URL and tenant, to a file name
+func (s *DiskCacheStorage) path(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(s.dir, hex.EncodeToString(sum[:]))
+}
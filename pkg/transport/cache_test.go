@@ -0,0 +1,367 @@
+package transport_test
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"github.com/d4l-data4life/go-svc/pkg/prom"
+	"github.com/d4l-data4life/go-svc/pkg/transport"
+)
+
+// origin answers with the header of the handler and counts the requests reaching it
+type origin struct {
+	requests atomic.Int32
+	handler  func(w http.ResponseWriter, req *http.Request)
+}
+
+func (o *origin) RoundTrip(req *http.Request) (*http.Response, error) {
+	o.requests.Add(1)
+	res := httptest.NewRecorder()
+	o.handler(res, req)
+	return res.Result(), nil
+}
+
+func get(t *testing.T, rt http.RoundTripper, header map[string]string) (*http.Response, string) {
+	t.Helper()
+	return send(t, rt, http.MethodGet, header)
+}
+
+func send(t *testing.T, rt http.RoundTripper, method string, header map[string]string) (*http.Response, string) {
+	t.Helper()
+	req, err := http.NewRequest(method, "http://flags.local/v1/flags", nil)
+	if err != nil {
+		t.Fatalf("error creating http request: %v", err)
+	}
+	for name, value := range header {
+		req.Header.Set(name, value)
+	}
+	res, err := rt.RoundTrip(req)
+	if err != nil {
+		t.Fatalf("round trip failed: %v", err)
+	}
+	defer res.Body.Close()
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		t.Fatalf("reading body: %v", err)
+	}
+	return res, string(body)
+}
+
+func newCache(o *origin, options ...transport.CacheOption) http.RoundTripper {
+	options = append([]transport.CacheOption{transport.CacheWithInitOptions(prom.WithSubsystem("cache"))}, options...)
+	return transport.Cache("flags", transport.NewMemoryCacheStorage(1<<20), options...)(o)
+}
+
+func TestCacheFreshness(t *testing.T) {
+	for _, tc := range [...]struct {
+		name         string
+		header       map[string]string
+		request      map[string]string
+		wantRequests int32
+	}{
+		{name: "max-age", header: map[string]string{"Cache-Control": "max-age=60"}, wantRequests: 1},
+		{name: "expires", header: map[string]string{"Expires": "Fri, 01 Jan 2100 00:00:00 GMT"}, wantRequests: 1},
+		{name: "expired", header: map[string]string{"Cache-Control": "max-age=60", "Age": "120"}, wantRequests: 2},
+		{name: "no-store", header: map[string]string{"Cache-Control": "no-store, max-age=60"}, wantRequests: 2},
+		{name: "private", header: map[string]string{"Cache-Control": "private, max-age=60"}, wantRequests: 2},
+		{name: "not cacheable", header: map[string]string{"Content-Type": "application/json"}, wantRequests: 2},
+		{name: "request no-cache", header: map[string]string{"Cache-Control": "max-age=60"}, request: map[string]string{"Cache-Control": "no-cache"}, wantRequests: 2},
+		{name: "request max-age", header: map[string]string{"Cache-Control": "max-age=60", "Age": "30"}, request: map[string]string{"Cache-Control": "max-age=10"}, wantRequests: 2},
+		{name: "request no-store", header: map[string]string{"Cache-Control": "max-age=60"}, request: map[string]string{"Cache-Control": "no-store"}, wantRequests: 2},
+		{name: "authorized shared", header: map[string]string{"Cache-Control": "max-age=60"}, request: map[string]string{"Authorization": "Bearer t"}, wantRequests: 2},
+		{name: "authorized public", header: map[string]string{"Cache-Control": "public, max-age=60"}, request: map[string]string{"Authorization": "Bearer t"}, wantRequests: 1},
+	} {
+		o := &origin{handler: func(w http.ResponseWriter, _ *http.Request) {
+			for name, value := range tc.header {
+				w.Header().Set(name, value)
+			}
+			_, _ = io.WriteString(w, "flags")
+		}}
+		cache := newCache(o)
+
+		for range 2 {
+			if _, body := get(t, cache, tc.request); body != "flags" {
+				t.Fatalf("%s: body = %q, want %q", tc.name, body, "flags")
+			}
+		}
+		if got := o.requests.Load(); got != tc.wantRequests {
+			t.Errorf("%s: origin got %d requests, want %d", tc.name, got, tc.wantRequests)
+		}
+	}
+}
+
+func TestCacheHitAge(t *testing.T) {
+	o := &origin{handler: func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Header().Set("Age", "10")
+		_, _ = io.WriteString(w, "flags")
+	}}
+	cache := newCache(o)
+
+	get(t, cache, nil)
+	res, _ := get(t, cache, nil)
+
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("status = %d, want %d", res.StatusCode, http.StatusOK)
+	}
+	if age := res.Header.Get("Age"); age != "10" {
+		t.Errorf("Age = %q, want %q", age, "10")
+	}
+}
+
+func TestCacheRevalidation(t *testing.T) {
+	for _, tc := range [...]struct {
+		name      string
+		validator string
+		value     string
+		condition string
+	}{
+		{name: "etag", validator: "ETag", value: `"v1"`, condition: "If-None-Match"},
+		{name: "last-modified", validator: "Last-Modified", value: "Mon, 01 Jan 2024 00:00:00 GMT", condition: "If-Modified-Since"},
+	} {
+		var conditional atomic.Int32
+		o := &origin{handler: func(w http.ResponseWriter, req *http.Request) {
+			w.Header().Set("Cache-Control", "no-cache")
+			w.Header().Set(tc.validator, tc.value)
+			if req.Header.Get(tc.condition) == tc.value {
+				conditional.Add(1)
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+			_, _ = io.WriteString(w, "flags")
+		}}
+		cache := newCache(o)
+
+		get(t, cache, nil)
+		res, body := get(t, cache, nil)
+
+		if res.StatusCode != http.StatusOK || body != "flags" {
+			t.Errorf("%s: response = %d %q, want the cached one", tc.name, res.StatusCode, body)
+		}
+		if conditional.Load() != 1 {
+			t.Errorf("%s: origin got %d conditional requests, want 1", tc.name, conditional.Load())
+		}
+	}
+}
+
+func TestCacheConditionalRequestPassesThrough(t *testing.T) {
+	o := &origin{handler: func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Header().Set("ETag", `"v1"`)
+		if req.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		_, _ = io.WriteString(w, "flags")
+	}}
+	cache := newCache(o)
+
+	get(t, cache, nil)
+	res, _ := get(t, cache, map[string]string{"If-None-Match": `"v1"`})
+
+	if res.StatusCode != http.StatusNotModified {
+		t.Errorf("status = %d, want the 304 of the origin", res.StatusCode)
+	}
+}
+
+func TestCacheStaleIfError(t *testing.T) {
+	for _, tc := range [...]struct {
+		name       string
+		header     string
+		options    []transport.CacheOption
+		wantStatus int
+	}{
+		{name: "response directive", header: "max-age=60, stale-if-error=3600", wantStatus: http.StatusOK},
+		{name: "expired directive", header: "max-age=60, stale-if-error=30", wantStatus: http.StatusServiceUnavailable},
+		{name: "option", header: "max-age=60", options: []transport.CacheOption{transport.CacheWithStaleIfError(time.Hour)}, wantStatus: http.StatusOK},
+		{name: "must-revalidate", header: "max-age=60, must-revalidate, stale-if-error=3600", wantStatus: http.StatusServiceUnavailable},
+		{name: "none", header: "max-age=60", wantStatus: http.StatusServiceUnavailable},
+	} {
+		var failing atomic.Bool
+		o := &origin{handler: func(w http.ResponseWriter, _ *http.Request) {
+			if failing.Load() {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			// stale by 60 seconds right away
+			w.Header().Set("Cache-Control", tc.header)
+			w.Header().Set("Age", "120")
+			_, _ = io.WriteString(w, "flags")
+		}}
+		cache := newCache(o, tc.options...)
+
+		get(t, cache, nil)
+		failing.Store(true)
+		res, _ := get(t, cache, nil)
+
+		if res.StatusCode != tc.wantStatus {
+			t.Errorf("%s: status = %d, want %d", tc.name, res.StatusCode, tc.wantStatus)
+		}
+	}
+}
+
+func TestCacheKeys(t *testing.T) {
+	o := &origin{handler: func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Header().Set("Vary", "Accept-Language")
+		_, _ = fmt.Fprintf(w, "flags of %s in %s", req.Header.Get("X-Tenant-ID"), req.Header.Get("Accept-Language"))
+	}}
+	cache := newCache(o)
+
+	for _, tc := range [...]struct {
+		tenant       string
+		language     string
+		wantBody     string
+		wantRequests int32
+	}{
+		{tenant: "t1", language: "en", wantBody: "flags of t1 in en", wantRequests: 1},
+		{tenant: "t1", language: "en", wantBody: "flags of t1 in en", wantRequests: 1},
+		{tenant: "t2", language: "en", wantBody: "flags of t2 in en", wantRequests: 2},
+		{tenant: "t1", language: "en", wantBody: "flags of t1 in en", wantRequests: 2},
+		{tenant: "t1", language: "de", wantBody: "flags of t1 in de", wantRequests: 3},
+	} {
+		_, body := get(t, cache, map[string]string{"X-Tenant-ID": tc.tenant, "Accept-Language": tc.language})
+		if body != tc.wantBody {
+			t.Errorf("body = %q, want %q", body, tc.wantBody)
+		}
+		if got := o.requests.Load(); got != tc.wantRequests {
+			t.Errorf("%s in %s: origin got %d requests, want %d", tc.tenant, tc.language, got, tc.wantRequests)
+		}
+	}
+}
+
+func TestCacheInvalidation(t *testing.T) {
+	o := &origin{handler: func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=60")
+		_, _ = io.WriteString(w, "flags")
+	}}
+	cache := newCache(o)
+
+	get(t, cache, nil)
+	send(t, cache, http.MethodPut, nil)
+	get(t, cache, nil)
+
+	if got := o.requests.Load(); got != 3 {
+		t.Errorf("origin got %d requests, want 3", got)
+	}
+}
+
+func TestCachePrivate(t *testing.T) {
+	o := &origin{handler: func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Cache-Control", "private, max-age=60")
+		_, _ = io.WriteString(w, "flags")
+	}}
+	cache := newCache(o, transport.CacheWithPrivate())
+
+	get(t, cache, map[string]string{"Authorization": "Bearer t"})
+	get(t, cache, map[string]string{"Authorization": "Bearer t"})
+
+	if got := o.requests.Load(); got != 1 {
+		t.Errorf("origin got %d requests, want 1", got)
+	}
+}
+
+func TestCacheMaxEntrySize(t *testing.T) {
+	body := strings.Repeat("f", 100)
+	o := &origin{handler: func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=60")
+		_, _ = io.WriteString(w, body)
+	}}
+	cache := newCache(o, transport.CacheWithMaxEntrySize(10))
+
+	for range 2 {
+		if _, got := get(t, cache, nil); got != body {
+			t.Fatalf("body has %d bytes, want %d", len(got), len(body))
+		}
+	}
+	if got := o.requests.Load(); got != 2 {
+		t.Errorf("origin got %d requests, want 2", got)
+	}
+}
+
+func TestCacheMetrics(t *testing.T) {
+	o := &origin{handler: func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=60")
+		_, _ = io.WriteString(w, "flags")
+	}}
+	cache := transport.Cache("metrics", transport.NewMemoryCacheStorage(1<<20),
+		transport.CacheWithInitOptions(prom.WithSubsystem("cache")))(o)
+
+	get(t, cache, nil)
+	get(t, cache, nil)
+	get(t, cache, nil)
+
+	metrics := httptest.NewRecorder()
+	promhttp.Handler().ServeHTTP(metrics, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	for _, want := range []string{
+		`d4l_cache_http_out_cache_requests_total{name="metrics",result="hit"} 2`,
+		`d4l_cache_http_out_cache_requests_total{name="metrics",result="miss"} 1`,
+	} {
+		if !strings.Contains(metrics.Body.String(), want) {
+			t.Errorf("metrics do not contain %s", want)
+		}
+	}
+}
+
+func TestMemoryCacheStorage(t *testing.T) {
+	storage := transport.NewMemoryCacheStorage(10)
+
+	storage.Set("a", []byte("aaaa"))
+	storage.Set("b", []byte("bbbb"))
+	storage.Get("a")
+	storage.Set("c", []byte("cccc"))
+
+	if _, ok := storage.Get("b"); ok {
+		t.Errorf("least recently used value was not evicted")
+	}
+	for _, key := range []string{"a", "c"} {
+		if _, ok := storage.Get(key); !ok {
+			t.Errorf("value %s was evicted", key)
+		}
+	}
+	if storage.Size() != 8 {
+		t.Errorf("size = %d, want 8", storage.Size())
+	}
+
+	storage.Set("d", []byte("too large value"))
+	if _, ok := storage.Get("d"); ok {
+		t.Errorf("value larger than the budget was stored")
+	}
+	storage.Delete("a")
+	if storage.Size() != 4 {
+		t.Errorf("size = %d, want 4", storage.Size())
+	}
+}
+
+func TestDiskCacheStorage(t *testing.T) {
+	dir := t.TempDir()
+	storage, err := transport.NewDiskCacheStorage(dir)
+	if err != nil {
+		t.Fatalf("creating storage: %v", err)
+	}
+
+	storage.Set("t1\x00http://flags.local/v1/flags", []byte("flags"))
+
+	// a new storage on the same directory sees the values
+	reopened, err := transport.NewDiskCacheStorage(dir)
+	if err != nil {
+		t.Fatalf("reopening storage: %v", err)
+	}
+	value, ok := reopened.Get("t1\x00http://flags.local/v1/flags")
+	if !ok || string(value) != "flags" {
+		t.Errorf("value = %q, %v, want %q", value, ok, "flags")
+	}
+
+	reopened.Delete("t1\x00http://flags.local/v1/flags")
+	if _, ok := storage.Get("t1\x00http://flags.local/v1/flags"); ok {
+		t.Errorf("deleted value was found")
+	}
+}
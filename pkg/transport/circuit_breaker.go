@@ -0,0 +1,344 @@
+package transport
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/d4l-data4life/go-svc/pkg/log"
+	"github.com/d4l-data4life/go-svc/pkg/logging"
+	"github.com/d4l-data4life/go-svc/pkg/prom"
+)
+
+// ErrCircuitOpen happens when a request is rejected because the circuit breaker is open.
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+// CircuitBreakerState is the state of a circuit breaker.
+type CircuitBreakerState int
+
+const (
+	// CircuitClosed lets all requests pass and records their outcome.
+	CircuitClosed CircuitBreakerState = iota
+	// CircuitHalfOpen lets a limited amount of probe requests pass to check if the downstream recovered.
+	CircuitHalfOpen
+	// CircuitOpen rejects all requests until the open timeout elapsed.
+	CircuitOpen
+)
+
+func (s CircuitBreakerState) String() string {
+	switch s {
+	case CircuitClosed:
+		return "closed"
+	case CircuitHalfOpen:
+		return "half-open"
+	case CircuitOpen:
+		return "open"
+	}
+	return "unknown"
+}
+
+var circuitBreakerStates = []string{CircuitClosed.String(), CircuitHalfOpen.String(), CircuitOpen.String()}
+
+const circuitBreakerBuckets = 10
+
+type circuitBreakerBucket struct {
+	epoch     int64
+	successes int
+	failures  int
+}
+
+type CircuitBreakerTransport struct {
+	name             string
+	failureRatio     float64
+	minRequests      int
+	window           time.Duration
+	openTimeout      time.Duration
+	halfOpenRequests int
+	classify         func(error) bool
+	logger           *log.Logger
+	metrics          *prom.CircuitBreakerInstrumenter
+
+	mu                sync.Mutex
+	state             CircuitBreakerState
+	openedAt          time.Time
+	buckets           [circuitBreakerBuckets]circuitBreakerBucket
+	halfOpenInFlight  int
+	halfOpenSuccesses int
+	// generation changes with every transition, outcomes of requests admitted in an older generation are ignored
+	generation uint64
+
+	rt http.RoundTripper
+}
+
+func (t *CircuitBreakerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	admittedIn, generation, err := t.admit(req.Context())
+	if err != nil {
+		t.metrics.Reject(t.name)
+		return nil, err
+	}
+
+	res, err := t.rt.RoundTrip(req)
+
+	if errors.Is(err, context.Canceled) {
+		// the caller gave up, this tells nothing about the downstream
+		t.release(admittedIn, generation)
+		return res, err
+	}
+	outcome := err
+	if outcome == nil {
+		outcome = StatusCode(res.StatusCode)
+	}
+	t.record(req.Context(), admittedIn, generation, t.classify(outcome))
+
+	return res, err
+}
+
+// State returns the current state of the circuit breaker.
+func (t *CircuitBreakerTransport) State() CircuitBreakerState {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.state == CircuitOpen && time.Since(t.openedAt) >= t.openTimeout {
+		return CircuitHalfOpen
+	}
+	return t.state
+}
+
+// admit decides whether a request may pass and returns the state and generation it was admitted in.
+func (t *CircuitBreakerTransport) admit(ctx context.Context) (CircuitBreakerState, uint64, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.state == CircuitOpen {
+		if time.Since(t.openedAt) < t.openTimeout {
+			return CircuitOpen, t.generation, fmt.Errorf("%w: %s", ErrCircuitOpen, t.name)
+		}
+		t.transition(ctx, CircuitHalfOpen)
+	}
+
+	if t.state == CircuitHalfOpen {
+		if t.halfOpenInFlight+t.halfOpenSuccesses >= t.halfOpenRequests {
+			return CircuitHalfOpen, t.generation, fmt.Errorf("%w: %s", ErrCircuitOpen, t.name)
+		}
+		t.halfOpenInFlight++
+	}
+
+	return t.state, t.generation, nil
+}
+
+// release frees the probe slot of a request without recording its outcome.
+func (t *CircuitBreakerTransport) release(admittedIn CircuitBreakerState, generation uint64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if admittedIn == CircuitHalfOpen && generation == t.generation {
+		t.halfOpenInFlight--
+	}
+}
+
+// record stores the outcome of a request that was admitted in the given state and generation.
+func (t *CircuitBreakerTransport) record(ctx context.Context, admittedIn CircuitBreakerState, generation uint64, failed bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if generation != t.generation {
+		// outcome of a request admitted before the state changed, e.g. a probe of an earlier half-open period
+		return
+	}
+
+	switch admittedIn {
+	case CircuitHalfOpen:
+		t.halfOpenInFlight--
+		if failed {
+			t.transition(ctx, CircuitOpen)
+			return
+		}
+		t.halfOpenSuccesses++
+		if t.halfOpenSuccesses >= t.halfOpenRequests {
+			t.transition(ctx, CircuitClosed)
+		}
+	case CircuitClosed:
+		b := t.currentBucket()
+		if failed {
+			b.failures++
+		} else {
+			b.successes++
+		}
+
+		successes, failures := t.windowCounts()
+		total := successes + failures
+		if total >= t.minRequests && float64(failures)/float64(total) >= t.failureRatio {
+			t.transition(ctx, CircuitOpen)
+		}
+	}
+}
+
+// currentBucket returns the bucket of the rolling window the current time falls into
+// and resets it if it still holds counts of an older window.
+func (t *CircuitBreakerTransport) currentBucket() *circuitBreakerBucket {
+	epoch := time.Now().UnixNano() / t.bucketWidth()
+	b := &t.buckets[epoch%circuitBreakerBuckets]
+	if b.epoch != epoch {
+		*b = circuitBreakerBucket{epoch: epoch}
+	}
+	return b
+}
+
+func (t *CircuitBreakerTransport) windowCounts() (successes, failures int) {
+	epoch := time.Now().UnixNano() / t.bucketWidth()
+	for _, b := range t.buckets {
+		if b.epoch > epoch-circuitBreakerBuckets {
+			successes += b.successes
+			failures += b.failures
+		}
+	}
+	return successes, failures
+}
+
+func (t *CircuitBreakerTransport) bucketWidth() int64 {
+	width := int64(t.window) / circuitBreakerBuckets
+	if width <= 0 {
+		return 1
+	}
+	return width
+}
+
+// transition changes the state and resets all counters, it must be called with the lock held.
+func (t *CircuitBreakerTransport) transition(ctx context.Context, to CircuitBreakerState) {
+	from := t.state
+	t.state = to
+	t.generation++
+	t.halfOpenInFlight = 0
+	t.halfOpenSuccesses = 0
+	if to == CircuitOpen {
+		t.openedAt = time.Now()
+	}
+	if to == CircuitClosed {
+		t.buckets = [circuitBreakerBuckets]circuitBreakerBucket{}
+	}
+
+	t.metrics.Transition(t.name, to.String())
+	t.metrics.SetState(t.name, to.String(), circuitBreakerStates...)
+
+	msg := fmt.Sprintf("circuit breaker %s changed state from %s to %s", t.name, from, to)
+	if to == CircuitOpen {
+		_ = t.logger.WarnGeneric(ctx, msg, ErrCircuitOpen)
+		return
+	}
+	_ = t.logger.InfoGeneric(ctx, msg)
+}
+
+// CircuitBreakerOption is to be implemented by functional options
+type CircuitBreakerOption func(*CircuitBreakerTransport)
+
+// CircuitBreakerWithFailureRatio sets the ratio of failed requests within the rolling window
+// at which the breaker opens (defaults to 0.5)
+func CircuitBreakerWithFailureRatio(ratio float64) CircuitBreakerOption {
+	return func(t *CircuitBreakerTransport) {
+		t.failureRatio = ratio
+	}
+}
+
+// CircuitBreakerWithMinRequests sets the amount of requests within the rolling window
+// required before the failure ratio is evaluated (defaults to 20)
+func CircuitBreakerWithMinRequests(n int) CircuitBreakerOption {
+	return func(t *CircuitBreakerTransport) {
+		t.minRequests = n
+	}
+}
+
+// CircuitBreakerWithWindow sets the duration of the rolling window (defaults to 60 seconds)
+func CircuitBreakerWithWindow(window time.Duration) CircuitBreakerOption {
+	return func(t *CircuitBreakerTransport) {
+		t.window = window
+	}
+}
+
+// CircuitBreakerWithOpenTimeout sets how long the breaker stays open before it lets probe requests pass
+// (defaults to 30 seconds)
+func CircuitBreakerWithOpenTimeout(timeout time.Duration) CircuitBreakerOption {
+	return func(t *CircuitBreakerTransport) {
+		t.openTimeout = timeout
+	}
+}
+
+// CircuitBreakerWithHalfOpenRequests sets the amount of successful probe requests
+// required to close the breaker again (defaults to 1)
+func CircuitBreakerWithHalfOpenRequests(n int) CircuitBreakerOption {
+	return func(t *CircuitBreakerTransport) {
+		t.halfOpenRequests = n
+	}
+}
+
+// CircuitBreakerWithClassifier replaces the function deciding whether a request failed.
+// The classifier receives either the error returned by the next round tripper
+// or the StatusCode of the response and returns true if it should count as failure.
+func CircuitBreakerWithClassifier(classify func(error) bool) CircuitBreakerOption {
+	return func(t *CircuitBreakerTransport) {
+		t.classify = classify
+	}
+}
+
+// CircuitBreakerWithLogger sets the logger used for state changes (defaults to the logging singleton)
+func CircuitBreakerWithLogger(logger *log.Logger) CircuitBreakerOption {
+	return func(t *CircuitBreakerTransport) {
+		t.logger = logger
+	}
+}
+
+// CircuitBreakerWithInitOptions changes the subsystem of the exported metrics
+func CircuitBreakerWithInitOptions(options ...prom.InitOption) CircuitBreakerOption {
+	return func(t *CircuitBreakerTransport) {
+		t.metrics = prom.NewCircuitBreakerInstrumenter(options...)
+	}
+}
+
+// DefaultCircuitBreakerClassifier counts transport errors and 5xx status codes as failures.
+// Requests canceled by the caller never reach the classifier, they count neither as failure nor as success.
+func DefaultCircuitBreakerClassifier(err error) bool {
+	var sc StatusCode
+	if errors.As(err, &sc) {
+		return sc >= http.StatusInternalServerError
+	}
+	return true
+}
+
+// CircuitBreaker stops sending requests to a downstream once the ratio of failed requests
+// within a rolling window exceeds a threshold. While open, requests fail fast with ErrCircuitOpen.
+// After the open timeout a limited amount of probe requests decides whether to close the breaker again.
+func CircuitBreaker(name string, options ...CircuitBreakerOption) TransportFunc {
+	return func(rt http.RoundTripper) http.RoundTripper {
+		if rt == nil {
+			rt = http.DefaultTransport
+		}
+
+		cb := &CircuitBreakerTransport{
+			name:             name,
+			failureRatio:     0.5,
+			minRequests:      20,
+			window:           60 * time.Second,
+			openTimeout:      30 * time.Second,
+			halfOpenRequests: 1,
+			classify:         DefaultCircuitBreakerClassifier,
+			state:            CircuitClosed,
+			rt:               rt,
+		}
+
+		for _, apply := range options {
+			apply(cb)
+		}
+
+		if cb.logger == nil {
+			cb.logger = logging.Logger()
+		}
+		if cb.metrics == nil {
+			cb.metrics = prom.NewCircuitBreakerInstrumenter()
+		}
+		cb.metrics.SetState(name, cb.state.String(), circuitBreakerStates...)
+
+		return cb
+	}
+}
@@ -0,0 +1,259 @@
+package transport_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/d4l-data4life/go-svc/pkg/log"
+	"github.com/d4l-data4life/go-svc/pkg/transport"
+)
+
+type StatusRoundTrip struct {
+	statusCode int
+	calls      int
+}
+
+func (s *StatusRoundTrip) RoundTrip(req *http.Request) (*http.Response, error) {
+	s.calls++
+	rec := httptest.NewRecorder()
+	rec.WriteHeader(s.statusCode)
+	return rec.Result(), nil
+}
+
+// ScriptedRoundTrip returns the outcomes in order, an outcome blocks until its release channel is closed
+type ScriptedRoundTrip struct {
+	outcomes chan scriptedOutcome
+}
+
+type scriptedOutcome struct {
+	statusCode int
+	err        error
+	release    chan struct{}
+}
+
+func (s *ScriptedRoundTrip) RoundTrip(req *http.Request) (*http.Response, error) {
+	o := <-s.outcomes
+	if o.release != nil {
+		<-o.release
+	}
+	if o.err != nil {
+		return nil, o.err
+	}
+	rec := httptest.NewRecorder()
+	rec.WriteHeader(o.statusCode)
+	return rec.Result(), nil
+}
+
+func newCircuitBreaker(t *testing.T, name string, rt http.RoundTripper, options ...transport.CircuitBreakerOption) *transport.CircuitBreakerTransport {
+	t.Helper()
+
+	options = append([]transport.CircuitBreakerOption{
+		transport.CircuitBreakerWithLogger(log.NewLogger("test", "v0", "localhost", log.WithWriter(io.Discard))),
+		transport.CircuitBreakerWithMinRequests(4),
+		transport.CircuitBreakerWithFailureRatio(0.5),
+		transport.CircuitBreakerWithOpenTimeout(50 * time.Millisecond),
+	}, options...)
+
+	return transport.CircuitBreaker(name, options...)(rt).(*transport.CircuitBreakerTransport)
+}
+
+func sendRequests(t *testing.T, rt http.RoundTripper, n int) error {
+	t.Helper()
+
+	var lastErr error
+	for i := 0; i < n; i++ {
+		req, err := http.NewRequest(http.MethodGet, "", nil)
+		if err != nil {
+			t.Fatalf("error creating http request: %v", err)
+		}
+		res, err := rt.RoundTrip(req)
+		if res != nil {
+			res.Body.Close()
+		}
+		lastErr = err
+	}
+	return lastErr
+}
+
+func TestCircuitBreakerTransport(t *testing.T) {
+	t.Run("stays closed on success", func(t *testing.T) {
+		downstream := &StatusRoundTrip{statusCode: http.StatusOK}
+		cb := newCircuitBreaker(t, "cb-success", downstream)
+
+		if err := sendRequests(t, cb, 10); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if cb.State() != transport.CircuitClosed {
+			t.Fatalf("expected closed breaker, got %s", cb.State())
+		}
+		if downstream.calls != 10 {
+			t.Fatalf("expected 10 downstream calls, got %d", downstream.calls)
+		}
+	})
+
+	t.Run("opens on failure ratio and fails fast", func(t *testing.T) {
+		downstream := &StatusRoundTrip{statusCode: http.StatusServiceUnavailable}
+		cb := newCircuitBreaker(t, "cb-open", downstream)
+
+		_ = sendRequests(t, cb, 4)
+		if cb.State() != transport.CircuitOpen {
+			t.Fatalf("expected open breaker, got %s", cb.State())
+		}
+
+		err := sendRequests(t, cb, 3)
+		if !errors.Is(err, transport.ErrCircuitOpen) {
+			t.Fatalf("expected ErrCircuitOpen, got %v", err)
+		}
+		if downstream.calls != 4 {
+			t.Fatalf("expected 4 downstream calls, got %d", downstream.calls)
+		}
+	})
+
+	t.Run("closes after successful probe", func(t *testing.T) {
+		downstream := &StatusRoundTrip{statusCode: http.StatusInternalServerError}
+		cb := newCircuitBreaker(t, "cb-recover", downstream)
+
+		_ = sendRequests(t, cb, 4)
+		if cb.State() != transport.CircuitOpen {
+			t.Fatalf("expected open breaker, got %s", cb.State())
+		}
+
+		time.Sleep(60 * time.Millisecond)
+		if cb.State() != transport.CircuitHalfOpen {
+			t.Fatalf("expected half-open breaker, got %s", cb.State())
+		}
+
+		downstream.statusCode = http.StatusOK
+		if err := sendRequests(t, cb, 1); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if cb.State() != transport.CircuitClosed {
+			t.Fatalf("expected closed breaker, got %s", cb.State())
+		}
+	})
+
+	t.Run("reopens after failed probe", func(t *testing.T) {
+		downstream := &StatusRoundTrip{statusCode: http.StatusBadGateway}
+		cb := newCircuitBreaker(t, "cb-reopen", downstream)
+
+		_ = sendRequests(t, cb, 4)
+		time.Sleep(60 * time.Millisecond)
+
+		_ = sendRequests(t, cb, 1)
+		if cb.State() != transport.CircuitOpen {
+			t.Fatalf("expected open breaker, got %s", cb.State())
+		}
+		if downstream.calls != 5 {
+			t.Fatalf("expected 5 downstream calls, got %d", downstream.calls)
+		}
+	})
+
+	t.Run("custom classifier", func(t *testing.T) {
+		downstream := &StatusRoundTrip{statusCode: http.StatusTooManyRequests}
+		cb := newCircuitBreaker(t, "cb-classifier", downstream,
+			transport.CircuitBreakerWithClassifier(func(err error) bool {
+				var sc transport.StatusCode
+				return errors.As(err, &sc) && sc == http.StatusTooManyRequests
+			}),
+		)
+
+		_ = sendRequests(t, cb, 4)
+		if cb.State() != transport.CircuitOpen {
+			t.Fatalf("expected open breaker, got %s", cb.State())
+		}
+	})
+
+	t.Run("client errors do not open the breaker", func(t *testing.T) {
+		downstream := &StatusRoundTrip{statusCode: http.StatusNotFound}
+		cb := newCircuitBreaker(t, "cb-4xx", downstream)
+
+		_ = sendRequests(t, cb, 10)
+		if cb.State() != transport.CircuitClosed {
+			t.Fatalf("expected closed breaker, got %s", cb.State())
+		}
+	})
+
+	t.Run("canceled probe neither closes nor blocks the breaker", func(t *testing.T) {
+		downstream := &ScriptedRoundTrip{outcomes: make(chan scriptedOutcome, 6)}
+		cb := newCircuitBreaker(t, "cb-canceled", downstream)
+
+		for i := 0; i < 4; i++ {
+			downstream.outcomes <- scriptedOutcome{statusCode: http.StatusServiceUnavailable}
+		}
+		_ = sendRequests(t, cb, 4)
+		time.Sleep(60 * time.Millisecond)
+
+		downstream.outcomes <- scriptedOutcome{err: context.Canceled}
+		if err := sendRequests(t, cb, 1); !errors.Is(err, context.Canceled) {
+			t.Fatalf("expected canceled error, got %v", err)
+		}
+		if cb.State() != transport.CircuitHalfOpen {
+			t.Fatalf("expected half-open breaker, got %s", cb.State())
+		}
+
+		downstream.outcomes <- scriptedOutcome{statusCode: http.StatusOK}
+		if err := sendRequests(t, cb, 1); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if cb.State() != transport.CircuitClosed {
+			t.Fatalf("expected closed breaker, got %s", cb.State())
+		}
+	})
+
+	t.Run("ignores probes of an earlier half-open period", func(t *testing.T) {
+		downstream := &ScriptedRoundTrip{outcomes: make(chan scriptedOutcome, 8)}
+		cb := newCircuitBreaker(t, "cb-generation", downstream, transport.CircuitBreakerWithHalfOpenRequests(2))
+
+		for i := 0; i < 4; i++ {
+			downstream.outcomes <- scriptedOutcome{statusCode: http.StatusServiceUnavailable}
+		}
+		_ = sendRequests(t, cb, 4)
+		time.Sleep(60 * time.Millisecond)
+
+		// the first probe hangs while the second one fails and reopens the breaker
+		release := make(chan struct{})
+		downstream.outcomes <- scriptedOutcome{statusCode: http.StatusOK, release: release}
+		stale := make(chan error)
+		go func() { stale <- sendRequests(t, cb, 1) }()
+		for len(downstream.outcomes) > 0 {
+			time.Sleep(time.Millisecond)
+		}
+		downstream.outcomes <- scriptedOutcome{statusCode: http.StatusServiceUnavailable}
+		_ = sendRequests(t, cb, 1)
+		if cb.State() != transport.CircuitOpen {
+			t.Fatalf("expected open breaker, got %s", cb.State())
+		}
+
+		// the stale probe succeeds while a probe of the next half-open period is in flight
+		time.Sleep(60 * time.Millisecond)
+		next := make(chan struct{})
+		downstream.outcomes <- scriptedOutcome{statusCode: http.StatusOK, release: next}
+		current := make(chan error)
+		go func() { current <- sendRequests(t, cb, 1) }()
+		for len(downstream.outcomes) > 0 {
+			time.Sleep(time.Millisecond)
+		}
+		close(release)
+		if err := <-stale; err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		downstream.outcomes <- scriptedOutcome{statusCode: http.StatusOK}
+		_ = sendRequests(t, cb, 1)
+		if cb.State() != transport.CircuitHalfOpen {
+			t.Fatalf("expected half-open breaker after one of two probes, got %s", cb.State())
+		}
+		close(next)
+		if err := <-current; err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if cb.State() != transport.CircuitClosed {
+			t.Fatalf("expected closed breaker, got %s", cb.State())
+		}
+	})
+}
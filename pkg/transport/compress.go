@@ -0,0 +1,135 @@
+package transport
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+
+	"github.com/d4l-data4life/go-svc/pkg/compression"
+)
+
+type CompressTransport struct {
+	rt       http.RoundTripper
+	encoding string
+	minSize  int64
+}
+
+func (t *CompressTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if t.encoding != "" && req.Body != nil && req.Body != http.NoBody &&
+		req.ContentLength >= t.minSize && req.Header.Get("Content-Encoding") == "" {
+		compressed, err := t.compress(req)
+		if err != nil {
+			return nil, err
+		}
+		req = compressed
+	}
+
+	// the accepted encodings are decoded here, so the default transport does not decode gzip on its own
+	if req.Header.Get("Accept-Encoding") == "" {
+		req = req.Clone(req.Context())
+		req.Header.Set("Accept-Encoding", "zstd, br, gzip")
+	}
+
+	res, err := t.rt.RoundTrip(req)
+	if err != nil || res == nil {
+		return res, err
+	}
+
+	encoding := res.Header.Get("Content-Encoding")
+	if !compression.Supported(encoding) || res.Body == nil || res.Body == http.NoBody {
+		return res, nil
+	}
+	decoder, err := compression.NewDecoder(encoding, res.Body)
+	if err != nil {
+		_ = res.Body.Close()
+		return nil, err
+	}
+	res.Body = &decodedBody{Reader: decoder, decoder: decoder, body: res.Body}
+	res.Header.Del("Content-Encoding")
+	res.Header.Del("Content-Length")
+	res.ContentLength = -1
+	res.Uncompressed = true
+
+	return res, nil
+}
+
+// compress returns a clone of the request with the encoded body, it can be rewound for retries and redirects
+func (t *CompressTransport) compress(req *http.Request) (*http.Request, error) {
+	var buf bytes.Buffer
+	encoder, err := compression.NewEncoder(t.encoding, &buf)
+	if err != nil {
+		return nil, err
+	}
+	_, err = io.Copy(encoder, req.Body)
+	_ = req.Body.Close()
+	if err != nil {
+		_ = encoder.Close()
+		return nil, err
+	}
+	if err := encoder.Close(); err != nil {
+		return nil, err
+	}
+
+	encoded := buf.Bytes()
+	out := req.Clone(req.Context())
+	out.Body = io.NopCloser(bytes.NewReader(encoded))
+	out.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(encoded)), nil
+	}
+	out.ContentLength = int64(len(encoded))
+	out.Header.Set("Content-Encoding", t.encoding)
+	out.Header.Del("Content-Length")
+
+	return out, nil
+}
+
+// decodedBody closes the decoder and the encoded body
+type decodedBody struct {
+	io.Reader
+	decoder io.Closer
+	body    io.Closer
+}
+
+func (b *decodedBody) Close() error {
+	_ = b.decoder.Close()
+	return b.body.Close()
+}
+
+// CompressOption is to be implemented by functional options
+type CompressOption func(*CompressTransport)
+
+// CompressWithEncoding sets the content coding of request bodies (defaults to gzip), "" sends them uncompressed
+func CompressWithEncoding(encoding string) CompressOption {
+	return func(t *CompressTransport) {
+		t.encoding = encoding
+	}
+}
+
+// CompressWithMinSize sets the Content-Length from which request bodies are compressed (defaults to 1 KiB)
+func CompressWithMinSize(size int64) CompressOption {
+	return func(t *CompressTransport) {
+		t.minSize = size
+	}
+}
+
+// Compress compresses request bodies of known length above the minimum size and transparently decodes
+// gzip, zstd and br encoded responses. Transports in front of Compress in the chain see the uncompressed
+// request and the decoded response, transports behind it the encoded bodies.
+func Compress(options ...CompressOption) TransportFunc {
+	return func(rt http.RoundTripper) http.RoundTripper {
+		if rt == nil {
+			rt = http.DefaultTransport
+		}
+
+		t := &CompressTransport{
+			rt:       rt,
+			encoding: compression.Gzip,
+			minSize:  1 << 10,
+		}
+		for _, apply := range options {
+			apply(t)
+		}
+
+		return t
+	}
+}
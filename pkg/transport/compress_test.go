@@ -0,0 +1,163 @@
+package transport_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/d4l-data4life/go-svc/pkg/compression"
+	"github.com/d4l-data4life/go-svc/pkg/log"
+	"github.com/d4l-data4life/go-svc/pkg/transport"
+)
+
+// compressingServer decodes the request body and answers with it encoded in the first accepted encoding
+func compressingServer(t *testing.T, received *string, requestEncoding *string) *httptest.Server {
+	t.Helper()
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		*requestEncoding = req.Header.Get("Content-Encoding")
+		body := io.Reader(req.Body)
+		if *requestEncoding != "" {
+			decoder, err := compression.NewDecoder(*requestEncoding, req.Body)
+			if err != nil {
+				t.Errorf("decoding request: %v", err)
+				return
+			}
+			defer decoder.Close()
+			body = decoder
+		}
+		data, _ := io.ReadAll(body)
+		*received = string(data)
+
+		encoding := compression.Negotiate(req.Header.Get("Accept-Encoding"), compression.Encodings())
+		w.Header().Set("Content-Type", "text/plain")
+		if encoding == "" {
+			_, _ = w.Write(data)
+			return
+		}
+		w.Header().Set("Content-Encoding", encoding)
+		encoder, _ := compression.NewEncoder(encoding, w)
+		_, _ = encoder.Write(data)
+		_ = encoder.Close()
+	}))
+}
+
+func TestCompressTransport(t *testing.T) {
+	t.Parallel()
+
+	var received, requestEncoding string
+	srv := compressingServer(t, &received, &requestEncoding)
+	defer srv.Close()
+
+	for _, tc := range [...]struct {
+		name         string
+		body         string
+		options      []transport.CompressOption
+		wantEncoding string
+	}{
+		{name: "small body", body: "small", wantEncoding: ""},
+		{name: "large body", body: strings.Repeat("large ", 500), wantEncoding: compression.Gzip},
+		{
+			name:         "configured encoding",
+			body:         strings.Repeat("large ", 500),
+			options:      []transport.CompressOption{transport.CompressWithEncoding(compression.Zstd)},
+			wantEncoding: compression.Zstd,
+		},
+		{
+			name:         "compression disabled",
+			body:         strings.Repeat("large ", 500),
+			options:      []transport.CompressOption{transport.CompressWithEncoding("")},
+			wantEncoding: "",
+		},
+	} {
+		client := &http.Client{Transport: transport.Compress(tc.options...)(nil)}
+
+		res, err := client.Post(srv.URL, "text/plain", strings.NewReader(tc.body))
+		if err != nil {
+			t.Fatalf("%s: request failed: %v", tc.name, err)
+		}
+		body, err := io.ReadAll(res.Body)
+		_ = res.Body.Close()
+		if err != nil {
+			t.Fatalf("%s: reading response: %v", tc.name, err)
+		}
+
+		if requestEncoding != tc.wantEncoding {
+			t.Errorf("%s: request Content-Encoding = %q, want %q", tc.name, requestEncoding, tc.wantEncoding)
+		}
+		if received != tc.body {
+			t.Errorf("%s: server received %d bytes, want %d", tc.name, len(received), len(tc.body))
+		}
+		if string(body) != tc.body {
+			t.Errorf("%s: response body has %d bytes, want %d", tc.name, len(body), len(tc.body))
+		}
+		if ce := res.Header.Get("Content-Encoding"); ce != "" {
+			t.Errorf("%s: response Content-Encoding = %q, want it removed", tc.name, ce)
+		}
+		if !res.Uncompressed {
+			t.Errorf("%s: response is not marked as uncompressed", tc.name)
+		}
+	}
+}
+
+func TestCompressTransportKeepsAcceptEncoding(t *testing.T) {
+	t.Parallel()
+
+	var received, requestEncoding string
+	srv := compressingServer(t, &received, &requestEncoding)
+	defer srv.Close()
+
+	req, err := http.NewRequest(http.MethodGet, srv.URL, nil)
+	if err != nil {
+		t.Fatalf("error creating http request: %v", err)
+	}
+	req.Header.Set("Accept-Encoding", "identity")
+
+	res, err := transport.Compress()(nil).RoundTrip(req)
+	if err != nil {
+		t.Fatalf("round trip failed: %v", err)
+	}
+	defer res.Body.Close()
+	if res.Uncompressed {
+		t.Errorf("identity response was decoded")
+	}
+}
+
+func TestCompressTransportLogsDecodedBodies(t *testing.T) {
+	t.Parallel()
+
+	var received, requestEncoding string
+	srv := compressingServer(t, &received, &requestEncoding)
+	defer srv.Close()
+
+	// the log transport behind Compress sees the encoded bodies and decodes them for logging
+	buf := new(bytes.Buffer)
+	logger := log.NewLogger("test", "v0", "localhost", log.WithWriter(buf))
+	client := &http.Client{Transport: transport.Chain(transport.Compress(), transport.Log(logger))(nil)}
+
+	body := strings.Repeat("logged ", 500)
+	res, err := client.Post(srv.URL, "text/plain", strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	_, _ = io.Copy(io.Discard, res.Body)
+	_ = res.Body.Close()
+
+	logs := json.NewDecoder(buf)
+	var requestLog, responseLog map[string]any
+	if err := logs.Decode(&requestLog); err != nil {
+		t.Fatalf("unmarshaling the request log: %v", err)
+	}
+	if err := logs.Decode(&responseLog); err != nil {
+		t.Fatalf("unmarshaling the response log: %v", err)
+	}
+	if requestLog["req-body"] != body {
+		t.Errorf("req-body = %.40q..., want the decoded body", requestLog["req-body"])
+	}
+	if responseLog["response-body"] != body {
+		t.Errorf("response-body = %.40q..., want the decoded body", responseLog["response-body"])
+	}
+}
@@ -0,0 +1,62 @@
+package transport
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/d4l-data4life/go-svc/pkg/fault"
+)
+
+type FaultInjectorTransport struct {
+	injector *fault.Injector
+	rt       http.RoundTripper
+}
+
+func (t *FaultInjectorTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	rule, ok := t.injector.Match(fault.Client, req, req.URL.Host)
+	if !ok {
+		return t.rt.RoundTrip(req)
+	}
+
+	if err := fault.Delay(req.Context(), rule); err != nil {
+		return nil, err
+	}
+
+	if rule.Error {
+		return nil, fmt.Errorf("%w: %s", fault.ErrInjectedFault, rule.Name)
+	}
+
+	if rule.StatusCode != 0 {
+		body := fmt.Sprintf("fault injected by rule %s", rule.Name)
+		return &http.Response{
+			Status:        fmt.Sprintf("%d %s", rule.StatusCode, http.StatusText(rule.StatusCode)),
+			StatusCode:    rule.StatusCode,
+			Proto:         "HTTP/1.1",
+			ProtoMajor:    1,
+			ProtoMinor:    1,
+			Header:        http.Header{"Content-Type": []string{"text/plain; charset=utf-8"}},
+			Body:          io.NopCloser(bytes.NewBufferString(body)),
+			ContentLength: int64(len(body)),
+			Request:       req,
+		}, nil
+	}
+
+	return t.rt.RoundTrip(req)
+}
+
+// FaultInjector injects latency, connection errors or status codes into outgoing http requests
+// matching the rules of the injector. The rules can be changed at runtime with injector.Handler().
+func FaultInjector(injector *fault.Injector) TransportFunc {
+	return func(rt http.RoundTripper) http.RoundTripper {
+		if rt == nil {
+			rt = http.DefaultTransport
+		}
+
+		return &FaultInjectorTransport{
+			injector: injector,
+			rt:       rt,
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package transport_test
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/d4l-data4life/go-svc/pkg/fault"
+	"github.com/d4l-data4life/go-svc/pkg/log"
+	"github.com/d4l-data4life/go-svc/pkg/transport"
+)
+
+func TestFaultInjectorTransport(t *testing.T) {
+	injector := fault.NewInjector(fault.WithLogger(log.NewLogger("test", "v0", "localhost", log.WithWriter(io.Discard))))
+
+	tests := []struct {
+		name       string
+		rule       fault.Rule
+		wantErr    error
+		wantStatus int
+		wantCalls  int
+	}{
+		{"no fault", fault.Rule{Name: "other-host", Host: "other.org", Percentage: 100, Error: true}, nil, http.StatusOK, 1},
+		{"connection error", fault.Rule{Name: "error", Percentage: 100, Error: true}, fault.ErrInjectedFault, 0, 0},
+		{"status code", fault.Rule{Name: "status", Percentage: 100, StatusCode: http.StatusServiceUnavailable}, nil, http.StatusServiceUnavailable, 0},
+		{"latency", fault.Rule{Name: "latency", Percentage: 100, Latency: fault.Duration(20 * time.Millisecond)}, nil, http.StatusOK, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := injector.SetRules(tt.rule); err != nil {
+				t.Fatalf("setting rules: %v", err)
+			}
+			downstream := &StatusRoundTrip{statusCode: http.StatusOK}
+			rt := transport.FaultInjector(injector)(downstream)
+
+			req, err := http.NewRequest(http.MethodGet, "http://example.org/api", nil)
+			if err != nil {
+				t.Fatalf("error creating http request: %v", err)
+			}
+
+			start := time.Now()
+			res, err := rt.RoundTrip(req)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("expected error %v, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("round trip failed: %v", err)
+			}
+			res.Body.Close()
+
+			if res.StatusCode != tt.wantStatus {
+				t.Fatalf("expected status %d, got %d", tt.wantStatus, res.StatusCode)
+			}
+			if downstream.calls != tt.wantCalls {
+				t.Fatalf("expected %d downstream calls, got %d", tt.wantCalls, downstream.calls)
+			}
+			if elapsed := time.Since(start); elapsed < time.Duration(tt.rule.Latency) {
+				t.Fatalf("expected latency of %v, took %v", time.Duration(tt.rule.Latency), elapsed)
+			}
+		})
+	}
+}
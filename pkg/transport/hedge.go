@@ -0,0 +1,251 @@
+package transport
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/d4l-data4life/go-svc/pkg/prom"
+)
+
+const defaultHedgeName = "default"
+
+// hedgeDelayRefresh is how often the learned delay is recomputed from the duration histogram
+const hedgeDelayRefresh = time.Second
+
+type hedgeResult struct {
+	res     *http.Response
+	err     error
+	attempt int
+	cancel  context.CancelFunc
+}
+
+// succeeded tells whether the result may be returned while other attempts are still running
+func (r hedgeResult) succeeded() bool {
+	return r.err == nil && r.res.StatusCode < http.StatusInternalServerError
+}
+
+// discard cancels the attempt and drains its response
+func (r hedgeResult) discard() {
+	drainBody(r.res)
+	r.cancel()
+}
+
+type HedgeTransport struct {
+	name      string
+	delay     time.Duration
+	maxHedges int
+	quantile  float64
+	durations *prom.RoundTripperInstrumenter
+	metrics   *prom.HedgeInstrumenter
+
+	// the learned delay is cached, computing it walks all series of the duration histogram
+	learnedDelay atomic.Int64
+	learnedAt    atomic.Int64
+	learning     atomic.Bool
+
+	rt http.RoundTripper
+}
+
+func (t *HedgeTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if t.maxHedges <= 0 || !safeRequest(req) {
+		return t.rt.RoundTrip(req)
+	}
+
+	getBody, err := replayableBody(req)
+	if err != nil {
+		return nil, err
+	}
+
+	delay := t.hedgeDelay()
+	results := make(chan hedgeResult, t.maxHedges+1)
+	cancels := make([]context.CancelFunc, 0, t.maxHedges+1)
+	launch := func(attempt int) {
+		ctx, cancel := context.WithCancel(req.Context())
+		cancels = append(cancels, cancel)
+		attemptReq := req.Clone(ctx)
+		if getBody != nil {
+			body, err := getBody()
+			if err != nil {
+				results <- hedgeResult{err: err, attempt: attempt, cancel: cancel}
+				return
+			}
+			attemptReq.Body = body
+		}
+		go func() {
+			res, err := t.rt.RoundTrip(attemptReq)
+			results <- hedgeResult{res: res, err: err, attempt: attempt, cancel: cancel}
+		}()
+	}
+
+	launch(0)
+	launched, inFlight := 1, 1
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	var last hedgeResult
+	for {
+		select {
+		case <-timer.C:
+			if launched <= t.maxHedges {
+				t.metrics.Hedge(t.name)
+				launch(launched)
+				launched++
+				inFlight++
+				timer.Reset(delay)
+			}
+		case result := <-results:
+			inFlight--
+			// failures are only returned once no other attempt is in flight, hedging does not turn into retrying
+			if result.succeeded() || inFlight == 0 {
+				if last.cancel != nil {
+					last.discard()
+				}
+				return t.win(result, results, inFlight, cancels)
+			}
+			if last.cancel != nil {
+				last.discard()
+			}
+			last = result
+		}
+	}
+}
+
+// win returns the result, cancels all other attempts and drains the responses still in flight
+func (t *HedgeTransport) win(
+	result hedgeResult, results <-chan hedgeResult, inFlight int, cancels []context.CancelFunc,
+) (*http.Response, error) {
+	if result.attempt > 0 && result.succeeded() {
+		t.metrics.Win(t.name)
+	}
+
+	for attempt, cancel := range cancels {
+		if attempt != result.attempt {
+			cancel()
+		}
+	}
+	if inFlight > 0 {
+		go func() {
+			for ; inFlight > 0; inFlight-- {
+				(<-results).discard()
+			}
+		}()
+	}
+
+	if result.err != nil {
+		result.cancel()
+		return nil, result.err
+	}
+	if result.res.Body == nil {
+		result.cancel()
+		return result.res, nil
+	}
+
+	// the context of the winning attempt lives until its body is closed
+	result.res.Body = &cancelingBody{ReadCloser: result.res.Body, cancel: result.cancel}
+	return result.res, nil
+}
+
+// hedgeDelay returns the learned quantile of the request durations or the configured delay if nothing was learned yet.
+// The quantile is recomputed at most once per hedgeDelayRefresh by a single caller, the others use the cached one.
+func (t *HedgeTransport) hedgeDelay() time.Duration {
+	if t.durations == nil {
+		return t.delay
+	}
+
+	now := time.Now().UnixNano()
+	if now-t.learnedAt.Load() >= int64(hedgeDelayRefresh) && t.learning.CompareAndSwap(false, true) {
+		d, ok := t.durations.DurationQuantile(t.name, t.quantile)
+		if !ok {
+			d = 0
+		}
+		t.learnedDelay.Store(int64(d))
+		t.learnedAt.Store(now)
+		t.learning.Store(false)
+	}
+
+	if d := time.Duration(t.learnedDelay.Load()); d > 0 {
+		return d
+	}
+	return t.delay
+}
+
+// safeRequest tells whether duplicates of the request do not change any state on the server
+func safeRequest(req *http.Request) bool {
+	switch req.Method {
+	case "", http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		return true
+	}
+	return false
+}
+
+// cancelingBody cancels the context of its request exactly once when the body is closed
+type cancelingBody struct {
+	io.ReadCloser
+	once   sync.Once
+	cancel context.CancelFunc
+}
+
+func (b *cancelingBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(b.cancel)
+	return err
+}
+
+// HedgeOption is to be implemented by functional options
+type HedgeOption func(*HedgeTransport)
+
+// HedgeWithName sets the target name used for the metrics and for learning the delay (defaults to "default")
+func HedgeWithName(name string) HedgeOption {
+	return func(t *HedgeTransport) {
+		t.name = name
+	}
+}
+
+// HedgeWithQuantile derives the hedging delay from the given quantile (e.g. 0.95) of the durations
+// recorded by the Prometheus transport with the same name. The fixed delay is used until requests were recorded.
+func HedgeWithQuantile(q float64, options ...prom.InitOption) HedgeOption {
+	return func(t *HedgeTransport) {
+		t.quantile = q
+		t.durations = prom.NewRoundTripperInstrumenter(options...)
+	}
+}
+
+// HedgeWithInitOptions changes the subsystem of the exported metrics
+func HedgeWithInitOptions(options ...prom.InitOption) HedgeOption {
+	return func(t *HedgeTransport) {
+		t.metrics = prom.NewHedgeInstrumenter(options...)
+	}
+}
+
+// Hedge sends up to maxHedges duplicates of safe requests (GET, HEAD, OPTIONS, TRACE), one after every delay
+// the request is still unanswered. The first successful response wins, all other attempts are canceled
+// and drained. Responses with 5xx status codes and errors are only returned once no other attempt is in flight.
+func Hedge(delay time.Duration, maxHedges int, options ...HedgeOption) TransportFunc {
+	return func(rt http.RoundTripper) http.RoundTripper {
+		if rt == nil {
+			rt = http.DefaultTransport
+		}
+
+		h := &HedgeTransport{
+			name:      defaultHedgeName,
+			delay:     delay,
+			maxHedges: maxHedges,
+			rt:        rt,
+		}
+
+		for _, apply := range options {
+			apply(h)
+		}
+
+		if h.metrics == nil {
+			h.metrics = prom.NewHedgeInstrumenter()
+		}
+
+		return h
+	}
+}
@@ -0,0 +1,211 @@
+package transport_test
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/d4l-data4life/go-svc/pkg/transport"
+)
+
+// SlowFirstRoundTrip answers the first request after slow and all others immediately.
+// It records the requests canceled before they were answered.
+type SlowFirstRoundTrip struct {
+	slow     time.Duration
+	calls    atomic.Int32
+	canceled atomic.Int32
+}
+
+func (s *SlowFirstRoundTrip) RoundTrip(req *http.Request) (*http.Response, error) {
+	call := s.calls.Add(1)
+	if call == 1 {
+		select {
+		case <-time.After(s.slow):
+		case <-req.Context().Done():
+			s.canceled.Add(1)
+			return nil, req.Context().Err()
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	rec.WriteString("attempt-" + string(rune('0'+call)))
+	return rec.Result(), nil
+}
+
+// SlowOddRoundTrip answers every odd request after slow and all others immediately,
+// so every request through a Hedge transport with one hedge is won by its hedge.
+type SlowOddRoundTrip struct {
+	slow  time.Duration
+	calls atomic.Int32
+}
+
+func (s *SlowOddRoundTrip) RoundTrip(req *http.Request) (*http.Response, error) {
+	if s.calls.Add(1)%2 == 1 {
+		select {
+		case <-time.After(s.slow):
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		}
+	}
+	return httptest.NewRecorder().Result(), nil
+}
+
+func TestHedgeTransport(t *testing.T) {
+	newRequest := func(t *testing.T, method string) *http.Request {
+		t.Helper()
+		req, err := http.NewRequestWithContext(context.Background(), method, "http://example.org", nil)
+		if err != nil {
+			t.Fatalf("error creating http request: %v", err)
+		}
+		return req
+	}
+
+	t.Run("hedge wins over slow request", func(t *testing.T) {
+		downstream := &SlowFirstRoundTrip{slow: time.Second}
+		rt := transport.Hedge(10*time.Millisecond, 1, transport.HedgeWithName("hedge-wins"))(downstream)
+
+		start := time.Now()
+		res, err := rt.RoundTrip(newRequest(t, http.MethodGet))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		body, _ := io.ReadAll(res.Body)
+		res.Body.Close()
+
+		if string(body) != "attempt-2" {
+			t.Fatalf("expected the hedged response, got %q", body)
+		}
+		if time.Since(start) > 500*time.Millisecond {
+			t.Fatalf("hedged request did not short-cut the slow request")
+		}
+
+		deadline := time.Now().Add(time.Second)
+		for downstream.canceled.Load() != 1 && time.Now().Before(deadline) {
+			time.Sleep(5 * time.Millisecond)
+		}
+		if downstream.canceled.Load() != 1 {
+			t.Fatalf("expected the slow request to be canceled")
+		}
+	})
+
+	t.Run("fast request is not hedged", func(t *testing.T) {
+		downstream := &SlowFirstRoundTrip{}
+		rt := transport.Hedge(100*time.Millisecond, 2)(downstream)
+
+		res, err := rt.RoundTrip(newRequest(t, http.MethodGet))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		res.Body.Close()
+
+		if calls := downstream.calls.Load(); calls != 1 {
+			t.Fatalf("expected 1 call, got %d", calls)
+		}
+	})
+
+	t.Run("unsafe methods are not hedged", func(t *testing.T) {
+		downstream := &SlowFirstRoundTrip{slow: 50 * time.Millisecond}
+		rt := transport.Hedge(time.Millisecond, 2)(downstream)
+
+		req := newRequest(t, http.MethodPost)
+		req.Body = io.NopCloser(strings.NewReader("payload"))
+		res, err := rt.RoundTrip(req)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		res.Body.Close()
+
+		if calls := downstream.calls.Load(); calls != 1 {
+			t.Fatalf("expected 1 call, got %d", calls)
+		}
+	})
+
+	t.Run("failure is returned when no attempt is left", func(t *testing.T) {
+		downstream := &StatusRoundTrip{statusCode: http.StatusServiceUnavailable}
+		rt := transport.Hedge(100*time.Millisecond, 2)(downstream)
+
+		res, err := rt.RoundTrip(newRequest(t, http.MethodGet))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		res.Body.Close()
+
+		if res.StatusCode != http.StatusServiceUnavailable {
+			t.Fatalf("expected status %d, got %d", http.StatusServiceUnavailable, res.StatusCode)
+		}
+	})
+	t.Run("delay is learned from recorded durations", func(t *testing.T) {
+		recorded := transport.Prometheus("hedge-learned")(&SlowFirstRoundTrip{})
+		for i := 0; i < 10; i++ {
+			res, err := recorded.RoundTrip(newRequest(t, http.MethodGet))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			res.Body.Close()
+		}
+
+		downstream := &SlowFirstRoundTrip{slow: time.Second}
+		rt := transport.Hedge(time.Hour, 1,
+			transport.HedgeWithName("hedge-learned"),
+			transport.HedgeWithQuantile(0.9),
+		)(downstream)
+
+		start := time.Now()
+		res, err := rt.RoundTrip(newRequest(t, http.MethodGet))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		res.Body.Close()
+
+		if time.Since(start) > 500*time.Millisecond {
+			t.Fatalf("expected the hedge to be sent after the learned delay")
+		}
+	})
+
+	t.Run("learned delay is refreshed periodically", func(t *testing.T) {
+		// the durations are recorded in the global registry, a fresh name keeps repeated runs independent
+		name := fmt.Sprintf("hedge-refresh-%d", time.Now().UnixNano())
+		downstream := &SlowOddRoundTrip{slow: 2 * time.Second}
+		rt := transport.Hedge(600*time.Millisecond, 1,
+			transport.HedgeWithName(name),
+			transport.HedgeWithQuantile(0.9),
+		)(downstream)
+		hedged := func() time.Duration {
+			start := time.Now()
+			res, err := rt.RoundTrip(newRequest(t, http.MethodGet))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			res.Body.Close()
+			return time.Since(start)
+		}
+		record := func() {
+			recorded := transport.Prometheus(name)(&SlowFirstRoundTrip{})
+			for i := 0; i < 10; i++ {
+				res, err := recorded.RoundTrip(newRequest(t, http.MethodGet))
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				res.Body.Close()
+			}
+		}
+
+		if d := hedged(); d < 500*time.Millisecond {
+			t.Fatalf("expected the fixed delay before anything was recorded, hedged after %v", d)
+		}
+		record()
+		if d := hedged(); d < 500*time.Millisecond {
+			t.Fatalf("expected the cached delay until the next refresh, hedged after %v", d)
+		}
+		time.Sleep(time.Second)
+		if d := hedged(); d > 400*time.Millisecond {
+			t.Fatalf("expected the learned delay after the refresh, hedged after %v", d)
+		}
+	})
+}
@@ -0,0 +1,111 @@
+package transport
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/d4l-data4life/go-svc/pkg/httpsig"
+)
+
+// ErrHMACKeyMissing happens when the signing key or its ID is missing.
+var ErrHMACKeyMissing = errors.New("no hmac signing key provided")
+
+type HMACSignTransport struct {
+	keyID   string
+	key     []byte
+	headers []string
+
+	rt http.RoundTripper
+}
+
+func (t *HMACSignTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if t.keyID == "" || len(t.key) == 0 {
+		return nil, ErrHMACKeyMissing
+	}
+
+	getBody, err := replayableBody(req)
+	if err != nil {
+		return nil, err
+	}
+	var body []byte
+	if getBody != nil {
+		if body, err = readBody(getBody); err != nil {
+			return nil, fmt.Errorf("reading request body for signing: %w", err)
+		}
+	}
+
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("creating signature nonce: %w", err)
+	}
+
+	r := req.Clone(req.Context())
+	if getBody != nil {
+		if r.Body, err = getBody(); err != nil {
+			return nil, err
+		}
+		r.GetBody = getBody
+	}
+
+	params := httpsig.Params{
+		KeyID:     t.keyID,
+		Timestamp: time.Now(),
+		Nonce:     hex.EncodeToString(nonce),
+		Headers:   t.headers,
+	}
+	digest := httpsig.Digest(body)
+	params.Signature = httpsig.Sign(t.key, r, params, digest)
+
+	r.Header.Set(httpsig.DigestHeader, digest)
+	r.Header.Set(httpsig.SignatureHeader, params.String())
+
+	return t.rt.RoundTrip(r)
+}
+
+func readBody(getBody func() (io.ReadCloser, error)) ([]byte, error) {
+	body, err := getBody()
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+	return io.ReadAll(body)
+}
+
+// HMACSignOption is to be implemented by functional options
+type HMACSignOption func(*HMACSignTransport)
+
+// HMACSignWithHeaders sets the signed headers (defaults to httpsig.DefaultHeaders)
+func HMACSignWithHeaders(headers ...string) HMACSignOption {
+	return func(t *HMACSignTransport) {
+		t.headers = headers
+	}
+}
+
+// HMACSign signs outgoing requests with the key instead of sending a reusable secret.
+// The signature covers the method, path, selected headers, a timestamp, a nonce and a digest of the body,
+// it is validated by middlewares.HMACVerify with the key of the same key ID.
+func HMACSign(keyID, key string, options ...HMACSignOption) TransportFunc {
+	return func(rt http.RoundTripper) http.RoundTripper {
+		if rt == nil {
+			rt = http.DefaultTransport
+		}
+
+		t := &HMACSignTransport{
+			keyID:   keyID,
+			key:     []byte(key),
+			headers: httpsig.DefaultHeaders,
+			rt:      rt,
+		}
+
+		for _, apply := range options {
+			apply(t)
+		}
+
+		return t
+	}
+}
@@ -0,0 +1,80 @@
+package transport_test
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/d4l-data4life/go-svc/pkg/httpsig"
+	"github.com/d4l-data4life/go-svc/pkg/transport"
+)
+
+// capturingTransport keeps the last request and its body
+type capturingTransport struct {
+	req  *http.Request
+	body string
+}
+
+func (t *capturingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.req = req
+	body, _ := io.ReadAll(req.Body)
+	t.body = string(body)
+	return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody}, nil
+}
+
+func TestHMACSign(t *testing.T) {
+	t.Parallel()
+
+	capture := &capturingTransport{}
+	rt := transport.HMACSign("svc-a", "signing-key")(capture)
+
+	req, err := http.NewRequest(http.MethodPost, "http://records.local/records?owner=1", strings.NewReader(`{"a":1}`))
+	if err != nil {
+		t.Fatalf("error creating http request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	if _, err := rt.RoundTrip(req); err != nil {
+		t.Fatalf("round trip failed: %v", err)
+	}
+
+	if req.Header.Get(httpsig.SignatureHeader) != "" {
+		t.Fatalf("the original request must not be modified")
+	}
+	if capture.body != `{"a":1}` {
+		t.Fatalf("expected the body to be sent, got %q", capture.body)
+	}
+	if capture.req.Header.Get(httpsig.DigestHeader) != httpsig.Digest([]byte(`{"a":1}`)) {
+		t.Fatalf("unexpected digest header %q", capture.req.Header.Get(httpsig.DigestHeader))
+	}
+
+	params, err := httpsig.ParseParams(capture.req.Header.Get(httpsig.SignatureHeader))
+	if err != nil {
+		t.Fatalf("parsing signature header failed: %v", err)
+	}
+	if params.KeyID != "svc-a" {
+		t.Fatalf("expected key ID svc-a, got %q", params.KeyID)
+	}
+	if !httpsig.Verify([]byte("signing-key"), capture.req, params, httpsig.Digest([]byte(`{"a":1}`))) {
+		t.Fatalf("expected a valid signature")
+	}
+	if httpsig.Verify([]byte("other-key"), capture.req, params, httpsig.Digest([]byte(`{"a":1}`))) {
+		t.Fatalf("expected the signature to be invalid for another key")
+	}
+}
+
+func TestHMACSignWithoutKey(t *testing.T) {
+	t.Parallel()
+
+	rt := transport.HMACSign("svc-a", "")(&capturingTransport{})
+
+	req, err := http.NewRequest(http.MethodGet, "http://records.local/records", nil)
+	if err != nil {
+		t.Fatalf("error creating http request: %v", err)
+	}
+
+	if _, err := rt.RoundTrip(req); err != transport.ErrHMACKeyMissing {
+		t.Fatalf("expected ErrHMACKeyMissing, got %v", err)
+	}
+}
@@ -11,14 +11,16 @@ type LogTransport struct {
 	rt     http.RoundTripper
 	logger *log.Logger
 	obf    map[string][]log.HTTPObfuscator
+
+	maxBodySize int
 }
 
 func (t *LogTransport) RoundTrip(req *http.Request) (*http.Response, error) {
 	reqTime := time.Now()
-	_ = t.logger.HTTPOutReq(req, t.obf)
+	_ = t.logger.HTTPOutReqWithMaxBodySize(req, t.obf, t.maxBodySize)
 
 	res, err := t.rt.RoundTrip(req)
-	_ = t.logger.HTTPOutResponse(req, res, reqTime, t.obf)
+	_ = t.logger.HTTPOutResponseWithMaxBodySize(req, res, reqTime, t.obf, t.maxBodySize)
 
 	return res, err
 }
@@ -34,6 +36,8 @@ func Log(logger *log.Logger, options ...func(*LogTransport)) TransportFunc {
 			rt:     rt,
 			logger: logger,
 			obf:    make(map[string][]log.HTTPObfuscator),
+
+			maxBodySize: log.DefaultMaxLoggedBodySize,
 		}
 
 		for _, apply := range options {
@@ -52,3 +56,12 @@ func WithObfuscators(o ...log.HTTPObfuscator) func(*LogTransport) {
 		}
 	}
 }
+
+// WithMaxLoggedBodySize limits the logged request and response bodies to the given amount of bytes
+// (defaults to log.DefaultMaxLoggedBodySize, <= 0 logs complete bodies). Truncated bodies end with "... [truncated]",
+// only the logged part of the body is buffered and the rest is streamed.
+func WithMaxLoggedBodySize(size int) func(*LogTransport) {
+	return func(l *LogTransport) {
+		l.maxBodySize = size
+	}
+}
@@ -0,0 +1,322 @@
+package transport
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"golang.org/x/oauth2/clientcredentials"
+	"golang.org/x/sync/singleflight"
+
+	"github.com/d4l-data4life/go-svc/pkg/prom"
+)
+
+// ErrTokenProviderMissing happens when neither a token provider nor a token URL is configured.
+var ErrTokenProviderMissing = errors.New("no oauth2 token provider configured")
+
+// TokenProvider fetches a new access token, client.ALPAuth implementations satisfy it.
+type TokenProvider interface {
+	Authenticate(ctx context.Context) (string, error)
+}
+
+// ExpiringTokenProvider is implemented by token providers that know when a fetched token expires.
+type ExpiringTokenProvider interface {
+	AuthenticateWithExpiry(ctx context.Context) (string, time.Time, error)
+}
+
+// OAuth2Config configures the OAuth2ClientCredentials transport.
+// Either Provider or TokenURL, ClientID and ClientSecret have to be set.
+type OAuth2Config struct {
+	// Name is used as label for the token metrics
+	Name string
+
+	// Provider fetches new tokens, e.g. client.NewAzureOauth2(...)
+	Provider TokenProvider
+
+	// TokenURL, ClientID, ClientSecret and Scopes are used to create a generic client credentials
+	// provider for any OIDC compliant token endpoint if no Provider is set
+	TokenURL     string
+	ClientID     string
+	ClientSecret string
+	Scopes       []string
+
+	// ExpiryDelta refreshes tokens this long before they expire (defaults to 30 seconds)
+	ExpiryDelta time.Duration
+
+	// DefaultTTL is used for tokens without known expiry (defaults to 5 minutes)
+	DefaultTTL time.Duration
+
+	// FetchTimeout bounds the token fetch, which outlives the request it was started for (defaults to 10 seconds)
+	FetchTimeout time.Duration
+
+	// InitOptions change the subsystem of the exported metrics
+	InitOptions []prom.InitOption
+}
+
+// ClientCredentialsProvider fetches tokens from an OIDC token endpoint using the client credentials grant.
+type ClientCredentialsProvider struct {
+	conf *clientcredentials.Config
+}
+
+// NewClientCredentialsProvider creates a token provider for the given token endpoint.
+func NewClientCredentialsProvider(tokenURL, clientID, clientSecret string, scopes ...string) *ClientCredentialsProvider {
+	return &ClientCredentialsProvider{
+		conf: &clientcredentials.Config{
+			ClientID:     clientID,
+			ClientSecret: clientSecret,
+			Scopes:       scopes,
+			TokenURL:     tokenURL,
+		},
+	}
+}
+
+func (p *ClientCredentialsProvider) Authenticate(ctx context.Context) (string, error) {
+	token, _, err := p.AuthenticateWithExpiry(ctx)
+	return token, err
+}
+
+func (p *ClientCredentialsProvider) AuthenticateWithExpiry(ctx context.Context) (string, time.Time, error) {
+	token, err := p.conf.Token(ctx)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	return token.AccessToken, token.Expiry, nil
+}
+
+type cachedToken struct {
+	value  string
+	expiry time.Time
+}
+
+// tokenCache caches a single token and makes sure only one fetch is in flight at a time.
+type tokenCache struct {
+	name         string
+	provider     TokenProvider
+	expiryDelta  time.Duration
+	defaultTTL   time.Duration
+	fetchTimeout time.Duration
+	metrics      *prom.OAuth2Instrumenter
+
+	mu    sync.RWMutex
+	token *cachedToken
+	group singleflight.Group
+}
+
+func (c *tokenCache) get(ctx context.Context) (string, error) {
+	c.mu.RLock()
+	token := c.token
+	c.mu.RUnlock()
+
+	if token != nil && time.Now().Add(c.expiryDelta).Before(token.expiry) {
+		return token.value, nil
+	}
+
+	// the fetch must not be canceled if only the first of several waiting callers gives up
+	ch := c.group.DoChan("token", func() (interface{}, error) {
+		fetchCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), c.fetchTimeout)
+		defer cancel()
+		return c.fetch(fetchCtx)
+	})
+
+	select {
+	case <-ctx.Done():
+		return "", ctx.Err()
+	case res := <-ch:
+		if res.Err != nil {
+			return "", res.Err
+		}
+		return res.Val.(string), nil
+	}
+}
+
+func (c *tokenCache) fetch(ctx context.Context) (string, error) {
+	var (
+		value  string
+		expiry time.Time
+		err    error
+	)
+	if p, ok := c.provider.(ExpiringTokenProvider); ok {
+		value, expiry, err = p.AuthenticateWithExpiry(ctx)
+	} else {
+		value, err = c.provider.Authenticate(ctx)
+	}
+	c.metrics.Fetch(c.name, err)
+	if err != nil {
+		return "", fmt.Errorf("fetching oauth2 token: %w", err)
+	}
+
+	if expiry.IsZero() {
+		expiry = tokenExpiry(value, c.defaultTTL)
+	}
+
+	c.mu.Lock()
+	c.token = &cachedToken{value: value, expiry: expiry}
+	c.mu.Unlock()
+
+	return value, nil
+}
+
+// invalidate drops the cached token if it is still the given one
+func (c *tokenCache) invalidate(value string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.token != nil && c.token.value == value {
+		c.token = nil
+	}
+}
+
+// tokenExpiry reads the exp claim of JWT access tokens and falls back to the default TTL for opaque tokens
+func tokenExpiry(value string, defaultTTL time.Duration) time.Time {
+	claims := jwt.RegisteredClaims{}
+	if _, _, err := jwt.NewParser().ParseUnverified(value, &claims); err == nil && claims.ExpiresAt != nil {
+		return claims.ExpiresAt.Time
+	}
+	return time.Now().Add(defaultTTL)
+}
+
+type OAuth2Transport struct {
+	cache *tokenCache
+	rt    http.RoundTripper
+}
+
+func (t *OAuth2Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	getBody, err := replayableBody(req)
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := t.cache.get(req.Context())
+	if err != nil {
+		return nil, err
+	}
+
+	authorized, err := t.authorize(req, token, getBody, req.GetBody == nil)
+	if err != nil {
+		return nil, err
+	}
+	res, err := t.rt.RoundTrip(authorized)
+	if err != nil || res.StatusCode != http.StatusUnauthorized {
+		return res, err
+	}
+
+	// the token might have been revoked before its expiry, retry once with a fresh one
+	t.cache.invalidate(token)
+	freshToken, err := t.cache.get(req.Context())
+	if err != nil || freshToken == token {
+		return res, nil
+	}
+	drainBody(res)
+
+	retry, err := t.authorize(req, freshToken, getBody, true)
+	if err != nil {
+		return nil, err
+	}
+	return t.rt.RoundTrip(retry)
+}
+
+// authorize clones the request with the given bearer token and, if requested, a fresh copy of the body
+func (t *OAuth2Transport) authorize(
+	req *http.Request,
+	token string,
+	getBody func() (io.ReadCloser, error),
+	rewind bool,
+) (*http.Request, error) {
+	r := req.Clone(req.Context())
+	r.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+	if getBody != nil && rewind {
+		body, err := getBody()
+		if err != nil {
+			return nil, fmt.Errorf("rewinding request body: %w", err)
+		}
+		r.Body = body
+	}
+	return r, nil
+}
+
+// OAuth2TokenSource caches the token of an OAuth2Config for other protocols than http, e.g. gRPC.
+type OAuth2TokenSource struct {
+	cache *tokenCache
+}
+
+// NewOAuth2TokenSource creates a token source with the same caching and metrics as the OAuth2ClientCredentials transport.
+// It fails with ErrTokenProviderMissing if neither a Provider nor a TokenURL is configured.
+func NewOAuth2TokenSource(cfg OAuth2Config) (*OAuth2TokenSource, error) {
+	cache := newTokenCache(cfg)
+	if cache.provider == nil {
+		return nil, ErrTokenProviderMissing
+	}
+	return &OAuth2TokenSource{cache: cache}, nil
+}
+
+// Token returns the cached token or fetches a new one
+func (s *OAuth2TokenSource) Token(ctx context.Context) (string, error) {
+	return s.cache.get(ctx)
+}
+
+// Invalidate drops the token, e.g. after it was rejected, so the next call to Token fetches a new one
+func (s *OAuth2TokenSource) Invalidate(token string) {
+	s.cache.invalidate(token)
+}
+
+func newTokenCache(cfg OAuth2Config) *tokenCache {
+	provider := cfg.Provider
+	if provider == nil && cfg.TokenURL != "" {
+		provider = NewClientCredentialsProvider(cfg.TokenURL, cfg.ClientID, cfg.ClientSecret, cfg.Scopes...)
+	}
+
+	cache := &tokenCache{
+		name:         cfg.Name,
+		provider:     provider,
+		expiryDelta:  cfg.ExpiryDelta,
+		defaultTTL:   cfg.DefaultTTL,
+		fetchTimeout: cfg.FetchTimeout,
+		metrics:      prom.NewOAuth2Instrumenter(cfg.InitOptions...),
+	}
+	if cache.expiryDelta == 0 {
+		cache.expiryDelta = 30 * time.Second
+	}
+	if cache.defaultTTL == 0 {
+		cache.defaultTTL = 5 * time.Minute
+	}
+	if cache.fetchTimeout == 0 {
+		cache.fetchTimeout = 10 * time.Second
+	}
+	return cache
+}
+
+// OAuth2ClientCredentials adds a bearer token obtained with the client credentials grant to outgoing http requests.
+// Tokens are cached until shortly before they expire and refreshed by a single request across goroutines.
+// A 401 response invalidates the cached token and the request is retried once with a fresh token.
+func OAuth2ClientCredentials(cfg OAuth2Config) TransportFunc {
+	cache := newTokenCache(cfg)
+
+	return func(rt http.RoundTripper) http.RoundTripper {
+		if rt == nil {
+			rt = http.DefaultTransport
+		}
+
+		if cache.provider == nil {
+			return &errorTransport{err: ErrTokenProviderMissing}
+		}
+
+		return &OAuth2Transport{
+			cache: cache,
+			rt:    rt,
+		}
+	}
+}
+
+// errorTransport fails every request with the given error, it is used for misconfigured transports
+type errorTransport struct {
+	err error
+}
+
+func (t *errorTransport) RoundTrip(_ *http.Request) (*http.Response, error) {
+	return nil, t.err
+}
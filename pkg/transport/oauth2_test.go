@@ -0,0 +1,261 @@
+package transport_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/d4l-data4life/go-svc/pkg/transport"
+)
+
+type tokenServer struct {
+	*httptest.Server
+	fetches   atomic.Int32
+	expiresIn int
+}
+
+func newTokenServer(t *testing.T, expiresIn int) *tokenServer {
+	t.Helper()
+
+	ts := &tokenServer{expiresIn: expiresIn}
+	ts.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil || r.Form.Get("grant_type") != "client_credentials" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		n := ts.fetches.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"access_token":"token-%d","token_type":"bearer","expires_in":%d}`, n, ts.expiresIn)
+	}))
+	t.Cleanup(ts.Close)
+
+	return ts
+}
+
+func TestOAuth2ClientCredentials(t *testing.T) {
+	t.Run("caches token across requests", func(t *testing.T) {
+		tokenSrv := newTokenServer(t, 3600)
+		apiSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("Authorization") != "Bearer token-1" {
+				w.WriteHeader(http.StatusUnauthorized)
+			}
+		}))
+		defer apiSrv.Close()
+
+		client := &http.Client{Transport: transport.OAuth2ClientCredentials(transport.OAuth2Config{
+			Name:         "oauth2-cache",
+			TokenURL:     tokenSrv.URL,
+			ClientID:     "client",
+			ClientSecret: "secret",
+		})(nil)}
+
+		var wg sync.WaitGroup
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				res, err := client.Get(apiSrv.URL)
+				if err != nil {
+					t.Errorf("request failed: %v", err)
+					return
+				}
+				res.Body.Close()
+				if res.StatusCode != http.StatusOK {
+					t.Errorf("expected status 200, got %d", res.StatusCode)
+				}
+			}()
+		}
+		wg.Wait()
+
+		if n := tokenSrv.fetches.Load(); n != 1 {
+			t.Fatalf("expected a single token fetch, got %d", n)
+		}
+	})
+
+	t.Run("refreshes token before expiry", func(t *testing.T) {
+		tokenSrv := newTokenServer(t, 10)
+		apiSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+		defer apiSrv.Close()
+
+		client := &http.Client{Transport: transport.OAuth2ClientCredentials(transport.OAuth2Config{
+			Name:        "oauth2-refresh",
+			TokenURL:    tokenSrv.URL,
+			ExpiryDelta: 30 * time.Second,
+		})(nil)}
+
+		for i := 0; i < 2; i++ {
+			res, err := client.Get(apiSrv.URL)
+			if err != nil {
+				t.Fatalf("request failed: %v", err)
+			}
+			res.Body.Close()
+		}
+
+		if n := tokenSrv.fetches.Load(); n != 2 {
+			t.Fatalf("expected 2 token fetches for tokens within expiry delta, got %d", n)
+		}
+	})
+
+	t.Run("retries once on 401 with fresh token", func(t *testing.T) {
+		tokenSrv := newTokenServer(t, 3600)
+		var bodies []string
+		apiSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, _ := io.ReadAll(r.Body)
+			bodies = append(bodies, string(body))
+			if r.Header.Get("Authorization") != "Bearer token-2" {
+				w.WriteHeader(http.StatusUnauthorized)
+			}
+		}))
+		defer apiSrv.Close()
+
+		client := &http.Client{Transport: transport.OAuth2ClientCredentials(transport.OAuth2Config{
+			Name:     "oauth2-401",
+			TokenURL: tokenSrv.URL,
+		})(nil)}
+
+		res, err := client.Post(apiSrv.URL, "text/plain", strings.NewReader("payload"))
+		if err != nil {
+			t.Fatalf("request failed: %v", err)
+		}
+		res.Body.Close()
+
+		if res.StatusCode != http.StatusOK {
+			t.Fatalf("expected status 200, got %d", res.StatusCode)
+		}
+		if len(bodies) != 2 || bodies[1] != "payload" {
+			t.Fatalf("expected body to be replayed, got %v", bodies)
+		}
+	})
+
+	t.Run("does not retry more than once", func(t *testing.T) {
+		tokenSrv := newTokenServer(t, 3600)
+		apiSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusUnauthorized)
+		}))
+		defer apiSrv.Close()
+
+		client := &http.Client{Transport: transport.OAuth2ClientCredentials(transport.OAuth2Config{
+			Name:     "oauth2-401-twice",
+			TokenURL: tokenSrv.URL,
+		})(nil)}
+
+		res, err := client.Get(apiSrv.URL)
+		if err != nil {
+			t.Fatalf("request failed: %v", err)
+		}
+		res.Body.Close()
+
+		if res.StatusCode != http.StatusUnauthorized {
+			t.Fatalf("expected status 401, got %d", res.StatusCode)
+		}
+		if n := tokenSrv.fetches.Load(); n != 2 {
+			t.Fatalf("expected 2 token fetches, got %d", n)
+		}
+	})
+
+	t.Run("uses custom provider", func(t *testing.T) {
+		rt := transport.OAuth2ClientCredentials(transport.OAuth2Config{
+			Name:     "oauth2-provider",
+			Provider: staticProvider("static-token"),
+		})(&HeaderCheckTransport{header: "Authorization", want: "Bearer static-token"})
+
+		req, err := http.NewRequest(http.MethodGet, "", nil)
+		if err != nil {
+			t.Fatalf("error creating http request: %v", err)
+		}
+		if _, err := rt.RoundTrip(req); err != nil {
+			t.Fatalf("round trip failed: %v", err)
+		}
+	})
+
+	t.Run("fails if the body cannot be replayed", func(t *testing.T) {
+		tokenSrv := newTokenServer(t, 3600)
+		var calls atomic.Int32
+		apiSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls.Add(1)
+			w.WriteHeader(http.StatusUnauthorized)
+		}))
+		defer apiSrv.Close()
+
+		client := &http.Client{Transport: transport.OAuth2ClientCredentials(transport.OAuth2Config{
+			Name:     "oauth2-getbody",
+			TokenURL: tokenSrv.URL,
+		})(nil)}
+
+		req, err := http.NewRequest(http.MethodPost, apiSrv.URL, strings.NewReader("payload"))
+		if err != nil {
+			t.Fatalf("error creating http request: %v", err)
+		}
+		errGetBody := errors.New("body gone")
+		req.GetBody = func() (io.ReadCloser, error) { return nil, errGetBody }
+
+		if _, err := client.Do(req); !errors.Is(err, errGetBody) {
+			t.Fatalf("expected GetBody error, got %v", err)
+		}
+		if n := calls.Load(); n != 1 {
+			t.Fatalf("expected no retry with an empty body, got %d calls", n)
+		}
+	})
+
+	t.Run("bounds the token fetch", func(t *testing.T) {
+		rt := transport.OAuth2ClientCredentials(transport.OAuth2Config{
+			Name:         "oauth2-timeout",
+			Provider:     blockingProvider{},
+			FetchTimeout: 20 * time.Millisecond,
+		})(&NopTransport{})
+
+		req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, "", nil)
+		if err != nil {
+			t.Fatalf("error creating http request: %v", err)
+		}
+		if _, err := rt.RoundTrip(req); !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("expected deadline exceeded, got %v", err)
+		}
+	})
+
+	t.Run("fails without provider", func(t *testing.T) {
+		rt := transport.OAuth2ClientCredentials(transport.OAuth2Config{})(&NopTransport{})
+
+		req, err := http.NewRequest(http.MethodGet, "", nil)
+		if err != nil {
+			t.Fatalf("error creating http request: %v", err)
+		}
+		if _, err := rt.RoundTrip(req); !errors.Is(err, transport.ErrTokenProviderMissing) {
+			t.Fatalf("expected ErrTokenProviderMissing, got %v", err)
+		}
+	})
+}
+
+type staticProvider string
+
+func (p staticProvider) Authenticate(_ context.Context) (string, error) {
+	return string(p), nil
+}
+
+type blockingProvider struct{}
+
+func (blockingProvider) Authenticate(ctx context.Context) (string, error) {
+	<-ctx.Done()
+	return "", ctx.Err()
+}
+
+type HeaderCheckTransport struct {
+	header string
+	want   string
+}
+
+func (t *HeaderCheckTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if got := req.Header.Get(t.header); got != t.want {
+		return nil, fmt.Errorf("header %s: got %q, want %q", t.header, got, t.want)
+	}
+	rec := httptest.NewRecorder()
+	return rec.Result(), nil
+}
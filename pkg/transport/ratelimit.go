@@ -0,0 +1,200 @@
+package transport
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/d4l-data4life/go-svc/pkg/prom"
+)
+
+// ErrRateLimited happens when a request would have to wait longer than allowed for the rate limiter.
+var ErrRateLimited = errors.New("rate limit exceeded")
+
+// ErrInvalidLimit happens for requests through a RateLimit or Bulkhead transport created with a limit that can't work.
+var ErrInvalidLimit = errors.New("invalid limit")
+
+const rateLimiterName = "ratelimit"
+
+// tokenBucket is a token bucket that allows reserving tokens ahead of time.
+// The amount of tokens may become negative, which represents requests waiting for a token.
+type tokenBucket struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// reserve takes a token and returns how long the caller has to wait until it is available
+func (b *tokenBucket) reserve(now time.Time) time.Duration {
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+	b.last = now
+	b.tokens--
+
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
+
+// cancel returns a reserved token that was not used
+func (b *tokenBucket) cancel() {
+	b.tokens++
+}
+
+// full tells whether the bucket refilled completely, so it is equal to a new bucket
+func (b *tokenBucket) full(now time.Time) bool {
+	return b.tokens+now.Sub(b.last).Seconds()*b.rate >= b.burst
+}
+
+type RateLimitTransport struct {
+	name    string
+	rate    float64
+	burst   int
+	maxWait time.Duration
+	key     func(*http.Request) string
+	metrics *prom.LimiterInstrumenter
+
+	mu        sync.Mutex
+	buckets   map[string]*tokenBucket
+	lastSweep time.Time
+
+	rt http.RoundTripper
+}
+
+func (t *RateLimitTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := t.wait(req.Context(), t.key(req)); err != nil {
+		return nil, err
+	}
+	return t.rt.RoundTrip(req)
+}
+
+func (t *RateLimitTransport) wait(ctx context.Context, key string) error {
+	now := time.Now()
+
+	t.mu.Lock()
+	t.sweep(now)
+	bucket, ok := t.buckets[key]
+	if !ok {
+		bucket = &tokenBucket{rate: t.rate, burst: float64(t.burst), tokens: float64(t.burst), last: now}
+		t.buckets[key] = bucket
+	}
+	delay := bucket.reserve(now)
+	if t.maxWait >= 0 && delay > t.maxWait {
+		bucket.cancel()
+		t.mu.Unlock()
+		t.metrics.Reject(rateLimiterName, t.name)
+		return fmt.Errorf("%w: %s would wait %v", ErrRateLimited, key, delay)
+	}
+	t.mu.Unlock()
+
+	if delay == 0 {
+		t.metrics.ObserveWait(rateLimiterName, t.name, 0)
+		return nil
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		t.mu.Lock()
+		bucket.cancel()
+		t.mu.Unlock()
+		t.metrics.Reject(rateLimiterName, t.name)
+		return ctx.Err()
+	case <-timer.C:
+		t.metrics.ObserveWait(rateLimiterName, t.name, time.Since(now))
+		return nil
+	}
+}
+
+// sweep removes idle buckets that refilled completely at most once per refill period, it must be called with the lock held
+func (t *RateLimitTransport) sweep(now time.Time) {
+	refill := time.Duration(float64(t.burst) / t.rate * float64(time.Second))
+	if now.Sub(t.lastSweep) <= max(refill, time.Second) {
+		return
+	}
+	for key, bucket := range t.buckets {
+		if bucket.full(now) {
+			delete(t.buckets, key)
+		}
+	}
+	t.lastSweep = now
+}
+
+// Buckets returns the amount of buckets currently tracked
+func (t *RateLimitTransport) Buckets() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return len(t.buckets)
+}
+
+// RateLimitOption is to be implemented by functional options
+type RateLimitOption func(*RateLimitTransport)
+
+// RateLimitWithKey sets the function partitioning requests into separate buckets (defaults to the target host)
+func RateLimitWithKey(key func(*http.Request) string) RateLimitOption {
+	return func(t *RateLimitTransport) {
+		t.key = key
+	}
+}
+
+// RateLimitWithMaxWait rejects requests with ErrRateLimited instead of waiting longer than the given duration.
+// By default requests wait until a token is available or their context is done.
+func RateLimitWithMaxWait(d time.Duration) RateLimitOption {
+	return func(t *RateLimitTransport) {
+		t.maxWait = d
+	}
+}
+
+// RateLimitWithInitOptions changes the subsystem and buckets of the exported metrics
+func RateLimitWithInitOptions(options ...prom.InitOption) RateLimitOption {
+	return func(t *RateLimitTransport) {
+		t.metrics = prom.NewLimiterInstrumenter(options...)
+	}
+}
+
+// RateLimit limits outgoing http requests to rps requests per second with bursts of up to burst requests,
+// using a token bucket per target host or per key. Requests wait for a token as long as their context allows.
+// Buckets of keys that were idle until their bucket refilled are dropped.
+// With rps <= 0 or burst < 1 all requests fail with ErrInvalidLimit.
+func RateLimit(name string, rps float64, burst int, options ...RateLimitOption) TransportFunc {
+	return func(rt http.RoundTripper) http.RoundTripper {
+		if rt == nil {
+			rt = http.DefaultTransport
+		}
+
+		if rps <= 0 || burst < 1 {
+			return &errorTransport{err: fmt.Errorf("%w: rate limiter %s with %v rps and burst %d", ErrInvalidLimit, name, rps, burst)}
+		}
+
+		rl := &RateLimitTransport{
+			name:      name,
+			rate:      rps,
+			burst:     burst,
+			maxWait:   -1,
+			key:       func(r *http.Request) string { return r.URL.Host },
+			buckets:   make(map[string]*tokenBucket),
+			lastSweep: time.Now(),
+			rt:        rt,
+		}
+
+		for _, apply := range options {
+			apply(rl)
+		}
+
+		if rl.metrics == nil {
+			rl.metrics = prom.NewLimiterInstrumenter()
+		}
+
+		return rl
+	}
+}
@@ -0,0 +1,126 @@
+package transport_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/d4l-data4life/go-svc/pkg/transport"
+)
+
+func TestRateLimitTransport(t *testing.T) {
+	newRequest := func(t *testing.T, ctx context.Context, url string) *http.Request {
+		t.Helper()
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			t.Fatalf("error creating http request: %v", err)
+		}
+		return req
+	}
+
+	t.Run("allows burst and delays further requests", func(t *testing.T) {
+		downstream := &StatusRoundTrip{statusCode: http.StatusOK}
+		rt := transport.RateLimit("ratelimit-burst", 20, 2)(downstream)
+
+		start := time.Now()
+		for i := 0; i < 3; i++ {
+			res, err := rt.RoundTrip(newRequest(t, context.Background(), "http://example.org"))
+			if err != nil {
+				t.Fatalf("round trip failed: %v", err)
+			}
+			res.Body.Close()
+		}
+		if elapsed := time.Since(start); elapsed < 40*time.Millisecond {
+			t.Fatalf("expected third request to wait for a token, took %v", elapsed)
+		}
+	})
+
+	t.Run("separate buckets per host", func(t *testing.T) {
+		downstream := &StatusRoundTrip{statusCode: http.StatusOK}
+		rt := transport.RateLimit("ratelimit-hosts", 1, 1, transport.RateLimitWithMaxWait(0))(downstream)
+
+		for _, url := range []string{"http://a.example.org", "http://b.example.org"} {
+			if _, err := rt.RoundTrip(newRequest(t, context.Background(), url)); err != nil {
+				t.Fatalf("round trip failed: %v", err)
+			}
+		}
+		if _, err := rt.RoundTrip(newRequest(t, context.Background(), "http://a.example.org")); !errors.Is(err, transport.ErrRateLimited) {
+			t.Fatalf("expected ErrRateLimited, got %v", err)
+		}
+	})
+
+	t.Run("custom key", func(t *testing.T) {
+		downstream := &StatusRoundTrip{statusCode: http.StatusOK}
+		rt := transport.RateLimit("ratelimit-key", 1, 1,
+			transport.RateLimitWithMaxWait(0),
+			transport.RateLimitWithKey(func(*http.Request) string { return "global" }),
+		)(downstream)
+
+		if _, err := rt.RoundTrip(newRequest(t, context.Background(), "http://a.example.org")); err != nil {
+			t.Fatalf("round trip failed: %v", err)
+		}
+		if _, err := rt.RoundTrip(newRequest(t, context.Background(), "http://b.example.org")); !errors.Is(err, transport.ErrRateLimited) {
+			t.Fatalf("expected ErrRateLimited, got %v", err)
+		}
+	})
+
+	t.Run("respects context cancellation", func(t *testing.T) {
+		downstream := &StatusRoundTrip{statusCode: http.StatusOK}
+		rt := transport.RateLimit("ratelimit-ctx", 0.1, 1)(downstream)
+
+		if _, err := rt.RoundTrip(newRequest(t, context.Background(), "http://example.org")); err != nil {
+			t.Fatalf("round trip failed: %v", err)
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		if _, err := rt.RoundTrip(newRequest(t, ctx, "http://example.org")); !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("expected deadline exceeded, got %v", err)
+		}
+		if downstream.calls != 1 {
+			t.Fatalf("expected 1 downstream call, got %d", downstream.calls)
+		}
+	})
+
+	t.Run("drops idle buckets", func(t *testing.T) {
+		downstream := &StatusRoundTrip{statusCode: http.StatusOK}
+		rt := transport.RateLimit("ratelimit-sweep", 100, 1,
+			transport.RateLimitWithKey(func(r *http.Request) string { return r.URL.Path }),
+		)(downstream).(*transport.RateLimitTransport)
+
+		for _, path := range []string{"/a", "/b", "/c"} {
+			if _, err := rt.RoundTrip(newRequest(t, context.Background(), "http://example.org"+path)); err != nil {
+				t.Fatalf("round trip failed: %v", err)
+			}
+		}
+		if n := rt.Buckets(); n != 3 {
+			t.Fatalf("expected 3 buckets, got %d", n)
+		}
+
+		time.Sleep(1100 * time.Millisecond)
+		if _, err := rt.RoundTrip(newRequest(t, context.Background(), "http://example.org/d")); err != nil {
+			t.Fatalf("round trip failed: %v", err)
+		}
+		if n := rt.Buckets(); n != 1 {
+			t.Fatalf("expected idle buckets to be dropped, got %d buckets", n)
+		}
+	})
+
+	t.Run("rejects invalid rate", func(t *testing.T) {
+		rt := transport.RateLimit("ratelimit-invalid", 0, 1)(&StatusRoundTrip{statusCode: http.StatusOK})
+
+		if _, err := rt.RoundTrip(newRequest(t, context.Background(), "http://example.org")); !errors.Is(err, transport.ErrInvalidLimit) {
+			t.Fatalf("expected ErrInvalidLimit, got %v", err)
+		}
+	})
+
+	t.Run("rejects burst below one", func(t *testing.T) {
+		rt := transport.RateLimit("ratelimit-no-burst", 10, 0)(&StatusRoundTrip{statusCode: http.StatusOK})
+
+		if _, err := rt.RoundTrip(newRequest(t, context.Background(), "http://example.org")); !errors.Is(err, transport.ErrInvalidLimit) {
+			t.Fatalf("expected ErrInvalidLimit, got %v", err)
+		}
+	})
+}
@@ -0,0 +1,248 @@
+package transport
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+
+	"github.com/d4l-data4life/go-svc/pkg/log"
+)
+
+// ErrRecorderUnmatched happens in replay mode when no recorded interaction matches the request.
+var ErrRecorderUnmatched = errors.New("no recorded interaction matches request")
+
+// RecorderMode defines whether the Recorder writes or serves interactions.
+type RecorderMode int
+
+const (
+	// RecorderModeRecord sends requests to the network and stores them in the cassette.
+	RecorderModeRecord RecorderMode = iota
+	// RecorderModeReplay serves responses from the cassette and never reaches the network.
+	RecorderModeReplay
+)
+
+// Cassette is the file format of recorded interactions.
+type Cassette struct {
+	Interactions []Interaction `json:"interactions"`
+}
+
+// Interaction is a single recorded request/response pair.
+type Interaction struct {
+	Request  RecordedRequest  `json:"request"`
+	Response RecordedResponse `json:"response"`
+}
+
+type RecordedRequest struct {
+	Method string      `json:"method"`
+	URL    string      `json:"url"`
+	Header http.Header `json:"header,omitempty"`
+	Body   string      `json:"body,omitempty"`
+}
+
+type RecordedResponse struct {
+	StatusCode int         `json:"status-code"`
+	Header     http.Header `json:"header,omitempty"`
+	Body       string      `json:"body,omitempty"`
+}
+
+// RecorderMatcher decides whether a recorded request matches the outgoing request.
+// The body of the outgoing request is passed separately, so that matchers do not have to consume it.
+type RecorderMatcher func(req *http.Request, body []byte, recorded RecordedRequest) bool
+
+// MatchMethod matches requests with the same HTTP method.
+func MatchMethod(req *http.Request, _ []byte, recorded RecordedRequest) bool {
+	return req.Method == recorded.Method
+}
+
+// MatchURL matches requests with the same URL including the query.
+func MatchURL(req *http.Request, _ []byte, recorded RecordedRequest) bool {
+	return req.URL.String() == recorded.URL
+}
+
+// MatchBody matches requests with the same body.
+func MatchBody(_ *http.Request, body []byte, recorded RecordedRequest) bool {
+	return string(body) == recorded.Body
+}
+
+type RecorderTransport struct {
+	path     string
+	mode     RecorderMode
+	matchers []RecorderMatcher
+
+	mu       sync.Mutex
+	cassette Cassette
+	used     []bool
+
+	rt http.RoundTripper
+}
+
+func (t *RecorderTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil && req.Body != http.NoBody {
+		var err error
+		body, err = io.ReadAll(req.Body)
+		_ = req.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("reading request body: %w", err)
+		}
+	}
+
+	if t.mode == RecorderModeReplay {
+		return t.replay(req, body)
+	}
+	return t.record(req, body)
+}
+
+func (t *RecorderTransport) replay(req *http.Request, body []byte) (*http.Response, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for i, interaction := range t.cassette.Interactions {
+		if t.used[i] || !t.matches(req, body, interaction.Request) {
+			continue
+		}
+		t.used[i] = true
+
+		return &http.Response{
+			Status:        fmt.Sprintf("%d %s", interaction.Response.StatusCode, http.StatusText(interaction.Response.StatusCode)),
+			StatusCode:    interaction.Response.StatusCode,
+			Proto:         "HTTP/1.1",
+			ProtoMajor:    1,
+			ProtoMinor:    1,
+			Header:        interaction.Response.Header.Clone(),
+			Body:          io.NopCloser(bytes.NewBufferString(interaction.Response.Body)),
+			ContentLength: int64(len(interaction.Response.Body)),
+			Request:       req,
+		}, nil
+	}
+
+	return nil, fmt.Errorf("%w: %s %s (cassette %s)", ErrRecorderUnmatched, req.Method, req.URL.String(), t.path)
+}
+
+func (t *RecorderTransport) matches(req *http.Request, body []byte, recorded RecordedRequest) bool {
+	for _, match := range t.matchers {
+		if !match(req, body, recorded) {
+			return false
+		}
+	}
+	return true
+}
+
+func (t *RecorderTransport) record(req *http.Request, body []byte) (*http.Response, error) {
+	r := req.Clone(req.Context())
+	if body != nil {
+		r.Body = io.NopCloser(bytes.NewReader(body))
+	}
+
+	res, err := t.rt.RoundTrip(r)
+	if err != nil {
+		return res, err
+	}
+
+	resBody, err := io.ReadAll(res.Body)
+	_ = res.Body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("reading response body: %w", err)
+	}
+	res.Body = io.NopCloser(bytes.NewReader(resBody))
+
+	interaction := Interaction{
+		Request: RecordedRequest{
+			Method: req.Method,
+			URL:    req.URL.String(),
+			Header: log.RedactHeaders(req.Header),
+			Body:   string(body),
+		},
+		Response: RecordedResponse{
+			StatusCode: res.StatusCode,
+			Header:     log.RedactHeaders(res.Header),
+			Body:       string(resBody),
+		},
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.cassette.Interactions = append(t.cassette.Interactions, interaction)
+	if err := t.save(); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+// save writes the whole cassette, it must be called with the lock held
+func (t *RecorderTransport) save() error {
+	data, err := json.MarshalIndent(t.cassette, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encoding cassette: %w", err)
+	}
+	if err := os.WriteFile(t.path, data, 0o600); err != nil {
+		return fmt.Errorf("writing cassette %s: %w", t.path, err)
+	}
+	return nil
+}
+
+func loadCassette(path string) (Cassette, error) {
+	cassette := Cassette{}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return cassette, fmt.Errorf("reading cassette %s: %w", path, err)
+	}
+	if err := json.Unmarshal(data, &cassette); err != nil {
+		return cassette, fmt.Errorf("decoding cassette %s: %w", path, err)
+	}
+	return cassette, nil
+}
+
+// RecorderOption is to be implemented by functional options
+type RecorderOption func(*RecorderTransport)
+
+// RecorderWithMatchers replaces the matchers used in replay mode (defaults to MatchMethod and MatchURL)
+func RecorderWithMatchers(matchers ...RecorderMatcher) RecorderOption {
+	return func(t *RecorderTransport) {
+		t.matchers = matchers
+	}
+}
+
+// Recorder records outgoing http requests and their responses to a JSON cassette file
+// or replays them from it for deterministic tests.
+// In record mode sensitive headers like `Authorization` are redacted with the same rules as in the HTTP logs
+// and the cassette is rewritten after every interaction.
+// In replay mode every recorded interaction is served at most once and requests without
+// a matching interaction fail with ErrRecorderUnmatched, so they never reach the network.
+func Recorder(path string, mode RecorderMode, options ...RecorderOption) TransportFunc {
+	return func(rt http.RoundTripper) http.RoundTripper {
+		if rt == nil {
+			rt = http.DefaultTransport
+		}
+
+		rec := &RecorderTransport{
+			path:     path,
+			mode:     mode,
+			matchers: []RecorderMatcher{MatchMethod, MatchURL},
+			rt:       rt,
+		}
+
+		for _, apply := range options {
+			apply(rec)
+		}
+
+		if mode == RecorderModeReplay {
+			cassette, err := loadCassette(path)
+			if err != nil {
+				return &errorTransport{err: err}
+			}
+			rec.cassette = cassette
+			rec.used = make([]bool, len(cassette.Interactions))
+		}
+
+		return rec
+	}
+}
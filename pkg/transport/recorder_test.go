@@ -0,0 +1,122 @@
+package transport_test
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/d4l-data4life/go-svc/pkg/transport"
+)
+
+func TestRecorderTransport(t *testing.T) {
+	cassettePath := filepath.Join(t.TempDir(), "cassette.json")
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "text/plain")
+		_, _ = w.Write([]byte(r.Method + ":" + string(body)))
+	}))
+
+	doRequest := func(t *testing.T, client *http.Client, method, body string) (string, error) {
+		t.Helper()
+
+		req, err := http.NewRequest(method, srv.URL+"/resource?q=1", strings.NewReader(body))
+		if err != nil {
+			t.Fatalf("error creating http request: %v", err)
+		}
+		req.Header.Set("Authorization", "Bearer secret")
+
+		res, err := client.Do(req)
+		if err != nil {
+			return "", err
+		}
+		defer res.Body.Close()
+
+		resBody, err := io.ReadAll(res.Body)
+		return string(resBody), err
+	}
+
+	t.Run("record", func(t *testing.T) {
+		client := &http.Client{Transport: transport.Recorder(cassettePath, transport.RecorderModeRecord)(nil)}
+
+		for _, method := range []string{http.MethodGet, http.MethodPost} {
+			if _, err := doRequest(t, client, method, "payload"); err != nil {
+				t.Fatalf("request failed: %v", err)
+			}
+		}
+
+		data, err := os.ReadFile(cassettePath)
+		if err != nil {
+			t.Fatalf("reading cassette: %v", err)
+		}
+		if strings.Contains(string(data), "secret") {
+			t.Fatalf("cassette contains unredacted authorization header: %s", data)
+		}
+		if !strings.Contains(string(data), "Obfuscated{13}") {
+			t.Fatalf("cassette misses obfuscated authorization header: %s", data)
+		}
+	})
+
+	srv.Close()
+
+	t.Run("replay", func(t *testing.T) {
+		client := &http.Client{Transport: transport.Recorder(cassettePath, transport.RecorderModeReplay)(nil)}
+
+		got, err := doRequest(t, client, http.MethodPost, "payload")
+		if err != nil {
+			t.Fatalf("request failed: %v", err)
+		}
+		if got != "POST:payload" {
+			t.Fatalf("unexpected replayed body %q", got)
+		}
+
+		got, err = doRequest(t, client, http.MethodGet, "payload")
+		if err != nil {
+			t.Fatalf("request failed: %v", err)
+		}
+		if got != "GET:payload" {
+			t.Fatalf("unexpected replayed body %q", got)
+		}
+	})
+
+	t.Run("replay fails for unmatched requests", func(t *testing.T) {
+		client := &http.Client{Transport: transport.Recorder(cassettePath, transport.RecorderModeReplay)(nil)}
+
+		if _, err := doRequest(t, client, http.MethodDelete, ""); !errors.Is(err, transport.ErrRecorderUnmatched) {
+			t.Fatalf("expected ErrRecorderUnmatched, got %v", err)
+		}
+
+		if _, err := doRequest(t, client, http.MethodGet, ""); err != nil {
+			t.Fatalf("request failed: %v", err)
+		}
+		if _, err := doRequest(t, client, http.MethodGet, ""); !errors.Is(err, transport.ErrRecorderUnmatched) {
+			t.Fatalf("expected used interaction to be unmatched, got %v", err)
+		}
+	})
+
+	t.Run("replay with body matcher", func(t *testing.T) {
+		client := &http.Client{Transport: transport.Recorder(cassettePath, transport.RecorderModeReplay,
+			transport.RecorderWithMatchers(transport.MatchMethod, transport.MatchURL, transport.MatchBody),
+		)(nil)}
+
+		if _, err := doRequest(t, client, http.MethodPost, "other"); !errors.Is(err, transport.ErrRecorderUnmatched) {
+			t.Fatalf("expected ErrRecorderUnmatched, got %v", err)
+		}
+		if _, err := doRequest(t, client, http.MethodPost, "payload"); err != nil {
+			t.Fatalf("request failed: %v", err)
+		}
+	})
+
+	t.Run("replay fails for missing cassette", func(t *testing.T) {
+		client := &http.Client{Transport: transport.Recorder(filepath.Join(t.TempDir(), "missing.json"), transport.RecorderModeReplay)(nil)}
+
+		if _, err := doRequest(t, client, http.MethodGet, ""); !errors.Is(err, os.ErrNotExist) {
+			t.Fatalf("expected missing cassette error, got %v", err)
+		}
+	})
+}
@@ -1,13 +1,23 @@
 package transport
 
 import (
+	"bytes"
 	"fmt"
+	"io"
+	"math/rand"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/eapache/go-resiliency/retrier"
 )
 
+// IdempotencyKeyHeader marks a request as safe to retry even if its method is not idempotent.
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// maxDrainBytes is the amount of bytes read from a discarded response body so that the connection can be reused.
+const maxDrainBytes = 4096
+
 type StatusCode int
 
 func (e StatusCode) Error() string {
@@ -18,6 +28,8 @@ type RetrierTransport struct {
 	allowedStatusCodes map[StatusCode]bool
 	retries            int
 	retrySleep         time.Duration
+	jitter             float64
+	maxRetryAfter      time.Duration
 	rt                 http.RoundTripper
 }
 
@@ -39,29 +51,160 @@ func (rt *RetrierTransport) Classify(err error) retrier.Action {
 }
 
 func (rt *RetrierTransport) RoundTrip(req *http.Request) (*http.Response, error) {
-	retry := retrier.New(retrier.ExponentialBackoff(rt.retries, rt.retrySleep), rt)
-	var response *http.Response
+	if !retriableRequest(req) {
+		return rt.rt.RoundTrip(req)
+	}
+
+	getBody, err := replayableBody(req)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx := req.Context()
+	backoff := retrier.ExponentialBackoff(rt.retries, rt.retrySleep)
+
+	for attempt := 0; ; attempt++ {
+		attemptReq := req
+		// the first attempt can use the original body unless it has been consumed for buffering
+		if getBody != nil && (attempt > 0 || req.GetBody == nil) {
+			body, err := getBody()
+			if err != nil {
+				return nil, fmt.Errorf("rewinding request body: %w", err)
+			}
+			attemptReq = req.Clone(ctx)
+			attemptReq.Body = body
+		}
 
-	err := retry.Run(func() error {
 		// nolint: bodyclose
-		resp, err := rt.rt.RoundTrip(req)
+		resp, err := rt.rt.RoundTrip(attemptReq)
+
+		outcome := err
 		if err == nil {
-			response = resp
-			return StatusCode(resp.StatusCode)
+			outcome = StatusCode(resp.StatusCode)
+		}
+
+		// roundtrip must return a response if the error is nil even if we retried
+		if rt.Classify(outcome) != retrier.Retry || attempt >= len(backoff) {
+			return resp, err
+		}
+
+		wait := rt.backoff(backoff[attempt])
+		if retryAfter := rt.retryAfter(resp); retryAfter > wait {
+			wait = retryAfter
 		}
-		return err
-	})
+		drainBody(resp)
 
-	// roundtrip must return a response if the error is nil even if we retried
-	if _, ok := err.(StatusCode); ok {
-		return response, nil
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// backoff applies the configured jitter to the given backoff duration
+func (rt *RetrierTransport) backoff(d time.Duration) time.Duration {
+	if rt.jitter <= 0 {
+		return d
+	}
+	// nolint: gosec
+	factor := 1 - rt.jitter + rand.Float64()*2*rt.jitter
+	return time.Duration(float64(d) * factor)
+}
+
+// retryAfter parses the Retry-After header of 429 and 503 responses
+// and caps the returned duration at the configured maximum
+func (rt *RetrierTransport) retryAfter(resp *http.Response) time.Duration {
+	if resp == nil || (resp.StatusCode != http.StatusTooManyRequests && resp.StatusCode != http.StatusServiceUnavailable) {
+		return 0
+	}
+
+	header := resp.Header.Get("Retry-After")
+	if header == "" {
+		return 0
+	}
+
+	var wait time.Duration
+	if seconds, err := strconv.Atoi(header); err == nil {
+		wait = time.Duration(seconds) * time.Second
+	} else if date, err := http.ParseTime(header); err == nil {
+		wait = time.Until(date)
+	}
+
+	if wait < 0 {
+		return 0
+	}
+	if wait > rt.maxRetryAfter {
+		return rt.maxRetryAfter
+	}
+	return wait
+}
+
+// retriableRequest reports whether the request may be sent more than once.
+// Only idempotent methods are retried, unless the caller marked the request with an idempotency key.
+func retriableRequest(req *http.Request) bool {
+	switch req.Method {
+	case "", http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return req.Header.Get(IdempotencyKeyHeader) != ""
+}
+
+// replayableBody returns a function creating a fresh copy of the request body for every attempt.
+// It uses GetBody if available and buffers the body otherwise. A nil function is returned for requests without body.
+func replayableBody(req *http.Request) (func() (io.ReadCloser, error), error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil, nil
+	}
+	if req.GetBody != nil {
+		return req.GetBody, nil
+	}
+
+	bodyBytes, err := io.ReadAll(req.Body)
+	if err != nil {
+		return nil, fmt.Errorf("buffering request body: %w", err)
+	}
+	_ = req.Body.Close()
+
+	return func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(bodyBytes)), nil
+	}, nil
+}
+
+// drainBody reads a bit of the discarded response body and closes it, so that the connection can be reused
+func drainBody(resp *http.Response) {
+	if resp == nil || resp.Body == nil {
+		return
+	}
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, maxDrainBytes))
+	_ = resp.Body.Close()
+}
+
+// RetrierOption is to be implemented by functional options
+type RetrierOption func(*RetrierTransport)
+
+// RetrierWithJitter randomizes each backoff by +/- the given fraction (defaults to 0.25)
+func RetrierWithJitter(jitter float64) RetrierOption {
+	return func(rt *RetrierTransport) {
+		rt.jitter = jitter
+	}
+}
+
+// RetrierWithMaxRetryAfter caps the time waited for a Retry-After header (defaults to 30 seconds)
+func RetrierWithMaxRetryAfter(d time.Duration) RetrierOption {
+	return func(rt *RetrierTransport) {
+		rt.maxRetryAfter = d
 	}
-	return response, err
 }
 
 // Retrier will retry requesting a resource depending on some http status code.
-// Generally, status codes from 200 to 399 are always viewed as a success
-func Retrier(retries int, retrySleep time.Duration, retriableStatusCodes []int) TransportFunc {
+// Generally, status codes from 200 to 399 are always viewed as a success.
+// Only idempotent methods or requests carrying an Idempotency-Key header are retried.
+// Request bodies are replayed on every attempt, a Retry-After header of 429 and 503 responses is honored
+// and retrying stops as soon as the request context is done.
+func Retrier(retries int, retrySleep time.Duration, retriableStatusCodes []int, options ...RetrierOption) TransportFunc {
 	return func(rt http.RoundTripper) http.RoundTripper {
 		if rt == nil {
 			rt = http.DefaultTransport
@@ -83,16 +226,24 @@ func Retrier(retries int, retrySleep time.Duration, retriableStatusCodes []int)
 			}
 		} else {
 			statusCodeSet = make(map[StatusCode]bool)
-			for sc := range retriableStatusCodes {
+			for _, sc := range retriableStatusCodes {
 				statusCodeSet[StatusCode(sc)] = true
 			}
 		}
 
-		return &RetrierTransport{
+		retrierTransport := &RetrierTransport{
 			allowedStatusCodes: statusCodeSet,
 			retries:            retries,
 			retrySleep:         retrySleep,
+			jitter:             0.25,
+			maxRetryAfter:      30 * time.Second,
 			rt:                 rt,
 		}
+
+		for _, apply := range options {
+			apply(retrierTransport)
+		}
+
+		return retrierTransport
 	}
 }
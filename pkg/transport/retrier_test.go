@@ -1,9 +1,12 @@
 package transport_test
 
 import (
+	"context"
 	"errors"
+	"io"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
@@ -129,3 +132,146 @@ func TestRetrierTransport_RoundTrip(t *testing.T) {
 		}
 	})
 }
+
+type BodyRecordingRoundTrip struct {
+	statusCodes []int
+	header      http.Header
+	bodies      []string
+}
+
+func (b *BodyRecordingRoundTrip) RoundTrip(req *http.Request) (*http.Response, error) {
+	body := ""
+	if req.Body != nil {
+		bodyBytes, err := io.ReadAll(req.Body)
+		if err != nil {
+			return nil, err
+		}
+		body = string(bodyBytes)
+	}
+	b.bodies = append(b.bodies, body)
+
+	rec := httptest.NewRecorder()
+	for key, values := range b.header {
+		rec.Header()[key] = values
+	}
+	rec.WriteHeader(b.statusCodes[len(b.bodies)-1])
+
+	return rec.Result(), nil
+}
+
+func TestRetrierTransport_Requests(t *testing.T) {
+	t.Run("replays request body", func(t *testing.T) {
+		proxy := &BodyRecordingRoundTrip{statusCodes: []int{http.StatusBadGateway, http.StatusBadGateway, http.StatusOK}}
+		roundtripper := transport.Retrier(3, time.Millisecond, nil)(proxy)
+
+		req, err := http.NewRequest(http.MethodPut, "", strings.NewReader("payload"))
+		if err != nil {
+			t.Fatalf("error creating http request: %v", err)
+		}
+		// force buffering instead of GetBody
+		req.GetBody = nil
+
+		resp, err := roundtripper.RoundTrip(req)
+		if err != nil || resp.StatusCode != http.StatusOK {
+			t.Fatalf("expected successful response, got error: %v", err)
+		}
+		for i, body := range proxy.bodies {
+			if body != "payload" {
+				t.Fatalf("attempt %d sent body %q", i, body)
+			}
+		}
+	})
+
+	t.Run("does not retry non-idempotent methods", func(t *testing.T) {
+		proxy := &BodyRecordingRoundTrip{statusCodes: []int{http.StatusBadGateway, http.StatusOK}}
+		roundtripper := transport.Retrier(3, time.Millisecond, nil)(proxy)
+
+		req, err := http.NewRequest(http.MethodPost, "", strings.NewReader("payload"))
+		if err != nil {
+			t.Fatalf("error creating http request: %v", err)
+		}
+
+		resp, err := roundtripper.RoundTrip(req)
+		if err != nil || resp.StatusCode != http.StatusBadGateway {
+			t.Fatalf("expected unretried bad gateway, got error: %v", err)
+		}
+		if len(proxy.bodies) != 1 {
+			t.Fatalf("expected 1 request, got %d", len(proxy.bodies))
+		}
+	})
+
+	t.Run("retries non-idempotent methods with idempotency key", func(t *testing.T) {
+		proxy := &BodyRecordingRoundTrip{statusCodes: []int{http.StatusBadGateway, http.StatusOK}}
+		roundtripper := transport.Retrier(3, time.Millisecond, nil)(proxy)
+
+		req, err := http.NewRequest(http.MethodPost, "", strings.NewReader("payload"))
+		if err != nil {
+			t.Fatalf("error creating http request: %v", err)
+		}
+		req.Header.Set(transport.IdempotencyKeyHeader, "key-1")
+
+		resp, err := roundtripper.RoundTrip(req)
+		if err != nil || resp.StatusCode != http.StatusOK {
+			t.Fatalf("expected successful response, got error: %v", err)
+		}
+		if len(proxy.bodies) != 2 || proxy.bodies[1] != "payload" {
+			t.Fatalf("expected replayed body on second request, got %v", proxy.bodies)
+		}
+	})
+
+	t.Run("honors capped retry-after", func(t *testing.T) {
+		proxy := &BodyRecordingRoundTrip{
+			statusCodes: []int{http.StatusServiceUnavailable, http.StatusOK},
+			header:      http.Header{"Retry-After": []string{"120"}},
+		}
+		roundtripper := transport.Retrier(3, time.Millisecond, nil,
+			transport.RetrierWithMaxRetryAfter(50*time.Millisecond),
+		)(proxy)
+
+		req, err := http.NewRequest(http.MethodGet, "", nil)
+		if err != nil {
+			t.Fatalf("error creating http request: %v", err)
+		}
+
+		start := time.Now()
+		resp, err := roundtripper.RoundTrip(req)
+		if err != nil || resp.StatusCode != http.StatusOK {
+			t.Fatalf("expected successful response, got error: %v", err)
+		}
+		if elapsed := time.Since(start); elapsed < 50*time.Millisecond || elapsed > time.Second {
+			t.Fatalf("expected to wait for capped retry-after, waited %v", elapsed)
+		}
+	})
+
+	t.Run("aborts when context is done", func(t *testing.T) {
+		proxy := &BodyRecordingRoundTrip{statusCodes: []int{http.StatusBadGateway, http.StatusOK}}
+		roundtripper := transport.Retrier(3, time.Hour, nil)(proxy)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, "", nil)
+		if err != nil {
+			t.Fatalf("error creating http request: %v", err)
+		}
+
+		resp, err := roundtripper.RoundTrip(req)
+		if !errors.Is(err, context.DeadlineExceeded) || resp != nil {
+			t.Fatalf("expected deadline exceeded, got error: %v", err)
+		}
+	})
+
+	t.Run("custom status codes", func(t *testing.T) {
+		proxy := &BodyRecordingRoundTrip{statusCodes: []int{http.StatusConflict, http.StatusOK}}
+		roundtripper := transport.Retrier(3, time.Millisecond, []int{http.StatusConflict})(proxy)
+
+		req, err := http.NewRequest(http.MethodGet, "", nil)
+		if err != nil {
+			t.Fatalf("error creating http request: %v", err)
+		}
+
+		resp, err := roundtripper.RoundTrip(req)
+		if err != nil || resp.StatusCode != http.StatusOK {
+			t.Fatalf("expected successful response, got error: %v", err)
+		}
+	})
+}
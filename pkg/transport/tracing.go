@@ -0,0 +1,51 @@
+package transport
+
+import (
+	"net/http"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+
+	"github.com/d4l-data4life/go-svc/pkg/tracing"
+)
+
+type TracingTransport struct {
+	rt http.RoundTripper
+}
+
+func (t *TracingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx, span := tracing.StartClientSpan(req.Context(), "HTTP "+req.Method,
+		attribute.String("http.request.method", req.Method),
+		attribute.String("server.address", req.URL.Host),
+		attribute.String("url.path", req.URL.Path),
+	)
+	defer span.End()
+
+	// the request must not be modified, so the headers are injected into a clone
+	req = req.Clone(ctx)
+	tracing.Inject(ctx, propagation.HeaderCarrier(req.Header))
+
+	res, err := t.rt.RoundTrip(req)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+
+	span.SetAttributes(attribute.Int("http.response.status_code", res.StatusCode))
+	if res.StatusCode >= http.StatusInternalServerError {
+		span.SetStatus(codes.Error, http.StatusText(res.StatusCode))
+	}
+	return res, nil
+}
+
+// Tracing wraps outgoing requests in client spans and propagates the W3C trace context (traceparent, tracestate)
+// together with the legacy Trace-Id header. It replaces the TraceID transport.
+func Tracing(rt http.RoundTripper) http.RoundTripper {
+	if rt == nil {
+		rt = http.DefaultTransport
+	}
+
+	return &TracingTransport{rt: rt}
+}
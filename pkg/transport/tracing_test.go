@@ -0,0 +1,62 @@
+package transport_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/d4l-data4life/go-svc/pkg/log"
+	"github.com/d4l-data4life/go-svc/pkg/tracing"
+	"github.com/d4l-data4life/go-svc/pkg/transport"
+)
+
+func TestTracingTransport(t *testing.T) {
+	exporter := tracing.NewInMemoryExporter()
+	shutdown, err := tracing.Init("test", tracing.WithSyncExporter(exporter))
+	if err != nil {
+		t.Fatalf("error initializing tracing: %v", err)
+	}
+	defer func() { _ = shutdown(context.Background()) }()
+
+	var header http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header = r.Header
+	}))
+	defer server.Close()
+
+	ctx := context.WithValue(context.Background(), log.TraceIDContextKey, "0af7651916cd43dd8448eb211c80319c")
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, server.URL, nil)
+	if err != nil {
+		t.Fatalf("error creating http request: %v", err)
+	}
+
+	res, err := transport.Tracing(nil).RoundTrip(req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	res.Body.Close()
+
+	if req.Header.Get("traceparent") != "" {
+		t.Fatalf("the original request must not be modified")
+	}
+
+	spans := exporter.GetSpans()
+	if len(spans) != 1 {
+		t.Fatalf("expected 1 span, got %d", len(spans))
+	}
+	span := spans[0]
+	if span.SpanKind != trace.SpanKindClient {
+		t.Fatalf("expected client span, got %v", span.SpanKind)
+	}
+
+	want := "00-0af7651916cd43dd8448eb211c80319c-" + span.SpanContext.SpanID().String() + "-01"
+	if got := header.Get("traceparent"); got != want {
+		t.Fatalf("expected traceparent %s, got %s", want, got)
+	}
+	if got := header.Get(log.TraceIDHeaderKey); got != "0af7651916cd43dd8448eb211c80319c" {
+		t.Fatalf("expected legacy trace id to be kept, got %s", got)
+	}
+}
@@ -0,0 +1,52 @@
+package test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/pkg/errors"
+
+	"github.com/d4l-data4life/go-svc/pkg/middlewares"
+)
+
+func TestMigrateIdempotencyKeys(t *testing.T) {
+	const (
+		table          = "idempotency_keys"
+		migrationTable = "idempotency_keys_migrations"
+	)
+
+	cfg, err := parseEnv()
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "could not parse the env"))
+	}
+
+	db, err := connectToDB(cfg)
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "could not connect to the DB"))
+	}
+
+	ctx := context.Background()
+	defer func() {
+		_ = cleanTable(ctx, db, table)
+		_ = cleanTable(ctx, db, migrationTable)
+	}()
+
+	m := middlewares.NewIdempotencyKeysMigration(db, &testLog{})
+
+	// running the migration twice must be a no-op the second time
+	for i := 0; i < 2; i++ {
+		if err := m.MigrateDB(ctx, middlewares.IdempotencyKeysMigrationVersion, true); err != nil {
+			t.Fatal(errors.Wrap(err, "could not run the migration"))
+		}
+	}
+
+	for _, name := range []string{table, migrationTable} {
+		schema, err := getSchemaForTable(ctx, db, name)
+		if err != nil {
+			t.Fatal(errors.Wrapf(err, "could not find the table %s", name))
+		}
+		if schema != "public" {
+			t.Errorf("expected to find table %s in schema public. Found it in schema %s", name, schema)
+		}
+	}
+}